@@ -2,12 +2,19 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
+	"net/url"
+	"os"
 	"os/signal"
+	"slices"
+	"strconv"
 	"syscall"
 
+	"github.com/Sofja96/go-metrics.git/internal/server/config"
 	"github.com/Sofja96/go-metrics.git/internal/server/handlers"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage/database"
 )
 
 const (
@@ -40,6 +47,14 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	defer cancel()
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+		if err := migrate(ctx); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	PrintBuildInfo()
 	s := handlers.New(ctx)
 
@@ -47,3 +62,76 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// migrate - подкоманда migrate [флаги сервера] up|down|status [версия]. Без версии up
+// применяет все миграции, а down откатывает последнюю. БД задается так же, как для сервера.
+func migrate(ctx context.Context) error {
+	c, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(handlers.StorageURL(c))
+	if err != nil {
+		return fmt.Errorf("invalid storage url: %w", err)
+	}
+	if !slices.Contains(database.Schemes, u.Scheme) {
+		return fmt.Errorf("migrate requires postgres storage, got scheme %q", u.Scheme)
+	}
+
+	pg, err := database.Open(database.DSN(u))
+	if err != nil {
+		return err
+	}
+	defer pg.DB.Close()
+
+	current, err := pg.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	args := flag.Args()
+	if len(args) == 0 || len(args) > 2 {
+		return fmt.Errorf("usage: server migrate up|down|status [version]")
+	}
+	target := -1
+	if len(args) == 2 {
+		if target, err = strconv.Atoi(args[1]); err != nil {
+			return fmt.Errorf("invalid version %q: %w", args[1], err)
+		}
+	}
+
+	switch args[0] {
+	case "status":
+		fmt.Printf("schema version: %d, latest: %d\n", current, database.LatestVersion())
+		for _, m := range database.Migrations() {
+			state := "pending"
+			if m.Version <= current {
+				state = "applied"
+			}
+			fmt.Printf("%04d_%s\t%s\n", m.Version, m.Name, state)
+		}
+		return nil
+	case "up":
+		if target == -1 {
+			target = database.LatestVersion()
+		}
+		if target < current {
+			return fmt.Errorf("schema version %d is already above %d, use down", current, target)
+		}
+	case "down":
+		if target == -1 {
+			target = max(current-1, 0)
+		}
+		if target > current {
+			return fmt.Errorf("schema version %d is already below %d, use up", current, target)
+		}
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down or status", args[0])
+	}
+
+	if err := pg.Migrate(ctx, target); err != nil {
+		return err
+	}
+	fmt.Printf("schema version: %d\n", target)
+	return nil
+}
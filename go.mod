@@ -17,6 +17,7 @@ require (
 	github.com/mdempsky/maligned v0.0.0-20220203220013-d7cd9a96ae47
 	github.com/shirou/gopsutil/v3 v3.23.10
 	github.com/stretchr/testify v1.10.0
+	go.etcd.io/bbolt v1.3.11
 	go.uber.org/zap v1.26.0
 	golang.org/x/tools v0.21.1-0.20240508182429-e35e4ccd0d2d
 	google.golang.org/grpc v1.70.0
@@ -16,10 +16,12 @@ import (
 	"github.com/Sofja96/go-metrics.git/internal/agent/envs"
 	"github.com/Sofja96/go-metrics.git/internal/agent/export"
 	"github.com/Sofja96/go-metrics.git/internal/agent/metrics"
+	"github.com/Sofja96/go-metrics.git/internal/agent/queue"
+	"github.com/Sofja96/go-metrics.git/internal/models"
 )
 
-// getMetrics -  собирает метрики и отправляет их в канал.
-func getMetrics(collector *metrics.Metrics, c chan<- []byte) {
+// getMetrics -  собирает метрики, включая метрики очереди отправки q, если она задана, и отправляет их в канал.
+func getMetrics(collector *metrics.Metrics, q *queue.Queue, c chan<- []byte) {
 	err := collector.GetMetrics()
 	if err != nil {
 		log.Printf("Error collecting runtime metrics: %v", err)
@@ -30,6 +32,10 @@ func getMetrics(collector *metrics.Metrics, c chan<- []byte) {
 		log.Printf("Error collecting PS metrics: %v", err)
 	}
 
+	if q != nil {
+		collector.GetQueueMetrics(q.Stats())
+	}
+
 	compressedMetrics, err := collector.PrepareMetrics()
 	if err != nil {
 		log.Printf("Error preparing metrics: %v", err)
@@ -49,11 +55,37 @@ func Run() error {
 		log.Printf("error load config: %v", err)
 	}
 
+	collector.Labels, err = cfg.MetricLabels()
+	if err != nil {
+		return fmt.Errorf("invalid metric labels: %w", err)
+	}
+
 	publicKey, err := LoadPublicKey(cfg.CryptoKey)
 	if err != nil {
 		return fmt.Errorf("failed to load public key: %w", err)
 	}
 
+	tlsConfig, err := cfg.TLSConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load TLS config: %w", err)
+	}
+
+	postRequest := models.PostRequest{
+		Key:         cfg.HashKey,
+		KeyID:       cfg.KeyID,
+		PublicKey:   publicKey,
+		CryptoKeyID: cfg.CryptoKeyID,
+		TLS:         tlsConfig,
+	}
+
+	sendQueue, err := queue.New(cfg.QueueDir, cfg.QueueMaxBytes)
+	if err != nil {
+		return fmt.Errorf("failed to open send queue: %w", err)
+	}
+	if stats := sendQueue.Stats(); stats.Depth > 0 {
+		log.Printf("В очереди с прошлого запуска %d пакетов метрик (%d байт)", stats.Depth, stats.Bytes)
+	}
+
 	chMetrics := make(chan []byte, cfg.RateLimit)
 
 	pollTicker := time.NewTicker(time.Duration(cfg.PollInterval) * time.Second)
@@ -68,7 +100,7 @@ func Run() error {
 	var grpcClient *export.GRPCClient
 
 	if cfg.UseGRPC {
-		grpcClient, err = export.NewGRPCClient(cfg.GrpcAddress)
+		grpcClient, err = export.NewGRPCClient(cfg.GrpcAddress, tlsConfig)
 		if err != nil {
 			log.Printf("failed to create gRPC client: %v", err)
 			cfg.UseGRPC = false
@@ -96,7 +128,7 @@ func Run() error {
 				log.Println("Сбор метрик завершен.")
 				return
 			case <-pollTicker.C:
-				getMetrics(collector, chMetrics)
+				getMetrics(collector, sendQueue, chMetrics)
 			}
 		}
 	}()
@@ -112,7 +144,7 @@ func Run() error {
 					return
 				case <-reportTicker.C:
 					log.Println("workerID", workerId, "started")
-					export.PostQueries(ctx, cfg, chMetrics, publicKey, grpcClient)
+					export.PostQueries(ctx, cfg, chMetrics, postRequest, grpcClient, sendQueue)
 				}
 			}
 		}(i)
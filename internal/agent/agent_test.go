@@ -9,6 +9,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/Sofja96/go-metrics.git/internal/agent/metrics"
+	"github.com/Sofja96/go-metrics.git/internal/agent/queue"
 	"github.com/Sofja96/go-metrics.git/internal/utils"
 )
 
@@ -61,7 +62,7 @@ func TestGetMetrics(t *testing.T) {
 	collector := metrics.NewMetricsCollector()
 	ch := make(chan []byte, 1)
 
-	getMetrics(collector, ch)
+	getMetrics(collector, nil, ch)
 
 	select {
 	case data := <-ch:
@@ -69,6 +70,18 @@ func TestGetMetrics(t *testing.T) {
 	default:
 		t.Fatal("Ожидались данные в канале")
 	}
+
+	t.Run("QueueMetrics", func(t *testing.T) {
+		q, err := queue.New(t.TempDir(), 0)
+		assert.NoError(t, err)
+		assert.NoError(t, q.Push([]byte("batch")))
+
+		getMetrics(collector, q, ch)
+		<-ch
+		assert.Equal(t, float64(1), collector.ValuesGauge["SendQueueDepth"])
+		assert.Equal(t, float64(len("batch")), collector.ValuesGauge["SendQueueBytes"])
+		assert.Equal(t, float64(0), collector.ValuesGauge["SendQueueDroppedBytes"])
+	})
 }
 
 func TestRun(t *testing.T) {
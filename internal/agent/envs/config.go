@@ -1,13 +1,18 @@
 package envs
 
 import (
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/caarlos0/env/v6"
 
+	"github.com/Sofja96/go-metrics.git/internal/models"
+	"github.com/Sofja96/go-metrics.git/internal/tlsconfig"
 	"github.com/Sofja96/go-metrics.git/internal/utils"
 )
 
@@ -18,10 +23,20 @@ type Config struct {
 	ReportInterval int    `env:"REPORT_INTERVAL"` // интервал отправки метрик
 	PollInterval   int    `env:"POLL_INTERVAL"`   // интервал сбора метрик
 	HashKey        string `env:"KEY"`             // ключ аутентификации
+	KeyID          string `env:"KEY_ID"`          // идентификатор ключа аутентификации на сервере
 	RateLimit      int    `env:"RATE_LIMIT"`      // ограничение на количество исходящих запросов
 	CryptoKey      string `env:"CRYPTO_KEY"`      // файл с публичным ключом сервера
+	CryptoKeyID    string `env:"CRYPTO_KEY_ID"`   // идентификатор ключа шифрования на сервере
 	Config         string `env:"CONFIG"`          // файл настроки конфигурации
 	UseGRPC        bool   `env:"USE_GRPC"`        // флаг включения grpc
+	UseStream      bool   `env:"USE_GRPC_STREAM"` // флаг отправки метрик через поток grpc StreamMetrics
+	Labels         string `env:"LABELS"`          // метки метрик в формате k1=v1,k2=v2
+	QueueDir       string `env:"QUEUE_DIR"`       // каталог очереди неотправленных метрик
+	QueueMaxBytes  int64  `env:"QUEUE_MAX_BYTES"` // максимальный размер очереди в байтах
+	TLS            bool   `env:"TLS"`             // флаг подключения к серверу по TLS
+	TLSCA          string `env:"TLS_CA"`          // файл с сертификатом CA сервера
+	TLSCert        string `env:"TLS_CERT"`        // файл с сертификатом агента для mTLS
+	TLSKey         string `env:"TLS_KEY"`         // файл с ключом сертификата агента
 }
 
 const (
@@ -30,6 +45,8 @@ const (
 	DefaultPollInterval   = 2
 	DefaultRateLimit      = 1
 	DefaultUseGRPC        = false
+	DefaultQueueDir       = "/tmp/metrics-agent-queue"
+	DefaultQueueMaxBytes  = 64 << 20
 )
 
 // TempConfig Временная структура для десериализации
@@ -39,7 +56,17 @@ type TempConfig struct {
 	PollInterval   string `json:"poll_interval"`
 	ReportInterval string `json:"report_interval"`
 	CryptoKey      string `json:"crypto_key"`
+	CryptoKeyID    string `json:"crypto_key_id"`
+	KeyID          string `json:"key_id"`
 	UseGRPC        bool   `json:"use_grpc"`
+	UseStream      bool   `json:"use_grpc_stream"`
+	Labels         string `json:"labels"`
+	QueueDir       string `json:"queue_dir"`
+	QueueMaxBytes  int64  `json:"queue_max_bytes"`
+	TLS            bool   `json:"tls"`
+	TLSCA          string `json:"tls_ca"`
+	TLSCert        string `json:"tls_cert"`
+	TLSKey         string `json:"tls_key"`
 }
 
 func LoadConfig() (*Config, error) {
@@ -69,6 +96,12 @@ func LoadConfig() (*Config, error) {
 	if cfg.RateLimit <= 0 {
 		cfg.RateLimit = DefaultRateLimit
 	}
+	if cfg.QueueDir == "" {
+		cfg.QueueDir = DefaultQueueDir
+	}
+	if cfg.QueueMaxBytes <= 0 {
+		cfg.QueueMaxBytes = DefaultQueueMaxBytes
+	}
 
 	return cfg, nil
 }
@@ -99,10 +132,42 @@ func (cfg *Config) applyFileValues(tempConfig *TempConfig) error {
 	if cfg.CryptoKey == "" && tempConfig.CryptoKey != "" {
 		cfg.CryptoKey = tempConfig.CryptoKey
 	}
+	if cfg.CryptoKeyID == "" && tempConfig.CryptoKeyID != "" {
+		cfg.CryptoKeyID = tempConfig.CryptoKeyID
+	}
+	if cfg.KeyID == "" && tempConfig.KeyID != "" {
+		cfg.KeyID = tempConfig.KeyID
+	}
+
+	if cfg.Labels == "" && tempConfig.Labels != "" {
+		cfg.Labels = tempConfig.Labels
+	}
+	if cfg.QueueDir == "" && tempConfig.QueueDir != "" {
+		cfg.QueueDir = tempConfig.QueueDir
+	}
+	if cfg.QueueMaxBytes == 0 && tempConfig.QueueMaxBytes != 0 {
+		cfg.QueueMaxBytes = tempConfig.QueueMaxBytes
+	}
+
+	if !cfg.TLS && tempConfig.TLS {
+		cfg.TLS = tempConfig.TLS
+	}
+	if cfg.TLSCA == "" && tempConfig.TLSCA != "" {
+		cfg.TLSCA = tempConfig.TLSCA
+	}
+	if cfg.TLSCert == "" && tempConfig.TLSCert != "" {
+		cfg.TLSCert = tempConfig.TLSCert
+	}
+	if cfg.TLSKey == "" && tempConfig.TLSKey != "" {
+		cfg.TLSKey = tempConfig.TLSKey
+	}
 
 	if tempConfig.UseGRPC != cfg.UseGRPC {
 		cfg.UseGRPC = tempConfig.UseGRPC
 	}
+	if !cfg.UseStream && tempConfig.UseStream {
+		cfg.UseStream = tempConfig.UseStream
+	}
 
 	return nil
 }
@@ -141,10 +206,61 @@ func (cfg *Config) ParseFlags() {
 	flag.IntVar(&cfg.ReportInterval, "r", cfg.ReportInterval, "frequency of sending metrics to the server")
 	flag.IntVar(&cfg.PollInterval, "p", cfg.PollInterval, "frequency of polling metrics")
 	flag.StringVar(&cfg.HashKey, "k", cfg.HashKey, "key for hash")
+	flag.StringVar(&cfg.KeyID, "key-id", cfg.KeyID, "id of the key for hash on the server")
 	flag.IntVar(&cfg.RateLimit, "l", cfg.RateLimit, "Rate Limit")
 	flag.StringVar(&cfg.CryptoKey, "crypto-key", cfg.CryptoKey, "path for public key file")
+	flag.StringVar(&cfg.CryptoKeyID, "crypto-key-id", cfg.CryptoKeyID, "id of the public key on the server")
 	flag.StringVar(&cfg.Config, "c", cfg.Config, "Path to JSON config file")
 	flag.BoolVar(&cfg.UseGRPC, "u", cfg.UseGRPC, "need to start grpc")
+	flag.BoolVar(&cfg.UseStream, "grpc-stream", cfg.UseStream, "send metrics over a single grpc stream")
+	flag.StringVar(&cfg.Labels, "labels", cfg.Labels, "labels attached to all metrics, k1=v1,k2=v2")
+	flag.StringVar(&cfg.QueueDir, "queue-dir", cfg.QueueDir, "directory of the queue of unsent metrics")
+	flag.Int64Var(&cfg.QueueMaxBytes, "queue-max-bytes", cfg.QueueMaxBytes, "max size of the queue of unsent metrics in bytes")
+	flag.BoolVar(&cfg.TLS, "tls", cfg.TLS, "connect to the server over TLS")
+	flag.StringVar(&cfg.TLSCA, "tls-ca", cfg.TLSCA, "path for server CA file")
+	flag.StringVar(&cfg.TLSCert, "tls-cert", cfg.TLSCert, "path for agent certificate file for mTLS")
+	flag.StringVar(&cfg.TLSKey, "tls-key", cfg.TLSKey, "path for agent certificate key file")
 
 	flag.Parse()
 }
+
+// TLSConfig - возвращает настройки TLS для подключения к серверу или nil, если TLS не используется.
+// TLS включается флагом TLS или заданием любого из файлов TLSCA, TLSCert.
+func (cfg *Config) TLSConfig() (*tls.Config, error) {
+	if !cfg.TLS && cfg.TLSCA == "" && cfg.TLSCert == "" {
+		return nil, nil
+	}
+	return tlsconfig.Client(cfg.TLSCA, cfg.TLSCert, cfg.TLSKey)
+}
+
+// MetricLabels - возвращает метки, которые агент добавляет ко всем метрикам. По умолчанию
+// это host=<имя хоста>; метки из настройки Labels дополняют и переопределяют его,
+// а пустое значение (host=) удаляет метку.
+func (cfg *Config) MetricLabels() (map[string]string, error) {
+	labels := make(map[string]string)
+	if hostname, err := os.Hostname(); err == nil {
+		labels["host"] = hostname
+	}
+
+	for _, pair := range strings.Split(cfg.Labels, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid label %q, expected key=value", pair)
+		}
+		key = strings.TrimSpace(key)
+		if value == "" {
+			delete(labels, key)
+			continue
+		}
+		labels[key] = value
+	}
+
+	if err := models.ValidateLabels(labels); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
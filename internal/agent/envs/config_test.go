@@ -128,3 +128,59 @@ func TestLoadConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestMetricLabels(t *testing.T) {
+	hostname, err := os.Hostname()
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		labels    string
+		expected  map[string]string
+		expectErr bool
+	}{
+		{
+			name:     "DefaultHost",
+			expected: map[string]string{"host": hostname},
+		},
+		{
+			name:     "ExtraLabels",
+			labels:   "dc=eu, env=prod",
+			expected: map[string]string{"host": hostname, "dc": "eu", "env": "prod"},
+		},
+		{
+			name:     "OverrideHost",
+			labels:   "host=agent-1",
+			expected: map[string]string{"host": "agent-1"},
+		},
+		{
+			name:     "RemoveHost",
+			labels:   "host=",
+			expected: map[string]string{},
+		},
+		{
+			name:      "WithoutValue",
+			labels:    "dc",
+			expectErr: true,
+		},
+		{
+			name:      "InvalidName",
+			labels:    "data-center=eu",
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Labels: tt.labels}
+
+			labels, err := cfg.MetricLabels()
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, labels)
+		})
+	}
+}
@@ -2,28 +2,44 @@ package export
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
 	"log"
+	"sync"
 
 	"github.com/Sofja96/go-metrics.git/internal/agent/gzip"
 	"github.com/Sofja96/go-metrics.git/internal/agent/hash"
+	"github.com/Sofja96/go-metrics.git/internal/envelope"
+	"github.com/Sofja96/go-metrics.git/internal/keyring"
 	"github.com/Sofja96/go-metrics.git/internal/models"
 	"github.com/Sofja96/go-metrics.git/internal/proto"
+	"github.com/Sofja96/go-metrics.git/internal/replay"
 	"github.com/Sofja96/go-metrics.git/internal/utils"
 )
 
 type GRPCClient struct {
 	Client proto.MetricsClient
 	conn   *grpc.ClientConn
+
+	// открытый поток StreamMetrics; mu защищает поток и номер пакета
+	mu       sync.Mutex
+	stream   proto.Metrics_StreamMetricsClient
+	cancel   context.CancelFunc
+	sequence uint64
 }
 
-// NewGRPCClient creates a new gRPC client.
-func NewGRPCClient(addr string) (*GRPCClient, error) {
+// NewGRPCClient creates a new gRPC client. If tlsConfig is nil, the connection is insecure.
+func NewGRPCClient(addr string, tlsConfig *tls.Config) (*GRPCClient, error) {
+	creds := insecure.NewCredentials()
+	if tlsConfig != nil {
+		creds = credentials.NewTLS(tlsConfig)
+	}
 	conn, err := grpc.NewClient(addr,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithTransportCredentials(creds),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to gRPC server: %w", err)
@@ -36,15 +52,29 @@ func NewGRPCClient(addr string) (*GRPCClient, error) {
 	}, nil
 }
 
-// Close closes the gRPC connection.
+// Close closes the metrics stream and the gRPC connection.
 func (c *GRPCClient) Close() error {
+	c.mu.Lock()
+	c.resetStream()
+	c.mu.Unlock()
 	return c.conn.Close()
 }
 
-func addMetadata(ctx context.Context, data []byte, key string) (context.Context, error) {
+// newMetadata - возвращает метаданные, общие для всех запросов агента: сжатие,
+// режим шифрования, идентификаторы ключей и адрес агента.
+func newMetadata(post models.PostRequest) (metadata.MD, error) {
 	md := metadata.New(map[string]string{
 		"content-encoding": "gzip",
 	})
+	if post.PublicKey != nil {
+		md.Set(envelope.MetadataKey, envelope.MetadataValue)
+		if post.CryptoKeyID != "" {
+			md.Set(keyring.CryptoKeyIDHeader, post.CryptoKeyID)
+		}
+	}
+	if len(post.Key) != 0 && post.KeyID != "" {
+		md.Set(keyring.KeyIDHeader, post.KeyID)
+	}
 
 	realIP, err := utils.GetLocalIP()
 	if err != nil {
@@ -52,37 +82,71 @@ func addMetadata(ctx context.Context, data []byte, key string) (context.Context,
 	}
 	md.Set("X-Real-IP", realIP)
 
-	if len(key) != 0 {
-		hmac, err := hash.ComputeHmac256([]byte(key), data)
+	return md, nil
+}
+
+// sign - возвращает время отправки, nonce и HMAC-подпись данных; без ключа подпись пустая.
+func sign(data []byte, post models.PostRequest) (timestamp, nonce, hmac string, err error) {
+	timestamp, nonce, err = replay.NewNonce()
+	if err != nil {
+		return "", "", "", err
+	}
+
+	if len(post.Key) != 0 {
+		hmac, err = hash.ComputeHmac256([]byte(post.Key), replay.Material(timestamp, nonce, data))
 		if err != nil {
-			return nil, fmt.Errorf("error computing HMAC: %w", err)
+			return "", "", "", fmt.Errorf("error computing HMAC: %w", err)
 		}
+	}
+
+	return timestamp, nonce, hmac, nil
+}
+
+func addMetadata(ctx context.Context, data []byte, post models.PostRequest) (context.Context, error) {
+	md, err := newMetadata(post)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp, nonce, hmac, err := sign(data, post)
+	if err != nil {
+		return nil, err
+	}
+	md.Set(replay.TimestampHeader, timestamp)
+	md.Set(replay.NonceHeader, nonce)
+	if hmac != "" {
 		md.Set("HashSHA256", hmac)
 	}
 
 	return metadata.NewOutgoingContext(ctx, md), nil
 }
 
-// UpdateMetrics sends metrics to the gRPC server.
-func (c *GRPCClient) UpdateMetrics(ctx context.Context, metrics []*proto.Metric, post models.PostRequest) (*proto.UpdateMetricsResponse, error) {
-	var dataToSend []byte
-
+// prepareData - сжимает метрики и шифрует их публичным ключом, если он задан.
+func prepareData(metrics []*proto.Metric, post models.PostRequest) ([]byte, error) {
 	compressedMetrics, err := gzip.Compress(metrics)
 	if err != nil {
 		return nil, fmt.Errorf("compression error %v", err)
+	}
 
+	if post.PublicKey == nil {
+		return compressedMetrics, nil
 	}
 
-	dataToSend = compressedMetrics
-	if post.PublicKey != nil {
-		encryptedData, err := EncryptWithPublicKey(compressedMetrics, post.PublicKey)
-		if err != nil {
-			return nil, fmt.Errorf("error encrypting data: %w", err)
-		}
-		dataToSend = encryptedData
+	encryptedData, err := EncryptWithPublicKey(compressedMetrics, post.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("error encrypting data: %w", err)
+	}
+	return encryptedData, nil
+}
+
+// UpdateMetrics sends metrics to the gRPC server.
+func (c *GRPCClient) UpdateMetrics(ctx context.Context, metrics []*proto.Metric, post models.PostRequest) (*proto.UpdateMetricsResponse, error) {
+	dataToSend, err := prepareData(metrics, post)
+	if err != nil {
+		return nil, err
 	}
 
-	ctx, err = addMetadata(ctx, dataToSend, post.Key)
+	ctx, err = addMetadata(ctx, dataToSend, post)
 	if err != nil {
 		return nil, fmt.Errorf("error adding metadata: %w", err)
 	}
@@ -102,3 +166,92 @@ func (c *GRPCClient) UpdateMetrics(ctx context.Context, metrics []*proto.Metric,
 
 	return res, nil
 }
+
+// StreamMetrics sends metrics as a batch of the StreamMetrics stream and waits for its ack.
+// The stream is opened on the first call with the metadata of post and reopened after an error.
+func (c *GRPCClient) StreamMetrics(ctx context.Context, metrics []*proto.Metric, post models.PostRequest) (*proto.MetricsAck, error) {
+	dataToSend, err := prepareData(metrics, post)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp, nonce, hmac, err := sign(dataToSend, post)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stream == nil {
+		if err := c.openStream(post); err != nil {
+			return nil, err
+		}
+	}
+
+	// отмена ctx прерывает ожидание подтверждения вместе с потоком
+	stop := context.AfterFunc(ctx, c.cancel)
+	defer stop()
+
+	c.sequence++
+	batch := &proto.MetricsBatch{
+		Sequence:       c.sequence,
+		CompressedData: dataToSend,
+		Hash:           hmac,
+		Timestamp:      timestamp,
+		Nonce:          nonce,
+	}
+
+	if err := c.stream.Send(batch); err != nil {
+		c.resetStream()
+		return nil, fmt.Errorf("error sending metrics via gRPC stream: %w", err)
+	}
+
+	ack, err := c.stream.Recv()
+	if err != nil {
+		c.resetStream()
+		return nil, fmt.Errorf("error receiving ack via gRPC stream: %w", err)
+	}
+
+	if ack.GetSequence() != batch.Sequence {
+		c.resetStream()
+		return nil, fmt.Errorf("unexpected ack sequence %d, want %d", ack.GetSequence(), batch.Sequence)
+	}
+
+	if !ack.GetSuccess() {
+		return ack, fmt.Errorf("server rejected batch %d: %s", ack.GetSequence(), ack.GetError())
+	}
+
+	return ack, nil
+}
+
+// openStream - открывает поток StreamMetrics с метаданными post.
+func (c *GRPCClient) openStream(post models.PostRequest) error {
+	md, err := newMetadata(post)
+	if err != nil {
+		return fmt.Errorf("error adding metadata: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(metadata.NewOutgoingContext(context.Background(), md))
+	stream, err := c.Client.StreamMetrics(ctx)
+	if err != nil {
+		cancel()
+		return fmt.Errorf("error opening gRPC stream: %w", err)
+	}
+
+	c.stream = stream
+	c.cancel = cancel
+	c.sequence = 0
+	return nil
+}
+
+// resetStream - закрывает поток; следующий пакет откроет новый.
+func (c *GRPCClient) resetStream() {
+	if c.stream == nil {
+		return
+	}
+	_ = c.stream.CloseSend()
+	c.cancel()
+	c.stream = nil
+	c.cancel = nil
+}
@@ -2,16 +2,23 @@ package export
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
+	"net"
 	"testing"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
 
 	mockproto "github.com/Sofja96/go-metrics.git/internal/agent/export/mocks"
+	"github.com/Sofja96/go-metrics.git/internal/envelope"
+	"github.com/Sofja96/go-metrics.git/internal/keyring"
 	"github.com/Sofja96/go-metrics.git/internal/models"
 	"github.com/Sofja96/go-metrics.git/internal/proto"
 	"github.com/Sofja96/go-metrics.git/internal/utils"
@@ -41,7 +48,14 @@ func TestNewGRPCClient(t *testing.T) {
 	t.Run("NewGRPCClient_SUCCESS", func(t *testing.T) {
 		addr := "localhost:50051"
 
-		client, err := NewGRPCClient(addr)
+		client, err := NewGRPCClient(addr, nil)
+		assert.NoError(t, err)
+		assert.NotNil(t, client)
+
+		assert.NoError(t, client.Close())
+	})
+	t.Run("NewGRPCClient_TLS", func(t *testing.T) {
+		client, err := NewGRPCClient("localhost:50051", &tls.Config{MinVersion: tls.VersionTLS12})
 		assert.NoError(t, err)
 		assert.NotNil(t, client)
 
@@ -120,18 +134,102 @@ func TestAddMetadata(t *testing.T) {
 	key := "test_key"
 
 	t.Run("Test without key", func(t *testing.T) {
-		ctx, err := addMetadata(ctx, data, "")
+		ctx, err := addMetadata(ctx, data, models.PostRequest{})
 		assert.NoError(t, err)
 		md, ok := metadata.FromOutgoingContext(ctx)
 		assert.True(t, ok)
 		assert.Equal(t, []string{"gzip"}, md.Get("content-encoding"))
 	})
 	t.Run("Test with key", func(t *testing.T) {
-		ctx, err := addMetadata(ctx, data, key)
+		ctx, err := addMetadata(ctx, data, models.PostRequest{Key: key, KeyID: "2025-01"})
 		assert.NoError(t, err)
 		md, ok := metadata.FromOutgoingContext(ctx)
 		assert.True(t, ok)
 		assert.Equal(t, []string{"gzip"}, md.Get("content-encoding"))
 		assert.NotEmpty(t, md.Get("HashSHA256"))
+		assert.Equal(t, []string{"2025-01"}, md.Get(keyring.KeyIDHeader))
+		assert.Empty(t, md.Get(envelope.MetadataKey))
 	})
+	t.Run("Test encrypted", func(t *testing.T) {
+		_, publicKey := utils.GenerateRsaKeyPair()
+		ctx, err := addMetadata(ctx, data, models.PostRequest{PublicKey: publicKey, CryptoKeyID: "2025-01"})
+		assert.NoError(t, err)
+		md, ok := metadata.FromOutgoingContext(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, []string{envelope.MetadataValue}, md.Get(envelope.MetadataKey))
+		assert.Equal(t, []string{"2025-01"}, md.Get(keyring.CryptoKeyIDHeader))
+	})
+}
+
+// streamServer - сервер StreamMetrics для тестов: подтверждает пакеты и
+// закрывает поток с ошибкой после failAfter пакетов, если он задан.
+type streamServer struct {
+	proto.UnimplementedMetricsServer
+	failAfter int
+	streams   []metadata.MD
+	batches   []*proto.MetricsBatch
+}
+
+func (s *streamServer) StreamMetrics(stream proto.Metrics_StreamMetricsServer) error {
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	s.streams = append(s.streams, md)
+
+	for received := 0; ; received++ {
+		batch, err := stream.Recv()
+		if err != nil {
+			return nil
+		}
+		if s.failAfter > 0 && received == s.failAfter {
+			s.failAfter = 0
+			return status.Error(codes.Unavailable, "restarting")
+		}
+		s.batches = append(s.batches, batch)
+		if err := stream.Send(&proto.MetricsAck{Sequence: batch.GetSequence(), Success: true}); err != nil {
+			return err
+		}
+	}
+}
+
+func TestGRPCClient_StreamMetrics(t *testing.T) {
+	server := &streamServer{failAfter: 2}
+
+	lis := bufconn.Listen(1 << 20)
+	grpcServer := grpc.NewServer()
+	proto.RegisterMetricsServer(grpcServer, server)
+	go func() { _ = grpcServer.Serve(lis) }()
+	defer grpcServer.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	assert.NoError(t, err)
+	client := &GRPCClient{Client: proto.NewMetricsClient(conn), conn: conn}
+	defer client.Close()
+
+	metrics := []*proto.Metric{{Id: "test_metric", Type: "counter", Delta: 1}}
+	post := models.PostRequest{Key: "test_key", KeyID: "2025-01"}
+
+	for i := uint64(1); i <= 2; i++ {
+		ack, err := client.StreamMetrics(context.Background(), metrics, post)
+		assert.NoError(t, err)
+		assert.Equal(t, i, ack.GetSequence())
+	}
+	assert.Len(t, server.streams, 1, "batches should share one stream")
+	assert.Equal(t, []string{"gzip"}, server.streams[0].Get("content-encoding"))
+	assert.Equal(t, []string{"2025-01"}, server.streams[0].Get(keyring.KeyIDHeader))
+	assert.Empty(t, server.streams[0].Get("HashSHA256"), "signature is sent in every batch")
+	assert.NotEmpty(t, server.batches[0].GetHash())
+	assert.NotEqual(t, server.batches[0].GetNonce(), server.batches[1].GetNonce())
+
+	// сервер закрыл поток: пакет не подтвержден, следующий открывает новый поток
+	_, err = client.StreamMetrics(context.Background(), metrics, post)
+	assert.Error(t, err)
+
+	ack, err := client.StreamMetrics(context.Background(), metrics, post)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), ack.GetSequence())
+	assert.Len(t, server.streams, 2)
 }
@@ -38,6 +38,46 @@ func (m *MockMetricsClient) EXPECT() *MockMetricsClientMockRecorder {
 	return m.recorder
 }
 
+// DeleteMetric mocks base method.
+func (m *MockMetricsClient) DeleteMetric(ctx context.Context, in *proto.DeleteMetricRequest, opts ...grpc.CallOption) (*proto.DeleteMetricResponse, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, in}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "DeleteMetric", varargs...)
+	ret0, _ := ret[0].(*proto.DeleteMetricResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteMetric indicates an expected call of DeleteMetric.
+func (mr *MockMetricsClientMockRecorder) DeleteMetric(ctx, in interface{}, opts ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, in}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMetric", reflect.TypeOf((*MockMetricsClient)(nil).DeleteMetric), varargs...)
+}
+
+// GetAlerts mocks base method.
+func (m *MockMetricsClient) GetAlerts(ctx context.Context, in *proto.GetAlertsRequest, opts ...grpc.CallOption) (*proto.GetAlertsResponse, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, in}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "GetAlerts", varargs...)
+	ret0, _ := ret[0].(*proto.GetAlertsResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAlerts indicates an expected call of GetAlerts.
+func (mr *MockMetricsClientMockRecorder) GetAlerts(ctx, in interface{}, opts ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, in}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAlerts", reflect.TypeOf((*MockMetricsClient)(nil).GetAlerts), varargs...)
+}
+
 // GetAllMetrics mocks base method.
 func (m *MockMetricsClient) GetAllMetrics(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*proto.GetAllMetricsResponse, error) {
 	m.ctrl.T.Helper()
@@ -78,6 +118,46 @@ func (mr *MockMetricsClientMockRecorder) GetMetric(ctx, in interface{}, opts ...
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMetric", reflect.TypeOf((*MockMetricsClient)(nil).GetMetric), varargs...)
 }
 
+// Query mocks base method.
+func (m *MockMetricsClient) Query(ctx context.Context, in *proto.QueryRequest, opts ...grpc.CallOption) (*proto.QueryResponse, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, in}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Query", varargs...)
+	ret0, _ := ret[0].(*proto.QueryResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Query indicates an expected call of Query.
+func (mr *MockMetricsClientMockRecorder) Query(ctx, in interface{}, opts ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, in}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Query", reflect.TypeOf((*MockMetricsClient)(nil).Query), varargs...)
+}
+
+// StreamMetrics mocks base method.
+func (m *MockMetricsClient) StreamMetrics(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[proto.MetricsBatch, proto.MetricsAck], error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "StreamMetrics", varargs...)
+	ret0, _ := ret[0].(grpc.BidiStreamingClient[proto.MetricsBatch, proto.MetricsAck])
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// StreamMetrics indicates an expected call of StreamMetrics.
+func (mr *MockMetricsClientMockRecorder) StreamMetrics(ctx interface{}, opts ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamMetrics", reflect.TypeOf((*MockMetricsClient)(nil).StreamMetrics), varargs...)
+}
+
 // UpdateMetric mocks base method.
 func (m *MockMetricsClient) UpdateMetric(ctx context.Context, in *proto.UpdateMetricRequest, opts ...grpc.CallOption) (*proto.UpdateMetricResponse, error) {
 	m.ctrl.T.Helper()
@@ -118,6 +198,26 @@ func (mr *MockMetricsClientMockRecorder) UpdateMetrics(ctx, in interface{}, opts
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateMetrics", reflect.TypeOf((*MockMetricsClient)(nil).UpdateMetrics), varargs...)
 }
 
+// Watch mocks base method.
+func (m *MockMetricsClient) Watch(ctx context.Context, in *proto.WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[proto.WatchEvent], error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, in}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Watch", varargs...)
+	ret0, _ := ret[0].(grpc.ServerStreamingClient[proto.WatchEvent])
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Watch indicates an expected call of Watch.
+func (mr *MockMetricsClientMockRecorder) Watch(ctx, in interface{}, opts ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, in}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Watch", reflect.TypeOf((*MockMetricsClient)(nil).Watch), varargs...)
+}
+
 // MockMetricsServer is a mock of MetricsServer interface.
 type MockMetricsServer struct {
 	ctrl     *gomock.Controller
@@ -141,6 +241,36 @@ func (m *MockMetricsServer) EXPECT() *MockMetricsServerMockRecorder {
 	return m.recorder
 }
 
+// DeleteMetric mocks base method.
+func (m *MockMetricsServer) DeleteMetric(arg0 context.Context, arg1 *proto.DeleteMetricRequest) (*proto.DeleteMetricResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteMetric", arg0, arg1)
+	ret0, _ := ret[0].(*proto.DeleteMetricResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteMetric indicates an expected call of DeleteMetric.
+func (mr *MockMetricsServerMockRecorder) DeleteMetric(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMetric", reflect.TypeOf((*MockMetricsServer)(nil).DeleteMetric), arg0, arg1)
+}
+
+// GetAlerts mocks base method.
+func (m *MockMetricsServer) GetAlerts(arg0 context.Context, arg1 *proto.GetAlertsRequest) (*proto.GetAlertsResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAlerts", arg0, arg1)
+	ret0, _ := ret[0].(*proto.GetAlertsResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAlerts indicates an expected call of GetAlerts.
+func (mr *MockMetricsServerMockRecorder) GetAlerts(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAlerts", reflect.TypeOf((*MockMetricsServer)(nil).GetAlerts), arg0, arg1)
+}
+
 // GetAllMetrics mocks base method.
 func (m *MockMetricsServer) GetAllMetrics(arg0 context.Context, arg1 *emptypb.Empty) (*proto.GetAllMetricsResponse, error) {
 	m.ctrl.T.Helper()
@@ -171,6 +301,35 @@ func (mr *MockMetricsServerMockRecorder) GetMetric(arg0, arg1 interface{}) *gomo
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMetric", reflect.TypeOf((*MockMetricsServer)(nil).GetMetric), arg0, arg1)
 }
 
+// Query mocks base method.
+func (m *MockMetricsServer) Query(arg0 context.Context, arg1 *proto.QueryRequest) (*proto.QueryResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Query", arg0, arg1)
+	ret0, _ := ret[0].(*proto.QueryResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Query indicates an expected call of Query.
+func (mr *MockMetricsServerMockRecorder) Query(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Query", reflect.TypeOf((*MockMetricsServer)(nil).Query), arg0, arg1)
+}
+
+// StreamMetrics mocks base method.
+func (m *MockMetricsServer) StreamMetrics(arg0 grpc.BidiStreamingServer[proto.MetricsBatch, proto.MetricsAck]) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StreamMetrics", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StreamMetrics indicates an expected call of StreamMetrics.
+func (mr *MockMetricsServerMockRecorder) StreamMetrics(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamMetrics", reflect.TypeOf((*MockMetricsServer)(nil).StreamMetrics), arg0)
+}
+
 // UpdateMetric mocks base method.
 func (m *MockMetricsServer) UpdateMetric(arg0 context.Context, arg1 *proto.UpdateMetricRequest) (*proto.UpdateMetricResponse, error) {
 	m.ctrl.T.Helper()
@@ -201,6 +360,20 @@ func (mr *MockMetricsServerMockRecorder) UpdateMetrics(arg0, arg1 interface{}) *
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateMetrics", reflect.TypeOf((*MockMetricsServer)(nil).UpdateMetrics), arg0, arg1)
 }
 
+// Watch mocks base method.
+func (m *MockMetricsServer) Watch(arg0 *proto.WatchRequest, arg1 grpc.ServerStreamingServer[proto.WatchEvent]) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Watch", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Watch indicates an expected call of Watch.
+func (mr *MockMetricsServerMockRecorder) Watch(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Watch", reflect.TypeOf((*MockMetricsServer)(nil).Watch), arg0, arg1)
+}
+
 // mustEmbedUnimplementedMetricsServer mocks base method.
 func (m *MockMetricsServer) mustEmbedUnimplementedMetricsServer() {
 	m.ctrl.T.Helper()
@@ -2,20 +2,25 @@ package export
 
 import (
 	"context"
-	"crypto/rand"
 	"crypto/rsa"
-	"crypto/sha256"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"time"
 
 	"github.com/hashicorp/go-retryablehttp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/Sofja96/go-metrics.git/internal/agent/envs"
 	"github.com/Sofja96/go-metrics.git/internal/agent/hash"
 	model "github.com/Sofja96/go-metrics.git/internal/agent/metrics"
+	"github.com/Sofja96/go-metrics.git/internal/agent/queue"
+	"github.com/Sofja96/go-metrics.git/internal/envelope"
+	"github.com/Sofja96/go-metrics.git/internal/keyring"
 	"github.com/Sofja96/go-metrics.git/internal/models"
+	"github.com/Sofja96/go-metrics.git/internal/replay"
 	"github.com/Sofja96/go-metrics.git/internal/utils"
 )
 
@@ -26,13 +31,17 @@ const (
 	retryWaitMax time.Duration = time.Second * 5 // максимальное время ожидания
 )
 
-// PostQueries - функция для формирования метрик перед отправкой и запуска отправки метрик.
-func PostQueries(ctx context.Context, cfg *envs.Config, chIn <-chan []byte, publicKey *rsa.PublicKey, grpcClient *GRPCClient) {
-	postRequest := models.PostRequest{
-		Key:       cfg.HashKey,
-		PublicKey: publicKey,
-	}
+// errMalformedBatch - пакет метрик поврежден, повторная отправка бессмысленна.
+var errMalformedBatch = errors.New("malformed metrics batch")
 
+// errRejectedBatch - сервер отклонил пакет метрик ответом 4xx или постоянной ошибкой gRPC,
+// повторная отправка бессмысленна.
+var errRejectedBatch = errors.New("metrics batch rejected by server")
+
+// PostQueries - функция для формирования метрик перед отправкой и запуска отправки метрик.
+// Если передана очередь q, пакеты сначала сохраняются в нее и отправляются начиная с самого
+// старого; не отправленные из-за недоступности сервера пакеты остаются в очереди.
+func PostQueries(ctx context.Context, cfg *envs.Config, chIn <-chan []byte, postRequest models.PostRequest, grpcClient *GRPCClient, q *queue.Queue) {
 	for {
 		select {
 		case <-ctx.Done():
@@ -42,42 +51,117 @@ func PostQueries(ctx context.Context, cfg *envs.Config, chIn <-chan []byte, publ
 				log.Println("Канал данных закрыт. Завершаем Worker")
 				return
 			}
-			if !cfg.UseGRPC {
-				retryClient := retryablehttp.NewClient()
-				retryClient.RetryMax = retryMax
-				retryClient.RetryWaitMin = retryWaitMin
-				retryClient.RetryWaitMax = retryWaitMax
-				retryClient.Backoff = linearBackoff
-				url := fmt.Sprintf("http://%s/updates/", cfg.Address)
-
-				err := PostBatch(retryClient, url, compressedData, postRequest)
-				if err != nil {
-					log.Printf("Ошибка отправки метрик: %v", err)
-				}
-			} else {
-				if grpcClient == nil {
-					log.Println("gRPC клиент не инициализирован")
-					continue
-				}
-				protoMetrics, err := model.ConvertToProtoMetrics(compressedData)
-				if err != nil {
-					log.Printf("ошибка преобразования метрик: %v", err)
-					continue
-				}
-
-				_, err = grpcClient.UpdateMetrics(ctx, protoMetrics, postRequest)
-				if err != nil {
-					log.Printf("Ошибка отправки метрик через gRPC: %v", err)
-					continue
-				}
-				log.Printf("Sending gRPC request with %d metrics", len(protoMetrics))
+			if q == nil {
+				_ = sendMetrics(ctx, cfg, compressedData, postRequest, grpcClient)
+				continue
 			}
+			if err := q.Push(compressedData); err != nil {
+				log.Printf("Ошибка сохранения метрик в очередь: %v", err)
+				_ = sendMetrics(ctx, cfg, compressedData, postRequest, grpcClient)
+			}
+			drainQueue(ctx, cfg, q, postRequest, grpcClient)
+		}
+	}
+}
+
+// drainQueue - отправляет пакеты из очереди, пока она не опустеет или сервер не перестанет отвечать.
+func drainQueue(ctx context.Context, cfg *envs.Config, q *queue.Queue, postRequest models.PostRequest, grpcClient *GRPCClient) {
+	for ctx.Err() == nil {
+		item, ok, err := q.Reserve()
+		if err != nil {
+			log.Printf("Ошибка чтения очереди метрик: %v", err)
+			return
+		}
+		if !ok {
+			return
+		}
+
+		err = sendMetrics(ctx, cfg, item.Data, postRequest, grpcClient)
+		switch {
+		case errors.Is(err, errMalformedBatch), errors.Is(err, errRejectedBatch):
+			log.Printf("Пакет метрик (%d байт) удален из очереди без отправки: %v", len(item.Data), err)
+		case err != nil:
+			q.Release(item.ID)
+			stats := q.Stats()
+			log.Printf("Метрики оставлены в очереди: пакетов %d (%d байт), отброшено %d байт",
+				stats.Depth, stats.Bytes, stats.DroppedBytes)
+			return
+		}
 
+		if err := q.Ack(item.ID); err != nil {
+			log.Printf("Ошибка удаления метрик из очереди: %v", err)
+			return
 		}
 	}
 }
 
-// PostBatch - функция отправки сжатых метрик на сервер.
+// sendMetrics - отправляет пакет метрик по HTTP или gRPC в зависимости от настроек.
+func sendMetrics(ctx context.Context, cfg *envs.Config, compressedData []byte, postRequest models.PostRequest, grpcClient *GRPCClient) error {
+	if !cfg.UseGRPC {
+		retryClient := retryablehttp.NewClient()
+		retryClient.RetryMax = retryMax
+		retryClient.RetryWaitMin = retryWaitMin
+		retryClient.RetryWaitMax = retryWaitMax
+		retryClient.Backoff = linearBackoff
+		scheme := "http"
+		if postRequest.TLS != nil {
+			scheme = "https"
+			retryClient.HTTPClient.Transport = &http.Transport{TLSClientConfig: postRequest.TLS}
+		}
+		url := fmt.Sprintf("%s://%s/updates/", scheme, cfg.Address)
+
+		err := PostBatch(retryClient, url, compressedData, postRequest)
+		if err != nil {
+			log.Printf("Ошибка отправки метрик: %v", err)
+			return err
+		}
+		return nil
+	}
+
+	if grpcClient == nil {
+		log.Println("gRPC клиент не инициализирован")
+		return fmt.Errorf("grpc client is not initialized")
+	}
+	protoMetrics, err := model.ConvertToProtoMetrics(compressedData)
+	if err != nil {
+		log.Printf("ошибка преобразования метрик: %v", err)
+		return fmt.Errorf("%w: %v", errMalformedBatch, err)
+	}
+
+	if cfg.UseStream {
+		_, err = grpcClient.StreamMetrics(ctx, protoMetrics, postRequest)
+	} else {
+		_, err = grpcClient.UpdateMetrics(ctx, protoMetrics, postRequest)
+	}
+	if err != nil {
+		log.Printf("Ошибка отправки метрик через gRPC: %v", err)
+		if isPermanentCode(status.Code(err)) {
+			return fmt.Errorf("%w: %v", errRejectedBatch, err)
+		}
+		return err
+	}
+	log.Printf("Sending gRPC request with %d metrics", len(protoMetrics))
+
+	return nil
+}
+
+// isPermanentCode - проверяет, что ответ gRPC с кодом code означает отказ принять пакет,
+// как ответ HTTP 4xx. Остальные коды, например Unavailable, DeadlineExceeded и
+// ResourceExhausted, считаются временными ошибками.
+func isPermanentCode(code codes.Code) bool {
+	switch code {
+	case codes.InvalidArgument, codes.NotFound, codes.AlreadyExists, codes.PermissionDenied,
+		codes.FailedPrecondition, codes.OutOfRange, codes.Unimplemented, codes.Unauthenticated:
+		return true
+	default:
+		return false
+	}
+}
+
+// PostBatch - функция отправки сжатых метрик на сервер. Ответ 5xx считается временной ошибкой,
+// ответ 4xx (кроме 408, 409 и 429) - отказом сервера принять пакет (errRejectedBatch).
+// Каждая попытка отправки подписывается с новыми временем и nonce: для этого PostBatch
+// устанавливает RequestLogHook клиента r.
 func PostBatch(r *retryablehttp.Client, url string, m []byte, post models.PostRequest) error {
 	var dataToSend []byte
 	var contentType string
@@ -88,7 +172,7 @@ func PostBatch(r *retryablehttp.Client, url string, m []byte, post models.PostRe
 			return fmt.Errorf("error encrypting data: %w", err)
 		}
 		dataToSend = encryptedData
-		contentType = "application/octet-stream"
+		contentType = envelope.ContentType
 	} else {
 		dataToSend = m
 		contentType = "application/json"
@@ -100,6 +184,9 @@ func PostBatch(r *retryablehttp.Client, url string, m []byte, post models.PostRe
 	}
 
 	req.Header.Add("content-type", contentType)
+	if post.PublicKey != nil && post.CryptoKeyID != "" {
+		req.Header.Add(keyring.CryptoKeyIDHeader, post.CryptoKeyID)
+	}
 	req.Header.Add("content-encoding", "gzip")
 	req.Header.Add("Accept-Encoding", "gzip")
 
@@ -109,14 +196,24 @@ func PostBatch(r *retryablehttp.Client, url string, m []byte, post models.PostRe
 	}
 	req.Header.Add("X-Real-IP", realIP)
 
-	if len(post.Key) != 0 {
-		hmac, err := hash.ComputeHmac256([]byte(post.Key), dataToSend)
-		if err != nil {
-			return fmt.Errorf("error compute hash data: %w", err)
+	if err = signRequest(req.Header, dataToSend, post); err != nil {
+		return err
+	}
+	// сервер запоминает nonce каждой принятой попытки, поэтому повтор с прежним nonce был бы отклонен
+	var signErr error
+	r.RequestLogHook = func(_ retryablehttp.Logger, httpReq *http.Request, attempt int) {
+		if attempt > 0 && signErr == nil {
+			signErr = signRequest(httpReq.Header, dataToSend, post)
 		}
-		req.Header.Add("HashSHA256", hmac)
 	}
+
 	resp, err := r.Do(req)
+	if signErr != nil {
+		if err == nil {
+			resp.Body.Close()
+		}
+		return signErr
+	}
 	if err != nil {
 		return fmt.Errorf("error connection: %w", err)
 	}
@@ -127,31 +224,46 @@ func PostBatch(r *retryablehttp.Client, url string, m []byte, post models.PostRe
 	log.Printf("Response Status Code: %d", resp.StatusCode)
 	log.Printf("Response Headers: %v", resp.Header)
 
-	return nil
+	switch {
+	case resp.StatusCode < http.StatusBadRequest:
+		return nil
+	case resp.StatusCode >= http.StatusInternalServerError,
+		resp.StatusCode == http.StatusRequestTimeout,
+		resp.StatusCode == http.StatusConflict,
+		resp.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("server responded with status %d", resp.StatusCode)
+	default:
+		return fmt.Errorf("%w: status %d", errRejectedBatch, resp.StatusCode)
+	}
 }
 
-// EncryptWithPublicKey - функция для шифрования данных с использованием публичного ключа RSA.
-func EncryptWithPublicKey(data []byte, publicKey *rsa.PublicKey) ([]byte, error) {
-	chunkSize := publicKey.Size() - 2*sha256.Size - 2 // Максимальный размер блока
-
-	var encryptedChunks []byte
-
-	for start := 0; start < len(data); start += chunkSize {
-		end := start + chunkSize
-		if end > len(data) {
-			end = len(data)
-		}
-		chunk := data[start:end]
+// signRequest - добавляет в заголовки header время отправки, nonce и, если задан ключ, подпись
+// данных data.
+func signRequest(header http.Header, data []byte, post models.PostRequest) error {
+	timestamp, nonce, err := replay.NewNonce()
+	if err != nil {
+		return err
+	}
+	header.Set(replay.TimestampHeader, timestamp)
+	header.Set(replay.NonceHeader, nonce)
 
-		encryptedChunk, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, chunk, nil)
+	if len(post.Key) != 0 {
+		hmac, err := hash.ComputeHmac256([]byte(post.Key), replay.Material(timestamp, nonce, data))
 		if err != nil {
-			return nil, fmt.Errorf("error encrypting chunk: %w", err)
+			return fmt.Errorf("error compute hash data: %w", err)
+		}
+		header.Set("HashSHA256", hmac)
+		if post.KeyID != "" {
+			header.Set(keyring.KeyIDHeader, post.KeyID)
 		}
-
-		encryptedChunks = append(encryptedChunks, encryptedChunk...)
 	}
+	return nil
+}
 
-	return encryptedChunks, nil
+// EncryptWithPublicKey - функция для шифрования данных: данные шифруются случайным ключом AES-256-GCM,
+// который передается вместе с ними зашифрованным публичным ключом RSA.
+func EncryptWithPublicKey(data []byte, publicKey *rsa.PublicKey) ([]byte, error) {
+	return envelope.Seal(data, publicKey)
 }
 
 // linearBackoff - расчитывает время ожижания между попытками отправки
@@ -3,13 +3,12 @@ package export
 import (
 	"bytes"
 	"context"
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/sha256"
+	"encoding/json"
 	"errors"
 	"io"
 	"log"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"sync"
 	"testing"
@@ -18,12 +17,21 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/hashicorp/go-retryablehttp"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/Sofja96/go-metrics.git/internal/agent/envs"
 	mockproto "github.com/Sofja96/go-metrics.git/internal/agent/export/mocks"
 	"github.com/Sofja96/go-metrics.git/internal/agent/gzip"
+	"github.com/Sofja96/go-metrics.git/internal/agent/hash"
+	"github.com/Sofja96/go-metrics.git/internal/agent/queue"
+	"github.com/Sofja96/go-metrics.git/internal/envelope"
 	"github.com/Sofja96/go-metrics.git/internal/models"
 	"github.com/Sofja96/go-metrics.git/internal/proto"
+	"github.com/Sofja96/go-metrics.git/internal/replay"
+	"github.com/Sofja96/go-metrics.git/internal/tlsconfig"
+	"github.com/Sofja96/go-metrics.git/internal/tlsconfig/tlstest"
 	"github.com/Sofja96/go-metrics.git/internal/utils"
 )
 
@@ -63,6 +71,26 @@ func TestPostBatch(t *testing.T) {
 			}),
 			expectedErr: "error connection: POST http://example.com giving up after 1 attempt(s)",
 		},
+		{
+			name: "rejected batch",
+			client: createMockRetryableClient(func(req *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusBadRequest,
+					Body:       io.NopCloser(bytes.NewBufferString("Bad Request")),
+				}, nil
+			}),
+			expectedErr: "metrics batch rejected by server: status 400",
+		},
+		{
+			name: "server error without retry",
+			client: createMockRetryableClient(func(req *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusNotImplemented,
+					Body:       io.NopCloser(bytes.NewBufferString("Not Implemented")),
+				}, nil
+			}),
+			expectedErr: "server responded with status 501",
+		},
 	}
 
 	for _, tt := range tests {
@@ -94,6 +122,47 @@ func TestPostBatch(t *testing.T) {
 	}
 }
 
+func TestPostBatchRetrySigned(t *testing.T) {
+	guard := replay.NewGuard(0, 0)
+	var (
+		mu       sync.Mutex
+		attempts int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		timestamp, nonce := r.Header.Get(replay.TimestampHeader), r.Header.Get(replay.NonceHeader)
+		sign, err := hash.ComputeHmac256([]byte("test-key"), replay.Material(timestamp, nonce, body))
+		assert.NoError(t, err)
+		if sign != r.Header.Get("HashSHA256") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := guard.Check(timestamp, nonce); err != nil {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		// первая попытка принята, но не сохранена из-за ошибки хранилища
+		if attempts == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	client := retryablehttp.NewClient()
+	client.RetryWaitMin = time.Millisecond
+	client.RetryWaitMax = time.Millisecond
+	client.Logger = nil
+
+	err := PostBatch(client, srv.URL, []byte(`{"key": "value"}`), models.PostRequest{Key: "test-key"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+}
+
 // createMockRetryableClient создаёт mock retryablehttp.Client с кастомным транспортом
 func createMockRetryableClient(roundTrip func(req *http.Request) (*http.Response, error)) *retryablehttp.Client {
 	client := retryablehttp.NewClient()
@@ -120,7 +189,7 @@ func TestEncryptWithPublicKey(t *testing.T) {
 	assert.NotNil(t, encrypted)
 	assert.NotEqual(t, original, encrypted)
 
-	decryptedData, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, encrypted, nil)
+	decryptedData, err := envelope.Open(encrypted, privateKey)
 	assert.NoError(t, err)
 
 	assert.Equal(t, original, decryptedData)
@@ -268,7 +337,7 @@ func TestPostQueries(t *testing.T) {
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				PostQueries(ctx, cfg, chIn, nil, grpcClient)
+				PostQueries(ctx, cfg, chIn, models.PostRequest{Key: cfg.HashKey}, grpcClient, nil)
 			}()
 
 			wg.Wait()
@@ -284,6 +353,92 @@ func TestPostQueries(t *testing.T) {
 	}
 }
 
+func TestSendMetricsTLS(t *testing.T) {
+	ca := tlstest.NewCA(t)
+	serverCert, serverKey := ca.Issue(t, "server", "localhost")
+	clientCert, clientKey := ca.Issue(t, "agent-1")
+
+	serverCfg, err := tlsconfig.Server(serverCert, serverKey, ca.File(t))
+	assert.NoError(t, err)
+
+	var clientName string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientName = r.TLS.PeerCertificates[0].Subject.CommonName
+		w.WriteHeader(http.StatusOK)
+	}))
+	srv.TLS = serverCfg
+	srv.StartTLS()
+	defer srv.Close()
+
+	clientCfg, err := tlsconfig.Client(ca.File(t), clientCert, clientKey)
+	assert.NoError(t, err)
+
+	cfg := &envs.Config{Address: srv.Listener.Addr().String()}
+	err = sendMetrics(context.Background(), cfg, []byte("data"), models.PostRequest{TLS: clientCfg}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "agent-1", clientName)
+}
+
+func TestPostQueriesWithQueue(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	m := &mocks{
+		grpcClient: mockproto.NewMockMetricsClient(ctrl),
+	}
+	grpcClient := &GRPCClient{Client: m.grpcClient}
+
+	cfg := &envs.Config{
+		UseGRPC:     true,
+		GrpcAddress: "localhost:50051",
+	}
+
+	q, err := queue.New(t.TempDir(), 0)
+	assert.NoError(t, err)
+
+	batch := func(id string) []byte {
+		compressedData, err := gzip.Compress([]models.Metrics{
+			{MType: "gauge", ID: id, Value: utils.FloatPtr(1)},
+		})
+		if err != nil {
+			t.Fatalf("ошибка сжатия данных: %v", err)
+		}
+		return compressedData
+	}
+
+	var sent []string
+	record := func(_ context.Context, req *proto.UpdateMetricsRequest, _ ...grpc.CallOption) (*proto.UpdateMetricsResponse, error) {
+		data, err := gzip.Decompress(req.GetCompressedData())
+		assert.NoError(t, err)
+		var metrics []*proto.Metric
+		assert.NoError(t, json.Unmarshal(data, &metrics))
+		sent = append(sent, metrics[0].GetId())
+		return &proto.UpdateMetricsResponse{Success: true}, nil
+	}
+
+	run := func(data []byte) {
+		chIn := make(chan []byte, 1)
+		chIn <- data
+		close(chIn)
+		PostQueries(context.Background(), cfg, chIn, models.PostRequest{}, grpcClient, q)
+	}
+
+	// сервер недоступен: пакет остается в очереди
+	m.grpcClient.EXPECT().UpdateMetrics(gomock.Any(), gomock.Any()).Return(nil, errors.New("unavailable"))
+	run(batch("first"))
+	assert.Equal(t, 1, q.Stats().Depth)
+
+	// сервер снова отвечает: сначала отправляется старый пакет, затем новый
+	m.grpcClient.EXPECT().UpdateMetrics(gomock.Any(), gomock.Any()).DoAndReturn(record).Times(2)
+	run(batch("second"))
+	assert.Equal(t, []string{"first", "second"}, sent)
+	assert.Equal(t, 0, q.Stats().Depth)
+
+	// поврежденный пакет не отправляется повторно
+	run([]byte(`{"key": "value"}`))
+	assert.Equal(t, 0, q.Stats().Depth)
+}
+
 func TestLinearBackoff(t *testing.T) {
 	retryWaitMin := time.Second * 1
 	retryWaitMax := time.Second * 5
@@ -294,3 +449,55 @@ func TestLinearBackoff(t *testing.T) {
 
 	assert.Equal(t, expected, result, "Некорректное время ожидания")
 }
+
+func TestPostQueriesWithQueueRejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	q, err := queue.New(t.TempDir(), 0)
+	assert.NoError(t, err)
+
+	chIn := make(chan []byte, 1)
+	chIn <- []byte(`[{"id": "Alloc", "type": "gauge", "value": 1}]`)
+	close(chIn)
+	PostQueries(context.Background(), &envs.Config{Address: srv.Listener.Addr().String()}, chIn, models.PostRequest{}, nil, q)
+
+	// отклоненный сервером пакет удаляется из очереди, а не отправляется повторно
+	assert.Equal(t, 0, q.Stats().Depth)
+}
+
+func TestSendMetricsGRPCStatus(t *testing.T) {
+	compressedData, err := gzip.Compress([]models.Metrics{
+		{MType: "gauge", ID: "Alloc", Value: utils.FloatPtr(1)},
+	})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		code     codes.Code
+		rejected bool
+	}{
+		{name: "invalid argument", code: codes.InvalidArgument, rejected: true},
+		{name: "unauthenticated", code: codes.Unauthenticated, rejected: true},
+		{name: "already exists", code: codes.AlreadyExists, rejected: true},
+		{name: "unavailable", code: codes.Unavailable, rejected: false},
+		{name: "resource exhausted", code: codes.ResourceExhausted, rejected: false},
+		{name: "deadline exceeded", code: codes.DeadlineExceeded, rejected: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			client := mockproto.NewMockMetricsClient(ctrl)
+			client.EXPECT().UpdateMetrics(gomock.Any(), gomock.Any()).Return(nil, status.Error(tt.code, "error"))
+
+			cfg := &envs.Config{UseGRPC: true}
+			err := sendMetrics(context.Background(), cfg, compressedData, models.PostRequest{}, &GRPCClient{Client: client})
+			assert.Error(t, err)
+			assert.Equal(t, tt.rejected, errors.Is(err, errRejectedBatch))
+		})
+	}
+}
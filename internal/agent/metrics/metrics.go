@@ -11,6 +11,7 @@ import (
 	"github.com/shirou/gopsutil/v3/mem"
 
 	"github.com/Sofja96/go-metrics.git/internal/agent/gzip"
+	"github.com/Sofja96/go-metrics.git/internal/agent/queue"
 	"github.com/Sofja96/go-metrics.git/internal/models"
 	"github.com/Sofja96/go-metrics.git/internal/proto"
 )
@@ -19,6 +20,7 @@ import (
 type Metrics struct {
 	ValuesGauge   map[string]float64 // метрики типа gauge
 	ValuesCounter map[string]int64   // метрики типа counter
+	Labels        map[string]string  // метки, добавляемые ко всем метрикам
 }
 
 // NewMetricsCollector - конструктор для создания экземпляра MetricsCollector.
@@ -89,6 +91,15 @@ func (m *Metrics) GetPSMetrics() error {
 
 }
 
+// GetQueueMetrics - функция сбора метрик очереди отправки по ее состоянию stats: количества и размера
+// ожидающих отправки пакетов, а также вытесненных из-за переполнения пакетов с момента запуска.
+func (m *Metrics) GetQueueMetrics(stats queue.Stats) {
+	m.ValuesGauge["SendQueueDepth"] = float64(stats.Depth)
+	m.ValuesGauge["SendQueueBytes"] = float64(stats.Bytes)
+	m.ValuesGauge["SendQueueDropped"] = float64(stats.Dropped)
+	m.ValuesGauge["SendQueueDroppedBytes"] = float64(stats.DroppedBytes)
+}
+
 // PrepareMetrics - преобразует собранные метрики в модели Metrics для отправки
 func (m *Metrics) PrepareMetrics() ([]byte, error) {
 	allMetrics := make([]models.Metrics, 0, len(m.ValuesGauge)+len(m.ValuesCounter))
@@ -96,9 +107,10 @@ func (m *Metrics) PrepareMetrics() ([]byte, error) {
 	for k, v := range m.ValuesGauge {
 		val := v
 		allMetrics = append(allMetrics, models.Metrics{
-			MType: "gauge",
-			ID:    k,
-			Value: &val,
+			MType:  "gauge",
+			ID:     k,
+			Value:  &val,
+			Labels: m.Labels,
 		})
 		log.Printf("%s: %d", k, int(val))
 	}
@@ -106,9 +118,10 @@ func (m *Metrics) PrepareMetrics() ([]byte, error) {
 	for k, v := range m.ValuesCounter {
 		val := v
 		allMetrics = append(allMetrics, models.Metrics{
-			MType: "counter",
-			ID:    k,
-			Delta: &val,
+			MType:  "counter",
+			ID:     k,
+			Delta:  &val,
+			Labels: m.Labels,
 		})
 		log.Printf("%s: %d", k, int(val))
 	}
@@ -138,8 +151,12 @@ func ConvertToProtoMetrics(compressedData []byte) ([]*proto.Metric, error) {
 	var protoMetrics []*proto.Metric
 	for _, m := range metrics {
 		protoMetric := &proto.Metric{
-			Id:   m.ID,
-			Type: m.MType,
+			Id:           m.ID,
+			Type:         m.MType,
+			Labels:       m.Labels,
+			Observations: m.Observations,
+			Buckets:      m.Buckets,
+			Quantiles:    m.Quantiles,
 		}
 		if m.Delta != nil {
 			protoMetric.Delta = *m.Delta
@@ -86,10 +86,11 @@ func TestConvertToProtoMetrics(t *testing.T) {
 			Value: nil,
 		},
 		{
-			ID:    "metric2",
-			MType: "gauge",
-			Delta: nil,
-			Value: new(float64),
+			ID:     "metric2",
+			MType:  "gauge",
+			Delta:  nil,
+			Value:  new(float64),
+			Labels: map[string]string{"host": "agent-1"},
 		},
 	}
 
@@ -103,6 +104,8 @@ func TestConvertToProtoMetrics(t *testing.T) {
 		assert.Len(t, protoMetrics, len(originalMetrics))
 		assert.Equal(t, protoMetrics[0].Id, originalMetrics[0].ID)
 		assert.Equal(t, protoMetrics[1].Type, originalMetrics[1].MType)
+		assert.Empty(t, protoMetrics[0].Labels)
+		assert.Equal(t, originalMetrics[1].Labels, protoMetrics[1].Labels)
 	})
 
 	t.Run("DecompressionError", func(t *testing.T) {
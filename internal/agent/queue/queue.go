@@ -0,0 +1,266 @@
+// Package queue реализует ограниченную по размеру очередь пакетов метрик на диске.
+// Каждый пакет хранится в отдельном файле-сегменте, поэтому очередь переживает
+// перезапуск агента и отдает пакеты на отправку начиная с самого старого.
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	segmentExt = ".seg" // расширение файла сегмента
+	tmpExt     = ".tmp" // расширение недописанного сегмента
+)
+
+// ErrBatchTooLarge - пакет больше допустимого размера очереди.
+var ErrBatchTooLarge = errors.New("batch exceeds queue size limit")
+
+// Item - пакет метрик, выданный из очереди на отправку.
+type Item struct {
+	ID   uint64 // идентификатор сегмента
+	Data []byte // содержимое пакета
+}
+
+// Stats - текущее состояние очереди.
+type Stats struct {
+	Depth        int   // количество пакетов в очереди
+	Bytes        int64 // суммарный размер пакетов в очереди
+	Dropped      int64 // количество пакетов, вытесненных из-за переполнения
+	DroppedBytes int64 // суммарный размер вытесненных пакетов
+}
+
+type segment struct {
+	id       uint64
+	size     int64
+	reserved bool
+}
+
+// Queue - очередь пакетов метрик в каталоге на диске.
+type Queue struct {
+	mu           sync.Mutex
+	dir          string
+	maxBytes     int64
+	segments     []*segment // от самого старого к самому новому
+	nextID       uint64
+	bytes        int64
+	dropped      int64
+	droppedBytes int64
+}
+
+// New - открывает очередь в каталоге dir, создавая его при необходимости, и загружает
+// сегменты, оставшиеся с прошлого запуска. maxBytes ограничивает суммарный размер пакетов;
+// значение 0 и меньше снимает ограничение.
+func New(dir string, maxBytes int64) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error create queue dir: %w", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error read queue dir: %w", err)
+	}
+
+	q := &Queue{
+		dir:      dir,
+		maxBytes: maxBytes,
+		nextID:   1,
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasSuffix(name, tmpExt) {
+			// сегмент не был дописан до конца, данные в нем неполные
+			_ = os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		if entry.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("error stat segment %s: %w", name, err)
+		}
+		q.segments = append(q.segments, &segment{id: id, size: info.Size()})
+		q.bytes += info.Size()
+	}
+
+	sort.Slice(q.segments, func(i, j int) bool {
+		return q.segments[i].id < q.segments[j].id
+	})
+	if n := len(q.segments); n > 0 {
+		q.nextID = q.segments[n-1].id + 1
+	}
+
+	return q, nil
+}
+
+// Push - добавляет пакет в конец очереди. Если очередь переполнена, из нее вытесняются
+// самые старые пакеты, которые сейчас не отправляются.
+func (q *Queue) Push(data []byte) error {
+	size := int64(len(data))
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.maxBytes > 0 && size > q.maxBytes {
+		q.dropped++
+		q.droppedBytes += size
+		return ErrBatchTooLarge
+	}
+
+	for q.maxBytes > 0 && q.bytes+size > q.maxBytes {
+		if !q.evictOldest() {
+			break
+		}
+	}
+
+	id := q.nextID
+	path := q.path(id)
+	if err := writeFile(path+tmpExt, data); err != nil {
+		return err
+	}
+	if err := os.Rename(path+tmpExt, path); err != nil {
+		_ = os.Remove(path + tmpExt)
+		return fmt.Errorf("error commit segment: %w", err)
+	}
+
+	q.nextID++
+	q.segments = append(q.segments, &segment{id: id, size: size})
+	q.bytes += size
+
+	return nil
+}
+
+// Reserve - выдает самый старый пакет, который еще не отправляется. Пакет остается
+// в очереди до вызова Ack; Release возвращает его для повторной отправки.
+// Если таких пакетов нет, возвращается false.
+func (q *Queue) Reserve() (Item, bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i := 0; i < len(q.segments); i++ {
+		seg := q.segments[i]
+		if seg.reserved {
+			continue
+		}
+
+		data, err := os.ReadFile(q.path(seg.id))
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				return Item{}, false, fmt.Errorf("error read segment: %w", err)
+			}
+			// файл удалили снаружи, забываем о нем
+			q.remove(i)
+			i--
+			continue
+		}
+
+		seg.reserved = true
+		return Item{ID: seg.id, Data: data}, true, nil
+	}
+
+	return Item{}, false, nil
+}
+
+// Ack - удаляет отправленный пакет из очереди.
+func (q *Queue) Ack(id uint64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	i := q.index(id)
+	if i < 0 {
+		return nil
+	}
+	if err := os.Remove(q.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error remove segment: %w", err)
+	}
+	q.remove(i)
+
+	return nil
+}
+
+// Release - возвращает пакет в очередь для повторной отправки.
+func (q *Queue) Release(id uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if i := q.index(id); i >= 0 {
+		q.segments[i].reserved = false
+	}
+}
+
+// Stats - возвращает глубину очереди и счетчики вытесненных пакетов.
+func (q *Queue) Stats() Stats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return Stats{
+		Depth:        len(q.segments),
+		Bytes:        q.bytes,
+		Dropped:      q.dropped,
+		DroppedBytes: q.droppedBytes,
+	}
+}
+
+// evictOldest - удаляет самый старый пакет, который сейчас не отправляется.
+func (q *Queue) evictOldest() bool {
+	for i, seg := range q.segments {
+		if seg.reserved {
+			continue
+		}
+		_ = os.Remove(q.path(seg.id))
+		q.dropped++
+		q.droppedBytes += seg.size
+		q.remove(i)
+		return true
+	}
+	return false
+}
+
+func (q *Queue) remove(i int) {
+	q.bytes -= q.segments[i].size
+	q.segments = append(q.segments[:i], q.segments[i+1:]...)
+}
+
+func (q *Queue) index(id uint64) int {
+	for i, seg := range q.segments {
+		if seg.id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (q *Queue) path(id uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", id, segmentExt))
+}
+
+// writeFile - записывает сегмент и сбрасывает его на диск.
+func writeFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("error create segment: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		_ = os.Remove(path)
+		return fmt.Errorf("error write segment: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		_ = os.Remove(path)
+		return fmt.Errorf("error sync segment: %w", err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,106 @@
+package queue
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueueOrder(t *testing.T) {
+	q, err := New(t.TempDir(), 0)
+	require.NoError(t, err)
+
+	require.NoError(t, q.Push([]byte("first")))
+	require.NoError(t, q.Push([]byte("second")))
+
+	first, ok, err := q.Reserve()
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, []byte("first"), first.Data)
+
+	second, ok, err := q.Reserve()
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, []byte("second"), second.Data)
+
+	_, ok, err = q.Reserve()
+	require.NoError(t, err)
+	assert.False(t, ok, "all batches are reserved")
+
+	q.Release(first.ID)
+	require.NoError(t, q.Ack(second.ID))
+
+	again, ok, err := q.Reserve()
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, first.ID, again.ID)
+	require.NoError(t, q.Ack(again.ID))
+
+	assert.Equal(t, Stats{}, q.Stats())
+}
+
+func TestQueueSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	q, err := New(dir, 0)
+	require.NoError(t, err)
+	require.NoError(t, q.Push([]byte("first")))
+	require.NoError(t, q.Push([]byte("second")))
+
+	item, ok, err := q.Reserve()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NoError(t, q.Ack(item.ID))
+
+	// недописанный сегмент с прошлого запуска должен быть удален
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "00000000000000000009.seg.tmp"), []byte("partial"), 0o644))
+
+	reopened, err := New(dir, 0)
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Depth: 1, Bytes: int64(len("second"))}, reopened.Stats())
+
+	require.NoError(t, reopened.Push([]byte("third")))
+
+	item, ok, err = reopened.Reserve()
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, []byte("second"), item.Data)
+
+	item, ok, err = reopened.Reserve()
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, []byte("third"), item.Data)
+
+	_, err = os.Stat(filepath.Join(dir, "00000000000000000009.seg.tmp"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestQueueBound(t *testing.T) {
+	q, err := New(t.TempDir(), 10)
+	require.NoError(t, err)
+
+	require.NoError(t, q.Push([]byte("aaaa")))
+	require.NoError(t, q.Push([]byte("bbbb")))
+	require.NoError(t, q.Push([]byte("cccc")))
+
+	assert.Equal(t, Stats{Depth: 2, Bytes: 8, Dropped: 1, DroppedBytes: 4}, q.Stats())
+
+	item, ok, err := q.Reserve()
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, []byte("bbbb"), item.Data)
+
+	err = q.Push([]byte("too large batch"))
+	assert.ErrorIs(t, err, ErrBatchTooLarge)
+	assert.Equal(t, Stats{Depth: 2, Bytes: 8, Dropped: 2, DroppedBytes: 19}, q.Stats())
+
+	// зарезервированный пакет не вытесняется
+	require.NoError(t, q.Push([]byte("dddd")))
+	item, ok, err = q.Reserve()
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, []byte("dddd"), item.Data)
+}
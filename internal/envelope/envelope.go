@@ -0,0 +1,176 @@
+// Package envelope реализует гибридное шифрование пакетов метрик: данные шифруются
+// случайным ключом AES-256-GCM, а сам ключ - один раз публичным ключом RSA (RSA-OAEP).
+//
+// Формат конверта:
+//
+//	magic "MENV" | версия (1 байт) | длина ключа (2 байта, big-endian) | зашифрованный ключ | nonce | шифртекст
+//
+// Заголовок до nonce используется как дополнительные данные AES-GCM, поэтому его
+// подмена обнаруживается при расшифровке.
+//
+// Для совместимости со старыми агентами пакет также содержит прежний режим, в котором
+// данные целиком шифруются RSA-OAEP блоками размером с ключ.
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	// ContentType - Content-Type HTTP-запроса с данными в формате конверта.
+	ContentType = "application/x-metrics-envelope"
+	// LegacyContentType - Content-Type HTTP-запроса с данными, зашифрованными блоками RSA.
+	LegacyContentType = "application/octet-stream"
+	// MetadataKey - ключ метаданных gRPC с режимом шифрования данных.
+	MetadataKey = "x-encryption"
+	// MetadataValue - значение MetadataKey для данных в формате конверта.
+	// Запросы без MetadataKey расшифровываются в прежнем блочном режиме.
+	MetadataValue = "envelope"
+
+	// Version - текущая версия формата конверта.
+	Version byte = 1
+)
+
+const (
+	magic   = "MENV"
+	keySize = 32 // AES-256
+)
+
+var (
+	// ErrMalformed - данные не являются конвертом или повреждены.
+	ErrMalformed = errors.New("malformed envelope")
+	// ErrUnsupportedVersion - версия конверта не поддерживается.
+	ErrUnsupportedVersion = errors.New("unsupported envelope version")
+)
+
+// Seal - шифрует данные случайным ключом AES-256-GCM и упаковывает их в конверт
+// вместе с ключом, зашифрованным публичным ключом RSA.
+func Seal(data []byte, publicKey *rsa.PublicKey) ([]byte, error) {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("error generate data key: %w", err)
+	}
+
+	wrappedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, key, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error wrap data key: %w", err)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, len(magic)+3+len(wrappedKey))
+	header = append(header, magic...)
+	header = append(header, Version)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(wrappedKey)))
+	header = append(header, wrappedKey...)
+
+	out := make([]byte, len(header), len(header)+gcm.NonceSize()+len(data)+gcm.Overhead())
+	copy(out, header)
+	out = out[:len(header)+gcm.NonceSize()]
+	nonce := out[len(header):]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("error generate nonce: %w", err)
+	}
+
+	return gcm.Seal(out, nonce, data, header), nil
+}
+
+// Open - расшифровывает конверт, созданный Seal.
+func Open(data []byte, privateKey *rsa.PrivateKey) ([]byte, error) {
+	if len(data) < len(magic)+3 || string(data[:len(magic)]) != magic {
+		return nil, ErrMalformed
+	}
+	if v := data[len(magic)]; v != Version {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, v)
+	}
+
+	keyLen := int(binary.BigEndian.Uint16(data[len(magic)+1:]))
+	headerLen := len(magic) + 3 + keyLen
+	if len(data) < headerLen {
+		return nil, ErrMalformed
+	}
+	header, rest := data[:headerLen], data[headerLen:]
+
+	key, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, header[len(magic)+3:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("error unwrap data key: %w", err)
+	}
+	if len(key) != keySize {
+		return nil, ErrMalformed
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < gcm.NonceSize() {
+		return nil, ErrMalformed
+	}
+
+	plain, err := gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], header)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypt envelope: %w", err)
+	}
+	return plain, nil
+}
+
+// EncryptChunked - шифрует данные в прежнем режиме: блоками RSA-OAEP максимального размера.
+func EncryptChunked(data []byte, publicKey *rsa.PublicKey) ([]byte, error) {
+	chunkSize := publicKey.Size() - 2*sha256.Size - 2 // Максимальный размер блока
+
+	var encryptedChunks []byte
+
+	for start := 0; start < len(data); start += chunkSize {
+		end := min(start+chunkSize, len(data))
+
+		encryptedChunk, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, data[start:end], nil)
+		if err != nil {
+			return nil, fmt.Errorf("error encrypting chunk: %w", err)
+		}
+
+		encryptedChunks = append(encryptedChunks, encryptedChunk...)
+	}
+
+	return encryptedChunks, nil
+}
+
+// DecryptChunked - расшифровывает данные, зашифрованные EncryptChunked.
+func DecryptChunked(data []byte, privateKey *rsa.PrivateKey) ([]byte, error) {
+	chunkSize := privateKey.Size()
+	var decryptedData []byte
+
+	for start := 0; start < len(data); start += chunkSize {
+		end := min(start+chunkSize, len(data))
+
+		decryptedChunk, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, data[start:end], nil)
+		if err != nil {
+			return nil, fmt.Errorf("error decrypting chunk: %w", err)
+		}
+
+		decryptedData = append(decryptedData, decryptedChunk...)
+	}
+
+	return decryptedData, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("error create gcm: %w", err)
+	}
+	return gcm, nil
+}
@@ -0,0 +1,73 @@
+package envelope
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealOpen(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	data := bytes.Repeat([]byte("test metrics data"), 1000)
+
+	sealed, err := Seal(data, &privateKey.PublicKey)
+	require.NoError(t, err)
+	assert.Equal(t, []byte(magic), sealed[:len(magic)])
+	assert.Equal(t, Version, sealed[len(magic)])
+
+	opened, err := Open(sealed, privateKey)
+	require.NoError(t, err)
+	assert.Equal(t, data, opened)
+
+	t.Run("Tampered ciphertext", func(t *testing.T) {
+		tampered := bytes.Clone(sealed)
+		tampered[len(tampered)-1] ^= 0xff
+		_, err := Open(tampered, privateKey)
+		assert.Error(t, err)
+	})
+
+	t.Run("Unsupported version", func(t *testing.T) {
+		tampered := bytes.Clone(sealed)
+		tampered[len(magic)] = Version + 1
+		_, err := Open(tampered, privateKey)
+		assert.ErrorIs(t, err, ErrUnsupportedVersion)
+	})
+
+	t.Run("Not an envelope", func(t *testing.T) {
+		_, err := Open([]byte("invalid-data"), privateKey)
+		assert.ErrorIs(t, err, ErrMalformed)
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		_, err := Open(sealed[:len(magic)+10], privateKey)
+		assert.ErrorIs(t, err, ErrMalformed)
+	})
+
+	t.Run("Incorrect private key", func(t *testing.T) {
+		otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		_, err = Open(sealed, otherKey)
+		assert.Error(t, err)
+	})
+}
+
+func TestChunked(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	data := bytes.Repeat([]byte("test metrics data"), 100)
+
+	encrypted, err := EncryptChunked(data, &privateKey.PublicKey)
+	require.NoError(t, err)
+	assert.Zero(t, len(encrypted)%privateKey.Size())
+
+	decrypted, err := DecryptChunked(encrypted, privateKey)
+	require.NoError(t, err)
+	assert.Equal(t, data, decrypted)
+}
@@ -0,0 +1,224 @@
+// Package keyring хранит набор ключей HMAC и приватных ключей RSA сервера с идентификаторами.
+// Агент передает идентификатор ключа в заголовке запроса (метаданных gRPC), и сервер
+// выбирает соответствующий ключ; это позволяет менять ключи без одновременного
+// перезапуска всех агентов и серверов.
+//
+// Ключи из параметров KEY и CRYPTO_KEY регистрируются с пустым идентификатором и
+// используются для запросов без идентификатора ключа. Остальные ключи задаются
+// JSON-файлом:
+//
+//	{
+//	  "hmac": [{"id": "2025-01", "secret": "..."}],
+//	  "rsa": [{"id": "2025-01", "private_key": "/etc/metrics/private-2025-01.pem"}]
+//	}
+package keyring
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+
+	"github.com/Sofja96/go-metrics.git/internal/utils"
+)
+
+const (
+	// KeyIDHeader - заголовок (ключ метаданных gRPC) с идентификатором ключа HMAC.
+	KeyIDHeader = "X-Key-ID"
+	// CryptoKeyIDHeader - заголовок (ключ метаданных gRPC) с идентификатором ключа RSA,
+	// которым зашифрованы данные.
+	CryptoKeyIDHeader = "X-Crypto-Key-ID"
+)
+
+// File - формат файла с набором ключей.
+type File struct {
+	HMAC []HMACKey `json:"hmac"`
+	RSA  []RSAKey  `json:"rsa"`
+}
+
+// HMACKey - ключ HMAC в файле набора ключей.
+type HMACKey struct {
+	ID     string `json:"id"`
+	Secret string `json:"secret"`
+}
+
+// RSAKey - приватный ключ RSA в файле набора ключей.
+type RSAKey struct {
+	ID         string `json:"id"`
+	PrivateKey string `json:"private_key"` // путь к файлу с ключом в формате PEM
+}
+
+// Keyring - набор ключей сервера. Безопасен для конкурентного использования.
+type Keyring struct {
+	mu   sync.RWMutex
+	hmac map[string][]byte
+	rsa  map[string]*rsa.PrivateKey
+
+	// источники ключей для Reload; у набора из FromKeys их нет
+	hashKey   string
+	cryptoKey string
+	file      string
+	static    bool
+}
+
+// New - загружает набор ключей: hashKey и файл cryptoKey регистрируются с пустым
+// идентификатором, остальные ключи читаются из файла file. Пустые параметры пропускаются.
+func New(hashKey, cryptoKey, file string) (*Keyring, error) {
+	k := &Keyring{
+		hashKey:   hashKey,
+		cryptoKey: cryptoKey,
+		file:      file,
+	}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// FromKeys - создает набор из одного ключа HMAC и одного приватного ключа RSA
+// с пустыми идентификаторами. Пустой ключ HMAC и nil вместо ключа RSA пропускаются.
+func FromKeys(hashKey []byte, privateKey *rsa.PrivateKey) *Keyring {
+	k := &Keyring{
+		hmac:   make(map[string][]byte),
+		rsa:    make(map[string]*rsa.PrivateKey),
+		static: true,
+	}
+	if len(hashKey) != 0 {
+		k.hmac[""] = hashKey
+	}
+	if privateKey != nil {
+		k.rsa[""] = privateKey
+	}
+	return k
+}
+
+// Reload - перечитывает ключи из источников. При ошибке прежний набор ключей сохраняется.
+func (k *Keyring) Reload() error {
+	if k.static {
+		return nil
+	}
+
+	hmacKeys := make(map[string][]byte)
+	rsaKeys := make(map[string]*rsa.PrivateKey)
+
+	if k.hashKey != "" {
+		hmacKeys[""] = []byte(k.hashKey)
+	}
+	if k.cryptoKey != "" {
+		privateKey, err := LoadPrivateKey(k.cryptoKey)
+		if err != nil {
+			return err
+		}
+		rsaKeys[""] = privateKey
+	}
+
+	f, err := utils.ReadConfigFromFile[File](k.file)
+	if err != nil {
+		return fmt.Errorf("error read keyring: %w", err)
+	}
+	if f != nil {
+		for _, key := range f.HMAC {
+			if key.ID == "" || key.Secret == "" {
+				return fmt.Errorf("hmac key must have id and secret")
+			}
+			if _, ok := hmacKeys[key.ID]; ok {
+				return fmt.Errorf("duplicate hmac key id: %s", key.ID)
+			}
+			hmacKeys[key.ID] = []byte(key.Secret)
+		}
+		for _, key := range f.RSA {
+			if key.ID == "" || key.PrivateKey == "" {
+				return fmt.Errorf("rsa key must have id and private_key")
+			}
+			if _, ok := rsaKeys[key.ID]; ok {
+				return fmt.Errorf("duplicate rsa key id: %s", key.ID)
+			}
+			privateKey, err := LoadPrivateKey(key.PrivateKey)
+			if err != nil {
+				return fmt.Errorf("rsa key %s: %w", key.ID, err)
+			}
+			rsaKeys[key.ID] = privateKey
+		}
+	}
+
+	k.mu.Lock()
+	k.hmac = hmacKeys
+	k.rsa = rsaKeys
+	k.mu.Unlock()
+
+	return nil
+}
+
+// ReloadOnSignal - перечитывает ключи при получении любого из сигналов sig до отмены контекста.
+func (k *Keyring) ReloadOnSignal(ctx context.Context, sig ...os.Signal) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sig...)
+	defer signal.Stop(ch)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case s := <-ch:
+			if err := k.Reload(); err != nil {
+				log.Printf("error reload keyring on %v: %v", s, err)
+				continue
+			}
+			log.Printf("keyring reloaded on %v", s)
+		}
+	}
+}
+
+// HMAC - возвращает ключ HMAC с указанным идентификатором.
+func (k *Keyring) HMAC(id string) ([]byte, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.hmac[id]
+	return key, ok
+}
+
+// PrivateKey - возвращает приватный ключ RSA с указанным идентификатором.
+func (k *Keyring) PrivateKey(id string) (*rsa.PrivateKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.rsa[id]
+	return key, ok
+}
+
+// HasHMAC - проверяет, что в наборе есть хотя бы один ключ HMAC.
+func (k *Keyring) HasHMAC() bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return len(k.hmac) != 0
+}
+
+// HasRSA - проверяет, что в наборе есть хотя бы один приватный ключ RSA.
+func (k *Keyring) HasRSA() bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return len(k.rsa) != 0
+}
+
+// LoadPrivateKey - загружает приватный ключ RSA из файла в формате PEM.
+func LoadPrivateKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading private key file: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "RSA PRIVATE KEY" {
+		return nil, fmt.Errorf("invalid PEM format or missing private key")
+	}
+
+	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing private key: %w", err)
+	}
+	return privateKey, nil
+}
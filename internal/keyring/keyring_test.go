@@ -0,0 +1,118 @@
+package keyring
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Sofja96/go-metrics.git/internal/utils"
+)
+
+func writeKey(t *testing.T, dir, name string) string {
+	t.Helper()
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(utils.PrivateToString(privateKey)), 0o600))
+	return path
+}
+
+func TestNew(t *testing.T) {
+	dir := t.TempDir()
+	legacyKey := writeKey(t, dir, "legacy.pem")
+	newKey := writeKey(t, dir, "new.pem")
+
+	file := filepath.Join(dir, "keyring.json")
+	require.NoError(t, os.WriteFile(file, []byte(`{
+		"hmac": [{"id": "2025-01", "secret": "new-secret"}],
+		"rsa": [{"id": "2025-01", "private_key": "`+newKey+`"}]
+	}`), 0o600))
+
+	k, err := New("legacy-secret", legacyKey, file)
+	require.NoError(t, err)
+
+	secret, ok := k.HMAC("")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("legacy-secret"), secret)
+
+	secret, ok = k.HMAC("2025-01")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("new-secret"), secret)
+
+	_, ok = k.HMAC("unknown")
+	assert.False(t, ok)
+
+	legacy, ok := k.PrivateKey("")
+	assert.True(t, ok)
+	rotated, ok := k.PrivateKey("2025-01")
+	assert.True(t, ok)
+	assert.False(t, legacy.Equal(rotated))
+
+	t.Run("Reload", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(file, []byte(`{"hmac": [{"id": "2025-02", "secret": "next-secret"}]}`), 0o600))
+		require.NoError(t, k.Reload())
+
+		_, ok := k.HMAC("2025-01")
+		assert.False(t, ok, "removed key should be forgotten")
+		_, ok = k.PrivateKey("2025-01")
+		assert.False(t, ok, "removed key should be forgotten")
+		secret, ok := k.HMAC("2025-02")
+		assert.True(t, ok)
+		assert.Equal(t, []byte("next-secret"), secret)
+	})
+
+	t.Run("ReloadKeepsKeysOnError", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(file, []byte(`{"hmac": [{"id": "", "secret": "x"}]}`), 0o600))
+		assert.Error(t, k.Reload())
+
+		_, ok := k.HMAC("2025-02")
+		assert.True(t, ok)
+	})
+}
+
+func TestNewErrors(t *testing.T) {
+	dir := t.TempDir()
+	key := writeKey(t, dir, "key.pem")
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "InvalidJSON", content: `{`},
+		{name: "DuplicateHMAC", content: `{"hmac": [{"id": "a", "secret": "x"}, {"id": "a", "secret": "y"}]}`},
+		{name: "DuplicateRSA", content: `{"rsa": [{"id": "a", "private_key": "` + key + `"}, {"id": "a", "private_key": "` + key + `"}]}`},
+		{name: "MissingKeyFile", content: `{"rsa": [{"id": "a", "private_key": "` + filepath.Join(dir, "missing.pem") + `"}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(dir, tt.name+".json")
+			require.NoError(t, os.WriteFile(file, []byte(tt.content), 0o600))
+
+			_, err := New("", "", file)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestFromKeys(t *testing.T) {
+	k := FromKeys(nil, nil)
+	assert.False(t, k.HasHMAC())
+	assert.False(t, k.HasRSA())
+	assert.NoError(t, k.Reload())
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	k = FromKeys([]byte("secret"), privateKey)
+	assert.True(t, k.HasHMAC())
+	assert.True(t, k.HasRSA())
+
+	got, ok := k.PrivateKey("")
+	assert.True(t, ok)
+	assert.Same(t, privateKey, got)
+}
@@ -0,0 +1,248 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+)
+
+// SummaryMaxObservations - количество последних наблюдений, по которым считаются квантили summary.
+const SummaryMaxObservations = 1024
+
+// DefaultBuckets - границы корзин histogram по умолчанию (как в клиентской библиотеке Prometheus).
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DefaultQuantiles - квантили summary по умолчанию.
+var DefaultQuantiles = []float64{0.5, 0.9, 0.99}
+
+// ErrLayoutMismatch - границы корзин или квантили не совпадают с уже сохраненными для серии.
+var ErrLayoutMismatch = errors.New("buckets or quantiles do not match the existing series")
+
+// ValidateObservations - проверяет, что наблюдения заданы и являются конечными числами.
+func ValidateObservations(values []float64) error {
+	if len(values) == 0 {
+		return fmt.Errorf("observations is empty")
+	}
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("invalid observation: %v", v)
+		}
+	}
+	return nil
+}
+
+// ValidateDistribution - проверяет наблюдения, границы корзин и квантили метрики histogram или summary.
+func ValidateDistribution(m Metrics) error {
+	if err := ValidateObservations(m.Observations); err != nil {
+		return err
+	}
+	if m.MType == "histogram" {
+		return ValidateBuckets(m.Buckets)
+	}
+	return ValidateQuantiles(m.Quantiles)
+}
+
+// ValidateBuckets - проверяет, что границы корзин конечны и строго возрастают.
+func ValidateBuckets(bounds []float64) error {
+	for i, b := range bounds {
+		if math.IsNaN(b) || math.IsInf(b, 0) {
+			return fmt.Errorf("invalid bucket bound: %v", b)
+		}
+		if i > 0 && b <= bounds[i-1] {
+			return fmt.Errorf("bucket bounds must be sorted in increasing order")
+		}
+	}
+	return nil
+}
+
+// ValidateQuantiles - проверяет, что квантили лежат в [0, 1] и строго возрастают.
+func ValidateQuantiles(quantiles []float64) error {
+	for i, q := range quantiles {
+		if math.IsNaN(q) || q < 0 || q > 1 {
+			return fmt.Errorf("invalid quantile: %v", q)
+		}
+		if i > 0 && q <= quantiles[i-1] {
+			return fmt.Errorf("quantiles must be sorted in increasing order")
+		}
+	}
+	return nil
+}
+
+// ObserveHistogram - добавляет наблюдения в гистограмму h; если h == nil, создает новую
+// с границами bounds. Для существующей гистограммы bounds должны совпадать с ее границами или быть пустыми.
+func ObserveHistogram(h *Histogram, bounds, values []float64) (*Histogram, error) {
+	if h == nil {
+		var err error
+		if h, err = NewHistogram(bounds); err != nil {
+			return nil, err
+		}
+	} else if !h.SameBounds(bounds) {
+		return nil, ErrLayoutMismatch
+	}
+	h.Observe(values...)
+	return h, nil
+}
+
+// ObserveSummary - добавляет наблюдения в summary s по тем же правилам, что и ObserveHistogram.
+func ObserveSummary(s *Summary, quantiles, values []float64) (*Summary, error) {
+	if s == nil {
+		var err error
+		if s, err = NewSummary(quantiles); err != nil {
+			return nil, err
+		}
+	} else if !s.SameQuantiles(quantiles) {
+		return nil, ErrLayoutMismatch
+	}
+	s.Observe(values...)
+	return s, nil
+}
+
+// Histogram - состояние метрики типа histogram.
+type Histogram struct {
+	Bounds []float64 `json:"bounds"` // верхние границы корзин по возрастанию
+	Counts []uint64  `json:"counts"` // наблюдения в каждой корзине; последний элемент - больше всех границ
+	Count  uint64    `json:"count"`  // общее количество наблюдений
+	Sum    float64   `json:"sum"`    // сумма наблюдений
+}
+
+// NewHistogram - создает пустую гистограмму с указанными границами корзин.
+// Если границы не заданы, используются DefaultBuckets.
+func NewHistogram(bounds []float64) (*Histogram, error) {
+	if len(bounds) == 0 {
+		bounds = DefaultBuckets
+	}
+	if err := ValidateBuckets(bounds); err != nil {
+		return nil, err
+	}
+	return &Histogram{
+		Bounds: slices.Clone(bounds),
+		Counts: make([]uint64, len(bounds)+1),
+	}, nil
+}
+
+// Observe - добавляет наблюдения в гистограмму.
+func (h *Histogram) Observe(values ...float64) {
+	for _, v := range values {
+		i := sort.SearchFloat64s(h.Bounds, v)
+		h.Counts[i]++
+		h.Count++
+		h.Sum += v
+	}
+}
+
+// SameBounds - проверяет, что гистограмма использует указанные границы корзин.
+// Пустые границы совпадают с любыми.
+func (h *Histogram) SameBounds(bounds []float64) bool {
+	return len(bounds) == 0 || slices.Equal(h.Bounds, bounds)
+}
+
+// Cumulative - возвращает количество наблюдений, не превышающих каждую из границ,
+// и последним элементом - общее количество наблюдений (граница +Inf).
+func (h *Histogram) Cumulative() []uint64 {
+	cumulative := make([]uint64, len(h.Counts))
+	var total uint64
+	for i, c := range h.Counts {
+		total += c
+		cumulative[i] = total
+	}
+	return cumulative
+}
+
+// Clone - возвращает копию гистограммы.
+func (h *Histogram) Clone() Histogram {
+	return Histogram{
+		Bounds: slices.Clone(h.Bounds),
+		Counts: slices.Clone(h.Counts),
+		Count:  h.Count,
+		Sum:    h.Sum,
+	}
+}
+
+// Summary - состояние метрики типа summary. Квантили считаются по последним
+// SummaryMaxObservations наблюдениям, Count и Sum - по всем.
+type Summary struct {
+	Quantiles    []float64 `json:"quantiles"`    // отслеживаемые квантили
+	Observations []float64 `json:"observations"` // последние наблюдения в порядке поступления
+	Count        uint64    `json:"count"`        // общее количество наблюдений
+	Sum          float64   `json:"sum"`          // сумма наблюдений
+}
+
+// Quantile - значение квантиля summary.
+type Quantile struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
+// SummaryValue - значения summary, отдаваемые клиентам.
+type SummaryValue struct {
+	Quantiles []Quantile `json:"quantiles"`
+	Count     uint64     `json:"count"`
+	Sum       float64    `json:"sum"`
+}
+
+// NewSummary - создает пустой summary с указанными квантилями.
+// Если квантили не заданы, используются DefaultQuantiles.
+func NewSummary(quantiles []float64) (*Summary, error) {
+	if len(quantiles) == 0 {
+		quantiles = DefaultQuantiles
+	}
+	if err := ValidateQuantiles(quantiles); err != nil {
+		return nil, err
+	}
+	return &Summary{
+		Quantiles:    slices.Clone(quantiles),
+		Observations: make([]float64, 0),
+	}, nil
+}
+
+// Observe - добавляет наблюдения в summary, вытесняя самые старые из окна.
+func (s *Summary) Observe(values ...float64) {
+	for _, v := range values {
+		s.Count++
+		s.Sum += v
+	}
+	s.Observations = append(s.Observations, values...)
+	if extra := len(s.Observations) - SummaryMaxObservations; extra > 0 {
+		s.Observations = append(s.Observations[:0], s.Observations[extra:]...)
+	}
+}
+
+// SameQuantiles - проверяет, что summary отслеживает указанные квантили.
+// Пустой список совпадает с любым.
+func (s *Summary) SameQuantiles(quantiles []float64) bool {
+	return len(quantiles) == 0 || slices.Equal(s.Quantiles, quantiles)
+}
+
+// Clone - возвращает копию summary.
+func (s *Summary) Clone() Summary {
+	return Summary{
+		Quantiles:    slices.Clone(s.Quantiles),
+		Observations: slices.Clone(s.Observations),
+		Count:        s.Count,
+		Sum:          s.Sum,
+	}
+}
+
+// Value - вычисляет значения квантилей по методу ближайшего ранга.
+// Для summary без наблюдений значения квантилей равны 0.
+func (s *Summary) Value() SummaryValue {
+	sorted := slices.Clone(s.Observations)
+	sort.Float64s(sorted)
+
+	value := SummaryValue{
+		Quantiles: make([]Quantile, 0, len(s.Quantiles)),
+		Count:     s.Count,
+		Sum:       s.Sum,
+	}
+	for _, q := range s.Quantiles {
+		var v float64
+		if len(sorted) > 0 {
+			rank := int(math.Ceil(q*float64(len(sorted)))) - 1
+			v = sorted[max(rank, 0)]
+		}
+		value.Quantiles = append(value.Quantiles, Quantile{Quantile: q, Value: v})
+	}
+	return value
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObserveHistogram(t *testing.T) {
+	h, err := ObserveHistogram(nil, []float64{1, 5}, []float64{0.5, 1, 3, 10})
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{2, 1, 1}, h.Counts)
+	assert.Equal(t, []uint64{2, 3, 4}, h.Cumulative())
+	assert.Equal(t, uint64(4), h.Count)
+	assert.Equal(t, 14.5, h.Sum)
+
+	h, err = ObserveHistogram(h, nil, []float64{2})
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{2, 2, 1}, h.Counts)
+
+	_, err = ObserveHistogram(h, []float64{1, 10}, []float64{2})
+	assert.ErrorIs(t, err, ErrLayoutMismatch)
+
+	h, err = ObserveHistogram(nil, nil, []float64{0.2})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultBuckets, h.Bounds)
+}
+
+func TestObserveSummary(t *testing.T) {
+	values := make([]float64, 0, 100)
+	for i := 1; i <= 100; i++ {
+		values = append(values, float64(i))
+	}
+
+	sm, err := ObserveSummary(nil, []float64{0, 0.5, 0.9, 1}, values)
+	require.NoError(t, err)
+	assert.Equal(t, SummaryValue{
+		Quantiles: []Quantile{
+			{Quantile: 0, Value: 1},
+			{Quantile: 0.5, Value: 50},
+			{Quantile: 0.9, Value: 90},
+			{Quantile: 1, Value: 100},
+		},
+		Count: 100,
+		Sum:   5050,
+	}, sm.Value())
+
+	_, err = ObserveSummary(sm, []float64{0.5}, []float64{1})
+	assert.ErrorIs(t, err, ErrLayoutMismatch)
+}
+
+func TestSummaryWindow(t *testing.T) {
+	sm, err := NewSummary(nil)
+	require.NoError(t, err)
+
+	for i := 0; i < SummaryMaxObservations; i++ {
+		sm.Observe(1)
+	}
+	sm.Observe(1000)
+
+	assert.Len(t, sm.Observations, SummaryMaxObservations)
+	assert.Equal(t, uint64(SummaryMaxObservations+1), sm.Count)
+	assert.Equal(t, 1000.0, sm.Observations[len(sm.Observations)-1])
+}
+
+func TestValidateDistribution(t *testing.T) {
+	tests := []struct {
+		name    string
+		metric  Metrics
+		wantErr bool
+	}{
+		{name: "Histogram", metric: Metrics{MType: "histogram", Observations: []float64{1}, Buckets: []float64{1, 2}}},
+		{name: "Summary", metric: Metrics{MType: "summary", Observations: []float64{1}, Quantiles: []float64{0.5}}},
+		{name: "NoObservations", metric: Metrics{MType: "histogram"}, wantErr: true},
+		{name: "NaNObservation", metric: Metrics{MType: "summary", Observations: []float64{math.NaN()}}, wantErr: true},
+		{name: "UnsortedBuckets", metric: Metrics{MType: "histogram", Observations: []float64{1}, Buckets: []float64{2, 1}}, wantErr: true},
+		{name: "InfBucket", metric: Metrics{MType: "histogram", Observations: []float64{1}, Buckets: []float64{math.Inf(1)}}, wantErr: true},
+		{name: "QuantileOutOfRange", metric: Metrics{MType: "summary", Observations: []float64{1}, Quantiles: []float64{1.5}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateDistribution(tt.metric)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -1,16 +1,29 @@
 package models
 
-import "crypto/rsa"
+import (
+	"crypto/rsa"
+	"crypto/tls"
+)
 
 // Metrics - структура метрик их идентификатор, тип и значение
 type Metrics struct {
-	ID    string   `json:"id"`              // имя метрики
-	MType string   `json:"type"`            // параметр, принимающий значение gauge или counter
-	Delta *int64   `json:"delta,omitempty"` // значение метрики в случае передачи counter
-	Value *float64 `json:"value,omitempty"` // значение метрики в случае передачи gauge
+	ID     string            `json:"id"`               // имя метрики
+	MType  string            `json:"type"`             // тип метрики: gauge, counter, histogram или summary
+	Delta  *int64            `json:"delta,omitempty"`  // значение метрики в случае передачи counter
+	Value  *float64          `json:"value,omitempty"`  // значение метрики в случае передачи gauge
+	Labels map[string]string `json:"labels,omitempty"` // метки серии, например host
+
+	Observations []float64     `json:"observations,omitempty"` // наблюдения histogram и summary
+	Buckets      []float64     `json:"buckets,omitempty"`      // границы корзин histogram
+	Quantiles    []float64     `json:"quantiles,omitempty"`    // квантили summary
+	Histogram    *Histogram    `json:"histogram,omitempty"`    // состояние histogram в ответе
+	Summary      *SummaryValue `json:"summary,omitempty"`      // значения summary в ответе
 }
 
 type PostRequest struct {
-	Key       string
-	PublicKey *rsa.PublicKey
+	Key         string
+	KeyID       string // идентификатор Key на сервере
+	PublicKey   *rsa.PublicKey
+	CryptoKeyID string      // идентификатор ключа, парного PublicKey, на сервере
+	TLS         *tls.Config // настройки TLS; nil - соединение без TLS
 }
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SeriesKey - возвращает идентификатор серии метрики: имя и отсортированные по ключу метки,
+// например HeapAlloc{host="agent-1"}. Для метрики без меток идентификатор совпадает с именем.
+func SeriesKey(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+	return name + "{" + FormatLabels(labels) + "}"
+}
+
+// SeriesKey - возвращает идентификатор серии метрики.
+func (m Metrics) SeriesKey() string {
+	return SeriesKey(m.ID, m.Labels)
+}
+
+// SplitSeriesKey - разделяет идентификатор серии на имя и строку меток в каноническом виде.
+func SplitSeriesKey(key string) (string, string) {
+	i := strings.IndexByte(key, '{')
+	if i < 0 || !strings.HasSuffix(key, "}") {
+		return key, ""
+	}
+	return key[:i], key[i+1 : len(key)-1]
+}
+
+// ParseSeriesKey - разбирает идентификатор серии на имя и метки.
+func ParseSeriesKey(key string) (string, map[string]string) {
+	name, labels := SplitSeriesKey(key)
+	return name, ParseLabels(labels)
+}
+
+// FormatLabels - формирует строку меток вида k1="v1",k2="v2" с ключами по возрастанию.
+// Значения экранируются так же, как в текстовом формате Prometheus.
+func FormatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k)
+		b.WriteString(`="`)
+		b.WriteString(labelValueEscaper.Replace(labels[k]))
+		b.WriteByte('"')
+	}
+	return b.String()
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// ParseLabels - разбирает строку меток, сформированную FormatLabels.
+func ParseLabels(s string) map[string]string {
+	if s == "" {
+		return nil
+	}
+
+	labels := make(map[string]string)
+	for len(s) > 0 {
+		eq := strings.Index(s, `="`)
+		if eq < 0 {
+			break
+		}
+		key := s[:eq]
+		s = s[eq+2:]
+
+		var value strings.Builder
+		i := 0
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+				if s[i] == 'n' {
+					value.WriteByte('\n')
+					continue
+				}
+			}
+			value.WriteByte(s[i])
+		}
+		labels[key] = value.String()
+
+		s = strings.TrimPrefix(s[min(i+1, len(s)):], ",")
+	}
+	return labels
+}
+
+// ValidateName - проверяет, что имя метрики не содержит символов {, }, " и запятой,
+// которые разделяют имя и метки в идентификаторе серии.
+func ValidateName(name string) error {
+	if strings.ContainsAny(name, `{}",`) {
+		return fmt.Errorf("invalid metric name: %q", name)
+	}
+	return nil
+}
+
+// ValidateLabels - проверяет, что имена меток соответствуют [a-zA-Z_][a-zA-Z0-9_]*.
+func ValidateLabels(labels map[string]string) error {
+	for k := range labels {
+		if k == "" {
+			return fmt.Errorf("empty label name")
+		}
+		for i, r := range k {
+			valid := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '_' || (i > 0 && r >= '0' && r <= '9')
+			if !valid {
+				return fmt.Errorf("invalid label name: %q", k)
+			}
+		}
+	}
+	return nil
+}
+
+// MatchLabels - проверяет, что среди меток серии есть все метки из фильтра с теми же значениями.
+func MatchLabels(labels, filter map[string]string) bool {
+	for k, v := range filter {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
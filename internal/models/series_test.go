@@ -0,0 +1,106 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeriesKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		metric   string
+		labels   map[string]string
+		expected string
+	}{
+		{name: "WithoutLabels", metric: "HeapAlloc", expected: "HeapAlloc"},
+		{name: "EmptyLabels", metric: "HeapAlloc", labels: map[string]string{}, expected: "HeapAlloc"},
+		{
+			name:     "SortedLabels",
+			metric:   "HeapAlloc",
+			labels:   map[string]string{"host": "agent-1", "dc": "eu"},
+			expected: `HeapAlloc{dc="eu",host="agent-1"}`,
+		},
+		{
+			name:     "EscapedValue",
+			metric:   "PollCount",
+			labels:   map[string]string{"path": "C:\\tmp \"x\"\n"},
+			expected: `PollCount{path="C:\\tmp \"x\"\n"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := SeriesKey(tt.metric, tt.labels)
+			assert.Equal(t, tt.expected, key)
+
+			name, labels := ParseSeriesKey(key)
+			assert.Equal(t, tt.metric, name)
+			if len(tt.labels) == 0 {
+				assert.Empty(t, labels)
+			} else {
+				assert.Equal(t, tt.labels, labels)
+			}
+		})
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	tests := []struct {
+		name    string
+		metric  string
+		wantErr bool
+	}{
+		{name: "Valid", metric: "HeapAlloc"},
+		{name: "Dotted", metric: "http.requests_total"},
+		{name: "OpenBrace", metric: `Alloc{host="agent-1"`, wantErr: true},
+		{name: "CloseBrace", metric: "Alloc}", wantErr: true},
+		{name: "Quote", metric: `Al"loc`, wantErr: true},
+		{name: "Comma", metric: "Alloc,Sys", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateName(tt.metric)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateLabels(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		wantErr bool
+	}{
+		{name: "Nil", labels: nil},
+		{name: "Valid", labels: map[string]string{"host": "agent-1", "_dc2": "eu"}},
+		{name: "Empty", labels: map[string]string{"": "x"}, wantErr: true},
+		{name: "LeadingDigit", labels: map[string]string{"1host": "x"}, wantErr: true},
+		{name: "InvalidChar", labels: map[string]string{"data-center": "x"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateLabels(tt.labels)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestMatchLabels(t *testing.T) {
+	labels := map[string]string{"host": "agent-1", "dc": "eu"}
+
+	assert.True(t, MatchLabels(labels, nil))
+	assert.True(t, MatchLabels(labels, map[string]string{"host": "agent-1"}))
+	assert.False(t, MatchLabels(labels, map[string]string{"host": "agent-2"}))
+	assert.False(t, MatchLabels(labels, map[string]string{"env": "prod"}))
+}
@@ -0,0 +1,146 @@
+// Package replay защищает подписанные запросы агента от повторной отправки.
+// Агент добавляет к запросу время отправки и случайный nonce, которые входят в подписываемые
+// данные, а сервер отклоняет запросы со слишком старым временем и уже встречавшимся nonce.
+package replay
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// TimestampHeader - заголовок (ключ метаданных gRPC) с временем отправки запроса в Unix-секундах.
+	TimestampHeader = "X-Timestamp"
+	// NonceHeader - заголовок (ключ метаданных gRPC) со случайным идентификатором запроса.
+	NonceHeader = "X-Nonce"
+
+	// DefaultMaxClockSkew - допустимое по умолчанию расхождение времени агента и сервера.
+	DefaultMaxClockSkew = 5 * time.Minute
+	// DefaultCacheSize - количество запоминаемых nonce по умолчанию.
+	DefaultCacheSize = 100000
+)
+
+var (
+	// ErrMissingHeaders - в запросе нет времени отправки или nonce.
+	ErrMissingHeaders = errors.New("missing timestamp or nonce")
+	// ErrStale - время отправки запроса выходит за допустимое расхождение.
+	ErrStale = errors.New("request timestamp is outside the allowed clock skew")
+	// ErrReplay - запрос с таким nonce уже был принят.
+	ErrReplay = errors.New("nonce has already been used")
+	// ErrCacheFull - кэш заполнен nonce, запросы с которыми еще проходят проверку времени.
+	ErrCacheFull = errors.New("nonce cache is full")
+)
+
+// Material - возвращает подписываемые данные: время отправки, nonce и тело запроса.
+func Material(timestamp, nonce string, body []byte) []byte {
+	material := make([]byte, 0, len(timestamp)+len(nonce)+2+len(body))
+	material = append(material, timestamp...)
+	material = append(material, '\n')
+	material = append(material, nonce...)
+	material = append(material, '\n')
+	return append(material, body...)
+}
+
+// NewNonce - возвращает случайный nonce и текущее время для подписи запроса.
+func NewNonce() (timestamp, nonce string, err error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("error generate nonce: %w", err)
+	}
+	return strconv.FormatInt(time.Now().Unix(), 10), hex.EncodeToString(b), nil
+}
+
+type entry struct {
+	nonce   string
+	expires time.Time
+}
+
+// Guard - проверяет время отправки запросов и запоминает последние nonce.
+// Nonce хранятся, пока запрос с ними может пройти проверку времени; если кэш
+// заполнен такими nonce, новые запросы отклоняются с ErrCacheFull.
+type Guard struct {
+	mu    sync.Mutex
+	skew  time.Duration
+	size  int
+	seen  map[string]struct{}
+	order []entry // в порядке добавления, начиная с head
+	head  int
+	now   func() time.Time
+}
+
+// NewGuard - создает проверку с допустимым расхождением времени skew и кэшем на size nonce.
+// Нулевые и отрицательные значения заменяются значениями по умолчанию.
+func NewGuard(skew time.Duration, size int) *Guard {
+	if skew <= 0 {
+		skew = DefaultMaxClockSkew
+	}
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	return &Guard{
+		skew: skew,
+		size: size,
+		seen: make(map[string]struct{}),
+		now:  time.Now,
+	}
+}
+
+// Check - проверяет время отправки и nonce запроса и запоминает nonce.
+// Вызывается только после успешной проверки подписи, чтобы чужие запросы не засоряли кэш.
+func (g *Guard) Check(timestamp, nonce string) error {
+	if timestamp == "" || nonce == "" {
+		return ErrMissingHeaders
+	}
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp: %w", err)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	g.expire(now)
+
+	sent := time.Unix(sec, 0)
+	if sent.Before(now.Add(-g.skew)) || sent.After(now.Add(g.skew)) {
+		return ErrStale
+	}
+	if _, ok := g.seen[nonce]; ok {
+		return ErrReplay
+	}
+
+	// вытеснение неистекшего nonce позволило бы повторить его запрос
+	if len(g.seen) >= g.size {
+		return ErrCacheFull
+	}
+	// запрос с этим временем отправки перестанет проходить проверку через skew
+	g.seen[nonce] = struct{}{}
+	g.order = append(g.order, entry{nonce: nonce, expires: sent.Add(g.skew)})
+
+	return nil
+}
+
+// expire - удаляет nonce, запросы с которыми уже не пройдут проверку времени.
+// Записи просматриваются в порядке добавления до первой неистекшей.
+func (g *Guard) expire(now time.Time) {
+	for g.head < len(g.order) && g.order[g.head].expires.Before(now) {
+		g.pop()
+	}
+}
+
+// pop - удаляет самую старую запись.
+func (g *Guard) pop() {
+	delete(g.seen, g.order[g.head].nonce)
+	g.order[g.head] = entry{}
+	g.head++
+	if g.head > len(g.order)/2 {
+		g.order = append(g.order[:0], g.order[g.head:]...)
+		g.head = 0
+	}
+}
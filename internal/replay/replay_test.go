@@ -0,0 +1,91 @@
+package replay
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGuardCheck(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	g := NewGuard(time.Minute, 10)
+	g.now = func() time.Time { return now }
+
+	ts := func(d time.Duration) string {
+		return strconv.FormatInt(now.Add(d).Unix(), 10)
+	}
+
+	tests := []struct {
+		name      string
+		timestamp string
+		nonce     string
+		wantErr   error
+	}{
+		{name: "Valid", timestamp: ts(0), nonce: "a"},
+		{name: "Replay", timestamp: ts(0), nonce: "a", wantErr: ErrReplay},
+		{name: "ReplayWithOtherTimestamp", timestamp: ts(10 * time.Second), nonce: "a", wantErr: ErrReplay},
+		{name: "WithinSkew", timestamp: ts(-time.Minute), nonce: "b"},
+		{name: "Stale", timestamp: ts(-2 * time.Minute), nonce: "c", wantErr: ErrStale},
+		{name: "FromFuture", timestamp: ts(2 * time.Minute), nonce: "d", wantErr: ErrStale},
+		{name: "MissingNonce", timestamp: ts(0), wantErr: ErrMissingHeaders},
+		{name: "MissingTimestamp", nonce: "e", wantErr: ErrMissingHeaders},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := g.Check(tt.timestamp, tt.nonce)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	assert.Error(t, g.Check("not-a-number", "f"))
+}
+
+func TestGuardExpire(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	g := NewGuard(time.Minute, 10)
+	g.now = func() time.Time { return now }
+
+	sent := strconv.FormatInt(now.Unix(), 10)
+	require.NoError(t, g.Check(sent, "a"))
+
+	now = now.Add(time.Minute)
+	assert.ErrorIs(t, g.Check(sent, "a"), ErrReplay)
+
+	now = now.Add(time.Second)
+	assert.ErrorIs(t, g.Check(sent, "a"), ErrStale)
+	assert.Empty(t, g.seen, "expired nonce should be forgotten")
+}
+
+func TestGuardBound(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	g := NewGuard(time.Minute, 3)
+	g.now = func() time.Time { return now }
+
+	sent := strconv.FormatInt(now.Unix(), 10)
+	for _, nonce := range []string{"a", "b", "c"} {
+		require.NoError(t, g.Check(sent, nonce))
+	}
+
+	// неистекшие nonce не вытесняются: иначе их запросы можно было бы повторить
+	assert.ErrorIs(t, g.Check(sent, "d"), ErrCacheFull)
+	assert.ErrorIs(t, g.Check(sent, "a"), ErrReplay)
+	assert.Len(t, g.seen, 3)
+
+	// после истечения место освобождается
+	now = now.Add(time.Minute + time.Second)
+	later := strconv.FormatInt(now.Unix(), 10)
+	assert.NoError(t, g.Check(later, "d"))
+	assert.Len(t, g.seen, 1)
+}
+
+func TestMaterial(t *testing.T) {
+	assert.Equal(t, []byte("1700000000\nabc\nbody"), Material("1700000000", "abc", []byte("body")))
+}
@@ -0,0 +1,196 @@
+package alerting
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Sofja96/go-metrics.git/internal/models"
+	"github.com/Sofja96/go-metrics.git/internal/server/query"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+)
+
+// DefaultInterval - период вычисления правил по умолчанию.
+const DefaultInterval = 30 * time.Second
+
+// State - состояние алерта.
+type State string
+
+const (
+	// StatePending - условие правила выполняется, но меньше времени For
+	StatePending State = "pending"
+	// StateFiring - условие правила выполняется не меньше времени For
+	StateFiring State = "firing"
+	// StateResolved - условие сработавшего алерта перестало выполняться
+	StateResolved State = "resolved"
+)
+
+// Alert - алерт правила Rule по ряду с именем Metric. Labels - метки ряда вместе с метками правила,
+// Value - значение ряда при последнем вычислении, ActiveAt - момент, с которого выполняется условие.
+type Alert struct {
+	Rule       string            `json:"rule"`
+	Metric     string            `json:"metric,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Value      float64           `json:"value"`
+	State      State             `json:"state"`
+	ActiveAt   time.Time         `json:"active_at"`
+	FiredAt    *time.Time        `json:"fired_at,omitempty"`
+	ResolvedAt *time.Time        `json:"resolved_at,omitempty"`
+}
+
+// Engine - вычисляет правила по данным хранилища и хранит активные (pending и firing) алерты.
+type Engine struct {
+	storage storage.Storage
+	rules   []Rule
+
+	mu     sync.RWMutex
+	alerts map[string]*Alert // по правилу и идентификатору серии ряда
+}
+
+// NewEngine - создает вычислитель правил rules над хранилищем s.
+func NewEngine(s storage.Storage, rules []Rule) *Engine {
+	return &Engine{
+		storage: s,
+		rules:   rules,
+		alerts:  make(map[string]*Alert),
+	}
+}
+
+// Eval - вычисляет правила на момент now и обновляет состояние алертов. Возвращает алерты,
+// которые появились, сработали или разрешились. Если правило не удалось вычислить,
+// его алерты сохраняют прежнее состояние.
+func (e *Engine) Eval(ctx context.Context, now time.Time) []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var changed []Alert
+	for i := range e.rules {
+		rule := &e.rules[i]
+		series, err := query.Eval(ctx, e.storage, rule.expr, now)
+		if err != nil {
+			log.Printf("error evaluate alerting rule %s: %v", rule.Name, err)
+			continue
+		}
+
+		active := make(map[string]bool, len(series))
+		for _, sr := range series {
+			if !rule.match(sr.Value) {
+				continue
+			}
+			key := rule.Name + "/" + models.SeriesKey(sr.Name, sr.Labels)
+			active[key] = true
+
+			a, ok := e.alerts[key]
+			stateChanged := !ok
+			if !ok {
+				a = &Alert{Rule: rule.Name, Metric: sr.Name, Labels: alertLabels(sr.Labels, rule.Labels),
+					State: StatePending, ActiveAt: now}
+				e.alerts[key] = a
+			}
+			a.Value = sr.Value
+			if a.State == StatePending && now.Sub(a.ActiveAt) >= rule.For {
+				a.State = StateFiring
+				a.FiredAt = &now
+				stateChanged = true
+			}
+			if stateChanged {
+				changed = append(changed, *a)
+			}
+		}
+
+		for key, a := range e.alerts {
+			if a.Rule != rule.Name || active[key] {
+				continue
+			}
+			delete(e.alerts, key)
+			if a.State == StateFiring {
+				a.State = StateResolved
+				a.ResolvedAt = &now
+				changed = append(changed, *a)
+			}
+		}
+	}
+	sortAlerts(changed)
+	return changed
+}
+
+// Alerts - возвращает активные алерты в состоянии state (любом, если состояние пусто),
+// упорядоченные по правилу, имени ряда и меткам.
+func (e *Engine) Alerts(state State) []Alert {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	alerts := make([]Alert, 0, len(e.alerts))
+	for _, a := range e.alerts {
+		if state == "" || a.State == state {
+			alerts = append(alerts, *a)
+		}
+	}
+	sortAlerts(alerts)
+	return alerts
+}
+
+// Run - вычисляет правила с периодом interval (DefaultInterval, если не задан) до отмены контекста.
+// Если задан notifier, после каждого вычисления он получает сработавшие алерты и доставляет их
+// в отдельных горутинах, не задерживая вычисление.
+func (e *Engine) Run(ctx context.Context, interval time.Duration, notifier *Notifier) {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	if notifier != nil {
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			notifier.Run(ctx)
+		}()
+		defer wg.Wait()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, a := range e.Eval(ctx, now) {
+				log.Printf("alert %s %s: %s = %g", a.Rule, a.State, models.SeriesKey(a.Metric, a.Labels), a.Value)
+			}
+			if notifier != nil {
+				notifier.Notify(now, e.Alerts(StateFiring))
+			}
+		}
+	}
+}
+
+// alertLabels - объединяет метки ряда и правила; метки правила важнее.
+func alertLabels(series, rule map[string]string) map[string]string {
+	if len(series)+len(rule) == 0 {
+		return nil
+	}
+	labels := make(map[string]string, len(series)+len(rule))
+	for k, v := range series {
+		labels[k] = v
+	}
+	for k, v := range rule {
+		labels[k] = v
+	}
+	return labels
+}
+
+// sortAlerts - упорядочивает алерты по правилу, имени ряда и меткам.
+func sortAlerts(alerts []Alert) {
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].Rule != alerts[j].Rule {
+			return alerts[i].Rule < alerts[j].Rule
+		}
+		if alerts[i].Metric != alerts[j].Metric {
+			return alerts[i].Metric < alerts[j].Metric
+		}
+		return models.FormatLabels(alerts[i].Labels) < models.FormatLabels(alerts[j].Labels)
+	})
+}
@@ -0,0 +1,137 @@
+package alerting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage/memory"
+	storagemock "github.com/Sofja96/go-metrics.git/internal/server/storage/mocks"
+)
+
+func TestEngine_Eval(t *testing.T) {
+	ctx := context.Background()
+	store, err := memory.New(ctx, memory.Options{})
+	require.NoError(t, err)
+
+	rules, err := ParseRules([]byte(`{"rules": [
+		{"name": "HeapInuseHigh", "expr": "HeapInuse", "op": ">", "threshold": 100, "for": "1m", "labels": {"severity": "warning"}},
+		{"name": "HeapInuseTotal", "expr": "sum(HeapInuse)", "op": ">=", "threshold": 300}
+	]}`))
+	require.NoError(t, err)
+	e := NewEngine(store, rules)
+
+	setHeap := func(host string, value float64) {
+		_, err := store.UpdateGauge(ctx, `HeapInuse{host="`+host+`"}`, value)
+		require.NoError(t, err)
+	}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	setHeap("a", 50)
+	setHeap("b", 150)
+	changed := e.Eval(ctx, now)
+	require.Len(t, changed, 1)
+	assert.Equal(t, Alert{
+		Rule:     "HeapInuseHigh",
+		Metric:   "HeapInuse",
+		Labels:   map[string]string{"host": "b", "severity": "warning"},
+		Value:    150,
+		State:    StatePending,
+		ActiveAt: now,
+	}, changed[0])
+
+	// условие выполняется меньше For: состояние не меняется
+	setHeap("b", 160)
+	assert.Empty(t, e.Eval(ctx, now.Add(30*time.Second)))
+	alerts := e.Alerts("")
+	require.Len(t, alerts, 1)
+	assert.Equal(t, 160.0, alerts[0].Value)
+	assert.Equal(t, StatePending, alerts[0].State)
+
+	// For истек, а сумма превысила порог: правило без For срабатывает сразу
+	setHeap("a", 140)
+	fired := now.Add(time.Minute)
+	changed = e.Eval(ctx, fired)
+	require.Len(t, changed, 3)
+	assert.Equal(t, "HeapInuseHigh", changed[0].Rule)
+	assert.Equal(t, "a", changed[0].Labels["host"])
+	assert.Equal(t, StatePending, changed[0].State)
+	assert.Equal(t, "HeapInuseHigh", changed[1].Rule)
+	assert.Equal(t, StateFiring, changed[1].State)
+	assert.Equal(t, &fired, changed[1].FiredAt)
+	assert.Equal(t, now, changed[1].ActiveAt)
+	assert.Equal(t, Alert{Rule: "HeapInuseTotal", Value: 300, State: StateFiring, ActiveAt: fired, FiredAt: &fired}, changed[2])
+	assert.Len(t, e.Alerts(""), 3)
+	assert.Len(t, e.Alerts(StateFiring), 2)
+	assert.Len(t, e.Alerts(StatePending), 1)
+
+	// pending-алерт исчезает без уведомления, сработавшие разрешаются
+	setHeap("a", 10)
+	setHeap("b", 10)
+	resolved := fired.Add(time.Minute)
+	changed = e.Eval(ctx, resolved)
+	require.Len(t, changed, 2)
+	for _, a := range changed {
+		assert.Equal(t, StateResolved, a.State)
+		assert.Equal(t, &resolved, a.ResolvedAt)
+	}
+	assert.Equal(t, "HeapInuseHigh", changed[0].Rule)
+	assert.Equal(t, "HeapInuseTotal", changed[1].Rule)
+	assert.Empty(t, e.Alerts(""))
+}
+
+func TestEngine_EvalCounterStalled(t *testing.T) {
+	ctx := context.Background()
+	store, err := memory.New(ctx, memory.Options{})
+	require.NoError(t, err)
+
+	rules, err := ParseRules([]byte(`{"rules": [
+		{"name": "PollCountStalled", "expr": "increase(PollCount[1m])", "op": "==", "threshold": 0}
+	]}`))
+	require.NoError(t, err)
+	e := NewEngine(store, rules)
+
+	_, err = store.UpdateCounter(ctx, "PollCount", 1)
+	require.NoError(t, err)
+	_, err = store.UpdateCounter(ctx, "PollCount", 1)
+	require.NoError(t, err)
+	assert.Empty(t, e.Eval(ctx, time.Now()))
+
+	// за минуту после последнего обновления counter не вырос
+	changed := e.Eval(ctx, time.Now().Add(2*time.Minute))
+	require.Len(t, changed, 1)
+	assert.Equal(t, "PollCount", changed[0].Metric)
+	assert.Equal(t, StateFiring, changed[0].State)
+}
+
+func TestEngine_EvalStorageError(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	m := storagemock.NewMockStorage(ctrl)
+
+	rules, err := ParseRules([]byte(`{"rules": [{"name": "PollCountHigh", "expr": "PollCount", "op": ">", "threshold": 1}]}`))
+	require.NoError(t, err)
+	e := NewEngine(m, rules)
+
+	gomock.InOrder(
+		m.EXPECT().GetAllGauges(ctx).Return([]storage.GaugeMetric{}, nil),
+		m.EXPECT().GetAllCounters(ctx).Return([]storage.CounterMetric{{Name: "PollCount", Value: 5}}, nil),
+		m.EXPECT().GetAllGauges(ctx).Return(nil, assert.AnError),
+	)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	changed := e.Eval(ctx, now)
+	require.Len(t, changed, 1)
+	assert.Equal(t, StateFiring, changed[0].State)
+
+	// ошибка чтения не разрешает алерт
+	assert.Empty(t, e.Eval(ctx, now.Add(time.Minute)))
+	alerts := e.Alerts("")
+	require.Len(t, alerts, 1)
+	assert.Equal(t, StateFiring, alerts[0].State)
+}
@@ -0,0 +1,330 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+
+	"github.com/Sofja96/go-metrics.git/internal/models"
+	"github.com/Sofja96/go-metrics.git/internal/utils"
+)
+
+const (
+	retryMax     int           = 3               // максимальное количество повторов доставки
+	retryWaitMin time.Duration = time.Second * 1 // минимальное время ожидания
+	retryWaitMax time.Duration = time.Second * 5 // максимальное время ожидания
+)
+
+// SignatureHeader - заголовок с HMAC-SHA256 тела уведомления, если у получателя задан ключ.
+const SignatureHeader = "HashSHA256"
+
+// Receiver - получатель уведомлений: webhook URL, ключ подписи Key (без подписи, если пуст)
+// и метки GroupBy, по которым алерты одного правила собираются в отдельные уведомления.
+type Receiver struct {
+	Name    string   `json:"name"`
+	URL     string   `json:"url"`
+	Key     string   `json:"key,omitempty"`
+	GroupBy []string `json:"group_by,omitempty"`
+}
+
+// NotifierConfig - получатели уведомлений и период RepeatInterval, с которым повторяются
+// уведомления о продолжающих срабатывать алертах; 0 - не повторять.
+type NotifierConfig struct {
+	Receivers      []Receiver
+	RepeatInterval time.Duration
+}
+
+// LoadNotifierConfig - загружает получателей уведомлений из JSON-файла path вида
+//
+//	{"repeat_interval": "4h", "receivers": [{"name": "chatops", "url": "https://bot.example/alerts",
+//	  "key": "secret", "group_by": ["host"]}]}
+func LoadNotifierConfig(path string) (NotifierConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return NotifierConfig{}, fmt.Errorf("error read alert receivers: %w", err)
+	}
+	return ParseNotifierConfig(data)
+}
+
+// ParseNotifierConfig - разбирает и проверяет получателей в формате файла LoadNotifierConfig.
+func ParseNotifierConfig(data []byte) (NotifierConfig, error) {
+	var file struct {
+		RepeatInterval string     `json:"repeat_interval,omitempty"`
+		Receivers      []Receiver `json:"receivers"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return NotifierConfig{}, fmt.Errorf("error decode alert receivers: %w", err)
+	}
+
+	cfg := NotifierConfig{Receivers: file.Receivers}
+	if file.RepeatInterval != "" {
+		d, err := time.ParseDuration(file.RepeatInterval)
+		if err != nil || d < 0 {
+			return NotifierConfig{}, fmt.Errorf("invalid repeat_interval %q", file.RepeatInterval)
+		}
+		cfg.RepeatInterval = d
+	}
+
+	names := make(map[string]bool, len(cfg.Receivers))
+	for i, r := range cfg.Receivers {
+		if r.Name == "" || r.URL == "" {
+			return NotifierConfig{}, fmt.Errorf("alert receiver %d must have name and url", i+1)
+		}
+		if names[r.Name] {
+			return NotifierConfig{}, fmt.Errorf("duplicate alert receiver %q", r.Name)
+		}
+		names[r.Name] = true
+	}
+	return cfg, nil
+}
+
+// Notification - тело уведомления получателю: сработавшие или разрешившиеся алерты правила Rule
+// с одинаковыми метками группировки GroupLabels. Status - firing, если среди алертов есть
+// сработавшие, иначе resolved.
+type Notification struct {
+	Receiver    string            `json:"receiver"`
+	Status      State             `json:"status"`
+	Rule        string            `json:"rule"`
+	GroupLabels map[string]string `json:"group_labels,omitempty"`
+	Alerts      []Alert           `json:"alerts"`
+}
+
+// delivered - отправленное получателю уведомление о сработавшем алерте.
+type delivered struct {
+	alert Alert
+	at    time.Time
+}
+
+// evaluation - сработавшие на момент now алерты, ожидающие доставки получателю.
+type evaluation struct {
+	now    time.Time
+	firing []Alert
+}
+
+// receiverState - получатель уведомлений, доставленные ему алерты и последнее
+// еще не обработанное вычисление правил.
+type receiverState struct {
+	Receiver
+
+	mu     sync.Mutex
+	sent   map[string]delivered // по ключу алерта
+	next   *evaluation
+	wakeup chan struct{} // сигнал о новом вычислении, буфер 1
+}
+
+// Notifier - доставляет получателям уведомления о сработавших и разрешившихся алертах.
+// Уведомление о сработавшем алерте отправляется один раз (и повторно через RepeatInterval),
+// о разрешившемся - только если получатель знал о срабатывании. Заглушенные алерты не отправляются.
+// Неудачная доставка повторяется при следующем вычислении правил. Доставку выполняет Run.
+type Notifier struct {
+	cfg       NotifierConfig
+	silences  *Silences
+	client    *retryablehttp.Client
+	receivers []*receiverState
+}
+
+// NewNotifier - создает доставщика уведомлений получателям cfg с учетом заглушений silences (может быть nil).
+func NewNotifier(cfg NotifierConfig, silences *Silences) *Notifier {
+	client := retryablehttp.NewClient()
+	client.RetryMax = retryMax
+	client.RetryWaitMin = retryWaitMin
+	client.RetryWaitMax = retryWaitMax
+	client.Backoff = linearBackoff
+
+	receivers := make([]*receiverState, 0, len(cfg.Receivers))
+	for _, r := range cfg.Receivers {
+		receivers = append(receivers, &receiverState{Receiver: r, sent: make(map[string]delivered), wakeup: make(chan struct{}, 1)})
+	}
+	return &Notifier{cfg: cfg, silences: silences, client: client, receivers: receivers}
+}
+
+// linearBackoff - время ожидания перед повтором доставки, растущее линейно с номером попытки.
+func linearBackoff(wait, _ time.Duration, attemptNum int, _ *http.Response) time.Duration {
+	return wait + wait*time.Duration(2*attemptNum)
+}
+
+// Notify - передает получателям сработавшие на момент now алерты firing и сразу возвращается,
+// не дожидаясь доставки. Пока получатель занят доставкой, более позднее вычисление заменяет
+// не обработанное им: уведомления по нему все равно строятся от полного списка сработавших алертов.
+func (n *Notifier) Notify(now time.Time, firing []Alert) {
+	for _, r := range n.receivers {
+		r.mu.Lock()
+		r.next = &evaluation{now: now, firing: firing}
+		r.mu.Unlock()
+
+		select {
+		case r.wakeup <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run - доставляет уведомления, переданные Notify, до отмены контекста. Каждый получатель
+// обслуживается своей горутиной, поэтому медленный получатель не задерживает остальных.
+// Возвращается после завершения начатых доставок.
+func (n *Notifier) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, r := range n.receivers {
+		wg.Add(1)
+		go func(r *receiverState) {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-r.wakeup:
+				}
+
+				r.mu.Lock()
+				e := r.next
+				r.next = nil
+				r.mu.Unlock()
+				if e != nil {
+					n.notifyReceiver(ctx, r, e.now, e.firing)
+				}
+			}
+		}(r)
+	}
+	wg.Wait()
+}
+
+// notifyReceiver - сверяет сработавшие на момент now алерты firing с уже доставленными получателю r
+// и отправляет уведомления о новых, повторяемых и разрешившихся алертах. Доставленные алерты
+// читаются и обновляются под блокировкой получателя, сама отправка выполняется без нее.
+func (n *Notifier) notifyReceiver(ctx context.Context, r *receiverState, now time.Time, firing []Alert) {
+	for _, notification := range groupAlerts(r.Receiver, n.pending(r, now, firing)) {
+		if err := n.send(ctx, r.Receiver, notification); err != nil {
+			log.Printf("error notify receiver %s: %v", r.Name, err)
+			continue
+		}
+		r.markDelivered(notification.Alerts, now)
+	}
+}
+
+// pending - алерты, о которых нужно уведомить получателя r на момент now.
+func (n *Notifier) pending(r *receiverState, now time.Time, firing []Alert) []Alert {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	active := make(map[string]bool, len(firing))
+	var pending []Alert
+	for _, a := range firing {
+		key := alertKey(a)
+		active[key] = true
+		if n.silences != nil && n.silences.Silenced(a, now) {
+			continue
+		}
+		if d, ok := r.sent[key]; ok && (n.cfg.RepeatInterval == 0 || now.Sub(d.at) < n.cfg.RepeatInterval) {
+			continue
+		}
+		pending = append(pending, a)
+	}
+	for key, d := range r.sent {
+		if active[key] {
+			continue
+		}
+		a := d.alert
+		a.State = StateResolved
+		a.ResolvedAt = &now
+		pending = append(pending, a)
+	}
+	return pending
+}
+
+// markDelivered - отмечает алерты, уведомление о которых доставлено на момент now. Состояние,
+// обновленное более поздним вызовом Notify за время доставки, не перезаписывается.
+func (r *receiverState) markDelivered(alerts []Alert, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, a := range alerts {
+		key := alertKey(a)
+		d, ok := r.sent[key]
+		if ok && d.at.After(now) {
+			continue
+		}
+		if a.State == StateResolved {
+			delete(r.sent, key)
+		} else {
+			r.sent[key] = delivered{alert: a, at: now}
+		}
+	}
+}
+
+// groupAlerts - собирает алерты в уведомления получателю r по правилу и меткам группировки.
+func groupAlerts(r Receiver, alerts []Alert) []Notification {
+	groups := make(map[string]*Notification)
+	var keys []string
+	for _, a := range alerts {
+		var labels map[string]string
+		for _, label := range r.GroupBy {
+			if v, ok := a.Labels[label]; ok {
+				if labels == nil {
+					labels = make(map[string]string, len(r.GroupBy))
+				}
+				labels[label] = v
+			}
+		}
+
+		key := models.SeriesKey(a.Rule, labels)
+		g, ok := groups[key]
+		if !ok {
+			g = &Notification{Receiver: r.Name, Status: StateResolved, Rule: a.Rule, GroupLabels: labels}
+			groups[key] = g
+			keys = append(keys, key)
+		}
+		if a.State == StateFiring {
+			g.Status = StateFiring
+		}
+		g.Alerts = append(g.Alerts, a)
+	}
+
+	sort.Strings(keys)
+	notifications := make([]Notification, 0, len(keys))
+	for _, key := range keys {
+		sortAlerts(groups[key].Alerts)
+		notifications = append(notifications, *groups[key])
+	}
+	return notifications
+}
+
+// send - отправляет уведомление получателю r с повторами при ошибках соединения и ответах 5xx.
+func (n *Notifier) send(ctx context.Context, r Receiver, notification Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("error encode notification: %w", err)
+	}
+
+	req, err := retryablehttp.NewRequestWithContext(ctx, http.MethodPost, r.URL, body)
+	if err != nil {
+		return fmt.Errorf("error create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.Key != "" {
+		req.Header.Set(SignatureHeader, utils.ComputeHmac256([]byte(r.Key), body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error send notification: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// alertKey - идентификатор алерта: правило и серия ряда.
+func alertKey(a Alert) string {
+	return a.Rule + "/" + models.SeriesKey(a.Metric, a.Labels)
+}
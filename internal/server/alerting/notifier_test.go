@@ -0,0 +1,291 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Sofja96/go-metrics.git/internal/utils"
+)
+
+// receiver - тестовый получатель уведомлений, отвечающий статусами codes по очереди (затем 200).
+type receiver struct {
+	t      *testing.T
+	key    string
+	server *httptest.Server
+
+	mu            sync.Mutex
+	codes         []int
+	requests      int
+	notifications []Notification
+}
+
+func newReceiver(t *testing.T, key string, codes ...int) *receiver {
+	r := &receiver{t: t, key: key, codes: codes}
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.requests++
+		if len(r.codes) > 0 {
+			code := r.codes[0]
+			r.codes = r.codes[1:]
+			if code != http.StatusOK {
+				w.WriteHeader(code)
+				return
+			}
+		}
+
+		if r.key != "" {
+			assert.Equal(t, utils.ComputeHmac256([]byte(r.key), body), req.Header.Get(SignatureHeader))
+		} else {
+			assert.Empty(t, req.Header.Get(SignatureHeader))
+		}
+		var n Notification
+		require.NoError(t, json.Unmarshal(body, &n))
+		r.notifications = append(r.notifications, n)
+	}))
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+// take - возвращает и сбрасывает полученные уведомления.
+func (r *receiver) take() []Notification {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := r.notifications
+	r.notifications = nil
+	return n
+}
+
+func newTestNotifier(cfg NotifierConfig, silences *Silences) *Notifier {
+	n := NewNotifier(cfg, silences)
+	n.client.RetryWaitMin = time.Millisecond
+	n.client.RetryWaitMax = 5 * time.Millisecond
+	n.client.Logger = nil
+	return n
+}
+
+// deliver - синхронно доставляет получателям n уведомления об алертах firing на момент now.
+func deliver(ctx context.Context, n *Notifier, now time.Time, firing []Alert) {
+	for _, r := range n.receivers {
+		n.notifyReceiver(ctx, r, now, firing)
+	}
+}
+
+func firingAlert(rule, host, env string) Alert {
+	return Alert{Rule: rule, Metric: "HeapInuse", Labels: map[string]string{"host": host, "env": env},
+		Value: 200, State: StateFiring}
+}
+
+func TestNotifier_Notify(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	grouped := newReceiver(t, "secret")
+	plain := newReceiver(t, "")
+	n := newTestNotifier(NotifierConfig{
+		RepeatInterval: time.Hour,
+		Receivers: []Receiver{
+			{Name: "grouped", URL: grouped.server.URL, Key: "secret", GroupBy: []string{"env"}},
+			{Name: "plain", URL: plain.server.URL},
+		},
+	}, nil)
+
+	a := firingAlert("HeapInuseHigh", "a", "prod")
+	b := firingAlert("HeapInuseHigh", "b", "prod")
+	c := firingAlert("HeapInuseHigh", "c", "dev")
+	deliver(ctx, n, now, []Alert{a, b, c})
+
+	// группы по env у получателя grouped, одна группа правила у plain
+	got := grouped.take()
+	require.Len(t, got, 2)
+	assert.Equal(t, Notification{Receiver: "grouped", Status: StateFiring, Rule: "HeapInuseHigh",
+		GroupLabels: map[string]string{"env": "dev"}, Alerts: []Alert{c}}, got[0])
+	assert.Equal(t, Notification{Receiver: "grouped", Status: StateFiring, Rule: "HeapInuseHigh",
+		GroupLabels: map[string]string{"env": "prod"}, Alerts: []Alert{a, b}}, got[1])
+	got = plain.take()
+	require.Len(t, got, 1)
+	assert.Len(t, got[0].Alerts, 3)
+
+	// уже доставленные алерты не повторяются до RepeatInterval
+	deliver(ctx, n, now.Add(time.Minute), []Alert{a, b, c})
+	assert.Empty(t, grouped.take())
+	assert.Empty(t, plain.take())
+
+	// c разрешился
+	resolvedAt := now.Add(2 * time.Minute)
+	deliver(ctx, n, resolvedAt, []Alert{a, b})
+	got = plain.take()
+	require.Len(t, got, 1)
+	assert.Equal(t, StateResolved, got[0].Status)
+	require.Len(t, got[0].Alerts, 1)
+	assert.Equal(t, "c", got[0].Alerts[0].Labels["host"])
+	assert.Equal(t, StateResolved, got[0].Alerts[0].State)
+	assert.Equal(t, &resolvedAt, got[0].Alerts[0].ResolvedAt)
+	got = grouped.take()
+	require.Len(t, got, 1)
+	assert.Equal(t, map[string]string{"env": "dev"}, got[0].GroupLabels)
+
+	// разрешение отправляется один раз
+	deliver(ctx, n, now.Add(3*time.Minute), []Alert{a, b})
+	assert.Empty(t, plain.take())
+
+	// RepeatInterval истек
+	deliver(ctx, n, now.Add(time.Hour), []Alert{a, b})
+	got = plain.take()
+	require.Len(t, got, 1)
+	assert.Equal(t, []Alert{a, b}, got[0].Alerts)
+}
+
+func TestNotifier_NotifyRetry(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := firingAlert("HeapInuseHigh", "a", "prod")
+
+	t.Run("RetryOnServerError", func(t *testing.T) {
+		r := newReceiver(t, "", http.StatusInternalServerError, http.StatusBadGateway)
+		n := newTestNotifier(NotifierConfig{Receivers: []Receiver{{Name: "r", URL: r.server.URL}}}, nil)
+
+		deliver(ctx, n, now, []Alert{a})
+		assert.Len(t, r.take(), 1)
+		assert.Equal(t, 3, r.requests)
+	})
+
+	t.Run("RedeliverAfterFailure", func(t *testing.T) {
+		r := newReceiver(t, "", http.StatusBadRequest)
+		n := newTestNotifier(NotifierConfig{Receivers: []Receiver{{Name: "r", URL: r.server.URL}}}, nil)
+
+		// 4xx не повторяется в рамках доставки, но алерт остается недоставленным
+		deliver(ctx, n, now, []Alert{a})
+		assert.Empty(t, r.take())
+		assert.Equal(t, 1, r.requests)
+
+		deliver(ctx, n, now.Add(time.Minute), []Alert{a})
+		assert.Len(t, r.take(), 1)
+	})
+}
+
+func TestNotifier_Run(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	received := make(chan struct{}, 1)
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case received <- struct{}{}:
+		default:
+		}
+		<-release
+	}))
+	defer slow.Close()
+	fast := newReceiver(t, "")
+	n := newTestNotifier(NotifierConfig{Receivers: []Receiver{
+		{Name: "slow", URL: slow.URL},
+		{Name: "fast", URL: fast.server.URL},
+	}}, nil)
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		n.Run(ctx)
+	}()
+
+	// Notify не ждет доставки, а медленный получатель не задерживает остальных
+	a := firingAlert("HeapInuseHigh", "a", "prod")
+	notified := make(chan struct{})
+	go func() {
+		defer close(notified)
+		n.Notify(now, []Alert{a})
+		<-received
+		n.Notify(now.Add(time.Second), []Alert{a})
+		n.Notify(now.Add(2*time.Second), nil)
+	}()
+	select {
+	case <-notified:
+	case <-time.After(time.Second):
+		t.Fatal("Notify blocked by delivery in progress")
+	}
+	require.Eventually(t, func() bool {
+		fast.mu.Lock()
+		defer fast.mu.Unlock()
+		return len(fast.notifications) == 2
+	}, time.Second, 5*time.Millisecond)
+	got := fast.take()
+	assert.Equal(t, StateFiring, got[0].Status)
+	assert.Equal(t, StateResolved, got[1].Status)
+
+	close(release)
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not stop")
+	}
+}
+
+func TestNotifier_NotifySilenced(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	r := newReceiver(t, "")
+	silences := NewSilences()
+	_, err := silences.Add(Silence{Labels: map[string]string{"env": "dev"}, EndsAt: now.Add(time.Hour)}, now)
+	require.NoError(t, err)
+	n := newTestNotifier(NotifierConfig{Receivers: []Receiver{{Name: "r", URL: r.server.URL}}}, silences)
+
+	a := firingAlert("HeapInuseHigh", "a", "prod")
+	c := firingAlert("HeapInuseHigh", "c", "dev")
+	deliver(ctx, n, now, []Alert{a, c})
+	got := r.take()
+	require.Len(t, got, 1)
+	assert.Equal(t, []Alert{a}, got[0].Alerts)
+
+	// после окончания заглушения алерт доставляется
+	deliver(ctx, n, now.Add(time.Hour), []Alert{a, c})
+	got = r.take()
+	require.Len(t, got, 1)
+	assert.Equal(t, []Alert{c}, got[0].Alerts)
+}
+
+func TestParseNotifierConfig(t *testing.T) {
+	cfg, err := ParseNotifierConfig([]byte(`{"repeat_interval": "4h", "receivers": [
+		{"name": "chatops", "url": "http://bot.local/alerts", "key": "secret", "group_by": ["host"]}
+	]}`))
+	require.NoError(t, err)
+	assert.Equal(t, NotifierConfig{
+		RepeatInterval: 4 * time.Hour,
+		Receivers: []Receiver{
+			{Name: "chatops", URL: "http://bot.local/alerts", Key: "secret", GroupBy: []string{"host"}},
+		},
+	}, cfg)
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "InvalidJSON", data: `{`},
+		{name: "InvalidRepeatInterval", data: `{"repeat_interval": "soon", "receivers": []}`},
+		{name: "NegativeRepeatInterval", data: `{"repeat_interval": "-1h", "receivers": []}`},
+		{name: "NoURL", data: `{"receivers": [{"name": "chatops"}]}`},
+		{name: "NoName", data: `{"receivers": [{"url": "http://bot.local"}]}`},
+		{name: "Duplicate", data: `{"receivers": [{"name": "a", "url": "http://a"}, {"name": "a", "url": "http://b"}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseNotifierConfig([]byte(tt.data))
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,122 @@
+// Package alerting - правила оповещений по метрикам сервера и отслеживание состояния алертов.
+package alerting
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Sofja96/go-metrics.git/internal/models"
+	"github.com/Sofja96/go-metrics.git/internal/server/query"
+)
+
+// операторы сравнения значения ряда с порогом
+const (
+	opGreater      = ">"
+	opGreaterEqual = ">="
+	opLess         = "<"
+	opLessEqual    = "<="
+	opEqual        = "=="
+	opNotEqual     = "!="
+)
+
+// Rule - правило оповещения: алерт возникает для каждого ряда выражения Expr (см. пакет query),
+// значение которого удовлетворяет сравнению Op с порогом Threshold, и срабатывает, если условие
+// выполняется не меньше For. Labels добавляются к меткам ряда в алерте.
+type Rule struct {
+	Name      string
+	Expr      string
+	Op        string
+	Threshold float64
+	For       time.Duration
+	Labels    map[string]string
+
+	expr query.Expr
+}
+
+// ruleFile - файл правил в формате JSON.
+type ruleFile struct {
+	Rules []struct {
+		Name      string            `json:"name"`
+		Expr      string            `json:"expr"`
+		Op        string            `json:"op"`
+		Threshold float64           `json:"threshold"`
+		For       string            `json:"for,omitempty"`
+		Labels    map[string]string `json:"labels,omitempty"`
+	} `json:"rules"`
+}
+
+// LoadRules - загружает правила из JSON-файла path вида
+//
+//	{"rules": [{"name": "HeapInuseHigh", "expr": "HeapInuse", "op": ">", "threshold": 536870912,
+//	  "for": "2m", "labels": {"severity": "warning"}}]}
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error read alerting rules: %w", err)
+	}
+	return ParseRules(data)
+}
+
+// ParseRules - разбирает и проверяет правила в формате файла LoadRules.
+func ParseRules(data []byte) ([]Rule, error) {
+	var file ruleFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("error decode alerting rules: %w", err)
+	}
+
+	names := make(map[string]bool, len(file.Rules))
+	rules := make([]Rule, 0, len(file.Rules))
+	for i, r := range file.Rules {
+		if r.Name == "" {
+			return nil, fmt.Errorf("alerting rule %d has no name", i+1)
+		}
+		if names[r.Name] {
+			return nil, fmt.Errorf("duplicate alerting rule %q", r.Name)
+		}
+		names[r.Name] = true
+
+		rule := Rule{Name: r.Name, Expr: r.Expr, Op: r.Op, Threshold: r.Threshold, Labels: r.Labels}
+		expr, err := query.Parse(r.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("alerting rule %q: %w", r.Name, err)
+		}
+		rule.expr = expr
+
+		switch r.Op {
+		case opGreater, opGreaterEqual, opLess, opLessEqual, opEqual, opNotEqual:
+		default:
+			return nil, fmt.Errorf("alerting rule %q: invalid comparison %q", r.Name, r.Op)
+		}
+		if r.For != "" {
+			if rule.For, err = time.ParseDuration(r.For); err != nil || rule.For < 0 {
+				return nil, fmt.Errorf("alerting rule %q: invalid for %q", r.Name, r.For)
+			}
+		}
+		if err = models.ValidateLabels(r.Labels); err != nil {
+			return nil, fmt.Errorf("alerting rule %q: %w", r.Name, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// match - проверяет, что значение ряда удовлетворяет условию правила.
+func (r *Rule) match(value float64) bool {
+	switch r.Op {
+	case opGreater:
+		return value > r.Threshold
+	case opGreaterEqual:
+		return value >= r.Threshold
+	case opLess:
+		return value < r.Threshold
+	case opLessEqual:
+		return value <= r.Threshold
+	case opEqual:
+		return value == r.Threshold
+	case opNotEqual:
+		return value != r.Threshold
+	}
+	return false
+}
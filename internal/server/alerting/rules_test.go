@@ -0,0 +1,77 @@
+package alerting
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"rules": [
+		{"name": "HeapInuseHigh", "expr": "HeapInuse", "op": ">", "threshold": 100, "for": "2m", "labels": {"severity": "warning"}},
+		{"name": "PollCountStalled", "expr": "increase(PollCount[1m])", "op": "==", "threshold": 0}
+	]}`), 0o600))
+
+	rules, err := LoadRules(path)
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	assert.Equal(t, "HeapInuseHigh", rules[0].Name)
+	assert.Equal(t, ">", rules[0].Op)
+	assert.Equal(t, 100.0, rules[0].Threshold)
+	assert.Equal(t, 2*time.Minute, rules[0].For)
+	assert.Equal(t, map[string]string{"severity": "warning"}, rules[0].Labels)
+	assert.NotNil(t, rules[0].expr)
+	assert.Zero(t, rules[1].For)
+
+	_, err = LoadRules(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestParseRulesErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+	}{
+		{name: "InvalidJSON", rules: `{"rules": [`},
+		{name: "NoName", rules: `{"rules": [{"expr": "Alloc", "op": ">"}]}`},
+		{name: "Duplicate", rules: `{"rules": [{"name": "A", "expr": "Alloc", "op": ">"}, {"name": "A", "expr": "Alloc", "op": "<"}]}`},
+		{name: "InvalidExpr", rules: `{"rules": [{"name": "A", "expr": "sum(Alloc", "op": ">"}]}`},
+		{name: "InvalidOp", rules: `{"rules": [{"name": "A", "expr": "Alloc", "op": "=>"}]}`},
+		{name: "InvalidFor", rules: `{"rules": [{"name": "A", "expr": "Alloc", "op": ">", "for": "soon"}]}`},
+		{name: "NegativeFor", rules: `{"rules": [{"name": "A", "expr": "Alloc", "op": ">", "for": "-1m"}]}`},
+		{name: "InvalidLabel", rules: `{"rules": [{"name": "A", "expr": "Alloc", "op": ">", "labels": {"1a": "b"}}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseRules([]byte(tt.rules))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestRule_match(t *testing.T) {
+	tests := []struct {
+		op   string
+		want [3]bool // значения 1, 2, 3 при пороге 2
+	}{
+		{op: ">", want: [3]bool{false, false, true}},
+		{op: ">=", want: [3]bool{false, true, true}},
+		{op: "<", want: [3]bool{true, false, false}},
+		{op: "<=", want: [3]bool{true, true, false}},
+		{op: "==", want: [3]bool{false, true, false}},
+		{op: "!=", want: [3]bool{true, false, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.op, func(t *testing.T) {
+			rule := Rule{Op: tt.op, Threshold: 2}
+			for i, value := range []float64{1, 2, 3} {
+				assert.Equal(t, tt.want[i], rule.match(value), value)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package alerting
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Sofja96/go-metrics.git/internal/models"
+)
+
+// ErrInvalidSilence - заглушение не ограничивает алерты или задано с неверным интервалом.
+var ErrInvalidSilence = errors.New("invalid silence")
+
+// Silence - заглушение уведомлений об алертах правила Rule (любого, если не задано), метки
+// которых содержат все Labels, на интервале [StartsAt, EndsAt).
+type Silence struct {
+	ID       string            `json:"id"`
+	Rule     string            `json:"rule,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	StartsAt time.Time         `json:"starts_at"`
+	EndsAt   time.Time         `json:"ends_at"`
+	Comment  string            `json:"comment,omitempty"`
+}
+
+// Matches - проверяет, что заглушение действует на алерт a в момент now.
+func (s Silence) Matches(a Alert, now time.Time) bool {
+	if now.Before(s.StartsAt) || !now.Before(s.EndsAt) {
+		return false
+	}
+	if s.Rule != "" && s.Rule != a.Rule {
+		return false
+	}
+	return models.MatchLabels(a.Labels, s.Labels)
+}
+
+// Silences - набор заглушений. Истекшие заглушения удаляются при изменении и чтении набора.
+type Silences struct {
+	mu       sync.Mutex
+	silences map[string]Silence
+}
+
+// NewSilences - создает пустой набор заглушений.
+func NewSilences() *Silences {
+	return &Silences{silences: make(map[string]Silence)}
+}
+
+// Add - добавляет заглушение на момент now и возвращает его с назначенным идентификатором.
+// Без StartsAt заглушение действует с now. Заглушение должно ограничивать правило или метки
+// и заканчиваться позже now и StartsAt.
+func (s *Silences) Add(silence Silence, now time.Time) (Silence, error) {
+	if silence.Rule == "" && len(silence.Labels) == 0 {
+		return Silence{}, fmt.Errorf("%w: must match rule or labels", ErrInvalidSilence)
+	}
+	if silence.StartsAt.IsZero() {
+		silence.StartsAt = now
+	}
+	if !silence.EndsAt.After(silence.StartsAt) || !silence.EndsAt.After(now) {
+		return Silence{}, fmt.Errorf("%w: must end after its start and now", ErrInvalidSilence)
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return Silence{}, fmt.Errorf("error generate silence id: %w", err)
+	}
+	silence.ID = hex.EncodeToString(id)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune(now)
+	s.silences[silence.ID] = silence
+	return silence, nil
+}
+
+// Delete - удаляет заглушение id; возвращает false, если его нет.
+func (s *Silences) Delete(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.silences[id]; !ok {
+		return false
+	}
+	delete(s.silences, id)
+	return true
+}
+
+// List - возвращает действующие и будущие на момент now заглушения по возрастанию начала.
+func (s *Silences) List(now time.Time) []Silence {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune(now)
+
+	silences := make([]Silence, 0, len(s.silences))
+	for _, silence := range s.silences {
+		silences = append(silences, silence)
+	}
+	sort.Slice(silences, func(i, j int) bool {
+		if !silences[i].StartsAt.Equal(silences[j].StartsAt) {
+			return silences[i].StartsAt.Before(silences[j].StartsAt)
+		}
+		return silences[i].ID < silences[j].ID
+	})
+	return silences
+}
+
+// Silenced - проверяет, что на алерт a в момент now действует хотя бы одно заглушение.
+func (s *Silences) Silenced(a Alert, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, silence := range s.silences {
+		if silence.Matches(a, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// prune - удаляет истекшие на момент now заглушения. Вызывается под блокировкой.
+func (s *Silences) prune(now time.Time) {
+	for id, silence := range s.silences {
+		if !now.Before(silence.EndsAt) {
+			delete(s.silences, id)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSilences(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewSilences()
+
+	byRule, err := s.Add(Silence{Rule: "HeapInuseHigh", EndsAt: now.Add(time.Hour), Comment: "deploy"}, now)
+	require.NoError(t, err)
+	assert.NotEmpty(t, byRule.ID)
+	assert.Equal(t, now, byRule.StartsAt)
+
+	byLabels, err := s.Add(Silence{Labels: map[string]string{"host": "a"},
+		StartsAt: now.Add(time.Minute), EndsAt: now.Add(2 * time.Hour)}, now)
+	require.NoError(t, err)
+	assert.Equal(t, []Silence{byRule, byLabels}, s.List(now))
+
+	tests := []struct {
+		name  string
+		alert Alert
+		at    time.Time
+		want  bool
+	}{
+		{name: "Rule", alert: Alert{Rule: "HeapInuseHigh"}, at: now, want: true},
+		{name: "OtherRule", alert: Alert{Rule: "HeapInuseLow"}, at: now},
+		{name: "LabelsBeforeStart", alert: Alert{Rule: "HeapInuseLow", Labels: map[string]string{"host": "a"}}, at: now},
+		{name: "Labels", alert: Alert{Rule: "HeapInuseLow", Labels: map[string]string{"host": "a"}}, at: now.Add(time.Minute), want: true},
+		{name: "RuleExpired", alert: Alert{Rule: "HeapInuseHigh"}, at: now.Add(time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, s.Silenced(tt.alert, tt.at))
+		})
+	}
+
+	// истекшие заглушения не попадают в список
+	assert.Equal(t, []Silence{byLabels}, s.List(now.Add(time.Hour)))
+
+	assert.True(t, s.Delete(byLabels.ID))
+	assert.False(t, s.Delete(byLabels.ID))
+	assert.Empty(t, s.List(now))
+}
+
+func TestSilences_AddInvalid(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		silence Silence
+	}{
+		{name: "NoMatchers", silence: Silence{EndsAt: now.Add(time.Hour)}},
+		{name: "NoEnd", silence: Silence{Rule: "HeapInuseHigh"}},
+		{name: "EndBeforeStart", silence: Silence{Rule: "HeapInuseHigh", StartsAt: now.Add(2 * time.Hour), EndsAt: now.Add(time.Hour)}},
+		{name: "Expired", silence: Silence{Rule: "HeapInuseHigh", StartsAt: now.Add(-2 * time.Hour), EndsAt: now.Add(-time.Hour)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewSilences().Add(tt.silence, now)
+			assert.ErrorIs(t, err, ErrInvalidSilence)
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"flag"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -27,6 +28,10 @@ func TestLoadConfig(t *testing.T) {
 				"KEY":               "test-key",
 				"CRYPTO_KEY":        "",
 				"TRUSTED_SUBNET":    "127.0.0.0/8",
+				"MAX_CLOCK_SKEW":    "30s",
+				"METRIC_TTL":        "24h,gauge:Heap=1h",
+				"RETENTION":         "raw=24h,1m=30d",
+				"STORE_BACKUPS":     "5",
 			},
 			args: []string{},
 			expected: Config{
@@ -38,6 +43,10 @@ func TestLoadConfig(t *testing.T) {
 				DatabaseDSN:   "",
 				CryptoKey:     "",
 				TrustedSubnet: "127.0.0.0/8",
+				MaxClockSkew:  30 * time.Second,
+				MetricTTL:     "24h,gauge:Heap=1h",
+				Retention:     "raw=24h,1m=30d",
+				StoreBackups:  5,
 			},
 		},
 		{
@@ -58,6 +67,8 @@ func TestLoadConfig(t *testing.T) {
 				Restore:       false,
 				FilePath:      "/tmp/metrics.json",
 				TrustedSubnet: "127.0.0.0/8",
+				MaxClockSkew:  DefaultMaxClockSkew,
+				StoreBackups:  DefaultStoreBackups,
 			},
 		},
 		{
@@ -74,6 +85,167 @@ func TestLoadConfig(t *testing.T) {
 				HashKey:       "",
 				FilePath:      "/tmp/metrics-db.json",
 				Restore:       true,
+				MaxClockSkew:  DefaultMaxClockSkew,
+				StoreBackups:  DefaultStoreBackups,
+			},
+		},
+		{
+			name: "LoadZeroStoreIntervalEnablesWAL",
+			envVars: map[string]string{
+				"STORE_INTERVAL": "0",
+			},
+			args: []string{},
+			expected: Config{
+				Address:       DefaultAddress,
+				StoreInterval: 0,
+				FilePath:      DefaultFilePath,
+				Restore:       true,
+				MaxClockSkew:  DefaultMaxClockSkew,
+				StoreBackups:  DefaultStoreBackups,
+				WALSync:       DefaultWALSync,
+			},
+		},
+		{
+			name: "LoadWALSyncSuccess",
+			envVars: map[string]string{
+				"WAL_SYNC":          "interval",
+				"WAL_SYNC_INTERVAL": "200ms",
+			},
+			args: []string{
+				"-i", "0",
+			},
+			expected: Config{
+				Address:         DefaultAddress,
+				StoreInterval:   0,
+				FilePath:        DefaultFilePath,
+				Restore:         true,
+				MaxClockSkew:    DefaultMaxClockSkew,
+				StoreBackups:    DefaultStoreBackups,
+				WALSync:         "interval",
+				WALSyncInterval: 200 * time.Millisecond,
+			},
+		},
+		{
+			name: "LoadCacheSuccess",
+			envVars: map[string]string{
+				"CACHE_SIZE": "500",
+				"CACHE_TTL":  "30s",
+			},
+			args: []string{},
+			expected: Config{
+				Address:       DefaultAddress,
+				StoreInterval: DefaultStoreInterval,
+				FilePath:      DefaultFilePath,
+				Restore:       true,
+				MaxClockSkew:  DefaultMaxClockSkew,
+				StoreBackups:  DefaultStoreBackups,
+				CacheSize:     500,
+				CacheTTL:      30 * time.Second,
+			},
+		},
+		{
+			name: "LoadAlertingSuccess",
+			envVars: map[string]string{
+				"ALERT_RULES":     "/etc/metrics/rules.json",
+				"ALERT_INTERVAL":  "15s",
+				"ALERT_RECEIVERS": "/etc/metrics/receivers.json",
+			},
+			args: []string{},
+			expected: Config{
+				Address:        DefaultAddress,
+				StoreInterval:  DefaultStoreInterval,
+				FilePath:       DefaultFilePath,
+				Restore:        true,
+				MaxClockSkew:   DefaultMaxClockSkew,
+				StoreBackups:   DefaultStoreBackups,
+				AlertRules:     "/etc/metrics/rules.json",
+				AlertInterval:  15 * time.Second,
+				AlertReceivers: "/etc/metrics/receivers.json",
+			},
+		},
+		{
+			name: "LoadStatsdSuccess",
+			envVars: map[string]string{
+				"STATSD_ADDRESS":        ":8125",
+				"STATSD_FLUSH_INTERVAL": "5s",
+			},
+			args: []string{"-statsd-tcp", ":8126"},
+			expected: Config{
+				Address:             DefaultAddress,
+				StoreInterval:       DefaultStoreInterval,
+				FilePath:            DefaultFilePath,
+				Restore:             true,
+				MaxClockSkew:        DefaultMaxClockSkew,
+				StoreBackups:        DefaultStoreBackups,
+				StatsdAddress:       ":8125",
+				StatsdTCPAddress:    ":8126",
+				StatsdFlushInterval: 5 * time.Second,
+			},
+		},
+		{
+			name: "LoadBoltPathSuccess",
+			envVars: map[string]string{
+				"BOLT_PATH": "/var/lib/metrics/metrics.db",
+			},
+			args: []string{},
+			expected: Config{
+				Address:       DefaultAddress,
+				StoreInterval: DefaultStoreInterval,
+				FilePath:      DefaultFilePath,
+				Restore:       true,
+				MaxClockSkew:  DefaultMaxClockSkew,
+				StoreBackups:  DefaultStoreBackups,
+				BoltPath:      "/var/lib/metrics/metrics.db",
+			},
+		},
+		{
+			name: "LoadStorageURLSuccess",
+			envVars: map[string]string{
+				"STORAGE_URL":  "postgres://metrics@localhost/metrics?sslmode=disable",
+				"DATABASE_DSN": "host=localhost",
+			},
+			args: []string{},
+			expected: Config{
+				Address:       DefaultAddress,
+				StoreInterval: DefaultStoreInterval,
+				FilePath:      DefaultFilePath,
+				Restore:       true,
+				MaxClockSkew:  DefaultMaxClockSkew,
+				StoreBackups:  DefaultStoreBackups,
+				DatabaseDSN:   "host=localhost",
+				StorageURL:    "postgres://metrics@localhost/metrics?sslmode=disable",
+			},
+		},
+		{
+			name: "LoadLegacyDatabaseDSNSuccess",
+			envVars: map[string]string{
+				"DATABASE_DSN": "host=localhost user=metrics password='secret' sslmode=disable",
+			},
+			args: []string{},
+			expected: Config{
+				Address:       DefaultAddress,
+				StoreInterval: DefaultStoreInterval,
+				FilePath:      DefaultFilePath,
+				Restore:       true,
+				MaxClockSkew:  DefaultMaxClockSkew,
+				StoreBackups:  DefaultStoreBackups,
+				DatabaseDSN:   "host=localhost user=metrics password='secret' sslmode=disable",
+			},
+		},
+		{
+			name:    "LoadFileStorageWALSuccess",
+			envVars: map[string]string{},
+			args: []string{
+				"-f", "/tmp/metrics.json",
+				"-i", "0",
+			},
+			expected: Config{
+				Address:      DefaultAddress,
+				FilePath:     "/tmp/metrics.json",
+				Restore:      true,
+				MaxClockSkew: DefaultMaxClockSkew,
+				StoreBackups: DefaultStoreBackups,
+				WALSync:      DefaultWALSync,
 			},
 		},
 		{
@@ -90,6 +262,8 @@ func TestLoadConfig(t *testing.T) {
 				DatabaseDSN:   "",
 				CryptoKey:     "../../private.key",
 				TrustedSubnet: "127.0.0.0/8",
+				MaxClockSkew:  DefaultMaxClockSkew,
+				StoreBackups:  DefaultStoreBackups,
 			},
 		},
 		{
@@ -110,6 +284,8 @@ func TestLoadConfig(t *testing.T) {
 				FilePath:      "/tmp/metrics-db.json",
 				DatabaseDSN:   "",
 				TrustedSubnet: "127.0.0.0/8",
+				MaxClockSkew:  DefaultMaxClockSkew,
+				StoreBackups:  DefaultStoreBackups,
 			},
 		},
 	}
@@ -134,6 +310,22 @@ func TestLoadConfig(t *testing.T) {
 			assert.Equal(t, cfg.Restore, tc.expected.Restore, "expected Restore to be '%t', got '%t'", tc.expected.Restore, cfg.Restore)
 			assert.Equal(t, cfg.DatabaseDSN, tc.expected.DatabaseDSN, "expected DatabaseDSN to be '%s', got '%s'", tc.expected.DatabaseDSN, cfg.DatabaseDSN)
 			assert.Equal(t, cfg.CryptoKey, tc.expected.CryptoKey, "expected CryptoKey to be '%s', got '%s'", tc.expected.CryptoKey, cfg.CryptoKey)
+			assert.Equal(t, tc.expected.MaxClockSkew, cfg.MaxClockSkew)
+			assert.Equal(t, tc.expected.MetricTTL, cfg.MetricTTL)
+			assert.Equal(t, tc.expected.Retention, cfg.Retention)
+			assert.Equal(t, tc.expected.StoreBackups, cfg.StoreBackups)
+			assert.Equal(t, tc.expected.WALSync, cfg.WALSync)
+			assert.Equal(t, tc.expected.WALSyncInterval, cfg.WALSyncInterval)
+			assert.Equal(t, tc.expected.BoltPath, cfg.BoltPath)
+			assert.Equal(t, tc.expected.CacheSize, cfg.CacheSize)
+			assert.Equal(t, tc.expected.CacheTTL, cfg.CacheTTL)
+			assert.Equal(t, tc.expected.AlertRules, cfg.AlertRules)
+			assert.Equal(t, tc.expected.AlertInterval, cfg.AlertInterval)
+			assert.Equal(t, tc.expected.AlertReceivers, cfg.AlertReceivers)
+			assert.Equal(t, tc.expected.StatsdAddress, cfg.StatsdAddress)
+			assert.Equal(t, tc.expected.StatsdTCPAddress, cfg.StatsdTCPAddress)
+			assert.Equal(t, tc.expected.StatsdFlushInterval, cfg.StatsdFlushInterval)
+			assert.Equal(t, tc.expected.StorageURL, cfg.StorageURL)
 			assert.Equal(t, cfg.TrustedSubnet, tc.expected.TrustedSubnet, "expected TrustedSubnet to be '%s', got '%s'", tc.expected.TrustedSubnet, cfg.TrustedSubnet)
 
 			for key := range tc.envVars {
@@ -4,10 +4,12 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"os"
 	"time"
 
 	"github.com/caarlos0/env/v6"
 
+	"github.com/Sofja96/go-metrics.git/internal/replay"
 	"github.com/Sofja96/go-metrics.git/internal/utils"
 )
 
@@ -18,11 +20,42 @@ type Config struct {
 	StoreInterval int    `env:"STORE_INTERVAL"`    // интервал сохранения метрик
 	FilePath      string `env:"FILE_STORAGE_PATH"` // путь к файлу хранилища
 	Restore       bool   `env:"RESTORE"`           // указывает необходимость восстановить данные при старте сервера
+	StoreBackups  int    `env:"STORE_BACKUPS"`     // количество хранимых предыдущих снимков; отрицательное значение отключает их
 	DatabaseDSN   string `env:"DATABASE_DSN"`      // строка подключения к БД
+	BoltPath      string `env:"BOLT_PATH"`         // файл встроенного хранилища bbolt, используется без DATABASE_DSN
+	StorageURL    string `env:"STORAGE_URL"`       // URL хранилища, схема выбирает реализацию; без него хранилище выбирается по DATABASE_DSN, BOLT_PATH и настройкам файла
 	HashKey       string `env:"KEY"`               // ключ аутентификации
 	CryptoKey     string `env:"CRYPTO_KEY"`        // файл с приватным ключом сервера
+	Keyring       string `env:"KEYRING"`           // файл с набором ключей HMAC и RSA с идентификаторами
 	Config        string `env:"CONFIG"`            // файл настроки конфигурации
 	TrustedSubnet string `env:"TRUSTED_SUBNET"`    // доверенная подсеть
+
+	TLSCert        string `env:"TLS_CERT"`        // файл с сертификатом сервера
+	TLSKey         string `env:"TLS_KEY"`         // файл с ключом сертификата сервера
+	TLSClientCA    string `env:"TLS_CLIENT_CA"`   // файл с сертификатом CA клиентов, включает mTLS
+	TrustedClients string `env:"TRUSTED_CLIENTS"` // CN/SAN доверенных клиентов через запятую, заменяет проверку подсети
+
+	MaxClockSkew   time.Duration `env:"MAX_CLOCK_SKEW"`   // допустимое расхождение времени подписанного запроса
+	NonceCacheSize int           `env:"NONCE_CACHE_SIZE"` // количество запоминаемых nonce подписанных запросов
+
+	MetricTTL string `env:"METRIC_TTL"` // время жизни необновляемых серий, например "24h,gauge:Heap=1h"
+	Retention string `env:"RETENTION"`  // политика хранения истории, например "raw=24h,1m=30d,1h=365d"
+
+	WALSync         string        `env:"WAL_SYNC"`          // политика сброса журнала упреждающей записи: always, batch или interval
+	WALSyncInterval time.Duration `env:"WAL_SYNC_INTERVAL"` // период сброса журнала для политики interval
+
+	CacheSize int           `env:"CACHE_SIZE"` // количество серий в кеше чтения перед хранилищем; 0 и пустой CACHE_TTL отключают кеш
+	CacheTTL  time.Duration `env:"CACHE_TTL"`  // время жизни записи кеша чтения; 0 - до изменения серии, недопустимо для общей БД
+
+	AlertRules     string        `env:"ALERT_RULES"`     // JSON-файл правил оповещений; пустой путь отключает оповещения
+	AlertInterval  time.Duration `env:"ALERT_INTERVAL"`  // период вычисления правил оповещений
+	AlertReceivers string        `env:"ALERT_RECEIVERS"` // JSON-файл получателей уведомлений об алертах
+
+	StatsdAddress       string        `env:"STATSD_ADDRESS"`        // адрес и порт UDP-приемника метрик StatsD; пустой адрес отключает прием
+	StatsdTCPAddress    string        `env:"STATSD_TCP_ADDRESS"`    // адрес и порт TCP-приемника метрик StatsD; пустой адрес отключает прием
+	StatsdFlushInterval time.Duration `env:"STATSD_FLUSH_INTERVAL"` // период сброса метрик StatsD в хранилище
+
+	storeIntervalSet bool // интервал сохранения задан явно, в том числе нулевой
 }
 
 const (
@@ -30,6 +63,11 @@ const (
 	DefaultRestore       = true
 	DefaultStoreInterval = 3
 	DefaultFilePath      = "/tmp/metrics-db.json"
+	DefaultStoreBackups  = 2
+	DefaultWALSync       = "always" // политика журнала при STORE_INTERVAL=0
+
+	DefaultMaxClockSkew   = replay.DefaultMaxClockSkew
+	DefaultNonceCacheSize = replay.DefaultCacheSize
 )
 
 // TempConfig Временная структура для десериализации
@@ -39,9 +77,38 @@ type TempConfig struct {
 	StoreInterval string `json:"store_interval"`
 	FilePath      string `json:"store_file"`
 	Restore       bool   `json:"restore"`
+	StoreBackups  int    `json:"store_backups,omitempty"`
 	DatabaseDSN   string `json:"database_dsn,omitempty"`
+	BoltPath      string `json:"bolt_path,omitempty"`
+	StorageURL    string `json:"storage_url,omitempty"`
 	CryptoKey     string `json:"crypto_key,omitempty"`
+	Keyring       string `json:"keyring,omitempty"`
 	TrustedSubnet string `json:"trusted_subnet,omitempty"`
+
+	TLSCert        string `json:"tls_cert,omitempty"`
+	TLSKey         string `json:"tls_key,omitempty"`
+	TLSClientCA    string `json:"tls_client_ca,omitempty"`
+	TrustedClients string `json:"trusted_clients,omitempty"`
+
+	MaxClockSkew   string `json:"max_clock_skew,omitempty"`
+	NonceCacheSize int    `json:"nonce_cache_size,omitempty"`
+
+	MetricTTL string `json:"metric_ttl,omitempty"`
+	Retention string `json:"retention,omitempty"`
+
+	WALSync         string `json:"wal_sync,omitempty"`
+	WALSyncInterval string `json:"wal_sync_interval,omitempty"`
+
+	CacheSize int    `json:"cache_size,omitempty"`
+	CacheTTL  string `json:"cache_ttl,omitempty"`
+
+	AlertRules     string `json:"alert_rules,omitempty"`
+	AlertInterval  string `json:"alert_interval,omitempty"`
+	AlertReceivers string `json:"alert_receivers,omitempty"`
+
+	StatsdAddress       string `json:"statsd_address,omitempty"`
+	StatsdTCPAddress    string `json:"statsd_tcp_address,omitempty"`
+	StatsdFlushInterval string `json:"statsd_flush_interval,omitempty"`
 }
 
 func LoadConfig() (*Config, error) {
@@ -62,12 +129,24 @@ func LoadConfig() (*Config, error) {
 	if cfg.Address == "" {
 		cfg.Address = DefaultAddress
 	}
-	if cfg.StoreInterval == 0 {
+	if !cfg.storeIntervalSet {
 		cfg.StoreInterval = DefaultStoreInterval
 	}
 	if cfg.FilePath == "" {
 		cfg.FilePath = DefaultFilePath
 	}
+	if cfg.StoreBackups == 0 {
+		cfg.StoreBackups = DefaultStoreBackups
+	}
+	if cfg.MaxClockSkew == 0 {
+		cfg.MaxClockSkew = DefaultMaxClockSkew
+	}
+	if cfg.NonceCacheSize == 0 {
+		cfg.NonceCacheSize = DefaultNonceCacheSize
+	}
+	if cfg.WALSync == "" && cfg.StoreInterval == 0 {
+		cfg.WALSync = DefaultWALSync
+	}
 
 	return cfg, nil
 }
@@ -102,26 +181,43 @@ func (cfg *Config) applyFileValues(tempConfig *TempConfig) error {
 		cfg.GrpcAddress = tempConfig.GrpcAddress
 	}
 
-	if cfg.StoreInterval == 0 && tempConfig.StoreInterval != "" {
+	if !cfg.storeIntervalSet && tempConfig.StoreInterval != "" {
 		duration, err := time.ParseDuration(tempConfig.StoreInterval)
 		if err != nil {
 			return fmt.Errorf("invalid report_interval in config file: %w", err)
 		}
 		cfg.StoreInterval = int(duration.Seconds())
+		cfg.storeIntervalSet = true
 	}
 
 	if cfg.FilePath == "" && tempConfig.FilePath != "" {
 		cfg.FilePath = tempConfig.FilePath
 	}
 
+	if cfg.StoreBackups == 0 && tempConfig.StoreBackups != 0 {
+		cfg.StoreBackups = tempConfig.StoreBackups
+	}
+
 	if cfg.DatabaseDSN == "" && tempConfig.DatabaseDSN != "" {
 		cfg.DatabaseDSN = tempConfig.DatabaseDSN
 	}
 
+	if cfg.BoltPath == "" && tempConfig.BoltPath != "" {
+		cfg.BoltPath = tempConfig.BoltPath
+	}
+
+	if cfg.StorageURL == "" && tempConfig.StorageURL != "" {
+		cfg.StorageURL = tempConfig.StorageURL
+	}
+
 	if cfg.CryptoKey == "" && tempConfig.CryptoKey != "" {
 		cfg.CryptoKey = tempConfig.CryptoKey
 	}
 
+	if cfg.Keyring == "" && tempConfig.Keyring != "" {
+		cfg.Keyring = tempConfig.Keyring
+	}
+
 	if tempConfig.Restore != cfg.Restore {
 		cfg.Restore = tempConfig.Restore
 	}
@@ -130,6 +226,98 @@ func (cfg *Config) applyFileValues(tempConfig *TempConfig) error {
 		cfg.TrustedSubnet = tempConfig.TrustedSubnet
 	}
 
+	if cfg.TLSCert == "" && tempConfig.TLSCert != "" {
+		cfg.TLSCert = tempConfig.TLSCert
+	}
+
+	if cfg.TLSKey == "" && tempConfig.TLSKey != "" {
+		cfg.TLSKey = tempConfig.TLSKey
+	}
+
+	if cfg.TLSClientCA == "" && tempConfig.TLSClientCA != "" {
+		cfg.TLSClientCA = tempConfig.TLSClientCA
+	}
+
+	if cfg.TrustedClients == "" && tempConfig.TrustedClients != "" {
+		cfg.TrustedClients = tempConfig.TrustedClients
+	}
+
+	if cfg.MaxClockSkew == 0 && tempConfig.MaxClockSkew != "" {
+		skew, err := time.ParseDuration(tempConfig.MaxClockSkew)
+		if err != nil {
+			return fmt.Errorf("invalid max_clock_skew in config file: %w", err)
+		}
+		cfg.MaxClockSkew = skew
+	}
+
+	if cfg.NonceCacheSize == 0 && tempConfig.NonceCacheSize != 0 {
+		cfg.NonceCacheSize = tempConfig.NonceCacheSize
+	}
+
+	if cfg.MetricTTL == "" && tempConfig.MetricTTL != "" {
+		cfg.MetricTTL = tempConfig.MetricTTL
+	}
+
+	if cfg.Retention == "" && tempConfig.Retention != "" {
+		cfg.Retention = tempConfig.Retention
+	}
+
+	if cfg.WALSync == "" && tempConfig.WALSync != "" {
+		cfg.WALSync = tempConfig.WALSync
+	}
+
+	if cfg.WALSyncInterval == 0 && tempConfig.WALSyncInterval != "" {
+		interval, err := time.ParseDuration(tempConfig.WALSyncInterval)
+		if err != nil {
+			return fmt.Errorf("invalid wal_sync_interval in config file: %w", err)
+		}
+		cfg.WALSyncInterval = interval
+	}
+
+	if cfg.CacheSize == 0 && tempConfig.CacheSize != 0 {
+		cfg.CacheSize = tempConfig.CacheSize
+	}
+
+	if cfg.CacheTTL == 0 && tempConfig.CacheTTL != "" {
+		ttl, err := time.ParseDuration(tempConfig.CacheTTL)
+		if err != nil {
+			return fmt.Errorf("invalid cache_ttl in config file: %w", err)
+		}
+		cfg.CacheTTL = ttl
+	}
+
+	if cfg.AlertRules == "" && tempConfig.AlertRules != "" {
+		cfg.AlertRules = tempConfig.AlertRules
+	}
+
+	if cfg.AlertInterval == 0 && tempConfig.AlertInterval != "" {
+		interval, err := time.ParseDuration(tempConfig.AlertInterval)
+		if err != nil {
+			return fmt.Errorf("invalid alert_interval in config file: %w", err)
+		}
+		cfg.AlertInterval = interval
+	}
+
+	if cfg.AlertReceivers == "" && tempConfig.AlertReceivers != "" {
+		cfg.AlertReceivers = tempConfig.AlertReceivers
+	}
+
+	if cfg.StatsdAddress == "" && tempConfig.StatsdAddress != "" {
+		cfg.StatsdAddress = tempConfig.StatsdAddress
+	}
+
+	if cfg.StatsdTCPAddress == "" && tempConfig.StatsdTCPAddress != "" {
+		cfg.StatsdTCPAddress = tempConfig.StatsdTCPAddress
+	}
+
+	if cfg.StatsdFlushInterval == 0 && tempConfig.StatsdFlushInterval != "" {
+		interval, err := time.ParseDuration(tempConfig.StatsdFlushInterval)
+		if err != nil {
+			return fmt.Errorf("invalid statsd_flush_interval in config file: %w", err)
+		}
+		cfg.StatsdFlushInterval = interval
+	}
+
 	return nil
 }
 
@@ -138,6 +326,9 @@ func (cfg *Config) ApplyEnvVariables() error {
 	if err := env.Parse(cfg); err != nil {
 		return fmt.Errorf("error parsing environment variables: %w", err)
 	}
+	if _, ok := os.LookupEnv("STORE_INTERVAL"); ok {
+		cfg.storeIntervalSet = true
+	}
 
 	return nil
 }
@@ -149,11 +340,39 @@ func (cfg *Config) ParseFlags() {
 	flag.StringVar(&cfg.FilePath, "f", cfg.FilePath, "path file storage to save data")
 	flag.IntVar(&cfg.StoreInterval, "i", cfg.StoreInterval, "interval for saving metrics on the server")
 	flag.BoolVar(&cfg.Restore, "r", cfg.Restore, "need to load data at startup")
+	flag.IntVar(&cfg.StoreBackups, "store-backups", cfg.StoreBackups, "number of previous snapshots to keep, negative disables backups")
 	flag.StringVar(&cfg.DatabaseDSN, "d", cfg.DatabaseDSN, "connect to database")
+	flag.StringVar(&cfg.BoltPath, "bolt-path", cfg.BoltPath, "path to embedded bbolt storage file, used without database")
+	flag.StringVar(&cfg.StorageURL, "storage-url", cfg.StorageURL, "storage url, the scheme selects the backend; overrides database, bolt path and file settings")
 	flag.StringVar(&cfg.HashKey, "k", cfg.HashKey, "key for hash")
 	flag.StringVar(&cfg.CryptoKey, "crypto-key", cfg.CryptoKey, "path for public key file")
+	flag.StringVar(&cfg.Keyring, "keyring", cfg.Keyring, "path for keyring file with key ids")
 	flag.StringVar(&cfg.Config, "c", cfg.Config, "Path to JSON config file")
 	flag.StringVar(&cfg.TrustedSubnet, "t", cfg.TrustedSubnet, "trusted subnet")
+	flag.StringVar(&cfg.TLSCert, "tls-cert", cfg.TLSCert, "path for server certificate file")
+	flag.StringVar(&cfg.TLSKey, "tls-key", cfg.TLSKey, "path for server certificate key file")
+	flag.StringVar(&cfg.TLSClientCA, "tls-client-ca", cfg.TLSClientCA, "path for client CA file, enables mTLS")
+	flag.StringVar(&cfg.TrustedClients, "trusted-clients", cfg.TrustedClients, "CN/SAN of trusted client certificates, replaces trusted subnet")
+	flag.DurationVar(&cfg.MaxClockSkew, "max-clock-skew", cfg.MaxClockSkew, "allowed clock skew of signed requests")
+	flag.IntVar(&cfg.NonceCacheSize, "nonce-cache-size", cfg.NonceCacheSize, "number of remembered nonces of signed requests")
+	flag.StringVar(&cfg.MetricTTL, "metric-ttl", cfg.MetricTTL, "ttl of metrics that are not updated, e.g. 24h,gauge:Heap=1h")
+	flag.StringVar(&cfg.Retention, "retention", cfg.Retention, "history retention policy, e.g. raw=24h,1m=30d,1h=365d; empty keeps raw history only")
+	flag.StringVar(&cfg.WALSync, "wal-sync", cfg.WALSync, "write-ahead log fsync policy: always, batch or interval; empty disables the log unless store interval is 0")
+	flag.DurationVar(&cfg.WALSyncInterval, "wal-sync-interval", cfg.WALSyncInterval, "write-ahead log fsync period for the interval policy")
+	flag.IntVar(&cfg.CacheSize, "cache-size", cfg.CacheSize, "number of series in the read cache in front of storage, 0 with empty ttl disables the cache")
+	flag.DurationVar(&cfg.CacheTTL, "cache-ttl", cfg.CacheTTL, "ttl of read cache entries, 0 keeps entries until the series changes (not allowed with a shared database)")
+	flag.StringVar(&cfg.AlertRules, "alert-rules", cfg.AlertRules, "path to JSON file with alerting rules, empty disables alerting")
+	flag.DurationVar(&cfg.AlertInterval, "alert-interval", cfg.AlertInterval, "alerting rules evaluation period, 0 uses the default 30s")
+	flag.StringVar(&cfg.AlertReceivers, "alert-receivers", cfg.AlertReceivers, "path to JSON file with alert webhook receivers")
+	flag.StringVar(&cfg.StatsdAddress, "statsd", cfg.StatsdAddress, "address and port to receive StatsD metrics over UDP, empty disables")
+	flag.StringVar(&cfg.StatsdTCPAddress, "statsd-tcp", cfg.StatsdTCPAddress, "address and port to receive StatsD metrics over TCP, empty disables")
+	flag.DurationVar(&cfg.StatsdFlushInterval, "statsd-flush-interval", cfg.StatsdFlushInterval, "period of flushing StatsD metrics into storage, 0 uses the default 10s")
 
 	flag.Parse()
+
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "i" {
+			cfg.storeIntervalSet = true
+		}
+	})
 }
@@ -0,0 +1,45 @@
+package grpcserver
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/Sofja96/go-metrics.git/internal/proto"
+	"github.com/Sofja96/go-metrics.git/internal/server/alerting"
+)
+
+// GetAlerts - возвращает активные алерты, при req.State - только в этом состоянии.
+func (s *MetricsServer) GetAlerts(_ context.Context, req *proto.GetAlertsRequest) (*proto.GetAlertsResponse, error) {
+	if s.Alerts == nil {
+		return nil, status.Errorf(codes.Unimplemented, "alerting is not enabled")
+	}
+
+	state := alerting.State(req.GetState())
+	switch state {
+	case "", alerting.StatePending, alerting.StateFiring:
+	default:
+		return nil, status.Errorf(codes.InvalidArgument,
+			"Invalid alert state '%s'. Alert state can only be 'pending' or 'firing'", state)
+	}
+
+	alerts := s.Alerts.Alerts(state)
+	resp := &proto.GetAlertsResponse{Alerts: make([]*proto.Alert, 0, len(alerts))}
+	for _, a := range alerts {
+		alert := &proto.Alert{
+			Rule:     a.Rule,
+			Metric:   a.Metric,
+			Labels:   a.Labels,
+			Value:    a.Value,
+			State:    string(a.State),
+			ActiveAt: timestamppb.New(a.ActiveAt),
+		}
+		if a.FiredAt != nil {
+			alert.FiredAt = timestamppb.New(*a.FiredAt)
+		}
+		resp.Alerts = append(resp.Alerts, alert)
+	}
+	return resp, nil
+}
@@ -0,0 +1,74 @@
+package grpcserver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/Sofja96/go-metrics.git/internal/proto"
+	"github.com/Sofja96/go-metrics.git/internal/server/alerting"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage/memory"
+)
+
+func TestGetAlerts(t *testing.T) {
+	ctx := context.Background()
+	store, err := memory.NewInMemStorage(ctx, 0, "", false)
+	require.NoError(t, err)
+	_, err = store.UpdateGauge(ctx, `HeapInuse{host="agent-1"}`, 200)
+	require.NoError(t, err)
+
+	rules, err := alerting.ParseRules([]byte(`{"rules": [
+		{"name": "HeapInuseHigh", "expr": "HeapInuse", "op": ">", "threshold": 100, "labels": {"severity": "warning"}},
+		{"name": "HeapInuseNonZero", "expr": "HeapInuse", "op": "!=", "threshold": 0, "for": "1h"}
+	]}`))
+	require.NoError(t, err)
+	engine := alerting.NewEngine(store, rules)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	engine.Eval(ctx, now)
+
+	server := &MetricsServer{storage: store, Alerts: engine}
+
+	t.Run("Firing", func(t *testing.T) {
+		resp, err := server.GetAlerts(ctx, &proto.GetAlertsRequest{State: "firing"})
+		require.NoError(t, err)
+		require.Len(t, resp.Alerts, 1)
+		alert := resp.Alerts[0]
+		assert.Equal(t, "HeapInuseHigh", alert.Rule)
+		assert.Equal(t, "HeapInuse", alert.Metric)
+		assert.Equal(t, map[string]string{"host": "agent-1", "severity": "warning"}, alert.Labels)
+		assert.Equal(t, 200.0, alert.Value)
+		assert.Equal(t, now, alert.ActiveAt.AsTime())
+		assert.Equal(t, now, alert.FiredAt.AsTime())
+	})
+
+	t.Run("All", func(t *testing.T) {
+		resp, err := server.GetAlerts(ctx, &proto.GetAlertsRequest{})
+		require.NoError(t, err)
+		require.Len(t, resp.Alerts, 2)
+		assert.Equal(t, "pending", resp.Alerts[1].State)
+		assert.Nil(t, resp.Alerts[1].FiredAt)
+	})
+
+	t.Run("InvalidState", func(t *testing.T) {
+		_, err := server.GetAlerts(ctx, &proto.GetAlertsRequest{State: "unknown"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("StartedServer", func(t *testing.T) {
+		client := startServer(t, &MetricsServer{Alerts: engine}, store)
+		resp, err := client.GetAlerts(ctx, &proto.GetAlertsRequest{State: "firing"})
+		require.NoError(t, err)
+		require.Len(t, resp.Alerts, 1)
+		assert.Equal(t, "HeapInuseHigh", resp.Alerts[0].Rule)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		_, err := (&MetricsServer{storage: store}).GetAlerts(ctx, &proto.GetAlertsRequest{})
+		assert.Equal(t, codes.Unimplemented, status.Code(err))
+	})
+}
@@ -2,37 +2,47 @@ package grpcserver
 
 import (
 	"context"
-	"crypto/rand"
 	"crypto/rsa"
-	"crypto/sha256"
-	"fmt"
 
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
+	"github.com/Sofja96/go-metrics.git/internal/envelope"
+	"github.com/Sofja96/go-metrics.git/internal/keyring"
 	"github.com/Sofja96/go-metrics.git/internal/proto"
 )
 
-// DecryptInterceptor - интерцептор для дешифровки данных, зашифрованных публичным ключом.
+// DecryptInterceptor - интерцептор для дешифровки данных, зашифрованных публичным ключом,
+// с одним приватным ключом.
 func DecryptInterceptor(logger *zap.SugaredLogger, privateKey *rsa.PrivateKey) grpc.UnaryServerInterceptor {
+	return KeyringDecryptInterceptor(logger, keyring.FromKeys(nil, privateKey))
+}
+
+// KeyringDecryptInterceptor - интерцептор для дешифровки данных, зашифрованных публичным ключом.
+// Данные в формате конверта помечаются метаданными envelope.MetadataKey,
+// запросы без них расшифровываются в прежнем блочном режиме. Приватный ключ
+// выбирается по метаданным keyring.CryptoKeyIDHeader. Шифруются только данные
+// UpdateMetricsRequest, остальные запросы передаются обработчику без изменений.
+func KeyringDecryptInterceptor(logger *zap.SugaredLogger, kr *keyring.Keyring) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-		if privateKey == nil {
+		if !kr.HasRSA() {
 			logger.Info("Missing privateKey")
 			return handler(ctx, req)
 		}
 
 		updateReq, ok := req.(*proto.UpdateMetricsRequest)
 		if !ok {
-			logger.Error("Invalid request type")
-			return nil, status.Errorf(codes.InvalidArgument, "invalid request type")
+			return handler(ctx, req)
 		}
 
-		decryptedData, err := DecryptWithPrivateKey(updateReq.CompressedData, privateKey)
+		md, _ := metadata.FromIncomingContext(ctx)
+
+		decryptedData, err := decryptData(logger, md, kr, updateReq.CompressedData)
 		if err != nil {
-			logger.Errorf("Error decrypting data: %v", err)
-			return nil, status.Errorf(codes.Internal, "error decrypting data")
+			return nil, err
 		}
 
 		updateReq.CompressedData = decryptedData
@@ -40,25 +50,63 @@ func DecryptInterceptor(logger *zap.SugaredLogger, privateKey *rsa.PrivateKey) g
 	}
 }
 
-// DecryptWithPrivateKey - функция для дешифровки данных с использованием приватного ключа.
-func DecryptWithPrivateKey(data []byte, privateKey *rsa.PrivateKey) ([]byte, error) {
-	chunkSize := privateKey.Size()
-	var decryptedData []byte
+// DecryptStreamInterceptor - потоковый интерцептор для дешифровки пакетов с одним приватным ключом.
+func DecryptStreamInterceptor(logger *zap.SugaredLogger, privateKey *rsa.PrivateKey) grpc.StreamServerInterceptor {
+	return KeyringDecryptStreamInterceptor(logger, keyring.FromKeys(nil, privateKey))
+}
 
-	for start := 0; start < len(data); start += chunkSize {
-		end := start + chunkSize
-		if end > len(data) {
-			end = len(data)
+// KeyringDecryptStreamInterceptor - потоковый интерцептор для дешифровки пакетов.
+// Режим шифрования и идентификатор ключа задаются метаданными потока и действуют для всех пакетов.
+func KeyringDecryptStreamInterceptor(logger *zap.SugaredLogger, kr *keyring.Keyring) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !kr.HasRSA() {
+			logger.Info("Missing privateKey")
+			return handler(srv, ss)
 		}
-		chunk := data[start:end]
 
-		decryptedChunk, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, chunk, nil)
-		if err != nil {
-			return nil, fmt.Errorf("error decrypting chunk: %w", err)
+		md, _ := metadata.FromIncomingContext(ss.Context())
+
+		return handler(srv, newRecvStream(ss, func(m interface{}) error {
+			batch, ok := m.(*proto.MetricsBatch)
+			if !ok {
+				return nil
+			}
+
+			decryptedData, err := decryptData(logger, md, kr, batch.CompressedData)
+			if err != nil {
+				return err
+			}
+
+			batch.CompressedData = decryptedData
+			return nil
+		}))
+	}
+}
+
+// decryptData - расшифровывает данные в режиме и ключом, заданными метаданными md.
+func decryptData(logger *zap.SugaredLogger, md metadata.MD, kr *keyring.Keyring, data []byte) ([]byte, error) {
+	decrypt := DecryptWithPrivateKey
+	if mode := firstValue(md, envelope.MetadataKey); mode != "" {
+		if mode != envelope.MetadataValue {
+			return nil, status.Errorf(codes.InvalidArgument, "unsupported encryption mode: %s", mode)
 		}
+		decrypt = envelope.Open
+	}
 
-		decryptedData = append(decryptedData, decryptedChunk...)
+	privateKey, ok := kr.PrivateKey(firstValue(md, keyring.CryptoKeyIDHeader))
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown crypto key id")
 	}
 
+	decryptedData, err := decrypt(data, privateKey)
+	if err != nil {
+		logger.Errorf("Error decrypting data: %v", err)
+		return nil, status.Errorf(codes.Internal, "error decrypting data")
+	}
 	return decryptedData, nil
 }
+
+// DecryptWithPrivateKey - функция для дешифровки данных, зашифрованных блоками RSA (прежний режим).
+func DecryptWithPrivateKey(data []byte, privateKey *rsa.PrivateKey) ([]byte, error) {
+	return envelope.DecryptChunked(data, privateKey)
+}
@@ -5,14 +5,20 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
+	"github.com/Sofja96/go-metrics.git/internal/envelope"
+	"github.com/Sofja96/go-metrics.git/internal/keyring"
 	"github.com/Sofja96/go-metrics.git/internal/proto"
+	"github.com/Sofja96/go-metrics.git/internal/utils"
 )
 
 func TestDecryptInterceptor(t *testing.T) {
@@ -39,6 +45,74 @@ func TestDecryptInterceptor(t *testing.T) {
 		assert.NoError(t, err)
 	})
 
+	t.Run("Valid envelope", func(t *testing.T) {
+		data := []byte("test-data")
+		sealed, err := envelope.Seal(data, &privateKey.PublicKey)
+		assert.NoError(t, err)
+
+		ctx := metadata.NewIncomingContext(context.Background(),
+			metadata.Pairs(envelope.MetadataKey, envelope.MetadataValue))
+		req := &proto.UpdateMetricsRequest{CompressedData: sealed}
+
+		_, err = interceptor(ctx, req, nil, func(ctx context.Context, req interface{}) (interface{}, error) {
+			updateReq, ok := req.(*proto.UpdateMetricsRequest)
+			assert.True(t, ok, "Request is not of type UpdateMetricsRequest")
+			assert.Equal(t, string(data), string(updateReq.CompressedData), "Decrypted data mismatch")
+			return &proto.UpdateMetricsResponse{Success: true}, nil
+		})
+		assert.NoError(t, err)
+	})
+
+	t.Run("Crypto key id", func(t *testing.T) {
+		rotatedKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		assert.NoError(t, err)
+
+		keysFile := filepath.Join(t.TempDir(), "keyring.json")
+		keyFile := filepath.Join(t.TempDir(), "rotated.pem")
+		assert.NoError(t, os.WriteFile(keyFile, []byte(utils.PrivateToString(rotatedKey)), 0o600))
+		assert.NoError(t, os.WriteFile(keysFile, []byte(`{"rsa": [{"id": "2025-01", "private_key": "`+keyFile+`"}]}`), 0o600))
+		kr, err := keyring.New("", "", keysFile)
+		assert.NoError(t, err)
+		keyringInterceptor := KeyringDecryptInterceptor(logger, kr)
+
+		data := []byte("test-data")
+		sealed, err := envelope.Seal(data, &rotatedKey.PublicKey)
+		assert.NoError(t, err)
+		req := &proto.UpdateMetricsRequest{CompressedData: sealed}
+
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+			envelope.MetadataKey, envelope.MetadataValue,
+			keyring.CryptoKeyIDHeader, "2025-01",
+		))
+		_, err = keyringInterceptor(ctx, req, nil, func(ctx context.Context, req interface{}) (interface{}, error) {
+			assert.Equal(t, string(data), string(req.(*proto.UpdateMetricsRequest).CompressedData))
+			return &proto.UpdateMetricsResponse{Success: true}, nil
+		})
+		assert.NoError(t, err)
+
+		ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+			envelope.MetadataKey, envelope.MetadataValue,
+			keyring.CryptoKeyIDHeader, "unknown",
+		))
+		_, err = keyringInterceptor(ctx, &proto.UpdateMetricsRequest{CompressedData: sealed}, nil,
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return nil, nil
+			})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("Unsupported encryption mode", func(t *testing.T) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(envelope.MetadataKey, "unknown"))
+		req := &proto.UpdateMetricsRequest{CompressedData: []byte("test-data")}
+
+		_, err := interceptor(ctx, req, nil, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, nil
+		})
+		st, ok := status.FromError(err)
+		assert.True(t, ok, "Expected gRPC status error")
+		assert.Equal(t, codes.InvalidArgument, st.Code())
+	})
+
 	t.Run("Invalid encrypted data", func(t *testing.T) {
 		invalidReq := &proto.UpdateMetricsRequest{CompressedData: []byte("invalid-data")}
 		_, err = interceptor(context.Background(), invalidReq, nil, func(ctx context.Context, req interface{}) (interface{}, error) {
@@ -72,15 +146,14 @@ func TestDecryptInterceptor(t *testing.T) {
 		assert.Equal(t, codes.Internal, st.Code(), "Expected error code Internal")
 	})
 
-	t.Run("Invalid request type", func(t *testing.T) {
-		invalidReq := &proto.UpdateMetricsResponse{}
-		_, err := interceptor(context.Background(), invalidReq, nil, func(ctx context.Context, req interface{}) (interface{}, error) {
-			return nil, nil
+	t.Run("Other request type", func(t *testing.T) {
+		otherReq := &proto.DeleteMetricRequest{Type: "gauge", Name: "HeapAlloc"}
+		resp, err := interceptor(context.Background(), otherReq, nil, func(ctx context.Context, req interface{}) (interface{}, error) {
+			assert.Same(t, otherReq, req)
+			return &proto.DeleteMetricResponse{}, nil
 		})
-		assert.Error(t, err, "Expected error on invalid request type")
-		st, ok := status.FromError(err)
-		assert.True(t, ok, "Expected gRPC status error")
-		assert.Equal(t, codes.InvalidArgument, st.Code(), "Expected error code InvalidArgument,")
+		assert.NoError(t, err, "Other request types should pass through")
+		assert.NotNil(t, resp)
 	})
 	t.Run("Missing private key", func(t *testing.T) {
 		nilInterceptor := DecryptInterceptor(logger, nil) // Создаем интерцептор с nil ключом
@@ -0,0 +1,57 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/Sofja96/go-metrics.git/internal/models"
+	"github.com/Sofja96/go-metrics.git/internal/proto"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+)
+
+// DeleteMetric - удаляет серию метрики или, при req.Prefix, все серии с именами, начинающимися с req.Name.
+func (s *MetricsServer) DeleteMetric(ctx context.Context, req *proto.DeleteMetricRequest) (*proto.DeleteMetricResponse, error) {
+	mType := req.GetType()
+	switch mType {
+	case "gauge", "counter", "histogram", "summary":
+	case "":
+		if req.GetPrefix() {
+			break
+		}
+		fallthrough
+	default:
+		return nil, status.Errorf(codes.InvalidArgument,
+			"Invalid metric type '%s'. Metric type can only be 'gauge', 'counter', 'histogram' or 'summary'", mType)
+	}
+
+	d, ok := s.storage.(storage.Deleter)
+	if !ok {
+		return nil, status.Errorf(codes.Unimplemented, "%v", storage.ErrUnsupported)
+	}
+
+	if req.GetPrefix() {
+		deleted, err := d.DeleteByPrefix(ctx, mType, req.GetName())
+		if errors.Is(err, storage.ErrUnsupported) {
+			return nil, status.Errorf(codes.Unimplemented, "%v", err)
+		}
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "Failed to delete metrics: %v", err)
+		}
+		return &proto.DeleteMetricResponse{Deleted: int64(len(deleted))}, nil
+	}
+
+	ok, err := d.Delete(ctx, mType, models.SeriesKey(req.GetName(), req.GetLabels()))
+	if errors.Is(err, storage.ErrUnsupported) {
+		return nil, status.Errorf(codes.Unimplemented, "%v", err)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to delete metric: %v", err)
+	}
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "Metric '%s' not found", req.GetName())
+	}
+	return &proto.DeleteMetricResponse{Deleted: 1}, nil
+}
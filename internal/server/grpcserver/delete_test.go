@@ -0,0 +1,71 @@
+package grpcserver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/Sofja96/go-metrics.git/internal/proto"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage/memory"
+)
+
+func TestDeleteMetric(t *testing.T) {
+	ctx := context.Background()
+	store, err := memory.NewInMemStorage(ctx, 0, "", false)
+	require.NoError(t, err)
+	server := &MetricsServer{storage: store}
+
+	_, err = store.UpdateGauge(ctx, `Alloc{host="agent-1"}`, 1)
+	require.NoError(t, err)
+	_, err = store.UpdateGauge(ctx, "HeapAlloc", 2)
+	require.NoError(t, err)
+	_, err = store.UpdateGauge(ctx, "HeapInuse", 3)
+	require.NoError(t, err)
+	_, err = store.UpdateCounter(ctx, "HeapCount", 1)
+	require.NoError(t, err)
+
+	t.Run("DeleteSeries", func(t *testing.T) {
+		resp, err := server.DeleteMetric(ctx, &proto.DeleteMetricRequest{
+			Type:   "gauge",
+			Name:   "Alloc",
+			Labels: map[string]string{"host": "agent-1"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), resp.Deleted)
+
+		_, ok := store.GetGaugeValue(ctx, `Alloc{host="agent-1"}`)
+		assert.False(t, ok)
+	})
+
+	t.Run("DeleteUnknownSeries", func(t *testing.T) {
+		_, err := server.DeleteMetric(ctx, &proto.DeleteMetricRequest{Type: "gauge", Name: "Alloc"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("DeleteByPrefixOfType", func(t *testing.T) {
+		resp, err := server.DeleteMetric(ctx, &proto.DeleteMetricRequest{Type: "gauge", Name: "Heap", Prefix: true})
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), resp.Deleted)
+
+		_, ok := store.GetCounterValue(ctx, "HeapCount")
+		assert.True(t, ok, "other types should be kept")
+	})
+
+	t.Run("DeleteByPrefixOfAnyType", func(t *testing.T) {
+		resp, err := server.DeleteMetric(ctx, &proto.DeleteMetricRequest{Name: "Heap", Prefix: true})
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), resp.Deleted)
+	})
+
+	t.Run("InvalidType", func(t *testing.T) {
+		_, err := server.DeleteMetric(ctx, &proto.DeleteMetricRequest{Name: "Alloc"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+		_, err = server.DeleteMetric(ctx, &proto.DeleteMetricRequest{Type: "unknown", Name: "Alloc", Prefix: true})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
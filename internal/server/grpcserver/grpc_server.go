@@ -3,19 +3,29 @@ package grpcserver
 import (
 	"context"
 	"crypto/rsa"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net"
+	"time"
 
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
 
+	"github.com/Sofja96/go-metrics.git/internal/keyring"
 	"github.com/Sofja96/go-metrics.git/internal/models"
 	"github.com/Sofja96/go-metrics.git/internal/proto"
+	"github.com/Sofja96/go-metrics.git/internal/replay"
+	"github.com/Sofja96/go-metrics.git/internal/server/alerting"
 	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage/notify"
 )
 
 type MetricsServer struct {
@@ -23,9 +33,16 @@ type MetricsServer struct {
 	storage       storage.Storage
 	Address       string
 	TrustedSubnet string
-	Logger        *zap.SugaredLogger
-	PrivateKey    *rsa.PrivateKey
-	HashKey       string
+	// TrustedClients - CN/SAN доверенных клиентов; если заданы, заменяют проверку подсети
+	TrustedClients []string
+	TLSConfig      *tls.Config // если задан, сервер принимает только TLS-соединения
+	Logger         *zap.SugaredLogger
+	PrivateKey     *rsa.PrivateKey
+	HashKey        string
+	Keyring        *keyring.Keyring // если задан, используется вместо PrivateKey и HashKey
+	Replay         *replay.Guard
+	Hub            *notify.Hub      // источник изменений для Watch; nil - Watch недоступен
+	Alerts         *alerting.Engine // источник алертов для GetAlerts; nil - оповещения отключены
 }
 
 func NewMetricsServer(storage storage.Storage) *MetricsServer {
@@ -42,19 +59,32 @@ func (s *MetricsServer) GetMetric(ctx context.Context, req *proto.GetMetricReque
 
 	switch mType {
 	case "gauge":
-		value, ok := s.storage.GetGaugeValue(ctx, mName)
+		value, ok := storage.LookupGauge(ctx, s.storage, mName, req.GetLabels())
 		if !ok {
 			return nil, status.Errorf(codes.NotFound, "Gauge metric '%s' not found", mName)
 		}
 		resp.Metric.Value = value
 	case "counter":
-		value, ok := s.storage.GetCounterValue(ctx, mName)
+		value, ok := storage.LookupCounter(ctx, s.storage, mName, req.GetLabels())
 		if !ok {
 			return nil, status.Errorf(codes.NotFound, "Counter metric '%s' not found", mName)
 		}
 		resp.Metric.Delta = value
+	case "histogram":
+		value, ok := storage.LookupHistogram(ctx, s.storage, mName, req.GetLabels())
+		if !ok {
+			return nil, status.Errorf(codes.NotFound, "Histogram metric '%s' not found", mName)
+		}
+		resp.Metric.Histogram = histogramToProto(value)
+	case "summary":
+		value, ok := storage.LookupSummary(ctx, s.storage, mName, req.GetLabels())
+		if !ok {
+			return nil, status.Errorf(codes.NotFound, "Summary metric '%s' not found", mName)
+		}
+		resp.Metric.Summary = summaryToProto(value)
 	default:
-		return nil, status.Errorf(codes.InvalidArgument, "Invalid metric type '%s'. Metric type can only be 'gauge' or 'counter'", mType)
+		return nil, status.Errorf(codes.InvalidArgument,
+			"Invalid metric type '%s'. Metric type can only be 'gauge', 'counter', 'histogram' or 'summary'", mType)
 	}
 
 	return resp, nil
@@ -75,19 +105,49 @@ func (s *MetricsServer) GetAllMetrics(ctx context.Context, _ *emptypb.Empty) (*p
 		return nil, status.Errorf(codes.Internal, "Error fetching counter metrics: %v", err)
 	}
 
+	histograms, err := s.storage.GetAllHistograms(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Error fetching histogram metrics: %v", err)
+	}
+
+	summaries, err := s.storage.GetAllSummaries(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Error fetching summary metrics: %v", err)
+	}
+
 	for _, gauge := range gauges {
 		resp.Metrics = append(resp.Metrics, &proto.Metric{
-			Id:    gauge.Name,
-			Type:  "gauge",
-			Value: gauge.Value,
+			Id:     gauge.Name,
+			Type:   "gauge",
+			Value:  gauge.Value,
+			Labels: gauge.Labels,
 		})
 	}
 
 	for _, counter := range counters {
 		resp.Metrics = append(resp.Metrics, &proto.Metric{
-			Id:    counter.Name,
-			Type:  "counter",
-			Delta: counter.Value,
+			Id:     counter.Name,
+			Type:   "counter",
+			Delta:  counter.Value,
+			Labels: counter.Labels,
+		})
+	}
+
+	for _, histogram := range histograms {
+		resp.Metrics = append(resp.Metrics, &proto.Metric{
+			Id:        histogram.Name,
+			Type:      "histogram",
+			Labels:    histogram.Labels,
+			Histogram: histogramToProto(histogram.Value),
+		})
+	}
+
+	for _, summary := range summaries {
+		resp.Metrics = append(resp.Metrics, &proto.Metric{
+			Id:      summary.Name,
+			Type:    "summary",
+			Labels:  summary.Labels,
+			Summary: summaryToProto(summary.Value),
 		})
 	}
 
@@ -96,18 +156,39 @@ func (s *MetricsServer) GetAllMetrics(ctx context.Context, _ *emptypb.Empty) (*p
 
 func (s *MetricsServer) UpdateMetric(ctx context.Context, req *proto.UpdateMetricRequest) (*proto.UpdateMetricResponse, error) {
 	metric := req.GetMetric()
+	if err := models.ValidateName(metric.GetId()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if err := models.ValidateLabels(metric.GetLabels()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	key := models.SeriesKey(metric.GetId(), metric.GetLabels())
 
 	switch metric.GetType() {
 	case "gauge":
-		_, err := s.storage.UpdateGauge(ctx, metric.GetId(), metric.GetValue())
+		_, err := s.storage.UpdateGauge(ctx, key, metric.GetValue())
 		if err != nil {
 			return nil, status.Errorf(codes.Internal, "Error updating gauge metric '%s': %v", metric.Id, err)
 		}
 	case "counter":
-		_, err := s.storage.UpdateCounter(ctx, metric.GetId(), metric.GetDelta())
+		_, err := s.storage.UpdateCounter(ctx, key, metric.GetDelta())
 		if err != nil {
 			return nil, status.Errorf(codes.Internal, "Error updating counter metric '%s': %v", metric.Id, err)
 		}
+	case "histogram", "summary":
+		m := metricFromProto(metric)
+		if err := models.ValidateDistribution(m); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+		}
+		var err error
+		if m.MType == "histogram" {
+			_, err = s.storage.UpdateHistogram(ctx, key, m.Buckets, m.Observations)
+		} else {
+			_, err = s.storage.UpdateSummary(ctx, key, m.Quantiles, m.Observations)
+		}
+		if err != nil {
+			return nil, status.Errorf(updateErrorCode(err), "Error updating %s metric '%s': %v", m.MType, metric.Id, err)
+		}
 	default:
 		return nil, status.Errorf(codes.NotFound, "unsupported metric type: %s", metric.GetType())
 	}
@@ -115,11 +196,48 @@ func (s *MetricsServer) UpdateMetric(ctx context.Context, req *proto.UpdateMetri
 }
 
 func (s *MetricsServer) UpdateMetrics(ctx context.Context, req *proto.UpdateMetricsRequest) (*proto.UpdateMetricsResponse, error) {
+	if err := s.updateMetrics(ctx, req.GetMetrics()); err != nil {
+		return nil, err
+	}
+
+	return &proto.UpdateMetricsResponse{Success: true}, nil
+}
+
+// StreamMetrics - принимает пакеты метрик из потока агента и подтверждает каждый
+// номером пакета. Ошибка сохранения пакета возвращается в подтверждении и не закрывает
+// поток; ошибки проверки пакетов интерцепторами завершают поток.
+func (s *MetricsServer) StreamMetrics(stream proto.Metrics_StreamMetricsServer) error {
+	for {
+		batch, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		ack := &proto.MetricsAck{Sequence: batch.GetSequence(), Success: true}
+		if err := s.updateMetrics(stream.Context(), batch.GetMetrics()); err != nil {
+			ack.Success = false
+			ack.Error = status.Convert(err).Message()
+		}
+
+		if err := stream.Send(ack); err != nil {
+			return err
+		}
+	}
+}
+
+// updateMetrics - проверяет и сохраняет пакет метрик.
+func (s *MetricsServer) updateMetrics(ctx context.Context, protoMetrics []*proto.Metric) error {
 	var metrics []models.Metrics
-	for _, protoMetric := range req.GetMetrics() {
-		metric := models.Metrics{
-			ID:    protoMetric.GetId(),
-			MType: protoMetric.GetType(),
+	for _, protoMetric := range protoMetrics {
+		metric := metricFromProto(protoMetric)
+		if err := models.ValidateName(metric.ID); err != nil {
+			return status.Errorf(codes.InvalidArgument, "%v", err)
+		}
+		if err := models.ValidateLabels(metric.Labels); err != nil {
+			return status.Errorf(codes.InvalidArgument, "%v", err)
 		}
 
 		switch protoMetric.GetType() {
@@ -129,8 +247,12 @@ func (s *MetricsServer) UpdateMetrics(ctx context.Context, req *proto.UpdateMetr
 		case "gauge":
 			value := protoMetric.GetValue()
 			metric.Value = &value
+		case "histogram", "summary":
+			if err := models.ValidateDistribution(metric); err != nil {
+				return status.Errorf(codes.InvalidArgument, "%v", err)
+			}
 		default:
-			return nil, status.Errorf(codes.NotFound, "unsupported metric type: %s", protoMetric.GetType())
+			return status.Errorf(codes.NotFound, "unsupported metric type: %s", protoMetric.GetType())
 		}
 
 		metrics = append(metrics, metric)
@@ -138,33 +260,132 @@ func (s *MetricsServer) UpdateMetrics(ctx context.Context, req *proto.UpdateMetr
 
 	err := s.storage.BatchUpdate(ctx, metrics)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to batch update metrics: %v", err)
+		return status.Errorf(updateErrorCode(err), "failed to batch update metrics: %v", err)
 	}
 
-	return &proto.UpdateMetricsResponse{Success: true}, nil
+	return nil
+}
+
+// metricFromProto - преобразует метрику из protobuf в модель; значения gauge и counter не копируются.
+func metricFromProto(metric *proto.Metric) models.Metrics {
+	return models.Metrics{
+		ID:           metric.GetId(),
+		MType:        metric.GetType(),
+		Labels:       metric.GetLabels(),
+		Observations: metric.GetObservations(),
+		Buckets:      metric.GetBuckets(),
+		Quantiles:    metric.GetQuantiles(),
+	}
+}
+
+// histogramToProto - преобразует состояние histogram в protobuf.
+func histogramToProto(h models.Histogram) *proto.Histogram {
+	return &proto.Histogram{
+		Bounds: h.Bounds,
+		Counts: h.Counts,
+		Count:  h.Count,
+		Sum:    h.Sum,
+	}
+}
+
+// summaryToProto - преобразует значения summary в protobuf.
+func summaryToProto(sm models.SummaryValue) *proto.Summary {
+	quantiles := make([]*proto.Quantile, 0, len(sm.Quantiles))
+	for _, q := range sm.Quantiles {
+		quantiles = append(quantiles, &proto.Quantile{Quantile: q.Quantile, Value: q.Value})
+	}
+	return &proto.Summary{
+		Quantiles: quantiles,
+		Count:     sm.Count,
+		Sum:       sm.Sum,
+	}
+}
+
+// updateErrorCode - возвращает код gRPC для ошибки обновления метрики.
+func updateErrorCode(err error) codes.Code {
+	if errors.Is(err, models.ErrLayoutMismatch) {
+		return codes.InvalidArgument
+	}
+	return codes.Internal
 }
 
 func (s *MetricsServer) StartGRPCServer(store storage.Storage) {
+	if err := s.ListenAndServe(context.Background(), store); err != nil {
+		log.Fatalf("failed to serve: %v", err)
+	}
+}
+
+// shutdownTimeout - время, которое остановка сервера ждет завершения начатых вызовов.
+// Потоки StreamMetrics агентов не завершаются сами, поэтому по его истечении они прерываются.
+const shutdownTimeout = 5 * time.Second
+
+// ListenAndServe - принимает вызовы на адресе s.Address с хранилищем store до отмены
+// контекста, после чего останавливает сервер и возвращается, когда вызовы завершены.
+func (s *MetricsServer) ListenAndServe(ctx context.Context, store storage.Storage) error {
 	lis, err := net.Listen("tcp", s.Address)
 	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	grpcServer := s.newGRPCServer(store)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		timer := time.AfterFunc(shutdownTimeout, grpcServer.Stop)
+		grpcServer.GracefulStop()
+		timer.Stop()
+	}()
+
+	log.Printf("gRPC server listening at %v", s.Address)
+	err = grpcServer.Serve(lis)
+	cancel()
+	<-stopped
+	return err
+}
+
+// newGRPCServer - создает gRPC-сервер с цепочками интерцепторов по настройкам s
+// и регистрирует на нем s с хранилищем store.
+func (s *MetricsServer) newGRPCServer(store storage.Storage) *grpc.Server {
+	if s.Replay == nil {
+		s.Replay = replay.NewGuard(0, 0)
+	}
+	if s.Keyring == nil {
+		s.Keyring = keyring.FromKeys([]byte(s.HashKey), s.PrivateKey)
 	}
 
-	grpcServer := grpc.NewServer(
+	trustedInterceptor := ValidateTrustedSubnetInterceptor(s.TrustedSubnet, s.Logger)
+	trustedStreamInterceptor := ValidateTrustedSubnetStreamInterceptor(s.TrustedSubnet, s.Logger)
+	if len(s.TrustedClients) != 0 {
+		trustedInterceptor = ValidateTrustedClientInterceptor(s.TrustedClients, s.Logger)
+		trustedStreamInterceptor = ValidateTrustedClientStreamInterceptor(s.TrustedClients, s.Logger)
+	}
+
+	opts := []grpc.ServerOption{
 		grpc.ChainUnaryInterceptor(
 			LoggingInterceptor(s.Logger),
-			ValidateTrustedSubnetInterceptor(s.TrustedSubnet, s.Logger),
-			HMACInterceptor(s.Logger, []byte(s.HashKey)),
-			DecryptInterceptor(s.Logger, s.PrivateKey),
+			trustedInterceptor,
+			KeyringHMACInterceptor(s.Logger, s.Keyring, s.Replay),
+			KeyringDecryptInterceptor(s.Logger, s.Keyring),
 			GzipInterceptor(s.Logger),
 		),
-	)
-	proto.RegisterMetricsServer(grpcServer, NewMetricsServer(store))
+		grpc.ChainStreamInterceptor(
+			LoggingStreamInterceptor(s.Logger),
+			trustedStreamInterceptor,
+			KeyringHMACStreamInterceptor(s.Logger, s.Keyring, s.Replay),
+			KeyringDecryptStreamInterceptor(s.Logger, s.Keyring),
+			GzipStreamInterceptor(s.Logger),
+		),
+	}
+	if s.TLSConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(s.TLSConfig)))
+	}
 
-	reflection.Register(grpcServer)
+	grpcServer := grpc.NewServer(opts...)
+	s.storage = store
+	proto.RegisterMetricsServer(grpcServer, s)
 
-	log.Printf("gRPC server listening at %v", s.Address)
-	if err := grpcServer.Serve(lis); err != nil {
-		log.Fatalf("failed to serve: %v", err)
-	}
+	reflection.Register(grpcServer)
+	return grpcServer
 }
@@ -2,24 +2,58 @@ package grpcserver
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
 	"fmt"
+	"net"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
 	"google.golang.org/protobuf/types/known/emptypb"
 
 	"github.com/Sofja96/go-metrics.git/internal/models"
 	"github.com/Sofja96/go-metrics.git/internal/proto"
+	"github.com/Sofja96/go-metrics.git/internal/server/alerting"
 	"github.com/Sofja96/go-metrics.git/internal/server/storage"
 	"github.com/Sofja96/go-metrics.git/internal/server/storage/memory"
 	storagemock "github.com/Sofja96/go-metrics.git/internal/server/storage/mocks"
 	"github.com/Sofja96/go-metrics.git/internal/utils"
 )
 
+// startServer - запускает в памяти сервер s, собранный как в StartGRPCServer, и возвращает клиента к нему.
+func startServer(t *testing.T, s *MetricsServer, store storage.Storage) proto.MetricsClient {
+	t.Helper()
+	if s.Logger == nil {
+		s.Logger = zap.NewNop().Sugar()
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	grpcServer := s.newGRPCServer(store)
+	go func() { _ = grpcServer.Serve(lis) }()
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return proto.NewMetricsClient(conn)
+}
+
 type mocks struct {
 	storage *storagemock.MockStorage
 }
@@ -117,6 +151,18 @@ func TestUpdateMetric(t *testing.T) {
 		assert.True(t, ok, "Expected gRPC status error")
 		assert.Equal(t, codes.NotFound, st.Code(), "Expected error code NotFound")
 	})
+
+	t.Run("UpdateInvalidMetricName", func(t *testing.T) {
+		req := &proto.UpdateMetricRequest{
+			Metric: &proto.Metric{
+				Id:    "Alloc{host",
+				Type:  "gauge",
+				Value: 1,
+			},
+		}
+		_, err := server.UpdateMetric(context.Background(), req)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
 }
 
 func TestGetMetric(t *testing.T) {
@@ -289,12 +335,28 @@ func TestGetAllMetrics(t *testing.T) {
 			}, nil).
 			Times(1)
 
+		m.storage.EXPECT().
+			GetAllHistograms(gomock.Any()).
+			Return([]storage.HistogramMetric{
+				{Name: "latency", Value: models.Histogram{Bounds: []float64{1}, Counts: []uint64{1, 0}, Count: 1, Sum: 0.5}},
+			}, nil).
+			Times(1)
+
+		m.storage.EXPECT().
+			GetAllSummaries(gomock.Any()).
+			Return([]storage.SummaryMetric{
+				{Name: "size", Value: models.SummaryValue{Quantiles: []models.Quantile{{Quantile: 0.5, Value: 2}}, Count: 1, Sum: 2}},
+			}, nil).
+			Times(1)
+
 		req := &emptypb.Empty{}
 		resp, err := srv.GetAllMetrics(context.Background(), req)
 		assert.NoError(t, err)
-		assert.Len(t, resp.Metrics, 2)
+		assert.Len(t, resp.Metrics, 4)
 		assert.Equal(t, "gauge1", resp.Metrics[0].Id)
 		assert.Equal(t, "counter1", resp.Metrics[1].Id)
+		assert.Equal(t, []uint64{1, 0}, resp.Metrics[2].GetHistogram().GetCounts())
+		assert.Equal(t, 2.0, resp.Metrics[3].GetSummary().GetQuantiles()[0].GetValue())
 	})
 
 	t.Run("GetAllMetrics_GetAllGaugesError", func(t *testing.T) {
@@ -364,3 +426,65 @@ func TestStartGRPCServer(t *testing.T) {
 
 	require.NotNil(t, s)
 }
+
+func TestListenAndServe(t *testing.T) {
+	store, err := memory.NewInMemStorage(context.Background(), 0, "", false)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- (&MetricsServer{Address: "127.0.0.1:0"}).ListenAndServe(ctx, store) }()
+
+	// после отмены контекста сервер останавливается, и хранилище можно закрыть
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(shutdownTimeout + time.Second):
+		t.Fatal("server did not stop")
+	}
+
+	err = (&MetricsServer{Address: "invalid address"}).ListenAndServe(context.Background(), store)
+	assert.Error(t, err)
+}
+
+func TestStartGRPCServer_WithKeys(t *testing.T) {
+	ctx := context.Background()
+	store, err := memory.NewInMemStorage(ctx, 0, "", false)
+	require.NoError(t, err)
+	_, err = store.UpdateGauge(ctx, "HeapAlloc", 200)
+	require.NoError(t, err)
+
+	rules, err := alerting.ParseRules([]byte(`{"rules": [{"name": "HeapAllocHigh", "expr": "HeapAlloc", "op": ">", "threshold": 100}]}`))
+	require.NoError(t, err)
+	engine := alerting.NewEngine(store, rules)
+	engine.Eval(ctx, time.Now())
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	client := startServer(t, &MetricsServer{HashKey: "test-key", PrivateKey: privateKey, Alerts: engine}, store)
+
+	// агент подписывает запросы, поэтому метаданные HashSHA256 приходят и с запросами без данных
+	signed := metadata.AppendToOutgoingContext(ctx, "HashSHA256", "signature")
+
+	t.Run("Query", func(t *testing.T) {
+		resp, err := client.Query(signed, &proto.QueryRequest{Query: "HeapAlloc"})
+		require.NoError(t, err)
+		require.Len(t, resp.Series, 1)
+		assert.Equal(t, 200.0, resp.Series[0].Value)
+	})
+
+	t.Run("GetAlerts", func(t *testing.T) {
+		resp, err := client.GetAlerts(signed, &proto.GetAlertsRequest{})
+		require.NoError(t, err)
+		require.Len(t, resp.Alerts, 1)
+		assert.Equal(t, "HeapAllocHigh", resp.Alerts[0].Rule)
+	})
+
+	t.Run("DeleteMetric", func(t *testing.T) {
+		resp, err := client.DeleteMetric(signed, &proto.DeleteMetricRequest{Type: "gauge", Name: "HeapAlloc"})
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), resp.Deleted)
+	})
+}
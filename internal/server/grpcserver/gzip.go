@@ -41,26 +41,9 @@ func GzipInterceptor(logger *zap.SugaredLogger) grpc.UnaryServerInterceptor {
 				return handler(ctx, req)
 			}
 
-			logger.Infof("Compressed request size: %d bytes", len(metricsReq.CompressedData))
-
-			gz, err := gzip.NewReader(bytes.NewReader(metricsReq.CompressedData))
-			if err != nil {
-				logger.Errorf("Failed to create gzip reader: %v", err)
-				return nil, status.Errorf(codes.InvalidArgument, "failed to decompress request: %v", err)
-			}
-			defer gz.Close()
-
-			decompressedData, err := io.ReadAll(gz)
-			if err != nil {
-				logger.Errorf("Failed to read decompressed data: %v", err)
-				return nil, status.Errorf(codes.InvalidArgument, "failed to read decompressed request: %v", err)
-			}
-			logger.Infof("Decompressed request size: %d bytes", len(decompressedData))
-
-			var protoMetrics []*model.Metric
-			err = json.Unmarshal(decompressedData, &protoMetrics)
+			protoMetrics, err := decompressMetrics(logger, metricsReq.CompressedData)
 			if err != nil {
-				return nil, status.Errorf(codes.Internal, "failed json to model Metrics: %v", err)
+				return nil, err
 			}
 
 			newReq := &model.UpdateMetricsRequest{
@@ -73,3 +56,61 @@ func GzipInterceptor(logger *zap.SugaredLogger) grpc.UnaryServerInterceptor {
 		return handler(ctx, req)
 	}
 }
+
+// GzipStreamInterceptor - потоковый интерцептор для обработки gzip-сжатых пакетов.
+// Сжатие задается метаданными потока и действует для всех пакетов.
+func GzipStreamInterceptor(logger *zap.SugaredLogger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		md, _ := metadata.FromIncomingContext(ss.Context())
+		if encoding := md.Get("content-encoding"); len(encoding) == 0 || encoding[0] != "gzip" {
+			return handler(srv, ss)
+		}
+
+		return handler(srv, newRecvStream(ss, func(m interface{}) error {
+			batch, ok := m.(*model.MetricsBatch)
+			if !ok {
+				logger.Warn("Message is not MetricsBatch, skipping decompression")
+				return nil
+			}
+
+			if len(batch.CompressedData) == 0 {
+				return nil
+			}
+
+			protoMetrics, err := decompressMetrics(logger, batch.CompressedData)
+			if err != nil {
+				return err
+			}
+
+			batch.Metrics = protoMetrics
+			batch.CompressedData = nil
+			return nil
+		}))
+	}
+}
+
+// decompressMetrics - распаковывает сжатые gzip метрики в формате JSON.
+func decompressMetrics(logger *zap.SugaredLogger, data []byte) ([]*model.Metric, error) {
+	logger.Infof("Compressed request size: %d bytes", len(data))
+
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		logger.Errorf("Failed to create gzip reader: %v", err)
+		return nil, status.Errorf(codes.InvalidArgument, "failed to decompress request: %v", err)
+	}
+	defer gz.Close()
+
+	decompressedData, err := io.ReadAll(gz)
+	if err != nil {
+		logger.Errorf("Failed to read decompressed data: %v", err)
+		return nil, status.Errorf(codes.InvalidArgument, "failed to read decompressed request: %v", err)
+	}
+	logger.Infof("Decompressed request size: %d bytes", len(decompressedData))
+
+	var protoMetrics []*model.Metric
+	err = json.Unmarshal(decompressedData, &protoMetrics)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed json to model Metrics: %v", err)
+	}
+	return protoMetrics, nil
+}
@@ -2,9 +2,13 @@ package grpcserver
 
 import (
 	"context"
+	"errors"
+
 	"go.uber.org/zap"
 
+	"github.com/Sofja96/go-metrics.git/internal/keyring"
 	"github.com/Sofja96/go-metrics.git/internal/proto"
+	"github.com/Sofja96/go-metrics.git/internal/replay"
 	"github.com/Sofja96/go-metrics.git/internal/utils"
 
 	"google.golang.org/grpc"
@@ -13,37 +17,110 @@ import (
 	"google.golang.org/grpc/status"
 )
 
-// HMACInterceptor - интерцептор для проверки HMAC-подписи данных.
-func HMACInterceptor(logger *zap.SugaredLogger, key []byte) grpc.UnaryServerInterceptor {
+// HMACInterceptor - интерцептор для проверки HMAC-подписи данных с одним ключом.
+func HMACInterceptor(logger *zap.SugaredLogger, key []byte, guard *replay.Guard) grpc.UnaryServerInterceptor {
+	return KeyringHMACInterceptor(logger, keyring.FromKeys(key, nil), guard)
+}
+
+// KeyringHMACInterceptor - интерцептор для проверки HMAC-подписи данных.
+// Подписываются время отправки, nonce и данные запроса; guard отклоняет устаревшие
+// и повторно отправленные запросы. Ключ выбирается по метаданным keyring.KeyIDHeader.
+// Подписываются только данные UpdateMetricsRequest, остальные запросы передаются
+// обработчику без проверки. Если ключ задан, UpdateMetricsRequest без подписи и
+// UpdateMetricRequest, данные которого не подписываются, отклоняются.
+func KeyringHMACInterceptor(logger *zap.SugaredLogger, kr *keyring.Keyring, guard *replay.Guard) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !kr.HasHMAC() {
+			return handler(ctx, req)
+		}
 
-		md, ok := metadata.FromIncomingContext(ctx)
-		if !ok {
-			return nil, status.Errorf(codes.InvalidArgument, "missing metadata")
+		var updateReq *proto.UpdateMetricsRequest
+		switch r := req.(type) {
+		case *proto.UpdateMetricsRequest:
+			updateReq = r
+		case *proto.UpdateMetricRequest:
+			return nil, status.Errorf(codes.Unauthenticated, "unsigned update request, use UpdateMetrics")
+		default:
+			return handler(ctx, req)
 		}
 
+		md, _ := metadata.FromIncomingContext(ctx)
 		clientHmac := md.Get("HashSHA256")
 		if len(clientHmac) == 0 {
-			return handler(ctx, req)
+			return nil, status.Errorf(codes.Unauthenticated, "missing signature")
 		}
 
-		if len(key) == 0 {
-			return handler(ctx, req)
+		timestamp := firstValue(md, replay.TimestampHeader)
+		nonce := firstValue(md, replay.NonceHeader)
+		if err := verifyHMAC(logger, md, kr, guard, clientHmac[0], timestamp, nonce, updateReq.CompressedData); err != nil {
+			return nil, err
 		}
 
-		updateReq, ok := req.(*proto.UpdateMetricsRequest)
-		if !ok {
-			return nil, status.Errorf(codes.InvalidArgument, "invalid request type")
-		}
+		logger.Infof("Hash is equal. Requests is successfully")
 
-		serverHmac := utils.ComputeHmac256(key, updateReq.CompressedData)
+		return handler(ctx, req)
+	}
+}
+
+// HMACStreamInterceptor - потоковый интерцептор для проверки HMAC-подписи пакетов с одним ключом.
+func HMACStreamInterceptor(logger *zap.SugaredLogger, key []byte, guard *replay.Guard) grpc.StreamServerInterceptor {
+	return KeyringHMACStreamInterceptor(logger, keyring.FromKeys(key, nil), guard)
+}
 
-		if clientHmac[0] != serverHmac {
-			return nil, status.Errorf(codes.Unauthenticated, "HMAC verification failed")
+// KeyringHMACStreamInterceptor - потоковый интерцептор для проверки HMAC-подписи пакетов.
+// В отличие от унарного, подпись, время отправки и nonce передаются в каждом пакете
+// proto.MetricsBatch, а идентификатор ключа - в метаданных потока. Если ключ задан,
+// пакеты без подписи отклоняются.
+func KeyringHMACStreamInterceptor(logger *zap.SugaredLogger, kr *keyring.Keyring, guard *replay.Guard) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		md, _ := metadata.FromIncomingContext(ss.Context())
+
+		return handler(srv, newRecvStream(ss, func(m interface{}) error {
+			batch, ok := m.(*proto.MetricsBatch)
+			if !ok || !kr.HasHMAC() {
+				return nil
+			}
+			if batch.GetHash() == "" {
+				return status.Errorf(codes.Unauthenticated, "missing signature")
+			}
+
+			return verifyHMAC(logger, md, kr, guard, batch.GetHash(), batch.GetTimestamp(), batch.GetNonce(), batch.GetCompressedData())
+		}))
+	}
+}
+
+// verifyHMAC - проверяет подпись clientHmac данных data ключом из метаданных md
+// и отклоняет устаревшие и повторно отправленные данные.
+func verifyHMAC(logger *zap.SugaredLogger, md metadata.MD, kr *keyring.Keyring, guard *replay.Guard,
+	clientHmac, timestamp, nonce string, data []byte) error {
+	key, ok := kr.HMAC(firstValue(md, keyring.KeyIDHeader))
+	if !ok {
+		return status.Errorf(codes.Unauthenticated, "unknown key id")
+	}
+
+	serverHmac := utils.ComputeHmac256(key, replay.Material(timestamp, nonce, data))
+	if clientHmac != serverHmac {
+		return status.Errorf(codes.Unauthenticated, "HMAC verification failed")
+	}
+
+	if err := guard.Check(timestamp, nonce); err != nil {
+		logger.Errorf("Rejected request: %v", err)
+		if errors.Is(err, replay.ErrReplay) {
+			return status.Error(codes.AlreadyExists, err.Error())
 		}
+		if errors.Is(err, replay.ErrCacheFull) {
+			return status.Error(codes.ResourceExhausted, err.Error())
+		}
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
 
-		logger.Infof("Hash is equal. Requests is successfully")
+	return nil
+}
 
-		return handler(ctx, req)
+// firstValue - возвращает первое значение ключа метаданных или пустую строку.
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
 	}
+	return ""
 }
@@ -2,7 +2,9 @@ package grpcserver
 
 import (
 	"context"
+	"strconv"
 	"testing"
+	"time"
 
 	"go.uber.org/zap"
 	"google.golang.org/grpc/codes"
@@ -10,24 +12,32 @@ import (
 	"google.golang.org/grpc/status"
 
 	"github.com/Sofja96/go-metrics.git/internal/proto"
+	"github.com/Sofja96/go-metrics.git/internal/replay"
 	"github.com/Sofja96/go-metrics.git/internal/utils"
 )
 
 func TestHMACInterceptor(t *testing.T) {
 	logger := zap.NewNop().Sugar()
 	key := []byte("test-key")
-	interceptor := HMACInterceptor(logger, key)
+	interceptor := HMACInterceptor(logger, key, replay.NewGuard(time.Minute, 100))
 
 	req := &proto.UpdateMetricsRequest{
 		CompressedData: []byte("test-data"),
 	}
 
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	signed := func(timestamp, nonce string) context.Context {
+		hmac := utils.ComputeHmac256(key, replay.Material(timestamp, nonce, req.CompressedData))
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+			"HashSHA256", hmac,
+			replay.TimestampHeader, timestamp,
+			replay.NonceHeader, nonce,
+		))
+	}
 	hmac := utils.ComputeHmac256(key, req.CompressedData)
 
 	t.Run("ValidHMAC", func(t *testing.T) {
-		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("HashSHA256", hmac))
-
-		_, err := interceptor(ctx, req, nil, func(ctx context.Context, req interface{}) (interface{}, error) {
+		_, err := interceptor(signed(now, "nonce-1"), req, nil, func(ctx context.Context, req interface{}) (interface{}, error) {
 			return &proto.UpdateMetricsResponse{Success: true}, nil
 		})
 
@@ -35,6 +45,39 @@ func TestHMACInterceptor(t *testing.T) {
 			t.Fatalf("Interceptor returned an error: %v", err)
 		}
 	})
+	t.Run("ReplayedRequest", func(t *testing.T) {
+		_, err := interceptor(signed(now, "nonce-1"), req, nil, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return &proto.UpdateMetricsResponse{Success: true}, nil
+		})
+
+		if status.Code(err) != codes.AlreadyExists {
+			t.Fatalf("Expected AlreadyExists error, got %v", err)
+		}
+	})
+	t.Run("StaleTimestamp", func(t *testing.T) {
+		stale := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+		_, err := interceptor(signed(stale, "nonce-2"), req, nil, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return &proto.UpdateMetricsResponse{Success: true}, nil
+		})
+
+		if status.Code(err) != codes.Unauthenticated {
+			t.Fatalf("Expected Unauthenticated error, got %v", err)
+		}
+	})
+	t.Run("UnsignedTimestamp", func(t *testing.T) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+			"HashSHA256", hmac,
+			replay.TimestampHeader, now,
+			replay.NonceHeader, "nonce-3",
+		))
+		_, err := interceptor(ctx, req, nil, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return &proto.UpdateMetricsResponse{Success: true}, nil
+		})
+
+		if status.Code(err) != codes.Unauthenticated {
+			t.Fatalf("Expected Unauthenticated error, got %v", err)
+		}
+	})
 	t.Run("NoHMAC", func(t *testing.T) {
 		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs())
 
@@ -42,8 +85,19 @@ func TestHMACInterceptor(t *testing.T) {
 			return &proto.UpdateMetricsResponse{Success: true}, nil
 		})
 
-		if err != nil {
-			t.Fatalf("Interceptor returned an error: %v", err)
+		if status.Code(err) != codes.Unauthenticated {
+			t.Fatalf("Expected Unauthenticated error, got %v", err)
+		}
+	})
+	t.Run("UnsignedUpdateMetric", func(t *testing.T) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("HashSHA256", hmac))
+
+		_, err := interceptor(ctx, &proto.UpdateMetricRequest{}, nil, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return &proto.UpdateMetricResponse{}, nil
+		})
+
+		if status.Code(err) != codes.Unauthenticated {
+			t.Fatalf("Expected Unauthenticated error, got %v", err)
 		}
 	})
 	t.Run("InvalidHMAC", func(t *testing.T) {
@@ -65,25 +119,38 @@ func TestHMACInterceptor(t *testing.T) {
 			return &proto.UpdateMetricsResponse{Success: true}, nil
 		})
 
-		if status.Code(err) != codes.InvalidArgument {
-			t.Fatalf("Expected InvalidArgument error, got %v", err)
+		if status.Code(err) != codes.Unauthenticated {
+			t.Fatalf("Expected Unauthenticated error, got %v", err)
 		}
 	})
-	t.Run("InvalidRequestType", func(t *testing.T) {
+	t.Run("OtherRequestType", func(t *testing.T) {
 		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("HashSHA256", hmac))
 
-		invalidReq := "invalid-request-type"
+		otherReq := &proto.QueryRequest{Query: "HeapAlloc"}
 
-		_, err := interceptor(ctx, invalidReq, nil, func(ctx context.Context, req interface{}) (interface{}, error) {
-			return &proto.UpdateMetricsResponse{Success: true}, nil
+		_, err := interceptor(ctx, otherReq, nil, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return &proto.QueryResponse{}, nil
 		})
 
-		if status.Code(err) != codes.InvalidArgument {
-			t.Fatalf("Expected InvalidArgument error, got %v", err)
+		if err != nil {
+			t.Fatalf("Interceptor returned an error for other request type: %v", err)
+		}
+	})
+	t.Run("CacheFull", func(t *testing.T) {
+		full := HMACInterceptor(logger, key, replay.NewGuard(time.Minute, 1))
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			return &proto.UpdateMetricsResponse{Success: true}, nil
+		}
+
+		if _, err := full(signed(now, "nonce-5"), req, nil, handler); err != nil {
+			t.Fatalf("Interceptor returned an error: %v", err)
+		}
+		if _, err := full(signed(now, "nonce-6"), req, nil, handler); status.Code(err) != codes.ResourceExhausted {
+			t.Fatalf("Expected ResourceExhausted error, got %v", err)
 		}
 	})
 	t.Run("EmptyKey", func(t *testing.T) {
-		emptyKeyInterceptor := HMACInterceptor(logger, []byte{}) // Создаем интерцептор с пустым ключом
+		emptyKeyInterceptor := HMACInterceptor(logger, []byte{}, replay.NewGuard(0, 0)) // Создаем интерцептор с пустым ключом
 
 		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("HashSHA256", hmac))
 
@@ -46,3 +46,59 @@ func LoggingInterceptor(logger *zap.SugaredLogger) grpc.UnaryServerInterceptor {
 		return resp, err
 	}
 }
+
+// LoggingStreamInterceptor - интерцептор для логирования потоковых вызовов.
+// Пишет в лог открытие потока, а при его завершении - длительность, статус
+// и количество полученных и отправленных сообщений.
+func LoggingStreamInterceptor(logger *zap.SugaredLogger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		logger.Infof("gRPC stream %s opened", info.FullMethod)
+
+		md, ok := metadata.FromIncomingContext(ss.Context())
+		if ok {
+			logger.Infof("Metadata: %v", md)
+		}
+
+		counted := &countingStream{ServerStream: ss}
+		err := handler(srv, counted)
+
+		st, _ := status.FromError(err)
+		duration := time.Since(start)
+
+		if err != nil {
+			logger.Errorf("gRPC stream %s failed with code %s: %s, duration: %s, received: %d, sent: %d",
+				info.FullMethod, st.Code(), st.Message(), duration, counted.received, counted.sent)
+			return err
+		}
+		logger.Infof("gRPC stream %s closed, duration: %s, status: %s, received: %d, sent: %d",
+			info.FullMethod, duration, st.Code().String(), counted.received, counted.sent)
+
+		return nil
+	}
+}
+
+// countingStream - обертка над grpc.ServerStream, считающая сообщения потока.
+type countingStream struct {
+	grpc.ServerStream
+	received int
+	sent     int
+}
+
+// RecvMsg - получает сообщение и увеличивает счетчик полученных.
+func (s *countingStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.received++
+	}
+	return err
+}
+
+// SendMsg - отправляет сообщение и увеличивает счетчик отправленных.
+func (s *countingStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.sent++
+	}
+	return err
+}
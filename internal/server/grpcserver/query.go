@@ -0,0 +1,42 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/Sofja96/go-metrics.git/internal/proto"
+	"github.com/Sofja96/go-metrics.git/internal/server/query"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+)
+
+// Query - вычисляет выражение языка запросов (см. пакет query) над текущими значениями и историей метрик.
+func (s *MetricsServer) Query(ctx context.Context, req *proto.QueryRequest) (*proto.QueryResponse, error) {
+	result, err := query.Exec(ctx, s.storage, req.GetQuery(), time.Now())
+	if errors.Is(err, query.ErrSyntax) {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if errors.Is(err, storage.ErrUnsupported) {
+		return nil, status.Errorf(codes.Unimplemented, "%v", err)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to execute query: %v", err)
+	}
+
+	resp := &proto.QueryResponse{
+		Time:   timestamppb.New(result.Time),
+		Series: make([]*proto.Series, 0, len(result.Series)),
+	}
+	for _, series := range result.Series {
+		resp.Series = append(resp.Series, &proto.Series{
+			Name:   series.Name,
+			Labels: series.Labels,
+			Value:  series.Value,
+		})
+	}
+	return resp, nil
+}
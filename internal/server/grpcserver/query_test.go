@@ -0,0 +1,51 @@
+package grpcserver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/Sofja96/go-metrics.git/internal/proto"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage/memory"
+)
+
+func TestQuery(t *testing.T) {
+	ctx := context.Background()
+	store, err := memory.NewInMemStorage(ctx, 0, "", false)
+	require.NoError(t, err)
+	server := &MetricsServer{storage: store}
+
+	_, err = store.UpdateGauge(ctx, `Alloc{host="agent-1"}`, 1)
+	require.NoError(t, err)
+	_, err = store.UpdateGauge(ctx, `Alloc{host="agent-2"}`, 2)
+	require.NoError(t, err)
+	_, err = store.UpdateGauge(ctx, "HeapAlloc", 4)
+	require.NoError(t, err)
+
+	t.Run("Selector", func(t *testing.T) {
+		resp, err := server.Query(ctx, &proto.QueryRequest{Query: `Alloc{host="agent-2"}`})
+		require.NoError(t, err)
+		require.Len(t, resp.Series, 1)
+		assert.Equal(t, "Alloc", resp.Series[0].Name)
+		assert.Equal(t, map[string]string{"host": "agent-2"}, resp.Series[0].Labels)
+		assert.Equal(t, 2.0, resp.Series[0].Value)
+		assert.NotNil(t, resp.Time)
+	})
+
+	t.Run("Aggregation", func(t *testing.T) {
+		resp, err := server.Query(ctx, &proto.QueryRequest{Query: "sum(*Alloc)"})
+		require.NoError(t, err)
+		require.Len(t, resp.Series, 1)
+		assert.Empty(t, resp.Series[0].Name)
+		assert.Equal(t, 7.0, resp.Series[0].Value)
+	})
+
+	t.Run("InvalidQuery", func(t *testing.T) {
+		_, err := server.Query(ctx, &proto.QueryRequest{Query: "sum(Alloc"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
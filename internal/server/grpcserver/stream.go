@@ -0,0 +1,26 @@
+package grpcserver
+
+import (
+	"google.golang.org/grpc"
+)
+
+// recvStream - обертка над grpc.ServerStream, которая обрабатывает каждое полученное
+// сообщение функцией recv. Потоковые интерцепторы применяют через нее к пакетам
+// потока те же проверки и преобразования, что унарные - к запросам.
+type recvStream struct {
+	grpc.ServerStream
+	recv func(m interface{}) error
+}
+
+// newRecvStream - оборачивает поток ss.
+func newRecvStream(ss grpc.ServerStream, recv func(m interface{}) error) *recvStream {
+	return &recvStream{ServerStream: ss, recv: recv}
+}
+
+// RecvMsg - получает сообщение и обрабатывает его.
+func (s *recvStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.recv(m)
+}
@@ -0,0 +1,181 @@
+package grpcserver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/Sofja96/go-metrics.git/internal/keyring"
+	"github.com/Sofja96/go-metrics.git/internal/models"
+	"github.com/Sofja96/go-metrics.git/internal/proto"
+	"github.com/Sofja96/go-metrics.git/internal/replay"
+	storagemock "github.com/Sofja96/go-metrics.git/internal/server/storage/mocks"
+	"github.com/Sofja96/go-metrics.git/internal/utils"
+)
+
+// startStreamServer - запускает сервер с цепочкой потоковых интерцепторов в памяти
+// и возвращает клиента к нему.
+func startStreamServer(t *testing.T, server *MetricsServer, key []byte) proto.MetricsClient {
+	t.Helper()
+	logger := zap.NewNop().Sugar()
+	kr := keyring.FromKeys(key, nil)
+
+	lis := bufconn.Listen(1 << 20)
+	grpcServer := grpc.NewServer(grpc.ChainStreamInterceptor(
+		LoggingStreamInterceptor(logger),
+		ValidateTrustedSubnetStreamInterceptor("", logger),
+		KeyringHMACStreamInterceptor(logger, kr, replay.NewGuard(time.Minute, 100)),
+		KeyringDecryptStreamInterceptor(logger, kr),
+		GzipStreamInterceptor(logger),
+	))
+	proto.RegisterMetricsServer(grpcServer, server)
+	go func() { _ = grpcServer.Serve(lis) }()
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return proto.NewMetricsClient(conn)
+}
+
+func compressMetrics(t *testing.T, metrics []*proto.Metric) []byte {
+	t.Helper()
+	data, err := json.Marshal(metrics)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err = gz.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestStreamMetrics(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := storagemock.NewMockStorage(ctrl)
+	key := []byte("test-key")
+	client := startStreamServer(t, &MetricsServer{storage: store}, key)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "content-encoding", "gzip")
+	stream, err := client.StreamMetrics(ctx)
+	require.NoError(t, err)
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	batch := func(seq uint64, nonce string, metrics ...*proto.Metric) *proto.MetricsBatch {
+		data := compressMetrics(t, metrics)
+		return &proto.MetricsBatch{
+			Sequence:       seq,
+			CompressedData: data,
+			Hash:           utils.ComputeHmac256(key, replay.Material(now, nonce, data)),
+			Timestamp:      now,
+			Nonce:          nonce,
+		}
+	}
+
+	t.Run("Ack", func(t *testing.T) {
+		store.EXPECT().BatchUpdate(gomock.Any(), []models.Metrics{
+			{ID: "gauge1", MType: "gauge", Value: utils.FloatPtr(1.5)},
+		}).Return(nil)
+
+		require.NoError(t, stream.Send(batch(1, "nonce-1", &proto.Metric{Id: "gauge1", Type: "gauge", Value: 1.5})))
+		ack, err := stream.Recv()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), ack.GetSequence())
+		assert.True(t, ack.GetSuccess())
+	})
+
+	t.Run("StorageErrorKeepsStream", func(t *testing.T) {
+		store.EXPECT().BatchUpdate(gomock.Any(), gomock.Any()).Return(fmt.Errorf("storage error"))
+
+		require.NoError(t, stream.Send(batch(2, "nonce-2", &proto.Metric{Id: "counter1", Type: "counter", Delta: 2})))
+		ack, err := stream.Recv()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), ack.GetSequence())
+		assert.False(t, ack.GetSuccess())
+		assert.Contains(t, ack.GetError(), "storage error")
+
+		store.EXPECT().BatchUpdate(gomock.Any(), gomock.Any()).Return(nil)
+
+		require.NoError(t, stream.Send(batch(3, "nonce-3", &proto.Metric{Id: "counter1", Type: "counter", Delta: 2})))
+		ack, err = stream.Recv()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(3), ack.GetSequence())
+		assert.True(t, ack.GetSuccess())
+	})
+
+	t.Run("ReplayedBatchClosesStream", func(t *testing.T) {
+		require.NoError(t, stream.Send(batch(4, "nonce-3", &proto.Metric{Id: "counter1", Type: "counter", Delta: 2})))
+		_, err := stream.Recv()
+		assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	})
+
+	t.Run("InvalidSignature", func(t *testing.T) {
+		stream, err := client.StreamMetrics(ctx)
+		require.NoError(t, err)
+
+		b := batch(1, "nonce-4", &proto.Metric{Id: "gauge1", Type: "gauge", Value: 1})
+		b.Hash = "invalid"
+		require.NoError(t, stream.Send(b))
+		_, err = stream.Recv()
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("UnsignedBatch", func(t *testing.T) {
+		stream, err := client.StreamMetrics(ctx)
+		require.NoError(t, err)
+
+		b := batch(1, "nonce-5", &proto.Metric{Id: "counter1", Type: "counter", Delta: 2})
+		b.Hash, b.Timestamp, b.Nonce = "", "", ""
+		require.NoError(t, stream.Send(b))
+		_, err = stream.Recv()
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+}
+
+func TestValidateTrustedSubnetStreamInterceptor(t *testing.T) {
+	logger := zap.NewNop().Sugar()
+	interceptor := ValidateTrustedSubnetStreamInterceptor("192.168.1.0/24", logger)
+	handler := func(srv interface{}, stream grpc.ServerStream) error { return nil }
+
+	trusted := &fakeServerStream{ctx: metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-real-ip", "192.168.1.1"))}
+	assert.NoError(t, interceptor(nil, trusted, &grpc.StreamServerInfo{}, handler))
+
+	untrusted := &fakeServerStream{ctx: metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-real-ip", "10.0.0.1"))}
+	assert.Equal(t, codes.PermissionDenied, status.Code(interceptor(nil, untrusted, &grpc.StreamServerInfo{}, handler)))
+}
+
+// fakeServerStream - поток без сообщений с заданным контекстом.
+type fakeServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *fakeServerStream) Context() context.Context {
+	return s.ctx
+}
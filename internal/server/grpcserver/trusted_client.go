@@ -0,0 +1,62 @@
+package grpcserver
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/Sofja96/go-metrics.git/internal/tlsconfig"
+)
+
+// ValidateTrustedClientInterceptor - интерцептор для проверки клиента по CN/SAN сертификата,
+// проверенного при установке mTLS-соединения.
+func ValidateTrustedClientInterceptor(trusted []string, logger *zap.SugaredLogger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := checkTrustedClient(ctx, trusted, logger); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// ValidateTrustedClientStreamInterceptor - потоковый интерцептор для проверки клиента по CN/SAN
+// сертификата; проверка выполняется один раз при открытии потока.
+func ValidateTrustedClientStreamInterceptor(trusted []string, logger *zap.SugaredLogger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := checkTrustedClient(ss.Context(), trusted, logger); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// checkTrustedClient - проверяет, что сертификат клиента выдан на одно из имен trusted.
+func checkTrustedClient(ctx context.Context, trusted []string, logger *zap.SugaredLogger) error {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		logger.Warn("Missing peer info")
+		return status.Errorf(codes.Unauthenticated, "missing peer info")
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		logger.Warn("Connection is not secured with TLS")
+		return status.Errorf(codes.Unauthenticated, "client certificate required")
+	}
+
+	name, ok := tlsconfig.Trusted(&tlsInfo.State, trusted)
+	if !ok {
+		logger.Warn("Access denied: client certificate is not trusted")
+		return status.Errorf(codes.PermissionDenied, "access denied: client certificate is not trusted")
+	}
+
+	logger.Info("Access granted: trusted client ", name)
+
+	return nil
+}
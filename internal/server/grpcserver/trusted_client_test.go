@@ -0,0 +1,78 @@
+package grpcserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestValidateTrustedClientInterceptor(t *testing.T) {
+	logger := zap.NewNop().Sugar()
+	trusted := []string{"agent-1", "agent-2.metrics.local"}
+
+	verified := func(cn string, dnsNames ...string) credentials.AuthInfo {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: cn}, DNSNames: dnsNames}
+		return credentials.TLSInfo{State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}}
+	}
+
+	tests := []struct {
+		name         string
+		peer         *peer.Peer
+		expectedCode codes.Code
+	}{
+		{
+			name:         "Trusted CN",
+			peer:         &peer.Peer{AuthInfo: verified("agent-1")},
+			expectedCode: codes.OK,
+		},
+		{
+			name:         "Trusted SAN",
+			peer:         &peer.Peer{AuthInfo: verified("other", "agent-2.metrics.local")},
+			expectedCode: codes.OK,
+		},
+		{
+			name:         "Untrusted client",
+			peer:         &peer.Peer{AuthInfo: verified("agent-3")},
+			expectedCode: codes.PermissionDenied,
+		},
+		{
+			name:         "No verified certificate",
+			peer:         &peer.Peer{AuthInfo: credentials.TLSInfo{}},
+			expectedCode: codes.PermissionDenied,
+		},
+		{
+			name:         "Insecure connection",
+			peer:         &peer.Peer{},
+			expectedCode: codes.Unauthenticated,
+		},
+		{
+			name:         "Missing peer",
+			expectedCode: codes.Unauthenticated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interceptor := ValidateTrustedClientInterceptor(trusted, logger)
+
+			ctx := context.Background()
+			if tt.peer != nil {
+				ctx = peer.NewContext(ctx, tt.peer)
+			}
+
+			_, err := interceptor(ctx, nil, nil, func(ctx context.Context, req interface{}) (interface{}, error) {
+				return nil, nil
+			})
+			assert.Equal(t, tt.expectedCode, status.Code(err))
+		})
+	}
+}
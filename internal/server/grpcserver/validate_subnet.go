@@ -15,47 +15,67 @@ import (
 // ValidateTrustedSubnetInterceptor - интерцептор для проверки доверенной подсети по заголовку X-Real-IP.
 func ValidateTrustedSubnetInterceptor(trustedSubnet string, logger *zap.SugaredLogger) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-		if trustedSubnet == "" {
-			logger.Info("No trusted subnet configured, skipping validation.")
-			return handler(ctx, req)
+		if err := checkTrustedSubnet(ctx, trustedSubnet, logger); err != nil {
+			return nil, err
 		}
 
-		md, ok := metadata.FromIncomingContext(ctx)
-		if !ok {
-			logger.Warn("Missing metadata")
-			return nil, status.Errorf(codes.Unauthenticated, "missing metadata")
-		}
+		return handler(ctx, req)
+	}
+}
 
-		realIPs := md.Get("x-real-ip")
-		if len(realIPs) == 0 {
-			logger.Warn("Missing X-Real-IP header")
-			return nil, status.Errorf(codes.Unauthenticated, "missing X-Real-IP header")
+// ValidateTrustedSubnetStreamInterceptor - потоковый интерцептор для проверки доверенной подсети
+// по заголовку X-Real-IP; проверка выполняется один раз при открытии потока.
+func ValidateTrustedSubnetStreamInterceptor(trustedSubnet string, logger *zap.SugaredLogger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := checkTrustedSubnet(ss.Context(), trustedSubnet, logger); err != nil {
+			return err
 		}
-		realIP := strings.TrimSpace(realIPs[0])
+		return handler(srv, ss)
+	}
+}
 
-		_, cidr, err := net.ParseCIDR(trustedSubnet)
-		if err != nil {
-			logger.Error("Invalid trusted subnet configuration", "error", err)
-			return nil, status.Errorf(codes.Internal, "invalid trusted subnet configuration")
-		}
+// checkTrustedSubnet - проверяет, что адрес из метаданных X-Real-IP входит в доверенную подсеть.
+func checkTrustedSubnet(ctx context.Context, trustedSubnet string, logger *zap.SugaredLogger) error {
+	if trustedSubnet == "" {
+		logger.Info("No trusted subnet configured, skipping validation.")
+		return nil
+	}
 
-		ip := net.ParseIP(realIP)
-		if ip == nil {
-			logger.Warn("Invalid IP address in X-Real-IP header", "ip", realIP)
-			return nil, status.Errorf(codes.Unauthenticated, "invalid IP address in X-Real-IP header")
-		}
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		logger.Warn("Missing metadata")
+		return status.Errorf(codes.Unauthenticated, "missing metadata")
+	}
 
-		if !cidr.Contains(ip) {
-			logger.Warn("Access denied: IP not in trusted subnet",
-				"ip ", ip.String(),
-				" trustedSubnet ", trustedSubnet)
-			return nil, status.Errorf(codes.PermissionDenied, "access denied: IP not in trusted subnet")
-		}
+	realIPs := md.Get("x-real-ip")
+	if len(realIPs) == 0 {
+		logger.Warn("Missing X-Real-IP header")
+		return status.Errorf(codes.Unauthenticated, "missing X-Real-IP header")
+	}
+	realIP := strings.TrimSpace(realIPs[0])
+
+	_, cidr, err := net.ParseCIDR(trustedSubnet)
+	if err != nil {
+		logger.Error("Invalid trusted subnet configuration", "error", err)
+		return status.Errorf(codes.Internal, "invalid trusted subnet configuration")
+	}
+
+	ip := net.ParseIP(realIP)
+	if ip == nil {
+		logger.Warn("Invalid IP address in X-Real-IP header", "ip", realIP)
+		return status.Errorf(codes.Unauthenticated, "invalid IP address in X-Real-IP header")
+	}
 
-		logger.Info("Access granted: IP in trusted subnet",
+	if !cidr.Contains(ip) {
+		logger.Warn("Access denied: IP not in trusted subnet",
 			"ip ", ip.String(),
 			" trustedSubnet ", trustedSubnet)
-
-		return handler(ctx, req)
+		return status.Errorf(codes.PermissionDenied, "access denied: IP not in trusted subnet")
 	}
+
+	logger.Info("Access granted: IP in trusted subnet",
+		"ip ", ip.String(),
+		" trustedSubnet ", trustedSubnet)
+
+	return nil
 }
@@ -0,0 +1,68 @@
+package grpcserver
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/Sofja96/go-metrics.git/internal/models"
+	"github.com/Sofja96/go-metrics.git/internal/proto"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage/notify"
+)
+
+// Watch - отправляет клиенту изменения и удаления метрик, подходящие под фильтр, пока клиент не закроет поток.
+func (s *MetricsServer) Watch(req *proto.WatchRequest, stream proto.Metrics_WatchServer) error {
+	if s.Hub == nil {
+		return status.Errorf(codes.Unimplemented, "watch is not enabled")
+	}
+
+	switch req.GetType() {
+	case "", "gauge", "counter", "histogram", "summary":
+	default:
+		return status.Errorf(codes.InvalidArgument,
+			"Invalid metric type '%s'. Metric type can only be 'gauge', 'counter', 'histogram' or 'summary'", req.GetType())
+	}
+
+	sub := s.Hub.Subscribe(notify.Filter{Prefix: req.GetPrefix(), Type: req.GetType()}, 0)
+	defer sub.Close()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case e, ok := <-sub.C():
+			if !ok {
+				return nil
+			}
+			event := &proto.WatchEvent{
+				Metric:  metricToProto(e.Metrics),
+				Dropped: sub.TakeDropped(),
+				Deleted: e.Deleted,
+			}
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// metricToProto - преобразует состояние метрики в protobuf.
+func metricToProto(m models.Metrics) *proto.Metric {
+	metric := &proto.Metric{
+		Id:     m.ID,
+		Type:   m.MType,
+		Labels: m.Labels,
+	}
+	if m.Value != nil {
+		metric.Value = *m.Value
+	}
+	if m.Delta != nil {
+		metric.Delta = *m.Delta
+	}
+	if m.Histogram != nil {
+		metric.Histogram = histogramToProto(*m.Histogram)
+	}
+	if m.Summary != nil {
+		metric.Summary = summaryToProto(*m.Summary)
+	}
+	return metric
+}
@@ -0,0 +1,66 @@
+package grpcserver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/Sofja96/go-metrics.git/internal/models"
+	"github.com/Sofja96/go-metrics.git/internal/proto"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage/notify"
+	"github.com/Sofja96/go-metrics.git/internal/utils"
+)
+
+func TestWatch(t *testing.T) {
+	hub := notify.NewHub()
+	client := startStreamServer(t, &MetricsServer{Hub: hub}, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := client.Watch(ctx, &proto.WatchRequest{Type: "counter"})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return hub.Subscribers() == 1 }, time.Second, 10*time.Millisecond)
+	hub.Publish(
+		notify.Event{Metrics: models.Metrics{ID: "HeapAlloc", MType: "gauge", Value: utils.FloatPtr(1.5)}},
+		notify.Event{Metrics: models.Metrics{ID: "PollCount", MType: "counter", Delta: utils.IntPtr(7), Labels: map[string]string{"host": "agent-1"}}},
+		notify.Event{Metrics: models.Metrics{ID: "PollCount", MType: "counter"}, Deleted: true},
+	)
+
+	event, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "PollCount", event.GetMetric().GetId())
+	assert.Equal(t, int64(7), event.GetMetric().GetDelta())
+	assert.Equal(t, map[string]string{"host": "agent-1"}, event.GetMetric().GetLabels())
+	assert.Zero(t, event.GetDropped())
+	assert.False(t, event.GetDeleted())
+
+	event, err = stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "PollCount", event.GetMetric().GetId())
+	assert.True(t, event.GetDeleted())
+
+	cancel()
+	require.Eventually(t, func() bool { return hub.Subscribers() == 0 }, time.Second, 10*time.Millisecond)
+
+	t.Run("InvalidType", func(t *testing.T) {
+		stream, err := client.Watch(context.Background(), &proto.WatchRequest{Type: "unknown"})
+		require.NoError(t, err)
+		_, err = stream.Recv()
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("WithoutHub", func(t *testing.T) {
+		client := startStreamServer(t, &MetricsServer{}, nil)
+		stream, err := client.Watch(context.Background(), &proto.WatchRequest{})
+		require.NoError(t, err)
+		_, err = stream.Recv()
+		assert.Equal(t, codes.Unimplemented, status.Code(err))
+	})
+}
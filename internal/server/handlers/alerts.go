@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Sofja96/go-metrics.git/internal/server/alerting"
+)
+
+// Alerts - обработчик, отдающий в JSON активные алерты. Параметр state (pending или firing)
+// оставляет только алерты в этом состоянии.
+func Alerts(e *alerting.Engine) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		state := alerting.State(c.QueryParam("state"))
+		switch state {
+		case "", alerting.StatePending, alerting.StateFiring:
+		default:
+			return c.String(http.StatusBadRequest, "Invalid alert state. Alert state can only be 'pending' or 'firing'")
+		}
+
+		return c.JSON(http.StatusOK, e.Alerts(state))
+	}
+}
+
+// silenceRequest - тело запроса к /api/v1/silences. Вместо ends_at можно задать
+// длительность duration от начала заглушения.
+type silenceRequest struct {
+	Rule     string            `json:"rule,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	StartsAt time.Time         `json:"starts_at,omitempty"`
+	EndsAt   time.Time         `json:"ends_at,omitempty"`
+	Duration string            `json:"duration,omitempty"`
+	Comment  string            `json:"comment,omitempty"`
+}
+
+// Silences - обработчик, отдающий в JSON действующие и будущие заглушения уведомлений.
+func Silences(s *alerting.Silences) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, s.List(time.Now()))
+	}
+}
+
+// AddSilence - обработчик, добавляющий заглушение уведомлений и отдающий его в JSON с идентификатором.
+func AddSilence(s *alerting.Silences) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if c.Request().Header.Get("Content-Type") != "application/json" {
+			return c.String(http.StatusUnsupportedMediaType, "")
+		}
+		var req silenceRequest
+		if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+			return c.String(http.StatusBadRequest, "Error in JSON decode: "+err.Error())
+		}
+
+		now := time.Now()
+		silence := alerting.Silence{Rule: req.Rule, Labels: req.Labels, StartsAt: req.StartsAt,
+			EndsAt: req.EndsAt, Comment: req.Comment}
+		if req.Duration != "" {
+			d, err := time.ParseDuration(req.Duration)
+			if err != nil {
+				return c.String(http.StatusBadRequest, "Invalid silence duration")
+			}
+			start := req.StartsAt
+			if start.IsZero() {
+				start = now
+			}
+			silence.EndsAt = start.Add(d)
+		}
+
+		silence, err := s.Add(silence, now)
+		if errors.Is(err, alerting.ErrInvalidSilence) {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+		if err != nil {
+			return c.String(http.StatusInternalServerError, "error add silence")
+		}
+
+		return c.JSON(http.StatusCreated, silence)
+	}
+}
+
+// DeleteSilence - обработчик, удаляющий заглушение по идентификатору из пути.
+func DeleteSilence(s *alerting.Silences) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !s.Delete(c.Param("id")) {
+			return c.String(http.StatusNotFound, "Silence not found")
+		}
+		return c.NoContent(http.StatusOK)
+	}
+}
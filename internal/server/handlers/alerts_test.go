@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Sofja96/go-metrics.git/internal/server/alerting"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage/memory"
+)
+
+func TestAlerts(t *testing.T) {
+	ctx := context.Background()
+	s, err := memory.New(ctx, memory.Options{})
+	require.NoError(t, err)
+	_, err = s.UpdateGauge(ctx, `HeapInuse{host="agent-1"}`, 200)
+	require.NoError(t, err)
+	_, err = s.UpdateGauge(ctx, `HeapInuse{host="agent-2"}`, 50)
+	require.NoError(t, err)
+
+	rules, err := alerting.ParseRules([]byte(`{"rules": [
+		{"name": "HeapInuseHigh", "expr": "HeapInuse", "op": ">", "threshold": 100},
+		{"name": "HeapInuseLow", "expr": "HeapInuse", "op": "<", "threshold": 100, "for": "1h"}
+	]}`))
+	require.NoError(t, err)
+	engine := alerting.NewEngine(s, rules)
+	engine.Eval(ctx, time.Now())
+
+	e := echo.New()
+	e.GET("/api/v1/alerts", Alerts(engine))
+
+	tests := []struct {
+		name     string
+		target   string
+		wantCode int
+		want     []string
+	}{
+		{name: "All", target: "/api/v1/alerts", wantCode: http.StatusOK, want: []string{"HeapInuseHigh", "HeapInuseLow"}},
+		{name: "Firing", target: "/api/v1/alerts?state=firing", wantCode: http.StatusOK, want: []string{"HeapInuseHigh"}},
+		{name: "Pending", target: "/api/v1/alerts?state=pending", wantCode: http.StatusOK, want: []string{"HeapInuseLow"}},
+		{name: "InvalidState", target: "/api/v1/alerts?state=resolved", wantCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			assert.Equal(t, tt.wantCode, rec.Code)
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var alerts []alerting.Alert
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &alerts))
+			rules := make([]string, 0, len(alerts))
+			for _, a := range alerts {
+				rules = append(rules, a.Rule)
+			}
+			assert.Equal(t, tt.want, rules)
+		})
+	}
+}
+
+func TestSilences(t *testing.T) {
+	silences := alerting.NewSilences()
+	e := echo.New()
+	e.GET("/api/v1/silences", Silences(silences))
+	e.POST("/api/v1/silences", AddSilence(silences))
+	e.DELETE("/api/v1/silences/:id", DeleteSilence(silences))
+
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		wantCode    int
+	}{
+		{name: "Duration", body: `{"rule": "HeapInuseHigh", "duration": "1h", "comment": "deploy"}`,
+			contentType: "application/json", wantCode: http.StatusCreated},
+		{name: "EndsAt", body: `{"labels": {"host": "agent-1"}, "ends_at": "` + time.Now().Add(time.Hour).Format(time.RFC3339) + `"}`,
+			contentType: "application/json", wantCode: http.StatusCreated},
+		{name: "NoMatchers", body: `{"duration": "1h"}`, contentType: "application/json", wantCode: http.StatusBadRequest},
+		{name: "NoEnd", body: `{"rule": "HeapInuseHigh"}`, contentType: "application/json", wantCode: http.StatusBadRequest},
+		{name: "InvalidDuration", body: `{"rule": "HeapInuseHigh", "duration": "soon"}`,
+			contentType: "application/json", wantCode: http.StatusBadRequest},
+		{name: "InvalidJSON", body: `{`, contentType: "application/json", wantCode: http.StatusBadRequest},
+		{name: "InvalidContentType", body: `{}`, contentType: "text/plain", wantCode: http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/silences", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantCode, rec.Code)
+			if tt.wantCode != http.StatusCreated {
+				return
+			}
+			var silence alerting.Silence
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &silence))
+			assert.NotEmpty(t, silence.ID)
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/silences", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var list []alerting.Silence
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	require.Len(t, list, 2)
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/v1/silences/"+list[0].ID, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/v1/silences/"+list[0].ID, nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Sofja96/go-metrics.git/internal/server/storage/cache"
+)
+
+// CacheStats - обработчик, отдающий в JSON счетчики попаданий и промахов кеша чтения.
+func CacheStats(s *cache.Storage) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, s.Stats())
+	}
+}
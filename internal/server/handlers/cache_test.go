@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Sofja96/go-metrics.git/internal/server/storage/cache"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage/memory"
+)
+
+func TestCacheStats(t *testing.T) {
+	ctx := context.Background()
+	mem, err := memory.New(ctx, memory.Options{})
+	require.NoError(t, err)
+	s, err := cache.New(mem, cache.Options{})
+	require.NoError(t, err)
+
+	_, err = s.UpdateGauge(ctx, "Alloc", 1)
+	require.NoError(t, err)
+	s.GetGaugeValue(ctx, "Alloc")
+	s.GetGaugeValue(ctx, "Alloc")
+
+	e := echo.New()
+	e.GET("/api/v1/cache", CacheStats(s))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/cache", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"hits":1,"misses":1,"evictions":0,"entries":1}`, rec.Body.String())
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Sofja96/go-metrics.git/internal/models"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+)
+
+const (
+	histogram string = "histogram"
+	summary   string = "summary"
+)
+
+// invalidTypeMessage - текст ошибки для неизвестного типа метрики.
+const invalidTypeMessage = "Metric type can only be 'gauge', 'counter', 'histogram' or 'summary'"
+
+// isDistribution - проверяет, что тип метрики хранит распределение наблюдений.
+func isDistribution(mType string) bool {
+	return mType == histogram || mType == summary
+}
+
+// updateDistribution - добавляет наблюдения метрики histogram или summary в хранилище
+// и записывает в метрику ее новое состояние.
+func updateDistribution(ctx context.Context, s storage.Storage, metric *models.Metrics) error {
+	switch metric.MType {
+	case histogram:
+		h, err := s.UpdateHistogram(ctx, metric.SeriesKey(), metric.Buckets, metric.Observations)
+		if err != nil {
+			return err
+		}
+		metric.Histogram = &h
+	case summary:
+		sm, err := s.UpdateSummary(ctx, metric.SeriesKey(), metric.Quantiles, metric.Observations)
+		if err != nil {
+			return err
+		}
+		metric.Summary = &sm
+	default:
+		return fmt.Errorf("unsupported metrics type: %s", metric.MType)
+	}
+	return nil
+}
+
+// updateErrorStatus - возвращает код ответа для ошибки обновления метрики.
+func updateErrorStatus(err error) int {
+	if errors.Is(err, models.ErrLayoutMismatch) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// parseFloatList - разбирает список чисел, разделенных запятыми.
+func parseFloatList(s string) ([]float64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	parts := strings.Split(s, ",")
+	values := make([]float64, 0, len(parts))
+	for _, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("incorrect value in list: %s", part)
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
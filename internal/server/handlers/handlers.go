@@ -2,10 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/labstack/echo/v4"
 
@@ -27,9 +30,18 @@ func Webhook(storage storage.Storage) echo.HandlerFunc {
 		metricsName := c.Param("nameM")
 		metricsValue := c.Param("valueM")
 
+		if err := models.ValidateName(metricsName); err != nil {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+		labels := queryLabels(c, "buckets", "quantiles")
+		if err := models.ValidateLabels(labels); err != nil {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+		metricsKey := models.SeriesKey(metricsName, labels)
+
 		if metricsType == counter {
 			if value, err := strconv.ParseInt(metricsValue, 10, 64); err == nil {
-				_, err := storage.UpdateCounter(ctx, metricsName, value)
+				_, err := storage.UpdateCounter(ctx, metricsKey, value)
 				if err != nil {
 					return err
 				}
@@ -38,15 +50,33 @@ func Webhook(storage storage.Storage) echo.HandlerFunc {
 			}
 		} else if metricsType == gauge {
 			if value, err := strconv.ParseFloat(metricsValue, 64); err == nil {
-				_, err := storage.UpdateGauge(ctx, metricsName, value)
+				_, err := storage.UpdateGauge(ctx, metricsKey, value)
 				if err != nil {
 					return err
 				}
 			} else {
 				return c.String(http.StatusBadRequest, "incorrect values(float) of metric: "+metricsValue)
 			}
+		} else if isDistribution(metricsType) {
+			value, err := strconv.ParseFloat(metricsValue, 64)
+			if err != nil {
+				return c.String(http.StatusBadRequest, "incorrect values(float) of metric: "+metricsValue)
+			}
+			metric := models.Metrics{ID: metricsName, MType: metricsType, Labels: labels, Observations: []float64{value}}
+			if metric.Buckets, err = parseFloatList(c.QueryParam("buckets")); err != nil {
+				return c.String(http.StatusBadRequest, err.Error())
+			}
+			if metric.Quantiles, err = parseFloatList(c.QueryParam("quantiles")); err != nil {
+				return c.String(http.StatusBadRequest, err.Error())
+			}
+			if err := models.ValidateDistribution(metric); err != nil {
+				return c.String(http.StatusBadRequest, err.Error())
+			}
+			if err := updateDistribution(ctx, storage, &metric); err != nil {
+				return c.String(updateErrorStatus(err), err.Error())
+			}
 		} else {
-			return c.String(http.StatusBadRequest, "Invalid metric type. Metric type can only be 'gauge' or 'counter'")
+			return c.String(http.StatusBadRequest, "Invalid metric type. "+invalidTypeMessage)
 		}
 
 		c.Response().Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -71,19 +101,32 @@ func UpdateJSON(s storage.Storage) echo.HandlerFunc {
 		if len(metric.ID) == 0 {
 			return c.String(http.StatusNotFound, "No id metric for "+metric.MType)
 		}
+		if err := models.ValidateName(metric.ID); err != nil {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+		if err := models.ValidateLabels(metric.Labels); err != nil {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
 		switch metric.MType {
 		case counter:
-			_, err := s.UpdateCounter(ctx, metric.ID, *metric.Delta)
+			_, err := s.UpdateCounter(ctx, metric.SeriesKey(), *metric.Delta)
 			if err != nil {
 				return err
 			}
 		case gauge:
-			_, err := s.UpdateGauge(ctx, metric.ID, *metric.Value)
+			_, err := s.UpdateGauge(ctx, metric.SeriesKey(), *metric.Value)
 			if err != nil {
 				return err
 			}
+		case histogram, summary:
+			if err := models.ValidateDistribution(metric); err != nil {
+				return c.String(http.StatusBadRequest, err.Error())
+			}
+			if err := updateDistribution(ctx, s, &metric); err != nil {
+				return c.String(updateErrorStatus(err), err.Error())
+			}
 		default:
-			return c.String(http.StatusNotFound, "Invalid metric type. Can only be 'gauge' or 'counter'")
+			return c.String(http.StatusNotFound, "Invalid metric type. "+invalidTypeMessage)
 		}
 		return c.JSON(http.StatusOK, metric)
 	}
@@ -105,8 +148,24 @@ func UpdatesBatch(s storage.Storage) echo.HandlerFunc {
 		if len(metrics) == 0 {
 			return c.String(http.StatusBadRequest, "metrics is empty")
 		}
+		for _, metric := range metrics {
+			if err := models.ValidateName(metric.ID); err != nil {
+				return c.String(http.StatusBadRequest, err.Error())
+			}
+			if err := models.ValidateLabels(metric.Labels); err != nil {
+				return c.String(http.StatusBadRequest, err.Error())
+			}
+			if isDistribution(metric.MType) {
+				if err := models.ValidateDistribution(metric); err != nil {
+					return c.String(http.StatusBadRequest, err.Error())
+				}
+			}
+		}
 		err := s.BatchUpdate(ctx, metrics)
 		if err != nil {
+			if errors.Is(err, models.ErrLayoutMismatch) {
+				return c.String(http.StatusBadRequest, err.Error())
+			}
 			return c.String(http.StatusInternalServerError, "error batch update")
 		}
 
@@ -115,34 +174,87 @@ func UpdatesBatch(s storage.Storage) echo.HandlerFunc {
 }
 
 // ValueMetric - обработчик для получения метрики по типу и имени.
-func ValueMetric(storage storage.Storage) echo.HandlerFunc {
+func ValueMetric(s storage.Storage) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		ctx := c.Request().Context()
 
 		metricsType := c.Param("typeM")
 		metricsName := c.Param("nameM")
+		labels := queryLabels(c)
 		var v string
 		switch metricsType {
 		case counter:
-			value, ok := storage.GetCounterValue(ctx, metricsName)
+			value, ok := storage.LookupCounter(ctx, s, metricsName, labels)
 			if !ok {
 				return c.String(http.StatusNotFound, "")
 			}
 			v = fmt.Sprint(value)
 		case gauge:
-			value, ok := storage.GetGaugeValue(ctx, metricsName)
+			value, ok := storage.LookupGauge(ctx, s, metricsName, labels)
 			if !ok {
 				return c.String(http.StatusNotFound, "")
 			}
 			v = fmt.Sprint(value)
+		case histogram:
+			value, ok := storage.LookupHistogram(ctx, s, metricsName, labels)
+			if !ok {
+				return c.String(http.StatusNotFound, "")
+			}
+			return c.JSON(http.StatusOK, value)
+		case summary:
+			value, ok := storage.LookupSummary(ctx, s, metricsName, labels)
+			if !ok {
+				return c.String(http.StatusNotFound, "")
+			}
+			return c.JSON(http.StatusOK, value)
 		default:
-			return c.String(http.StatusNotFound, "Metric not fount or invalid metric type. Metric type can only be 'gauge' or 'counter'")
+			return c.String(http.StatusNotFound, "Metric not fount or invalid metric type. "+invalidTypeMessage)
 		}
 		c.Response().Header().Set("Content-Type", "text/plain; charset=utf-8")
 		return c.String(http.StatusOK, v)
 	}
 }
 
+// DeleteMetric - обработчик для удаления серии метрики по типу, имени и меткам из параметров запроса.
+// Имя, оканчивающееся на "*", удаляет все серии этого типа, имена которых начинаются с остальной части имени.
+func DeleteMetric(s storage.Deleter) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx := c.Request().Context()
+
+		metricsType := c.Param("typeM")
+		metricsName := c.Param("nameM")
+		switch metricsType {
+		case counter, gauge, histogram, summary:
+		default:
+			return c.String(http.StatusBadRequest, "Invalid metric type. "+invalidTypeMessage)
+		}
+
+		c.Response().Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if prefix, ok := strings.CutSuffix(metricsName, "*"); ok {
+			deleted, err := s.DeleteByPrefix(ctx, metricsType, prefix)
+			if errors.Is(err, storage.ErrUnsupported) {
+				return c.String(http.StatusNotImplemented, err.Error())
+			}
+			if err != nil {
+				return c.String(http.StatusInternalServerError, "error delete metrics")
+			}
+			return c.String(http.StatusOK, strconv.Itoa(len(deleted)))
+		}
+
+		ok, err := s.Delete(ctx, metricsType, models.SeriesKey(metricsName, queryLabels(c)))
+		if errors.Is(err, storage.ErrUnsupported) {
+			return c.String(http.StatusNotImplemented, err.Error())
+		}
+		if err != nil {
+			return c.String(http.StatusInternalServerError, "error delete metric")
+		}
+		if !ok {
+			return c.String(http.StatusNotFound, "")
+		}
+		return c.String(http.StatusOK, "1")
+	}
+}
+
 // ValueJSON - обработчик для получения метрики по типу и имени в формате JSON.
 func ValueJSON(s storage.Storage) echo.HandlerFunc {
 	return func(c echo.Context) error {
@@ -162,19 +274,31 @@ func ValueJSON(s storage.Storage) echo.HandlerFunc {
 		}
 		switch metric.MType {
 		case counter:
-			value, ok := s.GetCounterValue(ctx, metric.ID)
+			value, ok := storage.LookupCounter(ctx, s, metric.ID, metric.Labels)
 			if !ok {
 				return c.String(http.StatusNotFound, "")
 			}
 			metric.Delta = &value
 		case gauge:
-			value, ok := s.GetGaugeValue(ctx, metric.ID)
+			value, ok := storage.LookupGauge(ctx, s, metric.ID, metric.Labels)
 			if !ok {
 				return c.String(http.StatusNotFound, "")
 			}
 			metric.Value = &value
+		case histogram:
+			value, ok := storage.LookupHistogram(ctx, s, metric.ID, metric.Labels)
+			if !ok {
+				return c.String(http.StatusNotFound, "")
+			}
+			metric.Histogram = &value
+		case summary:
+			value, ok := storage.LookupSummary(ctx, s, metric.ID, metric.Labels)
+			if !ok {
+				return c.String(http.StatusNotFound, "")
+			}
+			metric.Summary = &value
 		default:
-			return c.String(http.StatusBadRequest, "Metric not found or invalid metric type. Metric type can only be 'gauge' or 'counter'")
+			return c.String(http.StatusBadRequest, "Metric not found or invalid metric type. "+invalidTypeMessage)
 		}
 		return c.JSON(http.StatusOK, metric)
 	}
@@ -194,6 +318,14 @@ func GetAllMetrics(storage storage.Storage) echo.HandlerFunc {
 		if err != nil {
 			return c.String(http.StatusInternalServerError, "")
 		}
+		histogramMetrics, err := storage.GetAllHistograms(ctx)
+		if err != nil {
+			return c.String(http.StatusInternalServerError, "")
+		}
+		summaryMetrics, err := storage.GetAllSummaries(ctx)
+		if err != nil {
+			return c.String(http.StatusInternalServerError, "")
+		}
 
 		var result strings.Builder
 
@@ -202,7 +334,7 @@ func GetAllMetrics(storage storage.Storage) echo.HandlerFunc {
 		result.WriteString("<h2>Gauge metrics:</h2>")
 		result.WriteString("<ul>")
 		for _, metric := range gaugeMetrics {
-			result.WriteString(fmt.Sprintf("<li>%s = %.2f</li>", metric.Name, metric.Value))
+			result.WriteString(fmt.Sprintf("<li>%s = %.2f</li>", models.SeriesKey(metric.Name, metric.Labels), metric.Value))
 		}
 		result.WriteString("</ul>")
 
@@ -210,15 +342,113 @@ func GetAllMetrics(storage storage.Storage) echo.HandlerFunc {
 		result.WriteString("<h2>Counter metrics:</h2>")
 		result.WriteString("<ul>")
 		for _, metric := range counterMetrics {
-			result.WriteString(fmt.Sprintf("<li>%s = %d</li>", metric.Name, metric.Value))
+			result.WriteString(fmt.Sprintf("<li>%s = %d</li>", models.SeriesKey(metric.Name, metric.Labels), metric.Value))
 		}
 		result.WriteString("</ul>")
+
+		// Формируем строку с метриками типа histogram
+		if len(histogramMetrics) > 0 {
+			result.WriteString("<h2>Histogram metrics:</h2>")
+			result.WriteString("<ul>")
+			for _, metric := range histogramMetrics {
+				result.WriteString(fmt.Sprintf("<li>%s: count = %d, sum = %.2f</li>",
+					models.SeriesKey(metric.Name, metric.Labels), metric.Value.Count, metric.Value.Sum))
+			}
+			result.WriteString("</ul>")
+		}
+
+		// Формируем строку с метриками типа summary
+		if len(summaryMetrics) > 0 {
+			result.WriteString("<h2>Summary metrics:</h2>")
+			result.WriteString("<ul>")
+			for _, metric := range summaryMetrics {
+				result.WriteString(fmt.Sprintf("<li>%s: count = %d, sum = %.2f",
+					models.SeriesKey(metric.Name, metric.Labels), metric.Value.Count, metric.Value.Sum))
+				for _, q := range metric.Value.Quantiles {
+					result.WriteString(fmt.Sprintf(", q%g = %.2f", q.Quantile, q.Value))
+				}
+				result.WriteString("</li>")
+			}
+			result.WriteString("</ul>")
+		}
 		result.WriteString("</body></html>")
 
 		return c.String(http.StatusOK, result.String())
 	}
 }
 
+// defaultHistoryWindow - интервал истории, который отдается, если начало не указано.
+const defaultHistoryWindow = time.Hour
+
+// History - обработчик для получения истории значений метрики по типу и имени.
+// Интервал задается параметрами from и to в формате RFC3339, шаг - параметром step (например, 1m).
+func History(s storage.Ranger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx := c.Request().Context()
+
+		metricsType := c.Param("typeM")
+		metricsName := c.Param("nameM")
+		if metricsType != counter && metricsType != gauge {
+			return c.String(http.StatusBadRequest, "Invalid metric type. Metric type can only be 'gauge' or 'counter'")
+		}
+
+		to := time.Now()
+		if v := c.QueryParam("to"); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return c.String(http.StatusBadRequest, "incorrect value of to: "+v)
+			}
+			to = t
+		}
+
+		from := to.Add(-defaultHistoryWindow)
+		if v := c.QueryParam("from"); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return c.String(http.StatusBadRequest, "incorrect value of from: "+v)
+			}
+			from = t
+		}
+
+		var step time.Duration
+		if v := c.QueryParam("step"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 {
+				return c.String(http.StatusBadRequest, "incorrect value of step: "+v)
+			}
+			step = d
+		}
+
+		labels := queryLabels(c, "from", "to", "step")
+		samples, err := s.GetRange(ctx, models.SeriesKey(metricsName, labels), metricsType, from, to, step)
+		if errors.Is(err, storage.ErrUnsupported) {
+			return c.String(http.StatusNotImplemented, err.Error())
+		}
+		if err != nil {
+			return c.String(http.StatusInternalServerError, "error get history")
+		}
+
+		return c.JSON(http.StatusOK, samples)
+	}
+}
+
+// queryLabels - собирает метки серии из параметров запроса, пропуская служебные параметры.
+func queryLabels(c echo.Context, reserved ...string) map[string]string {
+	params := c.QueryParams()
+	if len(params) == 0 {
+		return nil
+	}
+
+	labels := make(map[string]string, len(params))
+	for k, v := range params {
+		if slices.Contains(reserved, k) || len(v) == 0 {
+			continue
+		}
+		labels[k] = v[0]
+	}
+	return labels
+}
+
 // Ping - обработчик для определения доступности БД.
 func Ping(storage storage.Storage) echo.HandlerFunc {
 	return func(c echo.Context) error {
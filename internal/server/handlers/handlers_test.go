@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/labstack/echo/v4"
@@ -23,6 +24,8 @@ import (
 
 type mocks struct {
 	storage *storagemock.MockStorage
+	ranger  *storagemock.MockRanger
+	deleter *storagemock.MockDeleter
 	logger  zap.SugaredLogger
 }
 
@@ -72,13 +75,42 @@ func TestWebhook(t *testing.T) {
 			},
 			expectedStatusCode: http.StatusOK,
 		},
+		{
+			name:   "PushGaugeWithLabels",
+			path:   "/update/gauge/Alloc/13.123?host=agent-1",
+			method: http.MethodPost,
+			args: args{
+				metricsName:      `Alloc{host="agent-1"}`,
+				metricValueGauge: 13.123,
+			},
+			mockBehavior: func(m *mocks, args args) {
+				m.storage.EXPECT().UpdateGauge(gomock.Any(), args.metricsName, args.metricValueGauge).Return(13.123, nil)
+			},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "PushInvalidLabelName",
+			path:               "/update/gauge/Alloc/13.123?1host=agent-1",
+			method:             http.MethodPost,
+			mockBehavior:       func(m *mocks, args args) {},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedResponse:   `invalid label name: "1host"`,
+		},
+		{
+			name:               "PushInvalidMetricName",
+			path:               "/update/gauge/Alloc%7Bhost=%22agent-1%22%7D/13.123",
+			method:             http.MethodPost,
+			mockBehavior:       func(m *mocks, args args) {},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedResponse:   `invalid metric name: "Alloc{host=\"agent-1\"}"`,
+		},
 		{
 			name:               "PushUnknownMetricKind",
 			path:               "/update/unknown/Alloc/12.123",
 			method:             http.MethodPost,
 			mockBehavior:       func(m *mocks, args args) {},
 			expectedStatusCode: http.StatusBadRequest,
-			expectedResponse:   "Invalid metric type. Metric type can only be 'gauge' or 'counter'",
+			expectedResponse:   "Invalid metric type. Metric type can only be 'gauge', 'counter', 'histogram' or 'summary'",
 		},
 		{
 			name:               "PushWithoutNameMetric",
@@ -230,7 +262,7 @@ func TestValueMetric(t *testing.T) {
 			mockBehavior:       func(m *mocks, args args) {},
 			expectedStatusCode: http.StatusNotFound,
 			expectedBody: "Metric not fount or invalid metric type. " +
-				"Metric type can only be 'gauge' or 'counter'",
+				"Metric type can only be 'gauge', 'counter', 'histogram' or 'summary'",
 		},
 		{
 			name: "GetUnknownCounter",
@@ -256,6 +288,39 @@ func TestValueMetric(t *testing.T) {
 			expectedStatusCode: http.StatusNotFound,
 			expectedBody:       "",
 		},
+		{
+			name: "GetGaugeByLabelSubset",
+			path: "/value/gauge/Alloc?host=agent-1",
+			args: args{
+				metricsName: `Alloc{host="agent-1"}`,
+			},
+			mockBehavior: func(m *mocks, args args) {
+				m.storage.EXPECT().GetGaugeValue(gomock.Any(), args.metricsName).Return(float64(0), false)
+				m.storage.EXPECT().ListSeries(gomock.Any(), "gauge", "Alloc").Return([]string{
+					`Alloc{dc="eu",host="agent-1"}`,
+					`Alloc{dc="eu",host="agent-2"}`,
+				}, nil)
+				m.storage.EXPECT().GetGaugeValue(gomock.Any(), `Alloc{dc="eu",host="agent-1"}`).Return(3.5, true)
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       "3.5",
+		},
+		{
+			name: "GetAmbiguousGauge",
+			path: "/value/gauge/Alloc?dc=eu",
+			args: args{
+				metricsName: `Alloc{dc="eu"}`,
+			},
+			mockBehavior: func(m *mocks, args args) {
+				m.storage.EXPECT().GetGaugeValue(gomock.Any(), args.metricsName).Return(float64(0), false)
+				m.storage.EXPECT().ListSeries(gomock.Any(), "gauge", "Alloc").Return([]string{
+					`Alloc{dc="eu",host="agent-1"}`,
+					`Alloc{dc="eu",host="agent-2"}`,
+				}, nil)
+			},
+			expectedStatusCode: http.StatusNotFound,
+			expectedBody:       "",
+		},
 	}
 
 	for _, tt := range tests {
@@ -322,6 +387,8 @@ func TestGetAllMetrics(t *testing.T) {
 					{Name: "counter1", Value: 10},
 					{Name: "counter2", Value: 20},
 				}, nil)
+				m.storage.EXPECT().GetAllHistograms(gomock.Any()).Return([]storage.HistogramMetric{}, nil)
+				m.storage.EXPECT().GetAllSummaries(gomock.Any()).Return([]storage.SummaryMetric{}, nil)
 			},
 			expectedStatusCode: http.StatusOK,
 			expectedResponseBody: "<html><body>" +
@@ -334,6 +401,33 @@ func TestGetAllMetrics(t *testing.T) {
 				"<li>counter2 = 20</li>" +
 				"</ul></body></html>",
 		},
+		{
+			name: "SuccessGetAllMetricsWithDistributions",
+			mockBehavior: func(m *mocks, args args) {
+				m.storage.EXPECT().GetAllGauges(gomock.Any()).Return([]storage.GaugeMetric{}, nil)
+				m.storage.EXPECT().GetAllCounters(gomock.Any()).Return([]storage.CounterMetric{}, nil)
+				m.storage.EXPECT().GetAllHistograms(gomock.Any()).Return([]storage.HistogramMetric{
+					{Name: "latency", Value: models.Histogram{Bounds: []float64{1}, Counts: []uint64{2, 1}, Count: 3, Sum: 3.5}},
+				}, nil)
+				m.storage.EXPECT().GetAllSummaries(gomock.Any()).Return([]storage.SummaryMetric{
+					{Name: "size", Value: models.SummaryValue{
+						Quantiles: []models.Quantile{{Quantile: 0.5, Value: 10}, {Quantile: 0.9, Value: 20}},
+						Count:     4,
+						Sum:       50,
+					}},
+				}, nil)
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedResponseBody: "<html><body>" +
+				"<h2>Gauge metrics:</h2><ul></ul>" +
+				"<h2>Counter metrics:</h2><ul></ul>" +
+				"<h2>Histogram metrics:</h2><ul>" +
+				"<li>latency: count = 3, sum = 3.50</li>" +
+				"</ul>" +
+				"<h2>Summary metrics:</h2><ul>" +
+				"<li>size: count = 4, sum = 50.00, q0.5 = 10.00, q0.9 = 20.00</li>" +
+				"</ul></body></html>",
+		},
 		{
 			name: "ErrorGetAllGauges",
 			args: args{
@@ -454,7 +548,7 @@ func TestValueJSON(t *testing.T) {
 			mockBehavior:       func(m *mocks, args models.Metrics) {},
 			expectedStatusCode: http.StatusBadRequest,
 			expectedResponseBody: "Metric not found or invalid metric type. " +
-				"Metric type can only be 'gauge' or 'counter'",
+				"Metric type can only be 'gauge', 'counter', 'histogram' or 'summary'",
 			contentType: "application/json",
 		},
 		{
@@ -622,12 +716,47 @@ func TestUpdateJSON(t *testing.T) {
 			expectedStatusCode:   http.StatusInternalServerError,
 			contentType:          "application/json",
 		},
+		{
+			name:        "updateHistogramSuccess",
+			reqBodyFile: "./mocks/requests/update_histogram_json_ok.json",
+			args: models.Metrics{
+				ID:           "RequestDuration",
+				MType:        "histogram",
+				Observations: []float64{0.3, 2},
+				Buckets:      []float64{0.5, 1},
+			},
+			mockBehavior: func(m *mocks, args models.Metrics) {
+				m.storage.EXPECT().UpdateHistogram(gomock.Any(), args.ID, args.Buckets, args.Observations).
+					Return(models.Histogram{Bounds: []float64{0.5, 1}, Counts: []uint64{1, 0, 1}, Count: 2, Sum: 2.3}, nil)
+			},
+			expectedResponseBody: strings.NewReplacer("\n", "", " ", "").
+				Replace(utils.GetDataFromFile("./mocks/responses/update_histogram_json_ok.json").String()),
+			expectedStatusCode: http.StatusOK,
+			contentType:        "application/json",
+		},
+		{
+			name:        "updateHistogramLayoutMismatch",
+			reqBodyFile: "./mocks/requests/update_histogram_json_ok.json",
+			args: models.Metrics{
+				ID:           "RequestDuration",
+				MType:        "histogram",
+				Observations: []float64{0.3, 2},
+				Buckets:      []float64{0.5, 1},
+			},
+			mockBehavior: func(m *mocks, args models.Metrics) {
+				m.storage.EXPECT().UpdateHistogram(gomock.Any(), args.ID, args.Buckets, args.Observations).
+					Return(models.Histogram{}, models.ErrLayoutMismatch)
+			},
+			expectedResponseBody: models.ErrLayoutMismatch.Error(),
+			expectedStatusCode:   http.StatusBadRequest,
+			contentType:          "application/json",
+		},
 		{
 			name:                 "updateUnknownMetricKind",
 			reqBodyFile:          "./mocks/requests/get_unknown_metric_type.json",
 			mockBehavior:         func(m *mocks, args models.Metrics) {},
 			expectedStatusCode:   http.StatusNotFound,
-			expectedResponseBody: "Invalid metric type. Can only be 'gauge' or 'counter'",
+			expectedResponseBody: "Invalid metric type. Metric type can only be 'gauge', 'counter', 'histogram' or 'summary'",
 			contentType:          "application/json",
 		},
 		{
@@ -785,6 +914,188 @@ func TestUpdatesBatch(t *testing.T) {
 	}
 }
 
+func TestHistory(t *testing.T) {
+	from := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+
+	tests := []struct {
+		name               string
+		path               string
+		mockBehavior       func(m *mocks)
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{
+			name: "HistorySuccess",
+			path: "/history/gauge/HeapInuse?from=2024-01-01T12:00:00Z&to=2024-01-01T13:00:00Z&step=1m",
+			mockBehavior: func(m *mocks) {
+				m.ranger.EXPECT().GetRange(gomock.Any(), "HeapInuse", "gauge", from, to, time.Minute).
+					Return([]storage.Sample{{Timestamp: from, Value: 1.5}}, nil)
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `[{"timestamp":"2024-01-01T12:00:00Z","value":1.5}]`,
+		},
+		{
+			name:               "HistoryInvalidType",
+			path:               "/history/unknown/HeapInuse",
+			mockBehavior:       func(m *mocks) {},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       "Invalid metric type. Metric type can only be 'gauge' or 'counter'",
+		},
+		{
+			name:               "HistoryInvalidFrom",
+			path:               "/history/gauge/HeapInuse?from=yesterday",
+			mockBehavior:       func(m *mocks) {},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       "incorrect value of from: yesterday",
+		},
+		{
+			name:               "HistoryInvalidStep",
+			path:               "/history/counter/PollCount?step=-1m",
+			mockBehavior:       func(m *mocks) {},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       "incorrect value of step: -1m",
+		},
+		{
+			name: "HistoryStorageError",
+			path: "/history/counter/PollCount?from=2024-01-01T12:00:00Z&to=2024-01-01T13:00:00Z",
+			mockBehavior: func(m *mocks) {
+				m.ranger.EXPECT().GetRange(gomock.Any(), "PollCount", "counter", from, to, time.Duration(0)).
+					Return(nil, errors.New("error selecting samples"))
+			},
+			expectedStatusCode: http.StatusInternalServerError,
+			expectedBody:       "error get history",
+		},
+		{
+			name: "HistoryUnsupported",
+			path: "/history/gauge/HeapInuse?from=2024-01-01T12:00:00Z&to=2024-01-01T13:00:00Z",
+			mockBehavior: func(m *mocks) {
+				m.ranger.EXPECT().GetRange(gomock.Any(), "HeapInuse", "gauge", from, to, time.Duration(0)).
+					Return(nil, storage.ErrUnsupported)
+			},
+			expectedStatusCode: http.StatusNotImplemented,
+			expectedBody:       storage.ErrUnsupported.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			m := &mocks{
+				ranger: storagemock.NewMockRanger(c),
+				logger: *zap.NewNop().Sugar(),
+			}
+
+			tt.mockBehavior(m)
+			e := echo.New()
+			e.Use(middleware2.WithLogging(m.logger))
+			e.GET("/history/:typeM/:nameM", History(m.ranger))
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+
+			e.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.expectedStatusCode, w.Code)
+			assert.Equal(t, tt.expectedBody, strings.TrimSpace(w.Body.String()))
+		})
+	}
+}
+
+func TestDeleteMetric(t *testing.T) {
+	tests := []struct {
+		name               string
+		path               string
+		mockBehavior       func(m *mocks)
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{
+			name: "DeleteSuccess",
+			path: "/value/gauge/Alloc?host=agent-1",
+			mockBehavior: func(m *mocks) {
+				m.deleter.EXPECT().Delete(gomock.Any(), "gauge", `Alloc{host="agent-1"}`).Return(true, nil)
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       "1",
+		},
+		{
+			name: "DeleteUnknownMetric",
+			path: "/value/counter/unknown",
+			mockBehavior: func(m *mocks) {
+				m.deleter.EXPECT().Delete(gomock.Any(), "counter", "unknown").Return(false, nil)
+			},
+			expectedStatusCode: http.StatusNotFound,
+			expectedBody:       "",
+		},
+		{
+			name: "DeleteByPrefix",
+			path: "/value/gauge/Heap*",
+			mockBehavior: func(m *mocks) {
+				m.deleter.EXPECT().DeleteByPrefix(gomock.Any(), "gauge", "Heap").Return([]storage.SeriesID{
+					{Type: "gauge", ID: "HeapAlloc"},
+					{Type: "gauge", ID: "HeapInuse"},
+					{Type: "gauge", ID: "HeapSys"},
+				}, nil)
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       "3",
+		},
+		{
+			name:               "DeleteInvalidType",
+			path:               "/value/unknown/Alloc",
+			mockBehavior:       func(m *mocks) {},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       "Invalid metric type. " + invalidTypeMessage,
+		},
+		{
+			name: "DeleteStorageError",
+			path: "/value/histogram/latency",
+			mockBehavior: func(m *mocks) {
+				m.deleter.EXPECT().Delete(gomock.Any(), "histogram", "latency").Return(false, errors.New("error delete"))
+			},
+			expectedStatusCode: http.StatusInternalServerError,
+			expectedBody:       "error delete metric",
+		},
+		{
+			name: "DeleteUnsupported",
+			path: "/value/gauge/Heap*",
+			mockBehavior: func(m *mocks) {
+				m.deleter.EXPECT().DeleteByPrefix(gomock.Any(), "gauge", "Heap").Return(nil, storage.ErrUnsupported)
+			},
+			expectedStatusCode: http.StatusNotImplemented,
+			expectedBody:       storage.ErrUnsupported.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			m := &mocks{
+				deleter: storagemock.NewMockDeleter(c),
+				logger:  *zap.NewNop().Sugar(),
+			}
+
+			tt.mockBehavior(m)
+			e := echo.New()
+			e.Use(middleware2.WithLogging(m.logger))
+			e.DELETE("/value/:typeM/:nameM", DeleteMetric(m.deleter))
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodDelete, tt.path, nil)
+
+			e.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.expectedStatusCode, w.Code)
+			assert.Equal(t, tt.expectedBody, w.Body.String())
+		})
+	}
+}
+
 func TestPing(t *testing.T) {
 	type (
 		mockBehavior func(m *mocks)
@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Sofja96/go-metrics.git/internal/models"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+)
+
+// Типы содержимого, которые поддерживает эндпоинт /metrics.
+const (
+	prometheusContentType  = "text/plain; version=0.0.4; charset=utf-8"
+	openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+	openMetricsMediaType   = "application/openmetrics-text"
+)
+
+// PrometheusMetrics - обработчик, отдающий все метрики в текстовом формате Prometheus.
+// Если клиент в заголовке Accept запрашивает OpenMetrics, ответ формируется в этом формате.
+func PrometheusMetrics(s storage.Storage) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx := c.Request().Context()
+
+		gaugeMetrics, err := s.GetAllGauges(ctx)
+		if err != nil {
+			return c.String(http.StatusInternalServerError, "")
+		}
+		counterMetrics, err := s.GetAllCounters(ctx)
+		if err != nil {
+			return c.String(http.StatusInternalServerError, "")
+		}
+		histogramMetrics, err := s.GetAllHistograms(ctx)
+		if err != nil {
+			return c.String(http.StatusInternalServerError, "")
+		}
+		summaryMetrics, err := s.GetAllSummaries(ctx)
+		if err != nil {
+			return c.String(http.StatusInternalServerError, "")
+		}
+
+		openMetrics := strings.Contains(c.Request().Header.Get("Accept"), openMetricsMediaType)
+
+		contentType := prometheusContentType
+		if openMetrics {
+			contentType = openMetricsContentType
+		}
+
+		body := writeExposition(exposition{
+			gauges:     gaugeMetrics,
+			counters:   counterMetrics,
+			histograms: histogramMetrics,
+			summaries:  summaryMetrics,
+		}, openMetrics)
+
+		return c.Blob(http.StatusOK, contentType, []byte(body))
+	}
+}
+
+// exposition - метрики всех типов, которые отдаются эндпоинтом /metrics.
+type exposition struct {
+	gauges     []storage.GaugeMetric
+	counters   []storage.CounterMetric
+	histograms []storage.HistogramMetric
+	summaries  []storage.SummaryMetric
+}
+
+// family - семейство метрик экспозиции: серии одной метрики хранилища по строке меток.
+type family[T any] struct {
+	source string // имя метрики в хранилище, из которого получено имя семейства
+	series map[string]T
+}
+
+// addSeries - добавляет серию метрики source с метками labels в семейство name. Имена разных
+// метрик после приведения к именам Prometheus могут совпасть (например, a.b и a-b): семейство
+// принадлежит метрике с наименьшим именем, серии остальных пропускаются, а не перезаписывают ее серии.
+func addSeries[T any](families map[string]*family[T], name, source string, labels map[string]string, value T) {
+	f, ok := families[name]
+	if !ok {
+		f = &family[T]{source: source, series: make(map[string]T)}
+		families[name] = f
+	}
+	if f.source != source {
+		if source < f.source {
+			log.Printf("skip metric %q in exposition: its name %s collides with metric %q", f.source, name, source)
+			*f = family[T]{source: source, series: make(map[string]T)}
+		} else {
+			log.Printf("skip metric %q in exposition: its name %s collides with metric %q", source, name, f.source)
+			return
+		}
+	}
+	f.series[formatLabels(labels, "", "")] = value
+}
+
+// writeExposition - формирует текст с семействами метрик, отсортированными по имени.
+// Серии внутри семейства отсортированы по строке меток. Семейство, имя которого или имя
+// одной из серий которого уже занято семейством другого типа, пропускается; типы
+// занимают имена в порядке counter, gauge, histogram, summary.
+func writeExposition(m exposition, openMetrics bool) string {
+	gaugeValues := make(map[string]*family[float64], len(m.gauges))
+	for _, metric := range m.gauges {
+		addSeries(gaugeValues, sanitizeMetricName(metric.Name), metric.Name, metric.Labels, metric.Value)
+	}
+
+	counterValues := make(map[string]*family[int64], len(m.counters))
+	for _, metric := range m.counters {
+		name := sanitizeMetricName(metric.Name)
+		if openMetrics {
+			// в OpenMetrics имя семейства счетчика не должно оканчиваться на _total
+			name = strings.TrimSuffix(name, "_total")
+		}
+		addSeries(counterValues, name, metric.Name, metric.Labels, metric.Value)
+	}
+
+	histogramValues := make(map[string]*family[storage.HistogramMetric], len(m.histograms))
+	for _, metric := range m.histograms {
+		addSeries(histogramValues, sanitizeMetricName(metric.Name), metric.Name, metric.Labels, metric)
+	}
+
+	summaryValues := make(map[string]*family[storage.SummaryMetric], len(m.summaries))
+	for _, metric := range m.summaries {
+		addSeries(summaryValues, sanitizeMetricName(metric.Name), metric.Name, metric.Labels, metric)
+	}
+
+	var result strings.Builder
+	claimed := make(map[string]string, len(gaugeValues)+len(counterValues)+len(histogramValues)+len(summaryValues))
+	// одно имя не может принадлежать семействам разных типов: ни имя семейства,
+	// ни имена его серий (например, _sum гистограммы) не должны быть заняты
+	emit := func(name, mType string, suffixes ...string) bool {
+		names := append([]string{name}, suffixes...)
+		for i := 1; i < len(names); i++ {
+			names[i] = name + names[i]
+		}
+		for _, n := range names {
+			if owner, ok := claimed[n]; ok {
+				log.Printf("skip %s %s in exposition: name %s is already used by %s", mType, name, n, owner)
+				return false
+			}
+		}
+		for _, n := range names {
+			claimed[n] = mType + " " + name
+		}
+		result.WriteString("# TYPE " + name + " " + mType + "\n")
+		return true
+	}
+
+	for _, name := range sortedKeys(counterValues) {
+		sample, suffixes := name, []string(nil)
+		if openMetrics {
+			sample, suffixes = name+"_total", []string{"_total"}
+		}
+		if !emit(name, counter, suffixes...) {
+			continue
+		}
+		series := counterValues[name].series
+		for _, labels := range sortedKeys(series) {
+			result.WriteString(sample + labels + " " + strconv.FormatInt(series[labels], 10) + "\n")
+		}
+	}
+
+	for _, name := range sortedKeys(gaugeValues) {
+		if !emit(name, gauge) {
+			continue
+		}
+		series := gaugeValues[name].series
+		for _, labels := range sortedKeys(series) {
+			result.WriteString(name + labels + " " + formatFloat(series[labels]) + "\n")
+		}
+	}
+
+	for _, name := range sortedKeys(histogramValues) {
+		if !emit(name, histogram, "_bucket", "_sum", "_count") {
+			continue
+		}
+		series := histogramValues[name].series
+		for _, key := range sortedKeys(series) {
+			metric := series[key]
+			h := metric.Value
+			cumulative := h.Cumulative()
+			for i, count := range cumulative {
+				le := "+Inf"
+				if i < len(h.Bounds) {
+					le = formatFloat(h.Bounds[i])
+				}
+				result.WriteString(name + "_bucket" + formatLabels(metric.Labels, "le", le) + " " +
+					strconv.FormatUint(count, 10) + "\n")
+			}
+			result.WriteString(name + "_sum" + key + " " + formatFloat(h.Sum) + "\n")
+			result.WriteString(name + "_count" + key + " " + strconv.FormatUint(h.Count, 10) + "\n")
+		}
+	}
+
+	for _, name := range sortedKeys(summaryValues) {
+		if !emit(name, summary, "_sum", "_count") {
+			continue
+		}
+		series := summaryValues[name].series
+		for _, key := range sortedKeys(series) {
+			metric := series[key]
+			sm := metric.Value
+			for _, q := range sm.Quantiles {
+				result.WriteString(name + formatLabels(metric.Labels, "quantile", formatFloat(q.Quantile)) + " " +
+					formatFloat(q.Value) + "\n")
+			}
+			result.WriteString(name + "_sum" + key + " " + formatFloat(sm.Sum) + "\n")
+			result.WriteString(name + "_count" + key + " " + strconv.FormatUint(sm.Count, 10) + "\n")
+		}
+	}
+
+	if openMetrics {
+		result.WriteString("# EOF\n")
+	}
+
+	return result.String()
+}
+
+// formatLabels - формирует строку меток серии в фигурных скобках, добавляя служебную
+// метку extraKey (le или quantile), если она задана.
+func formatLabels(labels map[string]string, extraKey, extraValue string) string {
+	if extraKey != "" {
+		withExtra := make(map[string]string, len(labels)+1)
+		for k, v := range labels {
+			withExtra[k] = v
+		}
+		withExtra[extraKey] = extraValue
+		labels = withExtra
+	}
+	if len(labels) == 0 {
+		return ""
+	}
+	return "{" + models.FormatLabels(labels) + "}"
+}
+
+// sanitizeMetricName - приводит идентификатор метрики к допустимому имени Prometheus:
+// [a-zA-Z_:][a-zA-Z0-9_:]*. Недопустимые символы заменяются на '_'.
+func sanitizeMetricName(name string) string {
+	if name == "" {
+		return "_"
+	}
+
+	var b strings.Builder
+	b.Grow(len(name) + 1)
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// formatFloat - форматирует значение так же, как это делает клиентская библиотека Prometheus.
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// sortedKeys - возвращает отсортированные ключи карты.
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/Sofja96/go-metrics.git/internal/models"
+	middleware2 "github.com/Sofja96/go-metrics.git/internal/server/middleware"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+	storagemock "github.com/Sofja96/go-metrics.git/internal/server/storage/mocks"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	type mockBehavior func(m *mocks)
+
+	gauges := []storage.GaugeMetric{
+		{Name: "HeapAlloc", Value: 1024},
+		{Name: "HeapAlloc", Labels: map[string]string{"host": "agent-1", "dc": "eu"}, Value: 2048},
+		{Name: "CPU.utilization-1", Value: 0.5},
+		{Name: "1xx", Value: 2},
+	}
+	counters := []storage.CounterMetric{
+		{Name: "PollCount", Value: 10},
+		{Name: "PollCount", Labels: map[string]string{"host": "agent-\"1\""}, Value: 5},
+		{Name: "requests_total", Value: 3},
+	}
+	histograms := []storage.HistogramMetric{
+		{Name: "latency", Labels: map[string]string{"host": "a"}, Value: models.Histogram{
+			Bounds: []float64{0.1, 1},
+			Counts: []uint64{1, 2, 1},
+			Count:  4,
+			Sum:    3.2,
+		}},
+	}
+	summaries := []storage.SummaryMetric{
+		{Name: "size", Value: models.SummaryValue{
+			Quantiles: []models.Quantile{{Quantile: 0.5, Value: 10}, {Quantile: 0.99, Value: 20}},
+			Count:     3,
+			Sum:       35,
+		}},
+	}
+	distributions := "# TYPE latency histogram\n" +
+		"latency_bucket{host=\"a\",le=\"0.1\"} 1\n" +
+		"latency_bucket{host=\"a\",le=\"1\"} 3\n" +
+		"latency_bucket{host=\"a\",le=\"+Inf\"} 4\n" +
+		"latency_sum{host=\"a\"} 3.2\n" +
+		"latency_count{host=\"a\"} 4\n" +
+		"# TYPE size summary\n" +
+		"size{quantile=\"0.5\"} 10\n" +
+		"size{quantile=\"0.99\"} 20\n" +
+		"size_sum 35\n" +
+		"size_count 3\n"
+
+	tests := []struct {
+		name                string
+		accept              string
+		mockBehavior        mockBehavior
+		expectedStatusCode  int
+		expectedContentType string
+		expectedBody        string
+	}{
+		{
+			name: "PrometheusTextFormat",
+			mockBehavior: func(m *mocks) {
+				m.storage.EXPECT().GetAllGauges(gomock.Any()).Return(gauges, nil)
+				m.storage.EXPECT().GetAllCounters(gomock.Any()).Return(counters, nil)
+				m.storage.EXPECT().GetAllHistograms(gomock.Any()).Return(histograms, nil)
+				m.storage.EXPECT().GetAllSummaries(gomock.Any()).Return(summaries, nil)
+			},
+			expectedStatusCode:  http.StatusOK,
+			expectedContentType: prometheusContentType,
+			expectedBody: "# TYPE PollCount counter\n" +
+				"PollCount 10\n" +
+				"PollCount{host=\"agent-\\\"1\\\"\"} 5\n" +
+				"# TYPE requests_total counter\n" +
+				"requests_total 3\n" +
+				"# TYPE CPU_utilization_1 gauge\n" +
+				"CPU_utilization_1 0.5\n" +
+				"# TYPE HeapAlloc gauge\n" +
+				"HeapAlloc 1024\n" +
+				"HeapAlloc{dc=\"eu\",host=\"agent-1\"} 2048\n" +
+				"# TYPE _1xx gauge\n" +
+				"_1xx 2\n" +
+				distributions,
+		},
+		{
+			name:   "OpenMetricsFormat",
+			accept: "application/openmetrics-text; version=1.0.0,text/plain;version=0.0.4;q=0.5",
+			mockBehavior: func(m *mocks) {
+				m.storage.EXPECT().GetAllGauges(gomock.Any()).Return(gauges, nil)
+				m.storage.EXPECT().GetAllCounters(gomock.Any()).Return(counters, nil)
+				m.storage.EXPECT().GetAllHistograms(gomock.Any()).Return(histograms, nil)
+				m.storage.EXPECT().GetAllSummaries(gomock.Any()).Return(summaries, nil)
+			},
+			expectedStatusCode:  http.StatusOK,
+			expectedContentType: openMetricsContentType,
+			expectedBody: "# TYPE PollCount counter\n" +
+				"PollCount_total 10\n" +
+				"PollCount_total{host=\"agent-\\\"1\\\"\"} 5\n" +
+				"# TYPE requests counter\n" +
+				"requests_total 3\n" +
+				"# TYPE CPU_utilization_1 gauge\n" +
+				"CPU_utilization_1 0.5\n" +
+				"# TYPE HeapAlloc gauge\n" +
+				"HeapAlloc 1024\n" +
+				"HeapAlloc{dc=\"eu\",host=\"agent-1\"} 2048\n" +
+				"# TYPE _1xx gauge\n" +
+				"_1xx 2\n" +
+				distributions +
+				"# EOF\n",
+		},
+		{
+			name: "ErrorGetAllGauges",
+			mockBehavior: func(m *mocks) {
+				m.storage.EXPECT().GetAllGauges(gomock.Any()).Return(nil, errors.New("error get all gauges metrics"))
+			},
+			expectedStatusCode: http.StatusInternalServerError,
+		},
+		{
+			name: "ErrorGetAllCounters",
+			mockBehavior: func(m *mocks) {
+				m.storage.EXPECT().GetAllGauges(gomock.Any()).Return(gauges, nil)
+				m.storage.EXPECT().GetAllCounters(gomock.Any()).Return(nil, errors.New("error get all counters metrics"))
+			},
+			expectedStatusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			m := &mocks{
+				storage: storagemock.NewMockStorage(c),
+				logger:  *zap.NewNop().Sugar(),
+			}
+
+			tt.mockBehavior(m)
+			e := echo.New()
+			e.Use(middleware2.WithLogging(m.logger))
+			e.GET("/metrics", PrometheusMetrics(m.storage))
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+
+			e.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.expectedStatusCode, w.Code)
+			if tt.expectedStatusCode == http.StatusOK {
+				assert.Equal(t, tt.expectedContentType, w.Header().Get("Content-Type"))
+				assert.Equal(t, tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestSanitizeMetricName(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "Valid", input: "HeapAlloc", expected: "HeapAlloc"},
+		{name: "WithColon", input: "job:requests", expected: "job:requests"},
+		{name: "InvalidChars", input: "cpu.usage-total", expected: "cpu_usage_total"},
+		{name: "LeadingDigit", input: "9lives", expected: "_9lives"},
+		{name: "Unicode", input: "метрика", expected: "_______"},
+		{name: "Empty", input: "", expected: "_"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, sanitizeMetricName(tt.input))
+		})
+	}
+}
+
+func TestWriteExpositionCollisions(t *testing.T) {
+	tests := []struct {
+		name        string
+		metrics     exposition
+		openMetrics bool
+		expected    string
+	}{
+		{
+			name: "SanitizedNamesCollide",
+			metrics: exposition{gauges: []storage.GaugeMetric{
+				{Name: "a.b", Value: 1},
+				{Name: "a-b", Value: 2},
+				{Name: "a.b", Labels: map[string]string{"host": "x"}, Value: 3},
+			}},
+			expected: "# TYPE a_b gauge\n" +
+				"a_b 2\n",
+		},
+		{
+			name: "CounterWithTotalSuffixCollides",
+			metrics: exposition{counters: []storage.CounterMetric{
+				{Name: "requests_total", Value: 3},
+				{Name: "requests", Value: 5},
+			}},
+			openMetrics: true,
+			expected: "# TYPE requests counter\n" +
+				"requests_total 5\n" +
+				"# EOF\n",
+		},
+		{
+			name: "CounterWithTotalSuffixInTextFormat",
+			metrics: exposition{counters: []storage.CounterMetric{
+				{Name: "requests_total", Value: 3},
+				{Name: "requests", Value: 5},
+			}},
+			expected: "# TYPE requests counter\n" +
+				"requests 5\n" +
+				"# TYPE requests_total counter\n" +
+				"requests_total 3\n",
+		},
+		{
+			name: "GaugeCollidesWithCounter",
+			metrics: exposition{
+				gauges:   []storage.GaugeMetric{{Name: "PollCount", Value: 1.5}},
+				counters: []storage.CounterMetric{{Name: "PollCount", Value: 10}},
+			},
+			expected: "# TYPE PollCount counter\n" +
+				"PollCount 10\n",
+		},
+		{
+			name: "GaugeCollidesWithCounterTotal",
+			metrics: exposition{
+				gauges:   []storage.GaugeMetric{{Name: "requests_total", Value: 1.5}},
+				counters: []storage.CounterMetric{{Name: "requests", Value: 10}},
+			},
+			openMetrics: true,
+			expected: "# TYPE requests counter\n" +
+				"requests_total 10\n" +
+				"# EOF\n",
+		},
+		{
+			name: "HistogramCollidesWithGauge",
+			metrics: exposition{
+				gauges: []storage.GaugeMetric{{Name: "latency_sum", Value: 7}},
+				histograms: []storage.HistogramMetric{{Name: "latency", Value: models.Histogram{
+					Bounds: []float64{1},
+					Counts: []uint64{1, 0},
+					Count:  1,
+					Sum:    0.5,
+				}}},
+			},
+			expected: "# TYPE latency_sum gauge\n" +
+				"latency_sum 7\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, writeExposition(tt.metrics, tt.openMetrics))
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Sofja96/go-metrics.git/internal/server/query"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+)
+
+// queryRequest - тело запроса к /api/v1/query.
+type queryRequest struct {
+	Query string `json:"query"`
+}
+
+// Query - обработчик, вычисляющий выражение языка запросов (см. пакет query) над текущими
+// значениями и историей метрик и отдающий ряды результата в JSON.
+func Query(s storage.Storage) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx := c.Request().Context()
+
+		if c.Request().Header.Get("Content-Type") != "application/json" {
+			return c.String(http.StatusUnsupportedMediaType, "")
+		}
+		var req queryRequest
+		if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+			return c.String(http.StatusBadRequest, "Error in JSON decode: "+err.Error())
+		}
+
+		result, err := query.Exec(ctx, s, req.Query, time.Now())
+		if errors.Is(err, query.ErrSyntax) {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+		if errors.Is(err, storage.ErrUnsupported) {
+			return c.String(http.StatusNotImplemented, err.Error())
+		}
+		if err != nil {
+			return c.String(http.StatusInternalServerError, "error execute query")
+		}
+
+		return c.JSON(http.StatusOK, result)
+	}
+}
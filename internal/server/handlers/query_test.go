@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Sofja96/go-metrics.git/internal/server/query"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage/memory"
+)
+
+func TestQuery(t *testing.T) {
+	ctx := context.Background()
+	s, err := memory.New(ctx, memory.Options{})
+	require.NoError(t, err)
+	_, err = s.UpdateGauge(ctx, `Alloc{host="agent-1"}`, 1.5)
+	require.NoError(t, err)
+	_, err = s.UpdateGauge(ctx, `Alloc{host="agent-2"}`, 3)
+	require.NoError(t, err)
+	_, err = s.UpdateCounter(ctx, "PollCount", 5)
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.POST("/api/v1/query", Query(s))
+
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		wantCode    int
+		wantSeries  []query.Series
+	}{
+		{
+			name:        "Selector",
+			body:        `{"query":"Alloc{host=\"agent-1\"}"}`,
+			contentType: "application/json",
+			wantCode:    http.StatusOK,
+			wantSeries:  []query.Series{{Name: "Alloc", Labels: map[string]string{"host": "agent-1"}, Value: 1.5}},
+		},
+		{
+			name:        "Topk",
+			body:        `{"query":"topk(1, Alloc)"}`,
+			contentType: "application/json",
+			wantCode:    http.StatusOK,
+			wantSeries:  []query.Series{{Name: "Alloc", Labels: map[string]string{"host": "agent-2"}, Value: 3}},
+		},
+		{
+			name:        "MaxOverTypes",
+			body:        `{"query":"max(*)"}`,
+			contentType: "application/json",
+			wantCode:    http.StatusOK,
+			wantSeries:  []query.Series{{Value: 5}},
+		},
+		{
+			name:        "EmptyResult",
+			body:        `{"query":"rate(Unknown[5m])"}`,
+			contentType: "application/json",
+			wantCode:    http.StatusOK,
+			wantSeries:  []query.Series{},
+		},
+		{
+			name:        "InvalidQuery",
+			body:        `{"query":"avg(Alloc"}`,
+			contentType: "application/json",
+			wantCode:    http.StatusBadRequest,
+		},
+		{
+			name:        "InvalidJSON",
+			body:        `{"query":`,
+			contentType: "application/json",
+			wantCode:    http.StatusBadRequest,
+		},
+		{
+			name:        "InvalidContentType",
+			body:        `{"query":"Alloc"}`,
+			contentType: "text/plain",
+			wantCode:    http.StatusUnsupportedMediaType,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/query", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantCode, rec.Code)
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var result query.Result
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+			assert.Equal(t, tt.wantSeries, result.Series)
+			assert.False(t, result.Time.IsZero())
+		})
+	}
+}
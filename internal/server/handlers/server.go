@@ -2,30 +2,47 @@ package handlers
 
 import (
 	"context"
-	"crypto/rsa"
+	"crypto/tls"
+	"errors"
 	"log"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/labstack/echo/v4"
 	"go.uber.org/zap"
 
+	"github.com/Sofja96/go-metrics.git/internal/keyring"
+	"github.com/Sofja96/go-metrics.git/internal/replay"
+	"github.com/Sofja96/go-metrics.git/internal/server/alerting"
 	"github.com/Sofja96/go-metrics.git/internal/server/config"
 	"github.com/Sofja96/go-metrics.git/internal/server/grpcserver"
 	"github.com/Sofja96/go-metrics.git/internal/server/middleware"
+	"github.com/Sofja96/go-metrics.git/internal/server/statsd"
 	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage/boltdb"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage/cache"
 	"github.com/Sofja96/go-metrics.git/internal/server/storage/database"
 	"github.com/Sofja96/go-metrics.git/internal/server/storage/memory"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage/notify"
+	"github.com/Sofja96/go-metrics.git/internal/tlsconfig"
 )
 
 // APIServer - структура настроек API сервера.
 type APIServer struct {
-	echo    *echo.Echo
-	address string
-	logger  zap.SugaredLogger
+	echo      *echo.Echo
+	address   string
+	logger    zap.SugaredLogger
+	tlsConfig *tls.Config
+
+	store      storage.Storage
+	stop       context.CancelFunc // останавливает серверы gRPC и StatsD и фоновые задачи
+	background sync.WaitGroup     // серверы и фоновые задачи, обращающиеся к store
 }
 
 // New - создает, инициализурет и конфигурирует новый экземпляр ApiServer.
 func New(ctx context.Context) *APIServer {
+	ctx, stop := context.WithCancel(ctx)
 	c, err := config.LoadConfig()
 	if err != nil {
 		log.Printf("error load config: %v", err)
@@ -37,77 +54,206 @@ func New(ctx context.Context) *APIServer {
 	}
 	defer logger.Sync()
 
+	tlsConfig, err := tlsconfig.Server(c.TLSCert, c.TLSKey, c.TLSClientCA)
+	if err != nil {
+		log.Fatalf("Failed to load TLS config: %v", err)
+	}
+
+	trustedClients := tlsconfig.ParseNames(c.TrustedClients)
+	if len(trustedClients) != 0 && c.TLSClientCA == "" {
+		log.Fatalf("Trusted clients require client CA (TLS_CLIENT_CA)")
+	}
+
 	a := &APIServer{
-		echo:    echo.New(),
-		address: c.Address,
-		logger:  *logger.Sugar(),
+		echo:      echo.New(),
+		address:   c.Address,
+		logger:    *logger.Sugar(),
+		tlsConfig: tlsConfig,
+		stop:      stop,
 	}
 
-	var store storage.Storage
+	store, err := storage.Open(ctx, StorageURL(c))
+	if err != nil {
+		log.Fatalf("Failed to open storage: %v", err)
+	}
 
-	if len(c.DatabaseDSN) == 0 {
-		store, err = memory.NewInMemStorage(ctx, c.StoreInterval, c.FilePath, c.Restore)
-		if err != nil {
-			log.Print(err)
-		}
-	} else {
-		store, err = database.NewStorage(ctx, c.DatabaseDSN)
+	var cached *cache.Storage
+	if c.CacheSize > 0 || c.CacheTTL > 0 {
+		cached, err = cache.New(store, cache.Options{TTL: c.CacheTTL, MaxEntries: c.CacheSize})
 		if err != nil {
-			log.Print(err)
+			log.Fatalf("Failed to create read cache: %v", err)
 		}
+		store = cached
 	}
 
-	a.echo.Use(middleware.WithLogging(a.logger))
+	hub := notify.NewHub()
+	store = notify.New(store, hub)
+	a.store = store
 
-	pkFile := c.CryptoKey
-	var privateKey *rsa.PrivateKey
-	if len(pkFile) != 0 {
-		privateKey, err = middleware.LoadPrivateKey(pkFile)
+	ttlRules, err := storage.ParseTTLRules(c.MetricTTL)
+	if err != nil {
+		log.Fatalf("Failed to parse metric ttl: %v", err)
+	}
+	if d, ok := store.(storage.Deleter); ok {
+		a.goBackground(func() { storage.RunExpiry(ctx, d, ttlRules) })
+	}
+
+	retention, err := storage.ParseRetention(c.Retention)
+	if err != nil {
+		log.Fatalf("Failed to parse retention policy: %v", err)
+	}
+	if compactor, ok := store.(storage.Compactor); ok {
+		a.goBackground(func() { storage.RunCompactor(ctx, compactor, retention) })
+	}
+
+	var (
+		alerts   *alerting.Engine
+		silences *alerting.Silences
+	)
+	if c.AlertRules != "" {
+		rules, err := alerting.LoadRules(c.AlertRules)
 		if err != nil {
-			log.Fatalf("Failed to load private key: %v", err)
+			log.Fatalf("Failed to load alerting rules: %v", err)
+		}
+		alerts = alerting.NewEngine(store, rules)
+		silences = alerting.NewSilences()
+
+		var notifier *alerting.Notifier
+		if c.AlertReceivers != "" {
+			receivers, err := alerting.LoadNotifierConfig(c.AlertReceivers)
+			if err != nil {
+				log.Fatalf("Failed to load alert receivers: %v", err)
+			}
+			notifier = alerting.NewNotifier(receivers, silences)
 		}
-		a.echo.Use(middleware.DecryptMiddleware(privateKey))
+		a.goBackground(func() { alerts.Run(ctx, c.AlertInterval, notifier) })
 	}
 
-	key := c.HashKey
-	if len(key) != 0 {
-		a.echo.Use(middleware.HashMacMiddleware([]byte(key)))
+	a.echo.Use(middleware.WithLogging(a.logger))
+
+	keys, err := keyring.New(c.HashKey, c.CryptoKey, c.Keyring)
+	if err != nil {
+		log.Fatalf("Failed to load keys: %v", err)
 	}
+	go keys.ReloadOnSignal(ctx, syscall.SIGHUP)
+	a.echo.Use(middleware.KeyringDecryptMiddleware(keys))
+
+	guard := replay.NewGuard(c.MaxClockSkew, c.NonceCacheSize)
+	a.echo.Use(middleware.KeyringHashMacMiddleware(keys, guard))
 
 	trustedSubnet := c.TrustedSubnet
-	a.echo.Use(middleware.ValidateTrustedSubnet(trustedSubnet))
+	if len(trustedClients) != 0 {
+		a.echo.Use(middleware.ValidateTrustedClient(trustedClients))
+	} else {
+		a.echo.Use(middleware.ValidateTrustedSubnet(trustedSubnet))
+	}
 
 	a.echo.Use(middleware.GzipMiddleware())
 	a.echo.POST("/update/", UpdateJSON(store))
 	a.echo.POST("/updates/", UpdatesBatch(store))
 	a.echo.POST("/value/", ValueJSON(store))
 	a.echo.GET("/", GetAllMetrics(store))
+	a.echo.GET("/metrics", PrometheusMetrics(store))
 	a.echo.GET("/value/:typeM/:nameM", ValueMetric(store))
+	if d, ok := store.(storage.Deleter); ok {
+		a.echo.DELETE("/value/:typeM/:nameM", DeleteMetric(d))
+	}
+	if r, ok := store.(storage.Ranger); ok {
+		a.echo.GET("/history/:typeM/:nameM", History(r))
+	}
 	a.echo.POST("/update/:typeM/:nameM/:valueM", Webhook(store))
 	a.echo.GET("/ping", Ping(store))
+	a.echo.GET("/watch", Watch(hub))
+	a.echo.POST("/api/v1/query", Query(store))
+	if cached != nil {
+		a.echo.GET("/api/v1/cache", CacheStats(cached))
+	}
+	if alerts != nil {
+		a.echo.GET("/api/v1/alerts", Alerts(alerts))
+		a.echo.GET("/api/v1/silences", Silences(silences))
+		a.echo.POST("/api/v1/silences", AddSilence(silences))
+		a.echo.DELETE("/api/v1/silences/:id", DeleteSilence(silences))
+	}
 
 	grpcAddress := c.GrpcAddress
 	grpcServer := &grpcserver.MetricsServer{
-		Address:       grpcAddress,
-		Logger:        &a.logger,
-		TrustedSubnet: trustedSubnet,
-		PrivateKey:    privateKey,
-		HashKey:       key,
+		Address:        grpcAddress,
+		Logger:         &a.logger,
+		TrustedSubnet:  trustedSubnet,
+		TrustedClients: trustedClients,
+		TLSConfig:      tlsConfig,
+		Keyring:        keys,
+		Replay:         guard,
+		Hub:            hub,
+		Alerts:         alerts,
 	}
 	if len(grpcAddress) != 0 {
-		go grpcServer.StartGRPCServer(store)
+		a.goBackground(func() {
+			if err := grpcServer.ListenAndServe(ctx, store); err != nil {
+				log.Fatalf("Failed to run gRPC server: %v", err)
+			}
+		})
+	}
+
+	if c.StatsdAddress != "" || c.StatsdTCPAddress != "" {
+		statsdServer := statsd.New(store, c.StatsdFlushInterval)
+		a.goBackground(func() {
+			if err := statsdServer.ListenAndServe(ctx, c.StatsdAddress, c.StatsdTCPAddress); err != nil {
+				log.Fatalf("Failed to run statsd listener: %v", err)
+			}
+		})
 	}
 
 	return a
 }
 
+// StorageURL - возвращает URL хранилища из настроек: STORAGE_URL, а без него URL, собранный
+// из DATABASE_DSN, BOLT_PATH или настроек сохранения локального хранилища в файл.
+func StorageURL(c *config.Config) string {
+	switch {
+	case c.StorageURL != "":
+		return c.StorageURL
+	case c.DatabaseDSN != "":
+		return database.URL(c.DatabaseDSN)
+	case c.BoltPath != "":
+		return boltdb.URL(c.BoltPath)
+	default:
+		return memory.Options{
+			StoreInterval:   c.StoreInterval,
+			FilePath:        c.FilePath,
+			Restore:         c.Restore,
+			Backups:         c.StoreBackups,
+			WALSync:         memory.SyncPolicy(c.WALSync),
+			WALSyncInterval: c.WALSyncInterval,
+		}.URL()
+	}
+}
+
+// goBackground - запускает f в отдельной горутине; Start дожидается ее завершения
+// перед закрытием хранилища.
+func (a *APIServer) goBackground(f func()) {
+	a.background.Add(1)
+	go func() {
+		defer a.background.Done()
+		f()
+	}()
+}
+
 // Start - запускает сервер на заданном адресе.
 func (a *APIServer) Start(ctx context.Context) error {
 	serverErrors := make(chan error, 1)
 
 	go func() {
 		log.Println("Starting server on", a.address)
-		if err := a.echo.Start(a.address); err != nil {
+		var err error
+		if a.tlsConfig != nil {
+			a.echo.TLSServer.TLSConfig = a.tlsConfig
+			a.echo.TLSServer.Addr = a.address
+			err = a.echo.StartServer(a.echo.TLSServer)
+		} else {
+			err = a.echo.Start(a.address)
+		}
+		if err != nil {
 			serverErrors <- err
 		}
 	}()
@@ -122,9 +268,22 @@ func (a *APIServer) Start(ctx context.Context) error {
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	if err := a.echo.Shutdown(shutdownCtx); err != nil {
-		log.Printf("Error during server shutdown: %v\n", err)
-		return err
+	shutdownErr := a.echo.Shutdown(shutdownCtx)
+	if shutdownErr != nil {
+		log.Printf("Error during server shutdown: %v\n", shutdownErr)
+	}
+
+	// хранилище закрывается после остановки всех, кто в него пишет
+	if a.stop != nil {
+		a.stop()
+	}
+	a.background.Wait()
+	if err := storage.Close(a.store); err != nil {
+		log.Printf("Error closing storage: %v\n", err)
+		return errors.Join(shutdownErr, err)
+	}
+	if shutdownErr != nil {
+		return shutdownErr
 	}
 
 	log.Println("Server shut down gracefully")
@@ -10,6 +10,7 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/Sofja96/go-metrics.git/internal/server/config"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
 )
 
 func TestNew(t *testing.T) {
@@ -58,3 +59,102 @@ func TestStart(t *testing.T) {
 
 	cancel()
 }
+
+func TestStorageURL(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.Config
+		want string
+	}{
+		{
+			name: "Storage URL overrides legacy settings",
+			cfg:  config.Config{StorageURL: "postgres://metrics@localhost/metrics", DatabaseDSN: "host=localhost", BoltPath: "/tmp/metrics.db"},
+			want: "postgres://metrics@localhost/metrics",
+		},
+		{
+			name: "Database URL",
+			cfg:  config.Config{DatabaseDSN: "postgres://metrics@localhost/metrics?sslmode=disable"},
+			want: "postgres://metrics@localhost/metrics?sslmode=disable",
+		},
+		{
+			name: "Database key value string",
+			cfg:  config.Config{DatabaseDSN: "host=localhost password='a b'"},
+			want: "postgres://?dsn=host%3Dlocalhost+password%3D%27a+b%27",
+		},
+		{
+			name: "Bolt path",
+			cfg:  config.Config{BoltPath: "/var/lib/metrics/metrics.db"},
+			want: "file:///var/lib/metrics/metrics.db",
+		},
+		{
+			name: "Memory storage with file",
+			cfg:  config.Config{FilePath: "/tmp/metrics.json", Restore: true, StoreBackups: 2, WALSync: "always"},
+			want: "memory://?backups=2&file=%2Ftmp%2Fmetrics.json&restore=true&store_interval=0&wal_sync=always",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, StorageURL(&tt.cfg))
+		})
+	}
+}
+
+// closingStorage - хранилище, запоминающее момент закрытия.
+type closingStorage struct {
+	storage.Storage
+	closed chan struct{}
+}
+
+func (s *closingStorage) Close() error {
+	close(s.closed)
+	return nil
+}
+
+func TestStartClosesStorage(t *testing.T) {
+	logger, err := zap.NewDevelopment()
+	assert.NoError(t, err)
+	defer logger.Sync()
+
+	store := &closingStorage{closed: make(chan struct{})}
+	server := &APIServer{
+		echo:    echo.New(),
+		address: "localhost:0",
+		logger:  *logger.Sugar(),
+		store:   store,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	background, stop := context.WithCancel(context.Background())
+	server.stop = stop
+	// фоновая задача пишет в хранилище и после отмены: оно должно закрыться только после ее завершения
+	finished := make(chan struct{})
+	server.goBackground(func() {
+		<-background.Done()
+		time.Sleep(20 * time.Millisecond)
+		select {
+		case <-store.closed:
+			t.Error("storage closed before background task finished")
+		default:
+		}
+		close(finished)
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- server.Start(ctx) }()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not shut down")
+	}
+	<-finished
+	select {
+	case <-store.closed:
+	default:
+		t.Error("storage was not closed")
+	}
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Sofja96/go-metrics.git/internal/server/storage/notify"
+)
+
+// watchKeepAlive - интервал отправки комментария, не дающего прокси закрыть простаивающее соединение.
+const watchKeepAlive = 15 * time.Second
+
+// Watch - отправляет изменения метрик в формате Server-Sent Events. Параметры запроса
+// prefix и type ограничивают изменения по началу имени и типу метрики. Каждое изменение
+// передается событием metric с новым состоянием метрики в JSON, удаление серии - событием
+// deleted с ее именем, типом и метками; если клиент не успевал читать изменения, перед
+// следующим событием передается событие dropped с числом пропущенных.
+func Watch(hub *notify.Hub) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		filter := notify.Filter{
+			Prefix: c.QueryParam("prefix"),
+			Type:   c.QueryParam("type"),
+		}
+		switch filter.Type {
+		case "", gauge, counter, histogram, summary:
+		default:
+			return c.String(http.StatusBadRequest,
+				"Invalid metric type. Metric type can only be 'gauge', 'counter', 'histogram' or 'summary'")
+		}
+
+		sub := hub.Subscribe(filter, 0)
+		defer sub.Close()
+
+		resp := c.Response()
+		resp.Header().Set(echo.HeaderContentType, "text/event-stream")
+		resp.Header().Set(echo.HeaderCacheControl, "no-cache")
+		resp.Header().Set(echo.HeaderConnection, "keep-alive")
+		resp.WriteHeader(http.StatusOK)
+		resp.Flush()
+
+		keepAlive := time.NewTicker(watchKeepAlive)
+		defer keepAlive.Stop()
+
+		ctx := c.Request().Context()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-keepAlive.C:
+				if _, err := fmt.Fprint(resp, ": keep-alive\n\n"); err != nil {
+					return nil
+				}
+			case e, ok := <-sub.C():
+				if !ok {
+					return nil
+				}
+				if dropped := sub.TakeDropped(); dropped > 0 {
+					if _, err := fmt.Fprintf(resp, "event: dropped\ndata: %d\n\n", dropped); err != nil {
+						return nil
+					}
+				}
+				name := "metric"
+				if e.Deleted {
+					name = "deleted"
+				}
+				data, err := json.Marshal(e.Metrics)
+				if err != nil {
+					return nil
+				}
+				if _, err := fmt.Fprintf(resp, "event: %s\ndata: %s\n\n", name, data); err != nil {
+					return nil
+				}
+			}
+			resp.Flush()
+		}
+	}
+}
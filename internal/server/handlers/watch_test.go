@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Sofja96/go-metrics.git/internal/models"
+	middleware2 "github.com/Sofja96/go-metrics.git/internal/server/middleware"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage/notify"
+	"github.com/Sofja96/go-metrics.git/internal/utils"
+)
+
+func TestWatch(t *testing.T) {
+	hub := notify.NewHub()
+	e := echo.New()
+	e.Use(middleware2.GzipMiddleware())
+	e.GET("/watch", Watch(hub))
+
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	// readEvent - читает из потока одно событие SSE.
+	readEvent := func(r *bufio.Reader) string {
+		var lines []string
+		for {
+			line, err := r.ReadString('\n')
+			require.NoError(t, err)
+			line = strings.TrimSuffix(line, "\n")
+			if line == "" {
+				return strings.Join(lines, "\n")
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		encoding string
+	}{
+		{name: "Plain"},
+		{name: "Gzip", encoding: "gzip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, srv.URL+"/watch?type=gauge&prefix=Heap", nil)
+			require.NoError(t, err)
+			req.Header.Set("Accept-Encoding", tt.encoding)
+
+			resp, err := (&http.Client{Transport: &http.Transport{DisableCompression: true}}).Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+			var body io.Reader = resp.Body
+			if tt.encoding == "gzip" {
+				zr, err := gzip.NewReader(resp.Body)
+				require.NoError(t, err)
+				body = zr
+			}
+
+			require.Eventually(t, func() bool { return hub.Subscribers() == 1 }, time.Second, 10*time.Millisecond)
+			hub.Publish(
+				notify.Event{Metrics: models.Metrics{ID: "PollCount", MType: counter, Delta: utils.IntPtr(1)}},
+				notify.Event{Metrics: models.Metrics{ID: "HeapAlloc", MType: gauge, Value: utils.FloatPtr(1.5)}},
+				notify.Event{Metrics: models.Metrics{ID: "HeapAlloc", MType: gauge}, Deleted: true},
+			)
+
+			r := bufio.NewReader(body)
+			assert.Equal(t, "event: metric\ndata: {\"id\":\"HeapAlloc\",\"type\":\"gauge\",\"value\":1.5}", readEvent(r))
+			assert.Equal(t, "event: deleted\ndata: {\"id\":\"HeapAlloc\",\"type\":\"gauge\"}", readEvent(r))
+		})
+		require.Eventually(t, func() bool { return hub.Subscribers() == 0 }, time.Second, 10*time.Millisecond)
+	}
+
+	t.Run("InvalidType", func(t *testing.T) {
+		resp, err := http.Get(srv.URL + "/watch?type=unknown")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
@@ -2,18 +2,15 @@ package middleware
 
 import (
 	"bytes"
-	"crypto/rand"
 	"crypto/rsa"
-	"crypto/sha256"
-	"crypto/x509"
-	"encoding/pem"
-	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"os"
 
 	"github.com/labstack/echo/v4"
+
+	"github.com/Sofja96/go-metrics.git/internal/envelope"
+	"github.com/Sofja96/go-metrics.git/internal/keyring"
 )
 
 // LoadPrivateKey - функция для загрузки приватного ключа из файла
@@ -21,41 +18,51 @@ func LoadPrivateKey(path string) (*rsa.PrivateKey, error) {
 	if path == "" {
 		return nil, nil
 	}
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("error reading private key file: %w", err)
-	}
-
-	block, _ := pem.Decode(data)
-	if block == nil || block.Type != "RSA PRIVATE KEY" {
-		return nil, fmt.Errorf("invalid PEM format or missing private key")
-	}
-
-	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
-	if err != nil {
-		return nil, fmt.Errorf("error parsing private key: %w", err)
-	}
-	return privateKey, nil
+	return keyring.LoadPrivateKey(path)
 }
 
-// DecryptMiddleware - middleware для дешифровки данных, зашифрованных публичным ключом
+// DecryptMiddleware - middleware для дешифровки данных, зашифрованных публичным ключом,
+// с одним приватным ключом.
 func DecryptMiddleware(privateKey *rsa.PrivateKey) echo.MiddlewareFunc {
+	return KeyringDecryptMiddleware(keyring.FromKeys(nil, privateKey))
+}
+
+// KeyringDecryptMiddleware - middleware для дешифровки данных, зашифрованных публичным ключом.
+// Данные в формате конверта передаются с Content-Type envelope.ContentType,
+// данные старых агентов, зашифрованные блоками RSA, - с envelope.LegacyContentType.
+// Приватный ключ выбирается по заголовку keyring.CryptoKeyIDHeader.
+func KeyringDecryptMiddleware(kr *keyring.Keyring) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) (err error) {
+			if !kr.HasRSA() {
+				return next(c)
+			}
+
 			contentAsymmetric := c.Request().Header.Get("Content-Type")
-			if contentAsymmetric != "application/octet-stream" {
+			var decrypt func([]byte, *rsa.PrivateKey) ([]byte, error)
+			switch contentAsymmetric {
+			case envelope.ContentType:
+				decrypt = envelope.Open
+			case envelope.LegacyContentType:
+				decrypt = DecryptWithPrivateKey
+			default:
 				return next(c)
 			}
 
 			log.Printf("content-type: %s", contentAsymmetric)
 
+			privateKey, ok := kr.PrivateKey(c.Request().Header.Get(keyring.CryptoKeyIDHeader))
+			if !ok {
+				return c.String(http.StatusBadRequest, "unknown crypto key id")
+			}
+
 			body, err := io.ReadAll(c.Request().Body)
 			if err != nil {
 				log.Printf("error reading request body: %v", err)
 				return c.String(http.StatusInternalServerError, "error reading request body")
 			}
 
-			decryptedData, err := DecryptWithPrivateKey(body, privateKey)
+			decryptedData, err := decrypt(body, privateKey)
 			if err != nil {
 				log.Printf("error decrypting data: %v", err)
 				return c.String(http.StatusInternalServerError, "error decrypting data")
@@ -74,25 +81,7 @@ func DecryptMiddleware(privateKey *rsa.PrivateKey) echo.MiddlewareFunc {
 	}
 }
 
-// DecryptWithPrivateKey - функция для дешифровки данных с использованием приватного ключа
+// DecryptWithPrivateKey - функция для дешифровки данных, зашифрованных блоками RSA (прежний режим)
 func DecryptWithPrivateKey(data []byte, privateKey *rsa.PrivateKey) ([]byte, error) {
-	chunkSize := privateKey.Size()
-	var decryptedData []byte
-
-	for start := 0; start < len(data); start += chunkSize {
-		end := start + chunkSize
-		if end > len(data) {
-			end = len(data)
-		}
-		chunk := data[start:end]
-
-		decryptedChunk, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, chunk, nil)
-		if err != nil {
-			return nil, fmt.Errorf("error decrypting chunk: %w", err)
-		}
-
-		decryptedData = append(decryptedData, decryptedChunk...)
-	}
-
-	return decryptedData, nil
+	return envelope.DecryptChunked(data, privateKey)
 }
@@ -6,6 +6,7 @@ import (
 	"crypto/rsa"
 	"crypto/sha256"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -14,6 +15,7 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/Sofja96/go-metrics.git/internal/envelope"
 	"github.com/Sofja96/go-metrics.git/internal/utils"
 )
 
@@ -78,6 +80,32 @@ func TestMiddlewareDecryption(t *testing.T) {
 		assert.Equal(t, http.StatusOK, rec.Code, "expected status 200, got %d", rec.Code)
 	})
 
+	t.Run("envelope", func(t *testing.T) {
+		original := []byte("test metrics data")
+
+		sealed, err := envelope.Seal(original, publicKey)
+		assert.NoError(t, err)
+
+		e := echo.New()
+		e.Use(DecryptMiddleware(privateKey))
+		e.POST("/test", func(c echo.Context) error {
+			body, err := io.ReadAll(c.Request().Body)
+			if err != nil {
+				return err
+			}
+			return c.String(http.StatusOK, string(body))
+		})
+
+		req := httptest.NewRequest(http.MethodPost, "/test", bytes.NewReader(sealed))
+		req.Header.Set("Content-Type", envelope.ContentType)
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, string(original), rec.Body.String())
+	})
+
 	t.Run("invalid Content-Type", func(t *testing.T) {
 		original := []byte("test metrics data")
 
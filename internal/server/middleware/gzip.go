@@ -11,6 +11,7 @@ import (
 
 var (
 	_ http.ResponseWriter = (*compressWriter)(nil)
+	_ http.Flusher        = (*compressWriter)(nil)
 )
 
 // compressWriter реализует интерфейс http.ResponseWriter и позволяет прозрачно для сервера
@@ -42,6 +43,15 @@ func (c *compressWriter) WriteHeader(statusCode int) {
 	c.w.WriteHeader(statusCode)
 }
 
+// Flush досылает клиенту сжатые данные из буфера, не завершая поток gzip.
+// Нужен для потоковых ответов, например Server-Sent Events.
+func (c *compressWriter) Flush() {
+	_ = c.zw.Flush()
+	if f, ok := c.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 // Close закрывает gzip.Writer и досылает все данные из буфера.
 func (c *compressWriter) Close() error {
 	return c.zw.Close()
@@ -2,12 +2,16 @@ package middleware
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 
 	"github.com/labstack/echo/v4"
 
+	"github.com/Sofja96/go-metrics.git/internal/keyring"
+	"github.com/Sofja96/go-metrics.git/internal/replay"
 	"github.com/Sofja96/go-metrics.git/internal/utils"
 )
 
@@ -32,6 +36,11 @@ func (h *hashedWriter) hash() string {
 	return utils.ComputeHmac256(h.k, h.b.Bytes())
 }
 
+// isUpdateRequest - проверяет, что запрос обновляет метрики: /update/, /updates/ и /update/:typeM/:nameM/:valueM.
+func isUpdateRequest(r *http.Request) bool {
+	return r.Method == http.MethodPost && (r.URL.Path == "/updates/" || strings.HasPrefix(r.URL.Path, "/update/"))
+}
+
 func checkSign(key []byte, body []byte, hash string) error {
 	clientHash := utils.ComputeHmac256(key, body)
 	if clientHash != hash {
@@ -40,11 +49,32 @@ func checkSign(key []byte, body []byte, hash string) error {
 	return nil
 }
 
-// HashMacMiddleware - метод цифровой подписи передаваемых данных.
-func HashMacMiddleware(key []byte) echo.MiddlewareFunc {
+// HashMacMiddleware - метод цифровой подписи передаваемых данных с одним ключом.
+func HashMacMiddleware(key []byte, guard *replay.Guard) echo.MiddlewareFunc {
+	return KeyringHashMacMiddleware(keyring.FromKeys(key, nil), guard)
+}
+
+// KeyringHashMacMiddleware - метод цифровой подписи передаваемых данных.
+// Подписываются время отправки, nonce и тело запроса; guard отклоняет устаревшие
+// и повторно отправленные запросы. Ключ выбирается по заголовку keyring.KeyIDHeader.
+// Если ключ задан, запросы обновления метрик без подписи отклоняются.
+func KeyringHashMacMiddleware(kr *keyring.Keyring, guard *replay.Guard) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) (err error) {
-			if _, ok := c.Request().Header["Hashsha256"]; ok {
+			if !kr.HasHMAC() {
+				return next(c)
+			}
+
+			key, ok := kr.HMAC(c.Request().Header.Get(keyring.KeyIDHeader))
+			_, signed := c.Request().Header["Hashsha256"]
+			if !signed && isUpdateRequest(c.Request()) {
+				return c.String(http.StatusUnauthorized, "missing signature")
+			}
+			if signed {
+				if !ok {
+					return c.String(http.StatusBadRequest, "unknown key id")
+				}
+
 				bodyBytes, err := io.ReadAll(c.Request().Body)
 				if err != nil {
 					return c.String(http.StatusInternalServerError, "hashes are empty")
@@ -52,11 +82,22 @@ func HashMacMiddleware(key []byte) echo.MiddlewareFunc {
 
 				c.Request().Body = io.NopCloser(bytes.NewReader(bodyBytes))
 
-				err = checkSign(key, bodyBytes, c.Request().Header.Get("Hashsha256"))
+				timestamp := c.Request().Header.Get(replay.TimestampHeader)
+				nonce := c.Request().Header.Get(replay.NonceHeader)
+				err = checkSign(key, replay.Material(timestamp, nonce, bodyBytes), c.Request().Header.Get("Hashsha256"))
 				if err != nil {
 					return c.String(http.StatusBadRequest, "hashes are not equal")
 				}
 
+				if err = guard.Check(timestamp, nonce); err != nil {
+					if errors.Is(err, replay.ErrReplay) {
+						return c.String(http.StatusConflict, err.Error())
+					}
+					if errors.Is(err, replay.ErrCacheFull) {
+						return c.String(http.StatusServiceUnavailable, err.Error())
+					}
+					return c.String(http.StatusBadRequest, err.Error())
+				}
 			}
 
 			hashedWriter := newHashedWriter(c.Response(), key)
@@ -4,10 +4,16 @@ import (
 	"bytes"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/labstack/echo/v4"
 
+	"github.com/Sofja96/go-metrics.git/internal/keyring"
+	"github.com/Sofja96/go-metrics.git/internal/replay"
 	"github.com/Sofja96/go-metrics.git/internal/utils"
 )
 
@@ -15,18 +21,23 @@ func TestHashMacMiddleware(t *testing.T) {
 	key := []byte("test-secret-key")
 	e := echo.New()
 
-	e.Use(HashMacMiddleware(key))
+	e.Use(HashMacMiddleware(key, replay.NewGuard(time.Minute, 100)))
 
 	e.POST("/test", func(c echo.Context) error {
 		return c.String(http.StatusOK, "success")
 	})
 
-	t.Run("valid hash", func(t *testing.T) {
-		body := []byte("test body")
-		hash := utils.ComputeHmac256(key, body)
-
+	newRequest := func(body []byte, timestamp, nonce string) *http.Request {
 		req := httptest.NewRequest(http.MethodPost, "/test", bytes.NewReader(body))
-		req.Header.Set("Hashsha256", hash)
+		req.Header.Set("Hashsha256", utils.ComputeHmac256(key, replay.Material(timestamp, nonce, body)))
+		req.Header.Set(replay.TimestampHeader, timestamp)
+		req.Header.Set(replay.NonceHeader, nonce)
+		return req
+	}
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	t.Run("valid hash", func(t *testing.T) {
+		req := newRequest([]byte("test body"), now, "nonce-1")
 		rec := httptest.NewRecorder()
 
 		e.ServeHTTP(rec, req)
@@ -41,6 +52,41 @@ func TestHashMacMiddleware(t *testing.T) {
 		}
 	})
 
+	t.Run("replayed request", func(t *testing.T) {
+		req := newRequest([]byte("test body"), now, "nonce-1")
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusConflict {
+			t.Errorf("expected status 409, got %d", rec.Code)
+		}
+	})
+
+	t.Run("stale timestamp", func(t *testing.T) {
+		stale := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+		req := newRequest([]byte("test body"), stale, "nonce-2")
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rec.Code)
+		}
+	})
+
+	t.Run("tampered nonce", func(t *testing.T) {
+		req := newRequest([]byte("test body"), now, "nonce-3")
+		req.Header.Set(replay.NonceHeader, "nonce-4")
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rec.Code)
+		}
+	})
+
 	t.Run("invalid hash", func(t *testing.T) {
 		body := []byte("test body")
 		req := httptest.NewRequest(http.MethodPost, "/test", bytes.NewReader(body))
@@ -53,4 +99,115 @@ func TestHashMacMiddleware(t *testing.T) {
 			t.Errorf("expected status 400, got %d", rec.Code)
 		}
 	})
+
+	t.Run("unsigned update", func(t *testing.T) {
+		e.POST("/updates/", func(c echo.Context) error {
+			return c.String(http.StatusOK, "updated")
+		})
+		req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader([]byte(`[]`)))
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected status 401, got %d", rec.Code)
+		}
+	})
+
+	t.Run("unsigned read", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/test", bytes.NewReader([]byte("test body")))
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("expected status 200, got %d", rec.Code)
+		}
+	})
+}
+
+func TestHashMacMiddlewareCacheFull(t *testing.T) {
+	key := []byte("test-secret-key")
+	e := echo.New()
+	e.Use(HashMacMiddleware(key, replay.NewGuard(time.Minute, 1)))
+	e.POST("/test", func(c echo.Context) error {
+		return c.String(http.StatusOK, "success")
+	})
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	codes := make([]int, 0, 2)
+	for _, nonce := range []string{"nonce-1", "nonce-2"} {
+		body := []byte("test body")
+		req := httptest.NewRequest(http.MethodPost, "/test", bytes.NewReader(body))
+		req.Header.Set("Hashsha256", utils.ComputeHmac256(key, replay.Material(now, nonce, body)))
+		req.Header.Set(replay.TimestampHeader, now)
+		req.Header.Set(replay.NonceHeader, nonce)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		codes = append(codes, rec.Code)
+	}
+
+	if codes[0] != http.StatusOK || codes[1] != http.StatusServiceUnavailable {
+		t.Errorf("expected statuses [200 503], got %v", codes)
+	}
+}
+
+func TestKeyringHashMacMiddleware(t *testing.T) {
+	kr := keyring.FromKeys([]byte("old-key"), nil)
+	e := echo.New()
+	e.Use(KeyringHashMacMiddleware(kr, replay.NewGuard(time.Minute, 100)))
+	e.POST("/test", func(c echo.Context) error {
+		return c.String(http.StatusOK, "success")
+	})
+
+	keysFile := filepath.Join(t.TempDir(), "keyring.json")
+	err := os.WriteFile(keysFile, []byte(`{"hmac": [{"id": "2025-01", "secret": "new-key"}]}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := keyring.New("old-key", "", keysFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e2 := echo.New()
+	e2.Use(KeyringHashMacMiddleware(rotated, replay.NewGuard(time.Minute, 100)))
+	e2.POST("/test", func(c echo.Context) error {
+		return c.String(http.StatusOK, "success")
+	})
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	tests := []struct {
+		name     string
+		e        *echo.Echo
+		key      string
+		keyID    string
+		nonce    string
+		wantCode int
+	}{
+		{name: "DefaultKey", e: e, key: "old-key", nonce: "n1", wantCode: http.StatusOK},
+		{name: "UnknownKeyID", e: e, key: "new-key", keyID: "2025-01", nonce: "n2", wantCode: http.StatusBadRequest},
+		{name: "RotatedKey", e: e2, key: "new-key", keyID: "2025-01", nonce: "n3", wantCode: http.StatusOK},
+		{name: "LegacyKeyAfterRotation", e: e2, key: "old-key", nonce: "n4", wantCode: http.StatusOK},
+		{name: "WrongKeyForID", e: e2, key: "old-key", keyID: "2025-01", nonce: "n5", wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := []byte("test body")
+			req := httptest.NewRequest(http.MethodPost, "/test", bytes.NewReader(body))
+			req.Header.Set("Hashsha256", utils.ComputeHmac256([]byte(tt.key), replay.Material(now, tt.nonce, body)))
+			req.Header.Set(replay.TimestampHeader, now)
+			req.Header.Set(replay.NonceHeader, tt.nonce)
+			if tt.keyID != "" {
+				req.Header.Set(keyring.KeyIDHeader, tt.keyID)
+			}
+			rec := httptest.NewRecorder()
+
+			tt.e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("expected status %d, got %d", tt.wantCode, rec.Code)
+			}
+		})
+	}
 }
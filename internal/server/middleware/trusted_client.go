@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+
+	"github.com/Sofja96/go-metrics.git/internal/tlsconfig"
+)
+
+// ValidateTrustedClient - middleware для проверки клиента по CN/SAN сертификата,
+// проверенного при установке mTLS-соединения. Используется вместо проверки
+// доверенной подсети по заголовку X-Real-IP, который клиент может подделать.
+func ValidateTrustedClient(trusted []string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (err error) {
+			name, ok := tlsconfig.Trusted(c.Request().TLS, trusted)
+			if !ok {
+				log.Warn("Access denied: client certificate is not trusted")
+				return c.String(http.StatusForbidden, "Access denied: client certificate is not trusted")
+			}
+
+			log.Info("Access granted: trusted client ", name)
+
+			if err = next(c); err != nil {
+				c.Error(err)
+			}
+
+			return err
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestValidateTrustedClient - тест для проверки middleware.
+func TestValidateTrustedClient(t *testing.T) {
+	verified := func(cn string, dnsNames ...string) *tls.ConnectionState {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: cn}, DNSNames: dnsNames}
+		return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+
+	tests := []struct {
+		name           string
+		state          *tls.ConnectionState
+		expectedStatus int
+	}{
+		{
+			name:           "Trusted CN",
+			state:          verified("agent-1"),
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Trusted SAN",
+			state:          verified("other", "agent-2.metrics.local"),
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Untrusted client",
+			state:          verified("agent-3"),
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Without TLS",
+			state:          nil,
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.Use(ValidateTrustedClient([]string{"agent-1", "agent-2.metrics.local"}))
+
+			e.GET("/", func(c echo.Context) error {
+				return c.String(http.StatusOK, "OK")
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.TLS = tt.state
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/Sofja96/go-metrics.git/internal/models"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+)
+
+// функции и агрегации языка запросов
+const (
+	rate     = "rate"
+	increase = "increase"
+	sum      = "sum"
+	avg      = "avg"
+	minimum  = "min"
+	maximum  = "max"
+	topk     = "topk"
+)
+
+const counter = "counter"
+
+// Series - ряд результата запроса: имя метрики, метки и значение. У рядов, полученных агрегацией
+// sum, avg, min или max, имени нет, а метки - только метки группировки.
+type Series struct {
+	Name   string            `json:"name,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  float64           `json:"value"`
+}
+
+// Result - результат запроса на момент Time.
+type Result struct {
+	Time   time.Time `json:"time"`
+	Series []Series  `json:"series"`
+}
+
+// Expr - разобранное выражение языка запросов.
+type Expr interface {
+	// eval - вычисляет ряды выражения по данным s на момент now
+	eval(ctx context.Context, s storage.Storage, now time.Time) ([]Series, error)
+}
+
+// Exec - разбирает выражение q и вычисляет его по данным s на момент now.
+// Ошибки разбора оборачивают ErrSyntax, остальные - ошибки чтения хранилища.
+func Exec(ctx context.Context, s storage.Storage, q string, now time.Time) (Result, error) {
+	expr, err := Parse(q)
+	if err != nil {
+		return Result{}, err
+	}
+	series, err := Eval(ctx, s, expr, now)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{Time: now, Series: series}, nil
+}
+
+// Eval - вычисляет разобранное выражение expr по данным s на момент now.
+func Eval(ctx context.Context, s storage.Storage, expr Expr, now time.Time) ([]Series, error) {
+	return expr.eval(ctx, s, now)
+}
+
+// matcher - условие на значение метки; negate - метка должна отличаться от value.
+// Отсутствующая метка считается пустой.
+type matcher struct {
+	label  string
+	value  string
+	negate bool
+}
+
+// selector - отбор серий gauge и counter по шаблону имени и условиям на метки.
+type selector struct {
+	name     string
+	matchers []matcher
+}
+
+// match - проверяет, что серия с именем name и метками labels подходит под селектор.
+func (sel *selector) match(name string, labels map[string]string) bool {
+	if ok, _ := path.Match(sel.name, name); !ok {
+		return false
+	}
+	for _, m := range sel.matchers {
+		if (labels[m.label] == m.value) == m.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// counters - возвращает подходящие под селектор серии counter.
+func (sel *selector) counters(ctx context.Context, s storage.Storage) ([]storage.CounterMetric, error) {
+	counters, err := s.GetAllCounters(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error get counters: %w", err)
+	}
+	matched := make([]storage.CounterMetric, 0)
+	for _, c := range counters {
+		if sel.match(c.Name, c.Labels) {
+			matched = append(matched, c)
+		}
+	}
+	return matched, nil
+}
+
+func (sel *selector) eval(ctx context.Context, s storage.Storage, _ time.Time) ([]Series, error) {
+	gauges, err := s.GetAllGauges(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error get gauges: %w", err)
+	}
+	counters, err := sel.counters(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Series, 0)
+	for _, g := range gauges {
+		if sel.match(g.Name, g.Labels) {
+			result = append(result, Series{Name: g.Name, Labels: g.Labels, Value: g.Value})
+		}
+	}
+	for _, c := range counters {
+		result = append(result, Series{Name: c.Name, Labels: c.Labels, Value: float64(c.Value)})
+	}
+	sortSeries(result)
+	return result, nil
+}
+
+// rangeFunc - функция fn над историей серий counter за окно window до момента запроса.
+type rangeFunc struct {
+	fn       string
+	selector *selector
+	window   time.Duration
+}
+
+func (f *rangeFunc) eval(ctx context.Context, s storage.Storage, now time.Time) ([]Series, error) {
+	r, ok := s.(storage.Ranger)
+	if !ok {
+		return nil, fmt.Errorf("%s requires metric history: %w", f.fn, storage.ErrUnsupported)
+	}
+	counters, err := f.selector.counters(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Series, 0, len(counters))
+	for _, c := range counters {
+		// история читается и за предыдущее окно, чтобы прирост считался от последнего значения перед окном
+		from := now.Add(-f.window)
+		samples, err := r.GetRange(ctx, models.SeriesKey(c.Name, c.Labels), counter, from.Add(-f.window), now, 0)
+		if err != nil {
+			return nil, fmt.Errorf("error get history of %s: %w", c.Name, err)
+		}
+		value, ok := counterIncrease(samples, from)
+		if !ok {
+			continue
+		}
+		if f.fn == rate {
+			value /= f.window.Seconds()
+		}
+		result = append(result, Series{Name: c.Name, Labels: c.Labels, Value: value})
+	}
+	sortSeries(result)
+	return result, nil
+}
+
+// counterIncrease - возвращает прирост counter с момента from по упорядоченной истории значений.
+// Прирост отсчитывается от последнего значения перед from, а если его нет (серия создана позже,
+// история не сохранилась после перезапуска или вышла за время хранения) - от первого значения
+// после from, как в Prometheus: иначе в прирост попало бы все накопленное значение counter.
+// Уменьшение значения считается сбросом counter (например, после удаления серии), и прирост
+// продолжается от нуля. Каждое обновление counter попадает в историю, поэтому без значений после
+// from прирост нулевой, а по единственному значению без предыдущего прирост не определен.
+func counterIncrease(samples []storage.Sample, from time.Time) (float64, bool) {
+	i := sort.Search(len(samples), func(i int) bool { return !samples[i].Timestamp.Before(from) })
+	window := samples[i:]
+	switch {
+	case len(window) == 0:
+		return 0, true
+	case i > 0:
+		window = samples[i-1:]
+	case len(window) == 1:
+		return 0, false
+	}
+
+	var total float64
+	for k := 1; k < len(window); k++ {
+		delta := window[k].Value - window[k-1].Value
+		if delta < 0 {
+			delta = window[k].Value
+		}
+		total += delta
+	}
+	return total, true
+}
+
+// aggregation - агрегация op рядов expr по группам с одинаковыми значениями меток by;
+// для topk k - количество оставляемых рядов в каждой группе.
+type aggregation struct {
+	op   string
+	by   []string
+	k    int
+	expr Expr
+}
+
+func (a *aggregation) eval(ctx context.Context, s storage.Storage, now time.Time) ([]Series, error) {
+	series, err := a.expr.eval(ctx, s, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	groups := make(map[string][]Series)
+	for _, sr := range series {
+		key := models.FormatLabels(a.groupLabels(sr.Labels))
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], sr)
+	}
+
+	result := make([]Series, 0, len(groups))
+	if a.op == topk {
+		for _, key := range keys {
+			group := groups[key]
+			sort.SliceStable(group, func(i, j int) bool { return group[i].Value > group[j].Value })
+			result = append(result, group[:min(a.k, len(group))]...)
+		}
+		sort.SliceStable(result, func(i, j int) bool { return result[i].Value > result[j].Value })
+		return result, nil
+	}
+
+	for _, key := range keys {
+		group := groups[key]
+		value := group[0].Value
+		for _, sr := range group[1:] {
+			switch a.op {
+			case sum, avg:
+				value += sr.Value
+			case minimum:
+				value = min(value, sr.Value)
+			case maximum:
+				value = max(value, sr.Value)
+			}
+		}
+		if a.op == avg {
+			value /= float64(len(group))
+		}
+		result = append(result, Series{Labels: a.groupLabels(group[0].Labels), Value: value})
+	}
+	sortSeries(result)
+	return result, nil
+}
+
+// groupLabels - возвращает метки группировки ряда с метками labels; отсутствующие метки пропускаются.
+func (a *aggregation) groupLabels(labels map[string]string) map[string]string {
+	if len(a.by) == 0 {
+		return nil
+	}
+	group := make(map[string]string, len(a.by))
+	for _, label := range a.by {
+		if v, ok := labels[label]; ok {
+			group[label] = v
+		}
+	}
+	if len(group) == 0 {
+		return nil
+	}
+	return group
+}
+
+// sortSeries - упорядочивает ряды по имени и меткам.
+func sortSeries(series []Series) {
+	sort.Slice(series, func(i, j int) bool {
+		if series[i].Name != series[j].Name {
+			return series[i].Name < series[j].Name
+		}
+		return models.FormatLabels(series[i].Labels) < models.FormatLabels(series[j].Labels)
+	})
+}
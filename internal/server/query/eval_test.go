@@ -0,0 +1,217 @@
+package query
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage/memory"
+	storagemock "github.com/Sofja96/go-metrics.git/internal/server/storage/mocks"
+)
+
+func TestExec(t *testing.T) {
+	ctx := context.Background()
+	store, err := memory.New(ctx, memory.Options{})
+	require.NoError(t, err)
+
+	for key, value := range map[string]float64{
+		`HeapAlloc{env="prod",host="a"}`: 10,
+		`HeapAlloc{env="prod",host="b"}`: 30,
+		`HeapAlloc{env="dev",host="c"}`:  5,
+		`StackAlloc{host="a"}`:           2,
+		"Frees":                          7,
+	} {
+		_, err = store.UpdateGauge(ctx, key, value)
+		require.NoError(t, err)
+	}
+	_, err = store.UpdateCounter(ctx, `PollCount{host="a"}`, 4)
+	require.NoError(t, err)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		query string
+		want  []Series
+	}{
+		{
+			name:  "SelectorByName",
+			query: "Frees",
+			want:  []Series{{Name: "Frees", Value: 7}},
+		},
+		{
+			name:  "SelectorByGlobAndLabels",
+			query: `*Alloc{host!="b",env!="dev"}`,
+			want: []Series{
+				{Name: "HeapAlloc", Labels: map[string]string{"env": "prod", "host": "a"}, Value: 10},
+				{Name: "StackAlloc", Labels: map[string]string{"host": "a"}, Value: 2},
+			},
+		},
+		{
+			name:  "SelectorCounter",
+			query: "Poll*",
+			want:  []Series{{Name: "PollCount", Labels: map[string]string{"host": "a"}, Value: 4}},
+		},
+		{
+			name:  "SelectorNoMatch",
+			query: `HeapAlloc{host="z"}`,
+			want:  []Series{},
+		},
+		{
+			name:  "Sum",
+			query: "sum(HeapAlloc)",
+			want:  []Series{{Value: 45}},
+		},
+		{
+			name:  "AvgByEnv",
+			query: "avg by (env) (HeapAlloc)",
+			want: []Series{
+				{Labels: map[string]string{"env": "dev"}, Value: 5},
+				{Labels: map[string]string{"env": "prod"}, Value: 20},
+			},
+		},
+		{
+			name:  "MinMaxByHost",
+			query: "max(min by (host) (*Alloc)) by (host)",
+			want: []Series{
+				{Labels: map[string]string{"host": "a"}, Value: 2},
+				{Labels: map[string]string{"host": "b"}, Value: 30},
+				{Labels: map[string]string{"host": "c"}, Value: 5},
+			},
+		},
+		{
+			name:  "Topk",
+			query: "topk(2, *Alloc)",
+			want: []Series{
+				{Name: "HeapAlloc", Labels: map[string]string{"env": "prod", "host": "b"}, Value: 30},
+				{Name: "HeapAlloc", Labels: map[string]string{"env": "prod", "host": "a"}, Value: 10},
+			},
+		},
+		{
+			name:  "TopkByEnv",
+			query: "topk by (env) (1, HeapAlloc)",
+			want: []Series{
+				{Name: "HeapAlloc", Labels: map[string]string{"env": "prod", "host": "b"}, Value: 30},
+				{Name: "HeapAlloc", Labels: map[string]string{"env": "dev", "host": "c"}, Value: 5},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Exec(ctx, store, tt.query, now)
+			require.NoError(t, err)
+			assert.Equal(t, Result{Time: now, Series: tt.want}, result)
+		})
+	}
+
+	t.Run("SyntaxError", func(t *testing.T) {
+		_, err := Exec(ctx, store, "sum(", now)
+		assert.ErrorIs(t, err, ErrSyntax)
+	})
+}
+
+// rangeStorage - хранилище с историей значений из моков Storage и Ranger.
+type rangeStorage struct {
+	*storagemock.MockStorage
+	*storagemock.MockRanger
+}
+
+func TestExecRange(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	from := now.Add(-time.Minute)
+
+	ctrl := gomock.NewController(t)
+	m := storagemock.NewMockStorage(ctrl)
+	r := storagemock.NewMockRanger(ctrl)
+	m.EXPECT().GetAllCounters(ctx).Return([]storage.CounterMetric{
+		{Name: "Requests", Labels: map[string]string{"host": "a"}, Value: 30},
+		{Name: "Requests", Labels: map[string]string{"host": "b"}, Value: 15},
+		{Name: "Requests", Labels: map[string]string{"host": "c"}, Value: 15},
+		{Name: "Requests", Labels: map[string]string{"host": "d"}, Value: 8},
+		{Name: "Requests", Labels: map[string]string{"host": "e"}, Value: 19},
+		{Name: "Requests", Labels: map[string]string{"host": "f"}, Value: 1015},
+		{Name: "PollCount", Value: 1},
+	}, nil).AnyTimes()
+	// история читается за окно и предыдущее окно
+	lookback := from.Add(-time.Minute)
+	// прирост отсчитывается от последнего значения перед окном
+	r.EXPECT().GetRange(ctx, `Requests{host="a"}`, "counter", lookback, now, time.Duration(0)).Return([]storage.Sample{
+		{Timestamp: from.Add(-30 * time.Second), Value: 6}, {Timestamp: from.Add(20 * time.Second), Value: 12}, {Timestamp: now, Value: 36},
+	}, nil).AnyTimes()
+	// сброс counter: 20 -> 5 -> 15 дает прирост 5 + 10
+	r.EXPECT().GetRange(ctx, `Requests{host="b"}`, "counter", lookback, now, time.Duration(0)).Return([]storage.Sample{
+		{Timestamp: from.Add(-time.Second), Value: 20}, {Timestamp: from.Add(30 * time.Second), Value: 5}, {Timestamp: now, Value: 15},
+	}, nil).AnyTimes()
+	// единственного значения без предыдущего недостаточно для прироста
+	r.EXPECT().GetRange(ctx, `Requests{host="c"}`, "counter", lookback, now, time.Duration(0)).Return([]storage.Sample{
+		{Timestamp: now, Value: 15},
+	}, nil).AnyTimes()
+	// без обновлений за окно прирост нулевой
+	r.EXPECT().GetRange(ctx, `Requests{host="d"}`, "counter", lookback, now, time.Duration(0)).Return([]storage.Sample{
+		{Timestamp: from.Add(-10 * time.Second), Value: 8},
+	}, nil).AnyTimes()
+	// единственное значение в окне после значения перед окном
+	r.EXPECT().GetRange(ctx, `Requests{host="e"}`, "counter", lookback, now, time.Duration(0)).Return([]storage.Sample{
+		{Timestamp: from.Add(-20 * time.Second), Value: 4}, {Timestamp: now, Value: 19},
+	}, nil).AnyTimes()
+	// без значения перед окном (например, после перезапуска) прирост считается от первого значения в окне
+	r.EXPECT().GetRange(ctx, `Requests{host="f"}`, "counter", lookback, now, time.Duration(0)).Return([]storage.Sample{
+		{Timestamp: from.Add(10 * time.Second), Value: 1000}, {Timestamp: now, Value: 1015},
+	}, nil).AnyTimes()
+
+	tests := []struct {
+		name  string
+		query string
+		want  []Series
+	}{
+		{
+			name:  "Increase",
+			query: "increase(Requests[1m])",
+			want: []Series{
+				{Name: "Requests", Labels: map[string]string{"host": "a"}, Value: 30},
+				{Name: "Requests", Labels: map[string]string{"host": "b"}, Value: 15},
+				{Name: "Requests", Labels: map[string]string{"host": "d"}, Value: 0},
+				{Name: "Requests", Labels: map[string]string{"host": "e"}, Value: 15},
+				{Name: "Requests", Labels: map[string]string{"host": "f"}, Value: 15},
+			},
+		},
+		{
+			name:  "Rate",
+			query: `rate(Requests{host="a"}[1m])`,
+			want:  []Series{{Name: "Requests", Labels: map[string]string{"host": "a"}, Value: 0.5}},
+		},
+		{
+			name:  "SumRate",
+			query: "sum(rate(Requests[1m]))",
+			want:  []Series{{Value: 1.25}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Exec(ctx, rangeStorage{m, r}, tt.query, now)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, result.Series)
+		})
+	}
+
+	t.Run("StorageError", func(t *testing.T) {
+		m := storagemock.NewMockStorage(ctrl)
+		m.EXPECT().GetAllCounters(ctx).Return(nil, assert.AnError)
+
+		_, err := Exec(ctx, rangeStorage{m, r}, "rate(Requests[1m])", now)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.NotErrorIs(t, err, ErrSyntax)
+	})
+
+	t.Run("StorageWithoutHistory", func(t *testing.T) {
+		m := storagemock.NewMockStorage(ctrl)
+
+		_, err := Exec(ctx, m, "rate(Requests[1m])", now)
+		assert.ErrorIs(t, err, storage.ErrUnsupported)
+	})
+}
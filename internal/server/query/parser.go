@@ -0,0 +1,350 @@
+// Package query - язык запросов к метрикам сервера.
+//
+// Выражение - это селектор серий, функция над историей counter или агрегация рядов:
+//
+//	HeapAlloc                          - серия или серии gauge и counter с именем HeapAlloc
+//	Heap*{host="agent-1",env!="dev"}   - имена по шаблону (* и ?) с фильтром по меткам
+//	rate(PollCount[5m])                - скорость роста counter в секунду за окно
+//	increase(PollCount{host="a"}[1h])  - прирост counter за окно с учетом сбросов
+//	sum by (host) (rate(Requests[1m])) - sum, avg, min, max рядов, сгруппированных по меткам
+//	topk(3, *Alloc)                    - k рядов с наибольшими значениями
+//
+// Группировку by можно указать как перед скобками агрегации, так и после них.
+package query
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sofja96/go-metrics.git/internal/models"
+)
+
+// ErrSyntax - ошибка разбора выражения.
+var ErrSyntax = errors.New("invalid query")
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenDuration
+	tokenLParen
+	tokenRParen
+	tokenLBrace
+	tokenRBrace
+	tokenComma
+	tokenEq
+	tokenNeq
+)
+
+var tokenNames = map[tokenKind]string{
+	tokenEOF:      "end of query",
+	tokenIdent:    "name",
+	tokenString:   "string",
+	tokenDuration: "range",
+	tokenLParen:   "'('",
+	tokenRParen:   "')'",
+	tokenLBrace:   "'{'",
+	tokenRBrace:   "'}'",
+	tokenComma:    "','",
+	tokenEq:       "'='",
+	tokenNeq:      "'!='",
+}
+
+// punctuation - односимвольные лексемы.
+var punctuation = map[byte]tokenKind{
+	'(': tokenLParen, ')': tokenRParen, '{': tokenLBrace, '}': tokenRBrace, ',': tokenComma, '=': tokenEq,
+}
+
+// token - лексема выражения: вид, текст и смещение в строке запроса.
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// isIdent - проверяет, что символ может входить в имя метрики, шаблон имени, метку или число.
+func isIdent(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == ':' || c == '.' || c == '*' || c == '?'
+}
+
+// lex - разбивает выражение на лексемы.
+func lex(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isIdent(c):
+			start := i
+			for i < len(s) && isIdent(s[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: s[start:i], pos: start})
+		case c == '"':
+			start := i
+			for i++; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("%w: unterminated string at offset %d", ErrSyntax, start)
+			}
+			i++
+			text, err := strconv.Unquote(s[start:i])
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid string at offset %d", ErrSyntax, start)
+			}
+			tokens = append(tokens, token{kind: tokenString, text: text, pos: start})
+		case c == '[':
+			start := i
+			end := strings.IndexByte(s[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("%w: unterminated range at offset %d", ErrSyntax, start)
+			}
+			i += end + 1
+			tokens = append(tokens, token{kind: tokenDuration, text: strings.TrimSpace(s[start+1 : i-1]), pos: start})
+		case c == '!' && strings.HasPrefix(s[i:], "!="):
+			tokens = append(tokens, token{kind: tokenNeq, text: "!=", pos: i})
+			i += 2
+		default:
+			kind, ok := punctuation[c]
+			if !ok {
+				return nil, fmt.Errorf("%w: unexpected character %q at offset %d", ErrSyntax, c, i)
+			}
+			tokens = append(tokens, token{kind: kind, text: string(c), pos: i})
+			i++
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(s)}), nil
+}
+
+// Parse - разбирает выражение языка запросов. Ошибки разбора оборачивают ErrSyntax.
+func Parse(s string) (Expr, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	expr, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if _, err = p.expect(tokenEOF); err != nil {
+		return nil, err
+	}
+	return expr, nil
+}
+
+// parser - разбор выражения рекурсивным спуском.
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept - пропускает следующую лексему, если она вида kind.
+func (p *parser) accept(kind tokenKind) bool {
+	if p.peek().kind != kind {
+		return false
+	}
+	p.next()
+	return true
+}
+
+// acceptKeyword - пропускает следующую лексему, если это слово keyword.
+func (p *parser) acceptKeyword(keyword string) bool {
+	if t := p.peek(); t.kind != tokenIdent || t.text != keyword {
+		return false
+	}
+	p.next()
+	return true
+}
+
+// expect - возвращает следующую лексему, если она вида kind, иначе ошибку.
+func (p *parser) expect(kind tokenKind) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, unexpected(t, tokenNames[kind])
+	}
+	return t, nil
+}
+
+func unexpected(t token, want string) error {
+	got := tokenNames[t.kind]
+	if t.kind == tokenIdent || t.kind == tokenString {
+		got = strconv.Quote(t.text)
+	}
+	return fmt.Errorf("%w: expected %s, got %s at offset %d", ErrSyntax, want, got, t.pos)
+}
+
+// expr - выражение: функция, агрегация или селектор.
+func (p *parser) expr() (Expr, error) {
+	t, err := p.expect(tokenIdent)
+	if err != nil {
+		return nil, err
+	}
+
+	following := p.peek()
+	if following.kind != tokenLParen && !(following.kind == tokenIdent && following.text == "by") {
+		return p.selector(t)
+	}
+	switch t.text {
+	case rate, increase:
+		return p.rangeFunc(t.text)
+	case sum, avg, minimum, maximum, topk:
+		return p.aggregation(t.text)
+	default:
+		return nil, fmt.Errorf("%w: unknown function %q at offset %d", ErrSyntax, t.text, t.pos)
+	}
+}
+
+// rangeFunc - функция над историей: fn(selector[window]).
+func (p *parser) rangeFunc(fn string) (Expr, error) {
+	if _, err := p.expect(tokenLParen); err != nil {
+		return nil, err
+	}
+	t, err := p.expect(tokenIdent)
+	if err != nil {
+		return nil, err
+	}
+	sel, err := p.selector(t)
+	if err != nil {
+		return nil, err
+	}
+	t, err = p.expect(tokenDuration)
+	if err != nil {
+		return nil, err
+	}
+	window, err := time.ParseDuration(t.text)
+	if err != nil || window <= 0 {
+		return nil, fmt.Errorf("%w: invalid range %q at offset %d", ErrSyntax, t.text, t.pos)
+	}
+	if _, err = p.expect(tokenRParen); err != nil {
+		return nil, err
+	}
+	return &rangeFunc{fn: fn, selector: sel, window: window}, nil
+}
+
+// aggregation - агрегация: op [by (labels)] ([k,] expr) [by (labels)].
+func (p *parser) aggregation(op string) (Expr, error) {
+	a := &aggregation{op: op}
+	var err error
+	if p.acceptKeyword("by") {
+		if a.by, err = p.grouping(); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err = p.expect(tokenLParen); err != nil {
+		return nil, err
+	}
+	if op == topk {
+		t, err := p.expect(tokenIdent)
+		if err != nil {
+			return nil, err
+		}
+		if a.k, err = strconv.Atoi(t.text); err != nil || a.k < 1 {
+			return nil, fmt.Errorf("%w: invalid topk parameter %q at offset %d", ErrSyntax, t.text, t.pos)
+		}
+		if _, err = p.expect(tokenComma); err != nil {
+			return nil, err
+		}
+	}
+	if a.expr, err = p.expr(); err != nil {
+		return nil, err
+	}
+	if _, err = p.expect(tokenRParen); err != nil {
+		return nil, err
+	}
+
+	if a.by == nil && p.acceptKeyword("by") {
+		if a.by, err = p.grouping(); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// grouping - список меток группировки: (label, ...).
+func (p *parser) grouping() ([]string, error) {
+	if _, err := p.expect(tokenLParen); err != nil {
+		return nil, err
+	}
+	labels := make([]string, 0)
+	for !p.accept(tokenRParen) {
+		t, err := p.label()
+		if err != nil {
+			return nil, err
+		}
+		labels = append(labels, t.text)
+		if !p.accept(tokenComma) && p.peek().kind != tokenRParen {
+			return nil, unexpected(p.next(), "',' or ')'")
+		}
+	}
+	return labels, nil
+}
+
+// selector - селектор серий: шаблон имени и необязательный список условий на метки {label="v", ...}.
+func (p *parser) selector(name token) (*selector, error) {
+	sel := &selector{name: name.text}
+	if !p.accept(tokenLBrace) {
+		return sel, nil
+	}
+
+	for !p.accept(tokenRBrace) {
+		t, err := p.label()
+		if err != nil {
+			return nil, err
+		}
+		m := matcher{label: t.text}
+		switch op := p.next(); op.kind {
+		case tokenEq:
+		case tokenNeq:
+			m.negate = true
+		default:
+			return nil, unexpected(op, "'=' or '!='")
+		}
+		value, err := p.expect(tokenString)
+		if err != nil {
+			return nil, err
+		}
+		m.value = value.text
+		sel.matchers = append(sel.matchers, m)
+
+		if !p.accept(tokenComma) && p.peek().kind != tokenRBrace {
+			return nil, unexpected(p.next(), "',' or '}'")
+		}
+	}
+	return sel, nil
+}
+
+// label - имя метки, допустимое для models.ValidateLabels.
+func (p *parser) label() (token, error) {
+	t, err := p.expect(tokenIdent)
+	if err != nil {
+		return t, err
+	}
+	if models.ValidateLabels(map[string]string{t.text: ""}) != nil {
+		return t, fmt.Errorf("%w: invalid label name %q at offset %d", ErrSyntax, t.text, t.pos)
+	}
+	return t, nil
+}
@@ -0,0 +1,105 @@
+package query
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  Expr
+	}{
+		{
+			name:  "Selector",
+			query: "HeapAlloc",
+			want:  &selector{name: "HeapAlloc"},
+		},
+		{
+			name:  "SelectorWithLabels",
+			query: `Heap*{host="agent-1", env!="dev",}`,
+			want: &selector{name: "Heap*", matchers: []matcher{
+				{label: "host", value: "agent-1"},
+				{label: "env", value: "dev", negate: true},
+			}},
+		},
+		{
+			name:  "EscapedLabelValue",
+			query: `Alloc{path="a\"b"}`,
+			want:  &selector{name: "Alloc", matchers: []matcher{{label: "path", value: `a"b`}}},
+		},
+		{
+			name:  "Rate",
+			query: "rate(PollCount[ 5m ])",
+			want:  &rangeFunc{fn: rate, selector: &selector{name: "PollCount"}, window: 5 * time.Minute},
+		},
+		{
+			name:  "Increase",
+			query: `increase(Poll?ount{host="a"}[1h])`,
+			want: &rangeFunc{fn: increase, window: time.Hour,
+				selector: &selector{name: "Poll?ount", matchers: []matcher{{label: "host", value: "a"}}}},
+		},
+		{
+			name:  "AggregationByBefore",
+			query: "sum by (host, env) (rate(Requests[1m]))",
+			want: &aggregation{op: sum, by: []string{"host", "env"},
+				expr: &rangeFunc{fn: rate, selector: &selector{name: "Requests"}, window: time.Minute}},
+		},
+		{
+			name:  "AggregationByAfter",
+			query: "max(*Alloc) by (host)",
+			want:  &aggregation{op: maximum, by: []string{"host"}, expr: &selector{name: "*Alloc"}},
+		},
+		{
+			name:  "Topk",
+			query: "topk(3, avg by (host) (*Alloc))",
+			want: &aggregation{op: topk, k: 3,
+				expr: &aggregation{op: avg, by: []string{"host"}, expr: &selector{name: "*Alloc"}}},
+		},
+		{
+			name:  "MetricNamedAsFunction",
+			query: "sum",
+			want:  &selector{name: "sum"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := Parse(tt.query)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, expr)
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, q := range []string{
+		"",
+		"Alloc Heap",
+		"Alloc{",
+		`Alloc{host}`,
+		`Alloc{host=agent}`,
+		`Alloc{1host="a"}`,
+		`Alloc{host="a" env="b"}`,
+		`Alloc{host="a}`,
+		"Alloc/1",
+		"rate(PollCount)",
+		"rate(PollCount[5m)",
+		"rate(PollCount[five])",
+		"rate(PollCount[-1m])",
+		"rate(sum(PollCount)[5m])",
+		"sum(Alloc",
+		"sum by host (Alloc)",
+		"sum by (host (Alloc)",
+		"topk(Alloc)",
+		"topk(0, Alloc)",
+		"median(Alloc)",
+		"Alloc by (host)",
+	} {
+		_, err := Parse(q)
+		assert.ErrorIs(t, err, ErrSyntax, q)
+	}
+}
@@ -0,0 +1,211 @@
+package statsd
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+
+	"github.com/Sofja96/go-metrics.git/internal/models"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+)
+
+// типы метрик хранилища
+const (
+	counter   string = "counter"
+	gauge     string = "gauge"
+	histogram string = "histogram"
+	summary   string = "summary"
+)
+
+// maxSampleWeight - наибольшее количество наблюдений, которое представляет одно наблюдение
+// с частотой выборки; ограничивает память при очень малой частоте.
+const maxSampleWeight = 1000
+
+// maxObservations - наибольшее количество наблюдений серии между сбросами. Сверх него
+// хранится равномерная выборка наблюдений (reservoir sampling): распределение сохраняется,
+// а количество и сумма наблюдений в хранилище занижаются.
+const maxObservations = 10000
+
+// series - метрика, накопленная с последнего сброса.
+type series struct {
+	mType  string
+	name   string
+	labels map[string]string
+
+	count float64 // сумма counter с учетом частоты выборки
+
+	value    float64 // значение gauge или изменение, если absolute == false
+	absolute bool    // значение gauge задано без знака
+
+	observations []float64 // наблюдения timer или histogram, не больше maxObservations
+	observed     int64     // количество наблюдений, из которых сделана выборка observations
+}
+
+// observe - добавляет наблюдение value. После maxObservations наблюдений оно заменяет
+// случайное из сохраненных с вероятностью maxObservations/observed.
+func (s *series) observe(value float64) {
+	s.observed++
+	if len(s.observations) < maxObservations {
+		s.observations = append(s.observations, value)
+		return
+	}
+	if i := rand.Int63n(s.observed); i < maxObservations {
+		s.observations[i] = value
+	}
+}
+
+// Aggregator - накапливает метрики StatsD между сбросами в хранилище: counter суммируются,
+// для gauge сохраняется последнее значение с учетом относительных изменений, наблюдения
+// timer (summary в хранилище) и histogram собираются в пачку.
+type Aggregator struct {
+	flush  sync.Mutex // сериализует сбросы, чтобы относительные изменения gauge не применялись одновременно
+	mu     sync.Mutex
+	series map[string]*series // по типу хранилища и идентификатору серии
+}
+
+// NewAggregator - создает пустой накопитель метрик.
+func NewAggregator() *Aggregator {
+	return &Aggregator{series: make(map[string]*series)}
+}
+
+// Add - добавляет строку метрики в накопленные значения.
+func (a *Aggregator) Add(line Line) {
+	mType := storageType(line.Type)
+	key := mType + "/" + models.SeriesKey(line.Name, line.Labels)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	s, ok := a.series[key]
+	if !ok {
+		s = &series{mType: mType, name: line.Name, labels: line.Labels}
+		a.series[key] = s
+	}
+	switch mType {
+	case counter:
+		s.count += line.Value / line.Rate
+	case gauge:
+		if line.Relative {
+			s.value += line.Value
+		} else {
+			s.value, s.absolute = line.Value, true
+		}
+	default:
+		// наблюдение, сделанное с частотой rate, представляет 1/rate наблюдений
+		for n := min(max(math.Round(1/line.Rate), 1), maxSampleWeight); n > 0; n-- {
+			s.observe(line.Value)
+		}
+	}
+}
+
+// Flush - записывает накопленные метрики в хранилище одной пачкой и очищает накопитель.
+// Counter записывается округленным до целого, дробный остаток (при частоте выборки) переносится
+// на следующий сброс. Относительные изменения gauge применяются к текущему значению в хранилище:
+// чтение значения и запись пачки не атомарны, поэтому значение, записанное между ними в обход
+// накопителя (по HTTP или gRPC), будет перезаписано. При ошибке записи накопленные метрики
+// возвращаются в накопитель и записываются при следующем сбросе.
+func (a *Aggregator) Flush(ctx context.Context, s storage.Storage) error {
+	a.flush.Lock()
+	defer a.flush.Unlock()
+
+	a.mu.Lock()
+	pending := a.series
+	a.series = make(map[string]*series)
+	a.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(pending))
+	for key := range pending {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	metrics := make([]models.Metrics, 0, len(keys))
+	remainders := make(map[string]*series)
+	for _, key := range keys {
+		sr := pending[key]
+		m := models.Metrics{ID: sr.name, Labels: sr.labels}
+		switch sr.mType {
+		case counter:
+			delta := int64(math.Round(sr.count))
+			if rest := sr.count - float64(delta); rest != 0 {
+				remainders[key] = &series{mType: counter, name: sr.name, labels: sr.labels, count: rest}
+			}
+			if delta == 0 {
+				continue
+			}
+			m.MType, m.Delta = counter, &delta
+		case gauge:
+			value := sr.value
+			if !sr.absolute {
+				current, _ := s.GetGaugeValue(ctx, m.SeriesKey())
+				value += current
+			}
+			m.MType, m.Value = gauge, &value
+		default:
+			m.MType, m.Observations = sr.mType, sr.observations
+		}
+		metrics = append(metrics, m)
+	}
+	if len(metrics) == 0 {
+		a.carry(remainders)
+		return nil
+	}
+
+	if err := s.BatchUpdate(ctx, metrics); err != nil {
+		a.carry(pending)
+		return fmt.Errorf("error flush statsd metrics: %w", err)
+	}
+	a.carry(remainders)
+	return nil
+}
+
+// carry - возвращает в накопитель серии, не вошедшие в сброс: остатки counter или все серии
+// неудавшегося сброса. Значения, накопленные после начала сброса, считаются более поздними.
+func (a *Aggregator) carry(earlier map[string]*series) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for key, prev := range earlier {
+		s, ok := a.series[key]
+		if !ok {
+			a.series[key] = prev
+			continue
+		}
+		switch s.mType {
+		case counter:
+			s.count += prev.count
+		case gauge:
+			// абсолютное значение отменяет прежние, относительное дополняет их
+			if !s.absolute {
+				s.value += prev.value
+				s.absolute = prev.absolute
+			}
+		default:
+			later, observed := s.observations, s.observed
+			s.observations, s.observed = prev.observations, prev.observed
+			for _, value := range later {
+				s.observe(value)
+			}
+			s.observed = prev.observed + observed
+		}
+	}
+}
+
+// storageType - тип метрики хранилища для типа StatsD.
+func storageType(statsdType string) string {
+	switch statsdType {
+	case typeCounter:
+		return counter
+	case typeGauge:
+		return gauge
+	case typeTimer:
+		return summary
+	}
+	return histogram
+}
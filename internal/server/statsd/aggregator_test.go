@@ -0,0 +1,164 @@
+package statsd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Sofja96/go-metrics.git/internal/server/storage/memory"
+	storagemock "github.com/Sofja96/go-metrics.git/internal/server/storage/mocks"
+)
+
+func addLines(t *testing.T, a *Aggregator, lines ...string) {
+	for _, s := range lines {
+		line, err := ParseLine(s)
+		require.NoError(t, err)
+		a.Add(line)
+	}
+}
+
+func TestAggregator_Flush(t *testing.T) {
+	ctx := context.Background()
+	store, err := memory.New(ctx, memory.Options{})
+	require.NoError(t, err)
+	_, err = store.UpdateCounter(ctx, "requests", 10)
+	require.NoError(t, err)
+	_, err = store.UpdateGauge(ctx, "queue", 10)
+	require.NoError(t, err)
+
+	a := NewAggregator()
+	addLines(t, a,
+		"requests:1|c",
+		"requests:2|c|@0.5",
+		"requests:1|c|#host:a",
+		"rare:1|c|@0.001",
+		"queue:+5|g",
+		"queue:-2|g",
+		"temperature:3|g",
+		"temperature:-1|g",
+		"temperature:20|g",
+		"temperature:+1.5|g",
+		"latency:100|ms|@0.5",
+		"latency:300|ms",
+		"size:0.2|h",
+		"size:7|h",
+	)
+	require.NoError(t, a.Flush(ctx, store))
+
+	requests, ok := store.GetCounterValue(ctx, "requests")
+	require.True(t, ok)
+	assert.Equal(t, int64(15), requests)
+	requests, ok = store.GetCounterValue(ctx, `requests{host="a"}`)
+	require.True(t, ok)
+	assert.Equal(t, int64(1), requests)
+	rare, ok := store.GetCounterValue(ctx, "rare")
+	require.True(t, ok)
+	assert.Equal(t, int64(1000), rare)
+
+	// относительное изменение применяется к значению в хранилище
+	queue, ok := store.GetGaugeValue(ctx, "queue")
+	require.True(t, ok)
+	assert.Equal(t, 13.0, queue)
+	// последнее абсолютное значение с последующими изменениями
+	temperature, ok := store.GetGaugeValue(ctx, "temperature")
+	require.True(t, ok)
+	assert.Equal(t, 21.5, temperature)
+
+	latency, ok := store.GetSummary(ctx, "latency")
+	require.True(t, ok)
+	assert.Equal(t, uint64(3), latency.Count)
+	assert.Equal(t, 500.0, latency.Sum)
+
+	size, ok := store.GetHistogram(ctx, "size")
+	require.True(t, ok)
+	assert.Equal(t, uint64(2), size.Count)
+	assert.InDelta(t, 7.2, size.Sum, 1e-9)
+
+	// накопитель очищается после сброса
+	require.NoError(t, a.Flush(ctx, store))
+	requests, _ = store.GetCounterValue(ctx, "requests")
+	assert.Equal(t, int64(15), requests)
+}
+
+func TestAggregator_FlushRemainder(t *testing.T) {
+	ctx := context.Background()
+	store, err := memory.New(ctx, memory.Options{})
+	require.NoError(t, err)
+
+	// при частоте 0.4 каждая строка дает 2.5 запроса, дробная часть не теряется между сбросами
+	a := NewAggregator()
+	for i := 0; i < 4; i++ {
+		addLines(t, a, "requests:1|c|@0.4")
+		require.NoError(t, a.Flush(ctx, store))
+	}
+	requests, ok := store.GetCounterValue(ctx, "requests")
+	require.True(t, ok)
+	assert.Equal(t, int64(10), requests)
+
+	// остаток меньше единицы дожидается следующих значений
+	addLines(t, a, "rare:1|c|@0.8")
+	require.NoError(t, a.Flush(ctx, store))
+	rare, _ := store.GetCounterValue(ctx, "rare")
+	assert.Equal(t, int64(1), rare)
+	addLines(t, a, "rare:1|c|@0.8", "rare:1|c|@0.8", "rare:1|c|@0.8")
+	require.NoError(t, a.Flush(ctx, store))
+	rare, _ = store.GetCounterValue(ctx, "rare")
+	assert.Equal(t, int64(5), rare)
+}
+
+func TestAggregator_FlushError(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	m := storagemock.NewMockStorage(ctrl)
+	m.EXPECT().GetGaugeValue(ctx, "temperature").Return(0.0, false)
+	m.EXPECT().BatchUpdate(ctx, gomock.Len(4)).Return(assert.AnError)
+
+	a := NewAggregator()
+	addLines(t, a, "requests:1|c", "queue:5|g", "temperature:+1|g", "latency:100|ms")
+	assert.ErrorIs(t, a.Flush(ctx, m), assert.AnError)
+
+	// метрики неудавшегося сброса объединяются с накопленными после него
+	addLines(t, a, "requests:2|c", "queue:+1|g", "temperature:20|g", "latency:300|ms")
+	store, err := memory.New(ctx, memory.Options{})
+	require.NoError(t, err)
+	require.NoError(t, a.Flush(ctx, store))
+
+	requests, _ := store.GetCounterValue(ctx, "requests")
+	assert.Equal(t, int64(3), requests)
+	queue, _ := store.GetGaugeValue(ctx, "queue")
+	assert.Equal(t, 6.0, queue)
+	temperature, _ := store.GetGaugeValue(ctx, "temperature")
+	assert.Equal(t, 20.0, temperature)
+	latency, ok := store.GetSummary(ctx, "latency")
+	require.True(t, ok)
+	assert.Equal(t, uint64(2), latency.Count)
+	assert.Equal(t, 400.0, latency.Sum)
+
+	// пустой накопитель не обращается к хранилищу
+	assert.NoError(t, a.Flush(ctx, m))
+}
+
+func TestAggregator_MaxObservations(t *testing.T) {
+	ctx := context.Background()
+	store, err := memory.New(ctx, memory.Options{})
+	require.NoError(t, err)
+
+	// каждая строка с частотой 0.001 представляет 1000 наблюдений
+	a := NewAggregator()
+	for i := 0; i < 50; i++ {
+		addLines(t, a, "latency:100|ms|@0.001")
+	}
+	a.mu.Lock()
+	sr := a.series[summary+"/latency"]
+	assert.Len(t, sr.observations, maxObservations)
+	assert.Equal(t, int64(50*maxSampleWeight), sr.observed)
+	a.mu.Unlock()
+
+	require.NoError(t, a.Flush(ctx, store))
+	latency, ok := store.GetSummary(ctx, "latency")
+	require.True(t, ok)
+	assert.Equal(t, uint64(maxObservations), latency.Count)
+}
@@ -0,0 +1,106 @@
+// Package statsd - прием метрик в формате StatsD по UDP и TCP.
+//
+// Строка метрики имеет вид
+//
+//	name:value|type[|@rate][|#tag:value,...]
+//
+// где type - c (counter), g (gauge), ms (timer) или h (histogram). Значение gauge со знаком
+// + или - изменяет текущее значение на указанную величину. Частота выборки rate из (0, 1]
+// учитывается при подсчете counter и наблюдений timer и histogram. Теги в формате DogStatsD
+// становятся метками серии.
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/Sofja96/go-metrics.git/internal/models"
+)
+
+// типы метрик StatsD
+const (
+	typeCounter   = "c"
+	typeGauge     = "g"
+	typeTimer     = "ms"
+	typeHistogram = "h"
+)
+
+// ErrInvalidLine - строка не соответствует формату StatsD.
+var ErrInvalidLine = errors.New("invalid statsd line")
+
+// Line - разобранная строка метрики StatsD. Relative - значение gauge задано со знаком
+// и изменяет текущее значение.
+type Line struct {
+	Name     string
+	Labels   map[string]string
+	Type     string
+	Value    float64
+	Relative bool
+	Rate     float64
+}
+
+// ParseLine - разбирает строку метрики StatsD.
+func ParseLine(s string) (Line, error) {
+	name, rest, ok := strings.Cut(s, ":")
+	if !ok || name == "" {
+		return Line{}, fmt.Errorf("%w: expected name:value|type, got %q", ErrInvalidLine, s)
+	}
+	if err := models.ValidateName(name); err != nil {
+		return Line{}, fmt.Errorf("%w: %w", ErrInvalidLine, err)
+	}
+	fields := strings.Split(rest, "|")
+	if len(fields) < 2 {
+		return Line{}, fmt.Errorf("%w: expected name:value|type, got %q", ErrInvalidLine, s)
+	}
+
+	line := Line{Name: name, Type: fields[1], Rate: 1}
+	switch line.Type {
+	case typeCounter, typeGauge, typeTimer, typeHistogram:
+	default:
+		return Line{}, fmt.Errorf("%w: unsupported metric type %q", ErrInvalidLine, line.Type)
+	}
+
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return Line{}, fmt.Errorf("%w: invalid value %q", ErrInvalidLine, fields[0])
+	}
+	line.Value = value
+	line.Relative = line.Type == typeGauge && (fields[0][0] == '+' || fields[0][0] == '-')
+
+	for _, field := range fields[2:] {
+		switch {
+		case strings.HasPrefix(field, "@"):
+			rate, err := strconv.ParseFloat(field[1:], 64)
+			if err != nil || !(rate > 0 && rate <= 1) {
+				return Line{}, fmt.Errorf("%w: invalid sample rate %q", ErrInvalidLine, field)
+			}
+			line.Rate = rate
+		case strings.HasPrefix(field, "#"):
+			if line.Labels, err = parseTags(field[1:]); err != nil {
+				return Line{}, err
+			}
+		default:
+			return Line{}, fmt.Errorf("%w: unexpected field %q", ErrInvalidLine, field)
+		}
+	}
+	return line, nil
+}
+
+// parseTags - разбирает теги DogStatsD вида tag:value,tag2:value2 в метки серии.
+func parseTags(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, tag := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(tag, ":")
+		if !ok {
+			return nil, fmt.Errorf("%w: tag %q has no value", ErrInvalidLine, tag)
+		}
+		labels[k] = v
+	}
+	if err := models.ValidateLabels(labels); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidLine, err)
+	}
+	return labels, nil
+}
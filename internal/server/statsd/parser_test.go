@@ -0,0 +1,62 @@
+package statsd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want Line
+	}{
+		{name: "Counter", line: "requests:1|c", want: Line{Name: "requests", Type: typeCounter, Value: 1, Rate: 1}},
+		{name: "CounterSampled", line: "requests:2|c|@0.1", want: Line{Name: "requests", Type: typeCounter, Value: 2, Rate: 0.1}},
+		{name: "Gauge", line: "temperature:3.2|g", want: Line{Name: "temperature", Type: typeGauge, Value: 3.2, Rate: 1}},
+		{name: "GaugeIncrement", line: "queue:+4|g", want: Line{Name: "queue", Type: typeGauge, Value: 4, Relative: true, Rate: 1}},
+		{name: "GaugeDecrement", line: "queue:-1.5|g", want: Line{Name: "queue", Type: typeGauge, Value: -1.5, Relative: true, Rate: 1}},
+		{name: "Timer", line: "latency:320|ms|@0.5", want: Line{Name: "latency", Type: typeTimer, Value: 320, Rate: 0.5}},
+		{name: "Histogram", line: "size:0.25|h", want: Line{Name: "size", Type: typeHistogram, Value: 0.25, Rate: 1}},
+		{
+			name: "Tags",
+			line: "requests:1|c|@0.5|#host:a,env:prod",
+			want: Line{Name: "requests", Labels: map[string]string{"host": "a", "env": "prod"}, Type: typeCounter, Value: 1, Rate: 0.5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line, err := ParseLine(tt.line)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, line)
+		})
+	}
+}
+
+func TestParseLine_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{name: "NoValue", line: "requests"},
+		{name: "NoName", line: ":1|c"},
+		{name: "InvalidName", line: "requests{code=200}:1|c"},
+		{name: "NoType", line: "requests:1"},
+		{name: "UnsupportedType", line: "users:42|s"},
+		{name: "InvalidValue", line: "requests:one|c"},
+		{name: "NaN", line: "temperature:NaN|g"},
+		{name: "ZeroRate", line: "requests:1|c|@0"},
+		{name: "RateAboveOne", line: "requests:1|c|@2"},
+		{name: "TagWithoutValue", line: "requests:1|c|#host"},
+		{name: "InvalidTagName", line: "requests:1|c|#1host:a"},
+		{name: "UnexpectedField", line: "requests:1|c|x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseLine(tt.line)
+			assert.ErrorIs(t, err, ErrInvalidLine)
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package statsd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+)
+
+// DefaultFlushInterval - период сброса накопленных метрик в хранилище по умолчанию.
+const DefaultFlushInterval = 10 * time.Second
+
+// maxPacketSize - наибольший размер UDP-пакета StatsD.
+const maxPacketSize = 65535
+
+// Server - прием метрик StatsD по UDP и TCP с периодическим сбросом в хранилище.
+type Server struct {
+	storage    storage.Storage
+	aggregator *Aggregator
+	interval   time.Duration
+}
+
+// New - создает приемник метрик StatsD, сбрасывающий их в хранилище s с периодом
+// interval (DefaultFlushInterval, если не задан).
+func New(s storage.Storage, interval time.Duration) *Server {
+	if interval <= 0 {
+		interval = DefaultFlushInterval
+	}
+	return &Server{storage: s, aggregator: NewAggregator(), interval: interval}
+}
+
+// ListenAndServe - принимает метрики на UDP-адресе udpAddress и TCP-адресе tcpAddress
+// (пустой адрес отключает протокол) до отмены контекста, после чего сбрасывает накопленное.
+// Возвращает ошибку, если не удалось открыть адрес.
+func (s *Server) ListenAndServe(ctx context.Context, udpAddress, tcpAddress string) error {
+	var (
+		conn net.PacketConn
+		ln   net.Listener
+		err  error
+	)
+	if udpAddress != "" {
+		if conn, err = net.ListenPacket("udp", udpAddress); err != nil {
+			return err
+		}
+	}
+	if tcpAddress != "" {
+		if ln, err = net.Listen("tcp", tcpAddress); err != nil {
+			if conn != nil {
+				conn.Close()
+			}
+			return err
+		}
+	}
+	s.Serve(ctx, conn, ln)
+	return nil
+}
+
+// Serve - принимает метрики из conn и соединений ln (nil отключает источник) до отмены
+// контекста и сбрасывает их в хранилище. Закрывает conn и ln при завершении.
+func (s *Server) Serve(ctx context.Context, conn net.PacketConn, ln net.Listener) {
+	var wg sync.WaitGroup
+	if conn != nil {
+		log.Println("Starting statsd UDP listener on", conn.LocalAddr())
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.serveUDP(conn)
+		}()
+	}
+	if ln != nil {
+		log.Println("Starting statsd TCP listener on", ln.Addr())
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.serveTCP(ln)
+		}()
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if conn != nil {
+				conn.Close()
+			}
+			if ln != nil {
+				ln.Close()
+			}
+			wg.Wait()
+			// контекст отменен, но накопленное нужно успеть записать
+			if err := s.aggregator.Flush(context.WithoutCancel(ctx), s.storage); err != nil {
+				log.Printf("error flush statsd metrics: %v", err)
+			}
+			return
+		case <-ticker.C:
+			if err := s.aggregator.Flush(ctx, s.storage); err != nil {
+				log.Printf("error flush statsd metrics: %v", err)
+			}
+		}
+	}
+}
+
+// serveUDP - читает пакеты из conn до его закрытия.
+func (s *Server) serveUDP(conn net.PacketConn) {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("error read statsd packet: %v", err)
+			}
+			return
+		}
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			s.handleLine(line)
+		}
+	}
+}
+
+// serveTCP - принимает соединения ln до его закрытия и читает из них строки метрик.
+func (s *Server) serveTCP(ln net.Listener) {
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		conns = make(map[net.Conn]struct{})
+	)
+	defer func() {
+		mu.Lock()
+		for c := range conns {
+			c.Close()
+		}
+		mu.Unlock()
+		wg.Wait()
+	}()
+
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("error accept statsd connection: %v", err)
+			}
+			return
+		}
+
+		mu.Lock()
+		conns[c] = struct{}{}
+		mu.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				mu.Lock()
+				delete(conns, c)
+				mu.Unlock()
+				c.Close()
+			}()
+
+			scanner := bufio.NewScanner(c)
+			for scanner.Scan() {
+				s.handleLine(scanner.Text())
+			}
+		}()
+	}
+}
+
+// handleLine - разбирает строку метрики и добавляет ее в накопитель; пустые строки пропускаются.
+func (s *Server) handleLine(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+	l, err := ParseLine(line)
+	if err != nil {
+		log.Printf("error parse statsd line: %v", err)
+		return
+	}
+	s.aggregator.Add(l)
+}
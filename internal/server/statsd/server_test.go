@@ -0,0 +1,108 @@
+package statsd
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Sofja96/go-metrics.git/internal/server/storage/memory"
+)
+
+func TestServer_Serve(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store, err := memory.New(ctx, memory.Options{})
+	require.NoError(t, err)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		New(store, 10*time.Millisecond).Serve(ctx, conn, ln)
+	}()
+
+	udp, err := net.Dial("udp", conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer udp.Close()
+	_, err = udp.Write([]byte("requests:1|c\nrequests:2|c\ninvalid\ntemperature:3.2|g\n"))
+	require.NoError(t, err)
+
+	tcp, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	_, err = tcp.Write([]byte("requests:4|c|#host:a\nlatency:120|ms\n"))
+	require.NoError(t, err)
+	require.NoError(t, tcp.Close())
+
+	// метрики сбрасываются по таймеру
+	assert.Eventually(t, func() bool {
+		requests, ok := store.GetCounterValue(ctx, "requests")
+		labeled, labeledOK := store.GetCounterValue(ctx, `requests{host="a"}`)
+		return ok && requests == 3 && labeledOK && labeled == 4
+	}, time.Second, 5*time.Millisecond)
+	temperature, ok := store.GetGaugeValue(ctx, "temperature")
+	require.True(t, ok)
+	assert.Equal(t, 3.2, temperature)
+	latency, ok := store.GetSummary(ctx, "latency")
+	require.True(t, ok)
+	assert.Equal(t, uint64(1), latency.Count)
+
+	// после отмены контекста прием прекращается
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("server did not stop")
+	}
+	_, err = net.Dial("tcp", ln.Addr().String())
+	assert.Error(t, err)
+}
+
+func TestServer_ServeFlushOnShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	store, err := memory.New(ctx, memory.Options{})
+	require.NoError(t, err)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := New(store, time.Hour)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		srv.Serve(ctx, conn, nil)
+	}()
+
+	udp, err := net.Dial("udp", conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer udp.Close()
+	_, err = udp.Write([]byte("requests:10|c"))
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		srv.aggregator.mu.Lock()
+		defer srv.aggregator.mu.Unlock()
+		return len(srv.aggregator.series) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	// накопленное до отмены контекста записывается при остановке
+	cancel()
+	<-done
+	requests, ok := store.GetCounterValue(context.Background(), "requests")
+	require.True(t, ok)
+	assert.Equal(t, int64(10), requests)
+}
+
+func TestServer_ListenAndServeError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	err = New(nil, 0).ListenAndServe(context.Background(), "", ln.Addr().String())
+	assert.Error(t, err)
+}
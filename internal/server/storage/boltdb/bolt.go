@@ -0,0 +1,525 @@
+// Package boltdb - хранилище метрик во встроенной базе bbolt: данные хранятся в одном
+// файле и переживают перезапуск сервера без отдельной СУБД.
+package boltdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/Sofja96/go-metrics.git/internal/models"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+)
+
+const (
+	counter   string = "counter"
+	gauge     string = "gauge"
+	histogram string = "histogram"
+	summary   string = "summary"
+)
+
+// historySize - количество последних значений, которые хранятся для каждой серии.
+const historySize = 4096
+
+// openTimeout - время ожидания блокировки файла, если он открыт другим процессом.
+const openTimeout = 5 * time.Second
+
+var (
+	// updatedBucket - время последнего обновления серий по ключу <тип>/<серия>.
+	updatedBucket = []byte("updated")
+	// historyBucket - вложенные бакеты <тип>/<серия> с последними значениями серий gauge и counter.
+	historyBucket = []byte("history")
+)
+
+// BoltStorage - хранилище метрик в файле bbolt. Значения каждого типа лежат в бакете
+// с именем типа по ключу серии: gauge и counter - 8 байт, histogram и summary - JSON.
+// Каждый вызов выполняется в одной транзакции и сбрасывается на диск до возврата.
+type BoltStorage struct {
+	db *bolt.DB
+}
+
+var (
+	_ storage.Storage   = (*BoltStorage)(nil)
+	_ storage.Ranger    = (*BoltStorage)(nil)
+	_ storage.Deleter   = (*BoltStorage)(nil)
+	_ storage.Compactor = (*BoltStorage)(nil)
+)
+
+// New - открывает или создает файл хранилища path. Файл остается открытым до вызова Close.
+func New(ctx context.Context, path string) (*BoltStorage, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt storage: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{[]byte(gauge), []byte(counter), []byte(histogram), []byte(summary), updatedBucket, historyBucket, rollupBucket, rolledBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to init bolt storage: %w", err)
+	}
+
+	return &BoltStorage{db: db}, nil
+}
+
+// Close - закрывает файл хранилища, дождавшись завершения начатых транзакций.
+func (s *BoltStorage) Close() error {
+	return s.db.Close()
+}
+
+// Ping - проверяет, что файл хранилища открыт.
+func (s *BoltStorage) Ping(ctx context.Context) error {
+	return s.db.View(func(tx *bolt.Tx) error { return nil })
+}
+
+// UpdateCounter - увеличивает counter и возвращает новое значение.
+func (s *BoltStorage) UpdateCounter(ctx context.Context, name string, value int64) (int64, error) {
+	var result int64
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		result, err = newSeriesTx(tx).updateCounter(name, value)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error update counter: %w", err)
+	}
+	return result, nil
+}
+
+// UpdateGauge - устанавливает значение gauge.
+func (s *BoltStorage) UpdateGauge(ctx context.Context, name string, value float64) (float64, error) {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return newSeriesTx(tx).updateGauge(name, value)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error update gauge: %w", err)
+	}
+	return value, nil
+}
+
+// GetCounterValue - возвращает значение counter.
+func (s *BoltStorage) GetCounterValue(ctx context.Context, id string) (int64, bool) {
+	var value int64
+	var ok bool
+	_ = s.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket([]byte(counter)).Get([]byte(id)); v != nil {
+			value, ok = decodeCounter(v), true
+		}
+		return nil
+	})
+	return value, ok
+}
+
+// GetGaugeValue - возвращает значение gauge.
+func (s *BoltStorage) GetGaugeValue(ctx context.Context, id string) (float64, bool) {
+	var value float64
+	var ok bool
+	_ = s.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket([]byte(gauge)).Get([]byte(id)); v != nil {
+			value, ok = decodeGauge(v), true
+		}
+		return nil
+	})
+	return value, ok
+}
+
+// GetAllGauges - возвращает все метрики типа gauge.
+func (s *BoltStorage) GetAllGauges(ctx context.Context) ([]storage.GaugeMetric, error) {
+	gauges := make([]storage.GaugeMetric, 0)
+	err := s.forEach(gauge, func(name string, labels map[string]string, v []byte) error {
+		gauges = append(gauges, storage.GaugeMetric{Name: name, Labels: labels, Value: decodeGauge(v)})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return gauges, nil
+}
+
+// GetAllCounters - возвращает все метрики типа counter.
+func (s *BoltStorage) GetAllCounters(ctx context.Context) ([]storage.CounterMetric, error) {
+	counters := make([]storage.CounterMetric, 0)
+	err := s.forEach(counter, func(name string, labels map[string]string, v []byte) error {
+		counters = append(counters, storage.CounterMetric{Name: name, Labels: labels, Value: decodeCounter(v)})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return counters, nil
+}
+
+// UpdateHistogram - добавляет наблюдения в гистограмму, создавая ее с границами bounds.
+func (s *BoltStorage) UpdateHistogram(ctx context.Context, name string, bounds, observations []float64) (models.Histogram, error) {
+	var result models.Histogram
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		result, err = newSeriesTx(tx).updateHistogram(name, bounds, observations)
+		return err
+	})
+	if err != nil {
+		return models.Histogram{}, fmt.Errorf("error update histogram: %w", err)
+	}
+	return result, nil
+}
+
+// UpdateSummary - добавляет наблюдения в summary, создавая его с квантилями quantiles.
+func (s *BoltStorage) UpdateSummary(ctx context.Context, name string, quantiles, observations []float64) (models.SummaryValue, error) {
+	var result models.SummaryValue
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		result, err = newSeriesTx(tx).updateSummary(name, quantiles, observations)
+		return err
+	})
+	if err != nil {
+		return models.SummaryValue{}, fmt.Errorf("error update summary: %w", err)
+	}
+	return result, nil
+}
+
+// GetHistogram - возвращает гистограмму по идентификатору серии.
+func (s *BoltStorage) GetHistogram(ctx context.Context, id string) (models.Histogram, bool) {
+	var h models.Histogram
+	if !s.getState(histogram, id, &h) {
+		return models.Histogram{}, false
+	}
+	return h, true
+}
+
+// GetSummary - возвращает значения summary по идентификатору серии.
+func (s *BoltStorage) GetSummary(ctx context.Context, id string) (models.SummaryValue, bool) {
+	var sm models.Summary
+	if !s.getState(summary, id, &sm) {
+		return models.SummaryValue{}, false
+	}
+	return sm.Value(), true
+}
+
+// GetAllHistograms - возвращает все метрики типа histogram.
+func (s *BoltStorage) GetAllHistograms(ctx context.Context) ([]storage.HistogramMetric, error) {
+	histograms := make([]storage.HistogramMetric, 0)
+	err := s.forEach(histogram, func(name string, labels map[string]string, v []byte) error {
+		hm := storage.HistogramMetric{Name: name, Labels: labels}
+		if err := json.Unmarshal(v, &hm.Value); err != nil {
+			return fmt.Errorf("error decode histogram: %w", err)
+		}
+		histograms = append(histograms, hm)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return histograms, nil
+}
+
+// GetAllSummaries - возвращает все метрики типа summary.
+func (s *BoltStorage) GetAllSummaries(ctx context.Context) ([]storage.SummaryMetric, error) {
+	summaries := make([]storage.SummaryMetric, 0)
+	err := s.forEach(summary, func(name string, labels map[string]string, v []byte) error {
+		var sm models.Summary
+		if err := json.Unmarshal(v, &sm); err != nil {
+			return fmt.Errorf("error decode summary: %w", err)
+		}
+		summaries = append(summaries, storage.SummaryMetric{Name: name, Labels: labels, Value: sm.Value()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
+
+// BatchUpdate - обновляет метрики пачкой в одной транзакции: при ошибке не сохраняется
+// ни одна метрика пачки. В Delta метрик counter записываются новые значения,
+// в Histogram и Summary - новые состояния.
+func (s *BoltStorage) BatchUpdate(ctx context.Context, metrics []models.Metrics) error {
+	results := make([]int64, len(metrics))
+	histograms := make(map[int]models.Histogram)
+	summaries := make(map[int]models.SummaryValue)
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		st := newSeriesTx(tx)
+		for i, v := range metrics {
+			key := v.SeriesKey()
+			var err error
+			switch v.MType {
+			case gauge:
+				if v.Value == nil {
+					return fmt.Errorf("gauge %s has no value", v.ID)
+				}
+				err = st.updateGauge(key, *v.Value)
+			case counter:
+				if v.Delta == nil {
+					return fmt.Errorf("counter %s has no delta", v.ID)
+				}
+				results[i], err = st.updateCounter(key, *v.Delta)
+			case histogram:
+				histograms[i], err = st.updateHistogram(key, v.Buckets, v.Observations)
+			case summary:
+				summaries[i], err = st.updateSummary(key, v.Quantiles, v.Observations)
+			default:
+				return fmt.Errorf("unsupported metrics type: %s", v.MType)
+			}
+			if err != nil {
+				return fmt.Errorf("error update %s for batch update: %w", v.MType, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// значения записываются только после фиксации транзакции, чтобы при ошибке пачка не менялась
+	for i := range metrics {
+		switch metrics[i].MType {
+		case counter:
+			*metrics[i].Delta = results[i]
+		case histogram:
+			h := histograms[i]
+			metrics[i].Histogram = &h
+		case summary:
+			v := summaries[i]
+			metrics[i].Summary = &v
+		}
+	}
+	return nil
+}
+
+// GetRange - возвращает историю значений метрики за интервал [from, to] с шагом step.
+func (s *BoltStorage) GetRange(ctx context.Context, name, mType string, from, to time.Time, step time.Duration) ([]storage.Sample, error) {
+	if mType != gauge && mType != counter {
+		return nil, fmt.Errorf("unsupported metrics type: %s", mType)
+	}
+
+	var samples []storage.Sample
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		samples, err = readRange(tx, mType, historyKey(mType, name), from, to, step)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error read history: %w", err)
+	}
+	return samples, nil
+}
+
+// ListSeries - возвращает отсортированные идентификаторы серий метрики типа mType с именем name.
+// Ключи бакета упорядочены, поэтому просматриваются только ключи с префиксом name.
+func (s *BoltStorage) ListSeries(ctx context.Context, mType, name string) ([]string, error) {
+	switch mType {
+	case gauge, counter, histogram, summary:
+	default:
+		return nil, fmt.Errorf("unsupported metrics type: %s", mType)
+	}
+
+	keys := make([]string, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(mType)).Cursor()
+		for k, _ := c.Seek([]byte(name)); k != nil && bytes.HasPrefix(k, []byte(name)); k, _ = c.Next() {
+			if seriesName, _ := models.SplitSeriesKey(string(k)); seriesName == name {
+				keys = append(keys, string(k))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error list %s series: %w", mType, err)
+	}
+	return keys, nil
+}
+
+// forEach - перебирает серии метрики типа mType в транзакции чтения.
+func (s *BoltStorage) forEach(mType string, fn func(name string, labels map[string]string, v []byte) error) error {
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(mType)).ForEach(func(k, v []byte) error {
+			name, labels := models.ParseSeriesKey(string(k))
+			return fn(name, labels, v)
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("error read all %s: %w", mType, err)
+	}
+	return nil
+}
+
+// getState - читает состояние серии id метрики типа mType в v.
+func (s *BoltStorage) getState(mType, id string, v any) bool {
+	var ok bool
+	_ = s.db.View(func(tx *bolt.Tx) error {
+		if data := tx.Bucket([]byte(mType)).Get([]byte(id)); data != nil {
+			ok = json.Unmarshal(data, v) == nil
+		}
+		return nil
+	})
+	return ok
+}
+
+// seriesTx - изменение серий в транзакции записи.
+type seriesTx struct {
+	tx  *bolt.Tx
+	now time.Time
+}
+
+func newSeriesTx(tx *bolt.Tx) seriesTx {
+	return seriesTx{tx: tx, now: time.Now()}
+}
+
+func (st seriesTx) updateCounter(name string, value int64) (int64, error) {
+	b := st.tx.Bucket([]byte(counter))
+	if v := b.Get([]byte(name)); v != nil {
+		value += decodeCounter(v)
+	}
+	if err := b.Put([]byte(name), encodeCounter(value)); err != nil {
+		return 0, err
+	}
+	if err := st.record(counter, name, float64(value)); err != nil {
+		return 0, err
+	}
+	return value, st.touch(counter, name)
+}
+
+func (st seriesTx) updateGauge(name string, value float64) error {
+	if err := st.tx.Bucket([]byte(gauge)).Put([]byte(name), encodeGauge(value)); err != nil {
+		return err
+	}
+	if err := st.record(gauge, name, value); err != nil {
+		return err
+	}
+	return st.touch(gauge, name)
+}
+
+func (st seriesTx) updateHistogram(name string, bounds, observations []float64) (models.Histogram, error) {
+	var result models.Histogram
+	err := st.updateState(histogram, name, func(state []byte) (any, error) {
+		var h *models.Histogram
+		if state != nil {
+			h = new(models.Histogram)
+			if err := json.Unmarshal(state, h); err != nil {
+				return nil, fmt.Errorf("error decode histogram: %w", err)
+			}
+		}
+		h, err := models.ObserveHistogram(h, bounds, observations)
+		if err != nil {
+			return nil, err
+		}
+		result = h.Clone()
+		return h, nil
+	})
+	return result, err
+}
+
+func (st seriesTx) updateSummary(name string, quantiles, observations []float64) (models.SummaryValue, error) {
+	var result models.SummaryValue
+	err := st.updateState(summary, name, func(state []byte) (any, error) {
+		var sm *models.Summary
+		if state != nil {
+			sm = new(models.Summary)
+			if err := json.Unmarshal(state, sm); err != nil {
+				return nil, fmt.Errorf("error decode summary: %w", err)
+			}
+		}
+		sm, err := models.ObserveSummary(sm, quantiles, observations)
+		if err != nil {
+			return nil, err
+		}
+		result = sm.Value()
+		return sm, nil
+	})
+	return result, err
+}
+
+// updateState - передает состояние серии в update и сохраняет результат в виде JSON.
+// Для новой серии update получает nil.
+func (st seriesTx) updateState(mType, name string, update func(state []byte) (any, error)) error {
+	b := st.tx.Bucket([]byte(mType))
+	v, err := update(b.Get([]byte(name)))
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err = b.Put([]byte(name), data); err != nil {
+		return err
+	}
+	return st.touch(mType, name)
+}
+
+// record - сохраняет значение серии в историю, удаляя значения старше historySize последних.
+func (st seriesTx) record(mType, name string, value float64) error {
+	b, err := st.tx.Bucket(historyBucket).CreateBucketIfNotExists(historyKey(mType, name))
+	if err != nil {
+		return err
+	}
+	seq, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	if err = b.Put(encodeSeq(seq), encodeSample(st.now, value)); err != nil {
+		return err
+	}
+	if seq > historySize {
+		return b.Delete(encodeSeq(seq - historySize))
+	}
+	return nil
+}
+
+// touch - запоминает время обновления серии.
+func (st seriesTx) touch(mType, name string) error {
+	return st.tx.Bucket(updatedBucket).Put(historyKey(mType, name), encodeTime(st.now))
+}
+
+// historyKey - ключ серии с учетом ее типа.
+func historyKey(mType, name string) []byte {
+	return []byte(mType + "/" + name)
+}
+
+func encodeCounter(v int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(v))
+}
+
+func decodeCounter(b []byte) int64 {
+	return int64(binary.BigEndian.Uint64(b))
+}
+
+func encodeGauge(v float64) []byte {
+	return binary.BigEndian.AppendUint64(nil, math.Float64bits(v))
+}
+
+func decodeGauge(b []byte) float64 {
+	return math.Float64frombits(binary.BigEndian.Uint64(b))
+}
+
+func encodeSeq(seq uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, seq)
+}
+
+func encodeTime(t time.Time) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(t.UnixNano()))
+}
+
+func decodeTime(b []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(b)))
+}
+
+// encodeSample - значение истории: время в наносекундах и значение.
+func encodeSample(t time.Time, v float64) []byte {
+	return append(encodeTime(t), encodeGauge(v)...)
+}
+
+func decodeSample(b []byte) storage.Sample {
+	return storage.Sample{Timestamp: decodeTime(b[:8]), Value: decodeGauge(b[8:])}
+}
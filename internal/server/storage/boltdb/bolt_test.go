@@ -0,0 +1,90 @@
+package boltdb
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Sofja96/go-metrics.git/internal/models"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage/storagetest"
+)
+
+func openStorage(t *testing.T, path string) *BoltStorage {
+	t.Helper()
+	s, err := New(context.Background(), path)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+func TestStorageSuite(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return openStorage(t, filepath.Join(t.TempDir(), "metrics.db"))
+	})
+}
+
+func TestReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.db")
+
+	s := openStorage(t, path)
+	_, err := s.UpdateCounter(ctx, "PollCount", 3)
+	require.NoError(t, err)
+	require.NoError(t, s.BatchUpdate(ctx, []models.Metrics{
+		{ID: "Alloc", MType: "gauge", Labels: map[string]string{"host": "agent-1"}, Value: ptrToFloat64(2.5)},
+		{ID: "Latency", MType: "histogram", Buckets: []float64{1, 5}, Observations: []float64{3}},
+	}))
+	require.NoError(t, s.Close())
+	assert.Error(t, s.Ping(ctx))
+
+	reopened := openStorage(t, path)
+	pollCount, ok := reopened.GetCounterValue(ctx, "PollCount")
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), pollCount)
+	alloc, ok := storage.LookupGauge(ctx, reopened, "Alloc", map[string]string{"host": "agent-1"})
+	assert.True(t, ok)
+	assert.Equal(t, 2.5, alloc)
+	h, ok := reopened.GetHistogram(ctx, "Latency")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1), h.Count)
+}
+
+func TestClose(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s, err := New(ctx, filepath.Join(t.TempDir(), "metrics.db"))
+	require.NoError(t, err)
+
+	// файл закрывается только явно, после остановки всех, кто пишет в хранилище
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, s.Ping(context.Background()))
+
+	require.NoError(t, storage.Close(s))
+	assert.Error(t, s.Ping(context.Background()))
+}
+
+func TestHistoryLimit(t *testing.T) {
+	ctx := context.Background()
+	s := openStorage(t, filepath.Join(t.TempDir(), "metrics.db"))
+
+	from := time.Now().Add(-time.Minute)
+	for i := 0; i < historySize+10; i++ {
+		_, err := s.UpdateGauge(ctx, "Alloc", float64(i))
+		require.NoError(t, err)
+	}
+
+	samples, err := s.GetRange(ctx, "Alloc", "gauge", from, time.Now().Add(time.Minute), 0)
+	require.NoError(t, err)
+	require.Len(t, samples, historySize)
+	assert.Equal(t, float64(10), samples[0].Value)
+	assert.Equal(t, float64(historySize+9), samples[historySize-1].Value)
+}
+
+func ptrToFloat64(v float64) *float64 {
+	return &v
+}
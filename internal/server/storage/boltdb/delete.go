@@ -0,0 +1,121 @@
+package boltdb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/Sofja96/go-metrics.git/internal/models"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+)
+
+// Delete - удаляет серию id метрики типа mType вместе с ее историей.
+func (s *BoltStorage) Delete(ctx context.Context, mType, id string) (bool, error) {
+	deleted, err := s.deleteSeries(mType, func(_ *bolt.Tx, key string) bool {
+		return key == id
+	}, []byte(id))
+	if err != nil {
+		return false, err
+	}
+	return len(deleted) != 0, nil
+}
+
+// DeleteByPrefix - удаляет серии метрик типа mType (любого, если тип пуст), имена которых начинаются с prefix.
+func (s *BoltStorage) DeleteByPrefix(ctx context.Context, mType, prefix string) ([]storage.SeriesID, error) {
+	types := []string{mType}
+	if mType == "" {
+		types = []string{gauge, counter, histogram, summary}
+	}
+
+	var deleted []storage.SeriesID
+	for _, t := range types {
+		series, err := s.deleteSeries(t, func(_ *bolt.Tx, key string) bool {
+			name, _ := models.SplitSeriesKey(key)
+			return strings.HasPrefix(name, prefix)
+		}, []byte(prefix))
+		if err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, series...)
+	}
+	return deleted, nil
+}
+
+// DeleteExpired - удаляет серии, не обновлявшиеся дольше времени жизни ttl(mType, name) на момент now.
+// Серии без времени обновления получают его при первой проверке.
+func (s *BoltStorage) DeleteExpired(ctx context.Context, now time.Time, ttl func(mType, name string) time.Duration) ([]storage.SeriesID, error) {
+	var deleted []storage.SeriesID
+	for _, t := range []string{gauge, counter, histogram, summary} {
+		series, err := s.deleteSeries(t, func(tx *bolt.Tx, key string) bool {
+			name, _ := models.SplitSeriesKey(key)
+			d := ttl(t, name)
+			if d <= 0 {
+				return false
+			}
+			updated := tx.Bucket(updatedBucket).Get(historyKey(t, key))
+			if updated == nil {
+				_ = tx.Bucket(updatedBucket).Put(historyKey(t, key), encodeTime(now))
+				return false
+			}
+			return now.Sub(decodeTime(updated)) >= d
+		}, nil)
+		if err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, series...)
+	}
+	return deleted, nil
+}
+
+// deleteSeries - в одной транзакции удаляет серии метрики типа mType, ключи которых
+// начинаются с from и для которых match возвращает true, вместе с историей. Возвращает удаленные серии.
+func (s *BoltStorage) deleteSeries(mType string, match func(tx *bolt.Tx, key string) bool, from []byte) ([]storage.SeriesID, error) {
+	switch mType {
+	case gauge, counter, histogram, summary:
+	default:
+		return nil, fmt.Errorf("unsupported metrics type: %s", mType)
+	}
+
+	// ключи удаляются после обхода: изменять бакет во время обхода курсором нельзя
+	var keys []string
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(mType))
+
+		c := b.Cursor()
+		for k, _ := c.Seek(from); k != nil && strings.HasPrefix(string(k), string(from)); k, _ = c.Next() {
+			if match(tx, string(k)) {
+				keys = append(keys, string(k))
+			}
+		}
+
+		for _, key := range keys {
+			if err := b.Delete([]byte(key)); err != nil {
+				return err
+			}
+			if err := tx.Bucket(updatedBucket).Delete(historyKey(mType, key)); err != nil {
+				return err
+			}
+			for _, name := range [][]byte{historyBucket, rollupBucket} {
+				parent := tx.Bucket(name)
+				if parent.Bucket(historyKey(mType, key)) != nil {
+					if err := parent.DeleteBucket(historyKey(mType, key)); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error delete %s: %w", mType, err)
+	}
+
+	deleted := make([]storage.SeriesID, 0, len(keys))
+	for _, key := range keys {
+		deleted = append(deleted, storage.SeriesID{Type: mType, ID: key})
+	}
+	return deleted, nil
+}
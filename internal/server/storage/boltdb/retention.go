@@ -0,0 +1,255 @@
+package boltdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+)
+
+var (
+	// rollupBucket - вложенные бакеты <тип>/<серия>, а в них бакеты разрешений с агрегатами истории
+	// по времени начала интервала.
+	rollupBucket = []byte("rollup")
+	// rolledBucket - моменты, по которые свернуты уровни агрегатов, по разрешению.
+	rolledBucket = []byte("rolled")
+)
+
+// Compact - сворачивает историю серий в агрегаты уровней policy по начало текущего интервала
+// каждого уровня и удаляет значения и агрегаты старше времени хранения их уровня на момент now.
+func (s *BoltStorage) Compact(ctx context.Context, now time.Time, policy storage.RetentionPolicy) (int, error) {
+	removed := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		removed = 0
+		rolled := readRolled(tx)
+		until := make(map[time.Duration]time.Time, len(policy))
+		for _, level := range policy.Aggregates() {
+			until[level.Resolution] = storage.BucketStart(now, level.Resolution)
+			if rolled[level.Resolution].After(until[level.Resolution]) {
+				until[level.Resolution] = rolled[level.Resolution]
+			}
+		}
+
+		history, rollups := tx.Bucket(historyBucket), tx.Bucket(rollupBucket)
+		for _, key := range bucketKeys(history) {
+			series := history.Bucket(key)
+			if err := rollup(rollups, key, series, policy, rolled, until); err != nil {
+				return err
+			}
+			n, err := deleteBefore(series, now.Add(-policy.Raw()), func(_, v []byte) time.Time {
+				return decodeSample(v).Timestamp
+			})
+			if err != nil {
+				return err
+			}
+			removed += n
+		}
+
+		for _, key := range bucketKeys(rollups) {
+			n, err := retainAggregates(rollups.Bucket(key), now, policy)
+			if err != nil {
+				return err
+			}
+			removed += n
+			if len(bucketKeys(rollups.Bucket(key))) == 0 {
+				if err := rollups.DeleteBucket(key); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := tx.DeleteBucket(rolledBucket); err != nil {
+			return err
+		}
+		b, err := tx.CreateBucket(rolledBucket)
+		if err != nil {
+			return err
+		}
+		for resolution, t := range until {
+			if err := b.Put(encodeSeq(uint64(resolution)), encodeTime(t)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error compact history: %w", err)
+	}
+	return removed, nil
+}
+
+// rollup - дополняет агрегаты серии key уровнями policy за интервалы между rolled и until.
+func rollup(rollups *bolt.Bucket, key []byte, series *bolt.Bucket, policy storage.RetentionPolicy,
+	rolled, until map[time.Duration]time.Time) error {
+	var source []storage.Aggregate
+	err := series.ForEach(func(_, v []byte) error {
+		source = append(source, storage.SampleAggregate(decodeSample(v)))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, level := range policy.Aggregates() {
+		from, to := rolled[level.Resolution], until[level.Resolution]
+		var pending []storage.Aggregate
+		for _, a := range source {
+			if !a.Timestamp.Before(from) && a.Timestamp.Before(to) {
+				pending = append(pending, a)
+			}
+		}
+
+		seriesRollups := rollups.Bucket(key)
+		var b *bolt.Bucket
+		if seriesRollups != nil {
+			b = seriesRollups.Bucket(encodeSeq(uint64(level.Resolution)))
+		}
+		if len(pending) != 0 {
+			if seriesRollups, err = rollups.CreateBucketIfNotExists(key); err != nil {
+				return err
+			}
+			if b, err = seriesRollups.CreateBucketIfNotExists(encodeSeq(uint64(level.Resolution))); err != nil {
+				return err
+			}
+			for _, a := range storage.Rollup(pending, level.Resolution) {
+				if err := b.Put(encodeTime(a.Timestamp), encodeAggregate(a)); err != nil {
+					return err
+				}
+			}
+		}
+
+		source = source[:0]
+		if b != nil {
+			err = b.ForEach(func(k, v []byte) error {
+				source = append(source, decodeAggregate(k, v))
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// retainAggregates - удаляет агрегаты серии старше времени хранения их уровня и уровни, которых нет в policy.
+func retainAggregates(series *bolt.Bucket, now time.Time, policy storage.RetentionPolicy) (int, error) {
+	removed := 0
+	for _, k := range bucketKeys(series) {
+		b := series.Bucket(k)
+		retain := policy.Retain(time.Duration(binary.BigEndian.Uint64(k)))
+		if retain == 0 {
+			removed += b.Stats().KeyN
+			if err := series.DeleteBucket(k); err != nil {
+				return removed, err
+			}
+			continue
+		}
+		n, err := deleteBefore(b, now.Add(-retain), func(k, _ []byte) time.Time { return decodeTime(k) })
+		if err != nil {
+			return removed, err
+		}
+		removed += n
+	}
+	return removed, nil
+}
+
+// deleteBefore - удаляет из бакета, упорядоченного по времени, записи старше t.
+func deleteBefore(b *bolt.Bucket, t time.Time, timestamp func(k, v []byte) time.Time) (int, error) {
+	// ключи удаляются после обхода: изменять бакет во время обхода курсором нельзя
+	var keys [][]byte
+	c := b.Cursor()
+	for k, v := c.First(); k != nil && timestamp(k, v).Before(t); k, v = c.Next() {
+		keys = append(keys, bytes.Clone(k))
+	}
+	for _, k := range keys {
+		if err := b.Delete(k); err != nil {
+			return 0, err
+		}
+	}
+	return len(keys), nil
+}
+
+// readRange - читает историю серии key за [from, to] с шагом step из исходных значений и агрегатов.
+func readRange(tx *bolt.Tx, mType string, key []byte, from, to time.Time, step time.Duration) ([]storage.Sample, error) {
+	series := tx.Bucket(historyBucket).Bucket(key)
+	rollups := tx.Bucket(rollupBucket).Bucket(key)
+	if series == nil && rollups == nil {
+		return []storage.Sample{}, nil
+	}
+
+	return storage.ReadRange(from, to, step, readRolled(tx), func(resolution time.Duration, from, to time.Time) ([]storage.Sample, error) {
+		samples := make([]storage.Sample, 0)
+		if resolution == storage.RawResolution {
+			if series == nil {
+				return samples, nil
+			}
+			err := series.ForEach(func(_, v []byte) error {
+				if sample := decodeSample(v); !sample.Timestamp.Before(from) && sample.Timestamp.Before(to) {
+					samples = append(samples, sample)
+				}
+				return nil
+			})
+			return samples, err
+		}
+
+		if rollups == nil {
+			return samples, nil
+		}
+		b := rollups.Bucket(encodeSeq(uint64(resolution)))
+		if b == nil {
+			return samples, nil
+		}
+		c := b.Cursor()
+		for k, v := c.Seek(encodeTime(from)); k != nil && decodeTime(k).Before(to); k, v = c.Next() {
+			samples = append(samples, decodeAggregate(k, v).Sample(mType))
+		}
+		return samples, nil
+	})
+}
+
+// readRolled - читает моменты, по которые свернуты уровни агрегатов.
+func readRolled(tx *bolt.Tx) map[time.Duration]time.Time {
+	rolled := make(map[time.Duration]time.Time)
+	_ = tx.Bucket(rolledBucket).ForEach(func(k, v []byte) error {
+		rolled[time.Duration(binary.BigEndian.Uint64(k))] = decodeTime(v)
+		return nil
+	})
+	return rolled
+}
+
+// bucketKeys - возвращает ключи вложенных бакетов b.
+func bucketKeys(b *bolt.Bucket) [][]byte {
+	var keys [][]byte
+	_ = b.ForEach(func(k, v []byte) error {
+		if v == nil {
+			keys = append(keys, bytes.Clone(k))
+		}
+		return nil
+	})
+	return keys
+}
+
+// encodeAggregate - агрегат истории: минимум, максимум, сумма и количество значений.
+func encodeAggregate(a storage.Aggregate) []byte {
+	b := encodeGauge(a.Min)
+	b = binary.BigEndian.AppendUint64(b, math.Float64bits(a.Max))
+	b = binary.BigEndian.AppendUint64(b, math.Float64bits(a.Sum))
+	return binary.BigEndian.AppendUint64(b, uint64(a.Count))
+}
+
+func decodeAggregate(k, v []byte) storage.Aggregate {
+	return storage.Aggregate{
+		Timestamp: decodeTime(k),
+		Min:       decodeGauge(v[0:8]),
+		Max:       decodeGauge(v[8:16]),
+		Sum:       decodeGauge(v[16:24]),
+		Count:     int64(binary.BigEndian.Uint64(v[24:32])),
+	}
+}
@@ -0,0 +1,44 @@
+package boltdb
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+)
+
+// Scheme - схема URL хранилища bbolt: file:///var/lib/metrics/metrics.db
+// или file://./metrics.db для пути относительно рабочего каталога.
+const Scheme = "file"
+
+func init() {
+	storage.Register(Scheme, func(ctx context.Context, u *url.URL) (storage.Storage, error) {
+		path, err := PathFromURL(u)
+		if err != nil {
+			return nil, err
+		}
+		return New(ctx, path)
+	})
+}
+
+// PathFromURL - возвращает путь к файлу хранилища из URL.
+func PathFromURL(u *url.URL) (string, error) {
+	path := u.Opaque
+	if path == "" {
+		path = u.Host + u.Path
+	}
+	if path == "" {
+		return "", fmt.Errorf("bolt storage url has no file path")
+	}
+	if len(u.Query()) != 0 {
+		return "", fmt.Errorf("bolt storage url has unexpected parameters %q", u.RawQuery)
+	}
+	return path, nil
+}
+
+// URL - возвращает URL хранилища bbolt для файла path.
+func URL(path string) string {
+	u := url.URL{Scheme: Scheme, Path: path}
+	return u.String()
+}
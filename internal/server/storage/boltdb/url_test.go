@@ -0,0 +1,66 @@
+package boltdb
+
+import (
+	"context"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+)
+
+func TestPathFromURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		want    string
+		wantErr bool
+	}{
+		{url: "file:///var/lib/metrics/metrics.db", want: "/var/lib/metrics/metrics.db"},
+		{url: "file://./metrics.db", want: "./metrics.db"},
+		{url: "file:metrics.db", want: "metrics.db"},
+		{url: "file://", wantErr: true},
+		{url: "file:///tmp/metrics.db?sync=false", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			require.NoError(t, err)
+
+			path, err := PathFromURL(u)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, path)
+		})
+	}
+}
+
+func TestURL(t *testing.T) {
+	for _, path := range []string{"/var/lib/metrics/metrics.db", "./metrics.db", "metrics.db", "/tmp/metrics #1?.db"} {
+		t.Run(path, func(t *testing.T) {
+			u, err := url.Parse(URL(path))
+			require.NoError(t, err)
+			assert.Equal(t, Scheme, u.Scheme)
+
+			got, err := PathFromURL(u)
+			require.NoError(t, err)
+			assert.Equal(t, path, got)
+		})
+	}
+}
+
+func TestOpenURL(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s, err := storage.Open(ctx, "file://"+filepath.Join(t.TempDir(), "metrics.db"))
+	require.NoError(t, err)
+	_, ok := s.(*BoltStorage)
+	assert.True(t, ok)
+}
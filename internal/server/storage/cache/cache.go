@@ -0,0 +1,426 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Sofja96/go-metrics.git/internal/models"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+)
+
+const (
+	counter   string = "counter"
+	gauge     string = "gauge"
+	histogram string = "histogram"
+	summary   string = "summary"
+)
+
+// DefaultMaxEntries - размер кеша, если он не задан в Options.
+const DefaultMaxEntries = 10000
+
+// ErrTTLRequired - кеш без времени жизни записей перед общим хранилищем: изменения других
+// экземпляров сервера не сбрасывают записи, и кеш отдавал бы устаревшие значения бессрочно.
+var ErrTTLRequired = errors.New("cache ttl is required for a shared storage")
+
+// Options - настройки кеша.
+type Options struct {
+	TTL        time.Duration // время жизни записи; 0 - запись живет до изменения серии или вытеснения
+	MaxEntries int           // максимальное количество серий в кеше, включая серии списков GetAll*
+}
+
+// Stats - счетчики обращений к кешу.
+type Stats struct {
+	Hits      uint64 `json:"hits"`      // чтения, обслуженные из кеша
+	Misses    uint64 `json:"misses"`    // чтения, переданные в хранилище
+	Evictions uint64 `json:"evictions"` // записи, вытесненные из-за ограничения размера
+	Entries   int    `json:"entries"`   // текущий размер кеша в сериях
+}
+
+// entryKey - ключ записи: серия key типа mType или список всех серий типа, если all.
+type entryKey struct {
+	mType string
+	key   string
+	all   bool
+}
+
+type entry struct {
+	key     entryKey
+	value   any
+	size    int
+	expires time.Time
+}
+
+// pending - чтения записи из хранилища, начатые после промаха и еще не завершенные.
+type pending struct {
+	readers int
+	gen     uint64 // растет при каждом сбросе записи; прочитанное до сброса значение не сохраняется
+}
+
+// Storage - декоратор хранилища, кеширующий в памяти результаты чтения значений и списков метрик.
+// Запись через декоратор сбрасывает только затронутые серии и списки их типа: значения других
+// серий остаются в кеше. Отсутствующие серии и история значений не кешируются. Возвращаемые
+// значения не должны изменяться.
+type Storage struct {
+	storage.Storage
+	opts Options
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[entryKey]*list.Element
+	lru     *list.List            // записи от недавно использованных к давно использованным
+	pending map[entryKey]*pending // незавершенные чтения после промаха
+	size    int
+	stats   Stats
+}
+
+var (
+	_ storage.Storage   = (*Storage)(nil)
+	_ storage.Ranger    = (*Storage)(nil)
+	_ storage.Deleter   = (*Storage)(nil)
+	_ storage.Compactor = (*Storage)(nil)
+)
+
+// New - оборачивает хранилище s кешем с настройками opts. Изменения в обход декоратора
+// кеш не видит, поэтому перед общим хранилищем (см. storage.Shared) время жизни записей
+// обязательно, иначе возвращается ErrTTLRequired.
+func New(s storage.Storage, opts Options) (*Storage, error) {
+	if opts.TTL <= 0 && storage.Shared(s) {
+		return nil, ErrTTLRequired
+	}
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = DefaultMaxEntries
+	}
+	return &Storage{
+		Storage: s,
+		opts:    opts,
+		now:     time.Now,
+		entries: make(map[entryKey]*list.Element),
+		lru:     list.New(),
+		pending: make(map[entryKey]*pending),
+	}, nil
+}
+
+// Close - закрывает оборачиваемое хранилище.
+func (s *Storage) Close() error {
+	return storage.Close(s.Storage)
+}
+
+// Stats - возвращает счетчики попаданий и промахов кеша.
+func (s *Storage) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := s.stats
+	stats.Entries = s.size
+	return stats
+}
+
+// GetGaugeValue - возвращает значение gauge из кеша или хранилища.
+func (s *Storage) GetGaugeValue(ctx context.Context, id string) (float64, bool) {
+	return getValue(s, entryKey{mType: gauge, key: id}, func() (float64, bool) {
+		return s.Storage.GetGaugeValue(ctx, id)
+	})
+}
+
+// GetCounterValue - возвращает значение counter из кеша или хранилища.
+func (s *Storage) GetCounterValue(ctx context.Context, id string) (int64, bool) {
+	return getValue(s, entryKey{mType: counter, key: id}, func() (int64, bool) {
+		return s.Storage.GetCounterValue(ctx, id)
+	})
+}
+
+// GetHistogram - возвращает состояние histogram из кеша или хранилища.
+func (s *Storage) GetHistogram(ctx context.Context, id string) (models.Histogram, bool) {
+	return getValue(s, entryKey{mType: histogram, key: id}, func() (models.Histogram, bool) {
+		return s.Storage.GetHistogram(ctx, id)
+	})
+}
+
+// GetSummary - возвращает значения summary из кеша или хранилища.
+func (s *Storage) GetSummary(ctx context.Context, id string) (models.SummaryValue, bool) {
+	return getValue(s, entryKey{mType: summary, key: id}, func() (models.SummaryValue, bool) {
+		return s.Storage.GetSummary(ctx, id)
+	})
+}
+
+// GetAllGauges - возвращает все метрики типа gauge из кеша или хранилища.
+func (s *Storage) GetAllGauges(ctx context.Context) ([]storage.GaugeMetric, error) {
+	return getAll(ctx, s, gauge, s.Storage.GetAllGauges)
+}
+
+// GetAllCounters - возвращает все метрики типа counter из кеша или хранилища.
+func (s *Storage) GetAllCounters(ctx context.Context) ([]storage.CounterMetric, error) {
+	return getAll(ctx, s, counter, s.Storage.GetAllCounters)
+}
+
+// GetAllHistograms - возвращает все метрики типа histogram из кеша или хранилища.
+func (s *Storage) GetAllHistograms(ctx context.Context) ([]storage.HistogramMetric, error) {
+	return getAll(ctx, s, histogram, s.Storage.GetAllHistograms)
+}
+
+// GetAllSummaries - возвращает все метрики типа summary из кеша или хранилища.
+func (s *Storage) GetAllSummaries(ctx context.Context) ([]storage.SummaryMetric, error) {
+	return getAll(ctx, s, summary, s.Storage.GetAllSummaries)
+}
+
+// UpdateCounter - обновляет counter и сбрасывает его запись в кеше.
+func (s *Storage) UpdateCounter(ctx context.Context, name string, value int64) (int64, error) {
+	defer s.invalidate(counter, name)
+	return s.Storage.UpdateCounter(ctx, name, value)
+}
+
+// UpdateGauge - обновляет gauge и сбрасывает его запись в кеше.
+func (s *Storage) UpdateGauge(ctx context.Context, name string, value float64) (float64, error) {
+	defer s.invalidate(gauge, name)
+	return s.Storage.UpdateGauge(ctx, name, value)
+}
+
+// UpdateHistogram - добавляет наблюдения в histogram и сбрасывает его запись в кеше.
+func (s *Storage) UpdateHistogram(ctx context.Context, name string, bounds, observations []float64) (models.Histogram, error) {
+	defer s.invalidate(histogram, name)
+	return s.Storage.UpdateHistogram(ctx, name, bounds, observations)
+}
+
+// UpdateSummary - добавляет наблюдения в summary и сбрасывает его запись в кеше.
+func (s *Storage) UpdateSummary(ctx context.Context, name string, quantiles, observations []float64) (models.SummaryValue, error) {
+	defer s.invalidate(summary, name)
+	return s.Storage.UpdateSummary(ctx, name, quantiles, observations)
+}
+
+// BatchUpdate - обновляет метрики пачкой и сбрасывает записи затронутых серий.
+func (s *Storage) BatchUpdate(ctx context.Context, metrics []models.Metrics) error {
+	keys := make(map[string][]string)
+	for _, m := range metrics {
+		keys[m.MType] = append(keys[m.MType], m.SeriesKey())
+	}
+	defer func() {
+		for mType, k := range keys {
+			s.invalidate(mType, k...)
+		}
+	}()
+	return s.Storage.BatchUpdate(ctx, metrics)
+}
+
+// GetRange - получает историю метрики из хранилища; история не кешируется.
+func (s *Storage) GetRange(ctx context.Context, name, mType string, from, to time.Time, step time.Duration) ([]storage.Sample, error) {
+	r, ok := s.Storage.(storage.Ranger)
+	if !ok {
+		return nil, storage.ErrUnsupported
+	}
+	return r.GetRange(ctx, name, mType, from, to, step)
+}
+
+// Compact - сжимает историю в хранилище; последние значения серий и кеш не меняются.
+func (s *Storage) Compact(ctx context.Context, now time.Time, policy storage.RetentionPolicy) (int, error) {
+	c, ok := s.Storage.(storage.Compactor)
+	if !ok {
+		return 0, storage.ErrUnsupported
+	}
+	return c.Compact(ctx, now, policy)
+}
+
+// Delete - удаляет серию и сбрасывает ее запись в кеше.
+func (s *Storage) Delete(ctx context.Context, mType, id string) (bool, error) {
+	d, ok := s.Storage.(storage.Deleter)
+	if !ok {
+		return false, storage.ErrUnsupported
+	}
+	defer s.invalidate(mType, id)
+	return d.Delete(ctx, mType, id)
+}
+
+// DeleteByPrefix - удаляет серии по префиксу имени и сбрасывает их записи в кеше.
+// При ошибке хранилища сбрасывается кеш всех затронутых типов.
+func (s *Storage) DeleteByPrefix(ctx context.Context, mType, prefix string) ([]storage.SeriesID, error) {
+	d, ok := s.Storage.(storage.Deleter)
+	if !ok {
+		return nil, storage.ErrUnsupported
+	}
+	deleted, err := d.DeleteByPrefix(ctx, mType, prefix)
+	switch {
+	case err == nil:
+		s.invalidateDeleted(deleted)
+	case mType == "":
+		s.invalidateTypes(gauge, counter, histogram, summary)
+	default:
+		s.invalidateTypes(mType)
+	}
+	return deleted, err
+}
+
+// DeleteExpired - удаляет устаревшие серии и сбрасывает их записи в кеше.
+// При ошибке хранилища сбрасывается весь кеш.
+func (s *Storage) DeleteExpired(ctx context.Context, now time.Time, ttl func(mType, name string) time.Duration) ([]storage.SeriesID, error) {
+	d, ok := s.Storage.(storage.Deleter)
+	if !ok {
+		return nil, storage.ErrUnsupported
+	}
+	deleted, err := d.DeleteExpired(ctx, now, ttl)
+	if err != nil {
+		s.invalidateTypes(gauge, counter, histogram, summary)
+	} else {
+		s.invalidateDeleted(deleted)
+	}
+	return deleted, err
+}
+
+// invalidateDeleted - сбрасывает записи удаленных серий и списки их типов.
+func (s *Storage) invalidateDeleted(deleted []storage.SeriesID) {
+	keys := make(map[string][]string)
+	for _, series := range deleted {
+		keys[series.Type] = append(keys[series.Type], series.ID)
+	}
+	for mType, k := range keys {
+		s.invalidate(mType, k...)
+	}
+}
+
+// getValue - возвращает значение серии из кеша, а при промахе читает его функцией load и запоминает.
+func getValue[T any](s *Storage, k entryKey, load func() (T, bool)) (T, bool) {
+	cached, gen, ok := s.lookup(k)
+	if ok {
+		return cached.(T), true
+	}
+	v, ok := load()
+	if !ok {
+		s.release(k, gen)
+		return v, false
+	}
+	s.store(k, v, 1, gen)
+	return v, true
+}
+
+// getAll - возвращает копию списка всех серий типа mType из кеша, а при промахе читает его функцией load.
+func getAll[T any](ctx context.Context, s *Storage, mType string, load func(context.Context) ([]T, error)) ([]T, error) {
+	k := entryKey{mType: mType, all: true}
+	v, gen, ok := s.lookup(k)
+	if ok {
+		return slices.Clone(v.([]T)), nil
+	}
+	all, err := load(ctx)
+	if err != nil {
+		s.release(k, gen)
+		return nil, err
+	}
+	s.store(k, slices.Clone(all), max(len(all), 1), gen)
+	return all, nil
+}
+
+// lookup - ищет действующую запись k. При промахе регистрирует чтение записи из хранилища
+// и возвращает ее поколение, которое передается в store или release по завершении чтения.
+func (s *Storage) lookup(k entryKey) (any, uint64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[k]; ok {
+		e := el.Value.(*entry)
+		if s.opts.TTL <= 0 || s.now().Before(e.expires) {
+			s.lru.MoveToFront(el)
+			s.stats.Hits++
+			return e.value, 0, true
+		}
+		s.remove(el)
+	}
+	s.stats.Misses++
+	p, ok := s.pending[k]
+	if !ok {
+		p = &pending{}
+		s.pending[k] = p
+	}
+	p.readers++
+	return nil, p.gen, false
+}
+
+// store - завершает чтение записи k и сохраняет значение размером size серий, если с момента
+// промаха запись не сбрасывалась. Иначе значение могло быть прочитано до записи и уже устарело.
+func (s *Storage) store(k entryKey, value any, size int, gen uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.done(k, gen) || size > s.opts.MaxEntries {
+		return
+	}
+	if el, ok := s.entries[k]; ok {
+		s.remove(el)
+	}
+	for s.size+size > s.opts.MaxEntries {
+		s.remove(s.lru.Back())
+		s.stats.Evictions++
+	}
+
+	e := &entry{key: k, value: value, size: size}
+	if s.opts.TTL > 0 {
+		e.expires = s.now().Add(s.opts.TTL)
+	}
+	s.entries[k] = s.lru.PushFront(e)
+	s.size += size
+}
+
+// release - завершает чтение записи k, результат которого не сохраняется.
+func (s *Storage) release(k entryKey, gen uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.done(k, gen)
+}
+
+// done - завершает чтение записи k, начатое при поколении gen, и сообщает, что запись
+// с тех пор не сбрасывалась. Вызывается под s.mu.
+func (s *Storage) done(k entryKey, gen uint64) bool {
+	p := s.pending[k]
+	p.readers--
+	if p.readers == 0 {
+		delete(s.pending, k)
+	}
+	return p.gen == gen
+}
+
+// invalidate - сбрасывает записи серий keys типа mType и список всех серий этого типа.
+// Записи других серий не затрагиваются.
+func (s *Storage) invalidate(mType string, keys ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		s.drop(entryKey{mType: mType, key: key})
+	}
+	s.drop(entryKey{mType: mType, all: true})
+}
+
+// invalidateTypes - сбрасывает все записи типов types.
+func (s *Storage) invalidateTypes(types ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, el := range s.entries {
+		if slices.Contains(types, k.mType) {
+			s.remove(el)
+		}
+	}
+	for k, p := range s.pending {
+		if slices.Contains(types, k.mType) {
+			p.gen++
+		}
+	}
+}
+
+// drop - сбрасывает запись k и не дает сохранить значения, читаемые для нее сейчас.
+// Вызывается под s.mu.
+func (s *Storage) drop(k entryKey) {
+	if el, ok := s.entries[k]; ok {
+		s.remove(el)
+	}
+	if p, ok := s.pending[k]; ok {
+		p.gen++
+	}
+}
+
+func (s *Storage) remove(el *list.Element) {
+	e := s.lru.Remove(el).(*entry)
+	delete(s.entries, e.key)
+	s.size -= e.size
+}
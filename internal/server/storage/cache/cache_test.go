@@ -0,0 +1,284 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Sofja96/go-metrics.git/internal/models"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage/memory"
+	storagemock "github.com/Sofja96/go-metrics.git/internal/server/storage/mocks"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage/storagetest"
+	"github.com/Sofja96/go-metrics.git/internal/utils"
+)
+
+func TestStorageSuite(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		mem, err := memory.New(context.Background(), memory.Options{})
+		require.NoError(t, err)
+		return newStorage(t, mem, Options{MaxEntries: 100})
+	})
+}
+
+func TestStorage(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Hit after miss", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		m := storagemock.NewMockStorage(ctrl)
+		m.EXPECT().GetGaugeValue(ctx, "Alloc").Return(1.5, true).Times(1)
+		m.EXPECT().GetAllCounters(ctx).Return([]storage.CounterMetric{{Name: "PollCount", Value: 3}}, nil).Times(1)
+
+		s := newStorage(t, m, Options{})
+		for i := 0; i < 3; i++ {
+			v, ok := s.GetGaugeValue(ctx, "Alloc")
+			assert.True(t, ok)
+			assert.Equal(t, 1.5, v)
+
+			counters, err := s.GetAllCounters(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, []storage.CounterMetric{{Name: "PollCount", Value: 3}}, counters)
+		}
+		assert.Equal(t, Stats{Hits: 4, Misses: 2, Entries: 2}, s.Stats())
+	})
+
+	t.Run("Missing series are not cached", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		m := storagemock.NewMockStorage(ctrl)
+		m.EXPECT().GetCounterValue(ctx, "PollCount").Return(int64(0), false).Times(2)
+
+		s := newStorage(t, m, Options{})
+		for i := 0; i < 2; i++ {
+			_, ok := s.GetCounterValue(ctx, "PollCount")
+			assert.False(t, ok)
+		}
+		assert.Equal(t, Stats{Misses: 2}, s.Stats())
+	})
+
+	t.Run("Errors are not cached", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		m := storagemock.NewMockStorage(ctrl)
+		m.EXPECT().GetAllGauges(ctx).Return(nil, assert.AnError)
+		m.EXPECT().GetAllGauges(ctx).Return([]storage.GaugeMetric{}, nil)
+
+		s := newStorage(t, m, Options{})
+		_, err := s.GetAllGauges(ctx)
+		assert.ErrorIs(t, err, assert.AnError)
+		_, err = s.GetAllGauges(ctx)
+		assert.NoError(t, err)
+	})
+
+	t.Run("TTL", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		m := storagemock.NewMockStorage(ctrl)
+		m.EXPECT().GetGaugeValue(ctx, "Alloc").Return(1.0, true)
+		m.EXPECT().GetGaugeValue(ctx, "Alloc").Return(2.0, true)
+
+		now := time.Unix(1700000000, 0)
+		s := newStorage(t, m, Options{TTL: time.Minute})
+		s.now = func() time.Time { return now }
+
+		v, _ := s.GetGaugeValue(ctx, "Alloc")
+		assert.Equal(t, 1.0, v)
+		now = now.Add(59 * time.Second)
+		v, _ = s.GetGaugeValue(ctx, "Alloc")
+		assert.Equal(t, 1.0, v)
+		now = now.Add(time.Second)
+		v, _ = s.GetGaugeValue(ctx, "Alloc")
+		assert.Equal(t, 2.0, v)
+	})
+
+	t.Run("Size bound evicts least recently used", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		m := storagemock.NewMockStorage(ctrl)
+		m.EXPECT().GetGaugeValue(ctx, "A").Return(1.0, true).Times(1)
+		m.EXPECT().GetGaugeValue(ctx, "B").Return(2.0, true).Times(2)
+		m.EXPECT().GetGaugeValue(ctx, "C").Return(3.0, true).Times(1)
+		m.EXPECT().GetAllGauges(ctx).Return([]storage.GaugeMetric{{Name: "A"}, {Name: "B"}, {Name: "C"}}, nil).Times(2)
+
+		s := newStorage(t, m, Options{MaxEntries: 2})
+		s.GetGaugeValue(ctx, "A")
+		s.GetGaugeValue(ctx, "B")
+		s.GetGaugeValue(ctx, "A")
+		s.GetGaugeValue(ctx, "C") // вытесняет B
+		s.GetGaugeValue(ctx, "A")
+		s.GetGaugeValue(ctx, "B")
+
+		// список больше размера кеша не сохраняется
+		s.GetAllGauges(ctx)
+		s.GetAllGauges(ctx)
+
+		stats := s.Stats()
+		assert.Equal(t, uint64(2), stats.Hits)
+		assert.Equal(t, uint64(2), stats.Evictions)
+		assert.Equal(t, 2, stats.Entries)
+	})
+
+	t.Run("Writes invalidate series and lists", func(t *testing.T) {
+		mem, err := memory.New(ctx, memory.Options{})
+		require.NoError(t, err)
+		s := newStorage(t, mem, Options{})
+
+		_, err = s.UpdateCounter(ctx, "PollCount", 1)
+		require.NoError(t, err)
+		_, err = s.UpdateGauge(ctx, "Alloc", 1)
+		require.NoError(t, err)
+
+		v, _ := s.GetCounterValue(ctx, "PollCount")
+		assert.Equal(t, int64(1), v)
+		gauges, err := s.GetAllGauges(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []storage.GaugeMetric{{Name: "Alloc", Value: 1}}, gauges)
+
+		require.NoError(t, s.BatchUpdate(ctx, []models.Metrics{
+			{ID: "PollCount", MType: counter, Delta: utils.IntPtr(2)},
+			{ID: "Alloc", MType: gauge, Value: utils.FloatPtr(5)},
+		}))
+		v, _ = s.GetCounterValue(ctx, "PollCount")
+		assert.Equal(t, int64(3), v)
+		gauges, err = s.GetAllGauges(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []storage.GaugeMetric{{Name: "Alloc", Value: 5}}, gauges)
+
+		ok, err := s.Delete(ctx, counter, "PollCount")
+		require.NoError(t, err)
+		assert.True(t, ok)
+		_, ok = s.GetCounterValue(ctx, "PollCount")
+		assert.False(t, ok)
+
+		deleted, err := s.DeleteByPrefix(ctx, "", "All")
+		require.NoError(t, err)
+		assert.Equal(t, []storage.SeriesID{{Type: gauge, ID: "Alloc"}}, deleted)
+		gauges, err = s.GetAllGauges(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, gauges)
+	})
+
+	t.Run("Stale read is not stored after write", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		m := storagemock.NewMockStorage(ctrl)
+		s := newStorage(t, m, Options{})
+
+		// запись завершается, пока значение читается из хранилища
+		m.EXPECT().GetGaugeValue(ctx, "Alloc").DoAndReturn(func(context.Context, string) (float64, bool) {
+			s.invalidate(gauge, "Alloc")
+			return 1.0, true
+		})
+		m.EXPECT().GetGaugeValue(ctx, "Alloc").Return(2.0, true)
+
+		v, _ := s.GetGaugeValue(ctx, "Alloc")
+		assert.Equal(t, 1.0, v)
+		v, _ = s.GetGaugeValue(ctx, "Alloc")
+		assert.Equal(t, 2.0, v)
+	})
+
+	t.Run("Write of other series does not drop read", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		m := storagemock.NewMockStorage(ctrl)
+		s := newStorage(t, m, Options{})
+
+		// пока читается Alloc, записывается другая серия того же типа
+		m.EXPECT().UpdateGauge(ctx, "HeapAlloc", 2.0).Return(2.0, nil)
+		m.EXPECT().GetGaugeValue(ctx, "Alloc").DoAndReturn(func(context.Context, string) (float64, bool) {
+			_, err := s.UpdateGauge(ctx, "HeapAlloc", 2)
+			require.NoError(t, err)
+			return 1.0, true
+		}).Times(1)
+
+		for i := 0; i < 2; i++ {
+			v, _ := s.GetGaugeValue(ctx, "Alloc")
+			assert.Equal(t, 1.0, v)
+		}
+		assert.Equal(t, Stats{Hits: 1, Misses: 1, Entries: 1}, s.Stats())
+	})
+
+	t.Run("Stale list is not stored after write", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		m := storagemock.NewMockStorage(ctrl)
+		s := newStorage(t, m, Options{})
+
+		m.EXPECT().UpdateGauge(ctx, "Alloc", 2.0).Return(2.0, nil)
+		m.EXPECT().GetAllGauges(ctx).DoAndReturn(func(context.Context) ([]storage.GaugeMetric, error) {
+			_, err := s.UpdateGauge(ctx, "Alloc", 2)
+			require.NoError(t, err)
+			return []storage.GaugeMetric{{Name: "Alloc", Value: 1}}, nil
+		})
+		m.EXPECT().GetAllGauges(ctx).Return([]storage.GaugeMetric{{Name: "Alloc", Value: 2}}, nil)
+
+		gauges, err := s.GetAllGauges(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1.0, gauges[0].Value)
+		gauges, err = s.GetAllGauges(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2.0, gauges[0].Value)
+		assert.Empty(t, s.pending, "finished reads are not tracked")
+	})
+
+	t.Run("Delete drops only deleted series", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		m := storagemock.NewMockStorage(ctrl)
+		d := storagemock.NewMockDeleter(ctrl)
+		s := newStorage(t, deleterStorage{m, d}, Options{})
+
+		m.EXPECT().GetGaugeValue(ctx, "Alloc").Return(1.0, true).Times(1)
+		m.EXPECT().GetGaugeValue(ctx, "HeapAlloc").Return(2.0, true).Times(2)
+		d.EXPECT().DeleteByPrefix(ctx, "", "Heap").Return([]storage.SeriesID{{Type: gauge, ID: "HeapAlloc"}}, nil)
+
+		s.GetGaugeValue(ctx, "Alloc")
+		s.GetGaugeValue(ctx, "HeapAlloc")
+		_, err := s.DeleteByPrefix(ctx, "", "Heap")
+		require.NoError(t, err)
+		s.GetGaugeValue(ctx, "Alloc")
+		s.GetGaugeValue(ctx, "HeapAlloc")
+		assert.Equal(t, uint64(1), s.Stats().Hits)
+	})
+
+	t.Run("Optional capabilities of storage", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		s := newStorage(t, storagemock.NewMockStorage(ctrl), Options{})
+
+		_, err := s.Delete(ctx, gauge, "Alloc")
+		assert.ErrorIs(t, err, storage.ErrUnsupported)
+		_, err = s.GetRange(ctx, "Alloc", gauge, time.Now(), time.Now(), 0)
+		assert.ErrorIs(t, err, storage.ErrUnsupported)
+		_, err = s.Compact(ctx, time.Now(), nil)
+		assert.ErrorIs(t, err, storage.ErrUnsupported)
+	})
+}
+
+// deleterStorage - хранилище с удалением серий из моков Storage и Deleter.
+type deleterStorage struct {
+	*storagemock.MockStorage
+	*storagemock.MockDeleter
+}
+
+// sharedStorage - хранилище, общее для нескольких экземпляров сервера.
+type sharedStorage struct {
+	storage.Storage
+}
+
+func (sharedStorage) Shared() bool { return true }
+
+func TestNewSharedStorage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	shared := sharedStorage{Storage: storagemock.NewMockStorage(ctrl)}
+
+	_, err := New(shared, Options{MaxEntries: 100})
+	assert.ErrorIs(t, err, ErrTTLRequired)
+
+	s, err := New(shared, Options{TTL: time.Second})
+	require.NoError(t, err)
+	assert.NotNil(t, s)
+}
+
+func newStorage(t *testing.T, s storage.Storage, opts Options) *Storage {
+	t.Helper()
+	c, err := New(s, opts)
+	require.NoError(t, err)
+	return c
+}
@@ -0,0 +1,264 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Sofja96/go-metrics.git/internal/models"
+)
+
+// batchChunkSize - максимальное количество серий в одном запросе вставки. Postgres
+// принимает не больше 65535 параметров в запросе, на серию их уходит три.
+const batchChunkSize = 1000
+
+// seriesID - имя и метки серии в том виде, в котором они хранятся в таблицах.
+type seriesID struct {
+	name   string
+	labels string
+}
+
+func newSeriesID(key string) seriesID {
+	name, labels := models.SplitSeriesKey(key)
+	return seriesID{name: name, labels: labels}
+}
+
+// batchSeries - серия gauge или counter пачки с итоговым значением.
+type batchSeries struct {
+	seriesID
+	value float64 // последнее значение gauge
+	delta int64   // сумма приращений counter
+}
+
+// batchDistribution - обновление histogram или summary из пачки.
+type batchDistribution struct {
+	table  string
+	index  int // номер метрики в пачке
+	metric models.Metrics
+}
+
+// BatchUpdate - обновляет метрики пачкой в одной транзакции: при ошибке не сохраняется
+// ни одна метрика пачки. Повторы серий внутри пачки сворачиваются: для gauge остается
+// последнее значение, приращения counter суммируются. Gauge и counter записываются
+// многострочными upsert по batchChunkSize серий. В Delta метрик counter записываются
+// значения серии после применения каждого приращения, как при последовательных обновлениях,
+// в Histogram и Summary - новые состояния.
+func (pg *Postgres) BatchUpdate(ctx context.Context, metrics []models.Metrics) error {
+	if len(metrics) == 0 {
+		log.Println("no metrics provided")
+		return fmt.Errorf("no metrics provided")
+	}
+
+	gauges, counters, distributions, err := aggregateBatch(metrics)
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+
+	tx, err := pg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("error occured on creating tx on batchupdate: %v", err)
+		return fmt.Errorf("error occured on creating tx on batchupdate: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err = upsertGauges(ctx, tx, gauges); err != nil {
+		log.Printf("error update gauge: %v", err)
+		return fmt.Errorf("error update gauge: %w", err)
+	}
+	totals, err := upsertCounters(ctx, tx, counters)
+	if err != nil {
+		log.Printf("error update counter: %v", err)
+		return fmt.Errorf("error update counter: %w", err)
+	}
+	histograms := make(map[int]*models.Histogram)
+	summaries := make(map[int]*models.SummaryValue)
+	for _, d := range distributions {
+		var update func(state string) (string, error)
+		if d.table == "histogram_metrics" {
+			histograms[d.index] = new(models.Histogram)
+			update = observeHistogram(d.metric.Buckets, d.metric.Observations, histograms[d.index])
+		} else {
+			summaries[d.index] = new(models.SummaryValue)
+			update = observeSummary(d.metric.Quantiles, d.metric.Observations, summaries[d.index])
+		}
+		if err = updateStateTx(ctx, tx, d.table, d.metric.SeriesKey(), update); err != nil {
+			log.Printf("error update %s: %v", d.metric.MType, err)
+			return fmt.Errorf("error update %s: %w", d.metric.MType, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Printf("failed to commit transaction: %v", err)
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	for i, h := range histograms {
+		metrics[i].Histogram = h
+	}
+	for i, v := range summaries {
+		metrics[i].Summary = v
+	}
+
+	// итог серии известен только после upsert, поэтому промежуточные значения
+	// восстанавливаются с конца пачки вычитанием приращений
+	for i := len(metrics) - 1; i >= 0; i-- {
+		if metrics[i].MType != "counter" {
+			continue
+		}
+		key := newSeriesID(metrics[i].SeriesKey())
+		total, delta := totals[key], *metrics[i].Delta
+		*metrics[i].Delta = total
+		totals[key] = total - delta
+	}
+	return nil
+}
+
+// aggregateBatch - проверяет метрики пачки и сворачивает повторы серий gauge и counter.
+// Серии возвращаются упорядоченными по имени и меткам, чтобы одновременные пачки
+// блокировали строки в одном порядке и не взаимоблокировались.
+func aggregateBatch(metrics []models.Metrics) ([]batchSeries, []batchSeries, []batchDistribution, error) {
+	gauges := make(map[seriesID]*batchSeries)
+	counters := make(map[seriesID]*batchSeries)
+	distributions := make([]batchDistribution, 0)
+
+	for i, v := range metrics {
+		key := newSeriesID(v.SeriesKey())
+		switch v.MType {
+		case "gauge":
+			if v.Value == nil {
+				return nil, nil, nil, fmt.Errorf("gauge %s has no value", v.ID)
+			}
+			series(gauges, key).value = *v.Value
+		case "counter":
+			if v.Delta == nil {
+				return nil, nil, nil, fmt.Errorf("counter %s has no delta", v.ID)
+			}
+			series(counters, key).delta += *v.Delta
+		case "histogram":
+			distributions = append(distributions, batchDistribution{table: "histogram_metrics", index: i, metric: v})
+		case "summary":
+			distributions = append(distributions, batchDistribution{table: "summary_metrics", index: i, metric: v})
+		default:
+			return nil, nil, nil, fmt.Errorf("unsopperted metrics type: %s", v.MType)
+		}
+	}
+	return sortedSeries(gauges), sortedSeries(counters), distributions, nil
+}
+
+func series(m map[seriesID]*batchSeries, id seriesID) *batchSeries {
+	s, ok := m[id]
+	if !ok {
+		s = &batchSeries{seriesID: id}
+		m[id] = s
+	}
+	return s
+}
+
+func sortedSeries(m map[seriesID]*batchSeries) []batchSeries {
+	result := make([]batchSeries, 0, len(m))
+	for _, s := range m {
+		result = append(result, *s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].name != result[j].name {
+			return result[i].name < result[j].name
+		}
+		return result[i].labels < result[j].labels
+	})
+	return result
+}
+
+// upsertGauges - записывает значения серий gauge и их отсчеты истории.
+func upsertGauges(ctx context.Context, tx *sql.Tx, gauges []batchSeries) error {
+	for len(gauges) != 0 {
+		chunk := gauges[:min(len(gauges), batchChunkSize)]
+		gauges = gauges[len(chunk):]
+
+		args := make([]any, 0, len(chunk)*3)
+		for _, g := range chunk {
+			args = append(args, g.name, g.labels, g.value)
+		}
+		_, err := tx.ExecContext(ctx, `WITH upsert AS (INSERT INTO gauge_metrics(name, labels, value)
+                                              VALUES `+valuesList(len(chunk), 3)+`
+                                              ON CONFLICT (name, labels) DO UPDATE SET value = EXCLUDED.value, updated_at = now()
+                                              RETURNING name, labels, value)
+                                              INSERT INTO metric_samples(name, labels, type, value)
+                                              SELECT name, labels, 'gauge', value FROM upsert`, args...)
+		if err != nil {
+			return fmt.Errorf("error insert gauges: %w", err)
+		}
+	}
+	return nil
+}
+
+// upsertCounters - прибавляет приращения к сериям counter, записывает их отсчеты истории
+// и возвращает новые значения серий.
+func upsertCounters(ctx context.Context, tx *sql.Tx, counters []batchSeries) (map[seriesID]int64, error) {
+	totals := make(map[seriesID]int64, len(counters))
+	for len(counters) != 0 {
+		chunk := counters[:min(len(counters), batchChunkSize)]
+		counters = counters[len(chunk):]
+
+		args := make([]any, 0, len(chunk)*3)
+		for _, c := range chunk {
+			args = append(args, c.name, c.labels, c.delta)
+		}
+		rows, err := tx.QueryContext(ctx, `WITH upsert AS (INSERT INTO counter_metrics(name, labels, value)
+                                              VALUES `+valuesList(len(chunk), 3)+`
+                                              ON CONFLICT (name, labels) DO UPDATE
+                                              SET value = counter_metrics.value + EXCLUDED.value, updated_at = now()
+                                              RETURNING name, labels, value),
+                                              sample AS (INSERT INTO metric_samples(name, labels, type, value)
+                                              SELECT name, labels, 'counter', value FROM upsert)
+                                              SELECT name, labels, value FROM upsert`, args...)
+		if err != nil {
+			return nil, fmt.Errorf("error insert counters: %w", err)
+		}
+		err = scanTotals(rows, totals)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return totals, nil
+}
+
+func scanTotals(rows *sql.Rows, totals map[seriesID]int64) error {
+	defer rows.Close()
+	for rows.Next() {
+		var id seriesID
+		var value int64
+		if err := rows.Scan(&id.name, &id.labels, &value); err != nil {
+			return fmt.Errorf("error scanning counters: %w", err)
+		}
+		totals[id] = value
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error insert counters: %w", err)
+	}
+	return nil
+}
+
+// valuesList - возвращает список строк VALUES с нумерованными параметрами: ($1, $2), ($3, $4).
+func valuesList(rows, cols int) string {
+	var b strings.Builder
+	for r := 0; r < rows; r++ {
+		if r > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteByte('(')
+		for c := 0; c < cols; c++ {
+			if c > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(r*cols + c + 1))
+		}
+		b.WriteByte(')')
+	}
+	return b.String()
+}
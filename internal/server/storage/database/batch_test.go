@@ -0,0 +1,226 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Sofja96/go-metrics.git/internal/models"
+)
+
+func TestBatchUpdate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open mock database: %v", err)
+	}
+	defer db.Close()
+
+	gaugeQuery := regexp.QuoteMeta(`INSERT INTO gauge_metrics(name, labels, value) VALUES ($1, $2, $3), ($4, $5, $6)
+		ON CONFLICT (name, labels) DO UPDATE SET value = EXCLUDED.value`)
+	counterQuery := regexp.QuoteMeta(`INSERT INTO counter_metrics(name, labels, value) VALUES ($1, $2, $3), ($4, $5, $6)
+		ON CONFLICT (name, labels) DO UPDATE SET value = counter_metrics.value + EXCLUDED.value`)
+	histogramInsert := regexp.QuoteMeta(`INSERT INTO histogram_metrics(name, labels, state) VALUES ($1, $2, '')`)
+	histogramSelect := regexp.QuoteMeta(`SELECT state FROM histogram_metrics WHERE name = $1 AND labels = $2 FOR UPDATE`)
+	histogramUpdate := regexp.QuoteMeta(`UPDATE histogram_metrics SET state = $3`)
+	host := map[string]string{"host": "agent-1"}
+
+	// повторы серий: gauge cpu_usage и counter counter1 без меток встречаются дважды
+	batch := func() []models.Metrics {
+		return []models.Metrics{
+			{ID: "memory_usage", MType: "gauge", Value: ptrToFloat64(60.0)},
+			{ID: "cpu_usage", MType: "gauge", Value: ptrToFloat64(75.5)},
+			{ID: "counter1", MType: "counter", Delta: ptrToInt64(10)},
+			{ID: "counter1", MType: "counter", Labels: host, Delta: ptrToInt64(3)},
+			{ID: "cpu_usage", MType: "gauge", Value: ptrToFloat64(80.0)},
+			{ID: "counter1", MType: "counter", Delta: ptrToInt64(5)},
+			{ID: "latency", MType: "histogram", Buckets: []float64{1, 5}, Observations: []float64{3}},
+		}
+	}
+	expectGauges := func() *sqlmock.ExpectedExec {
+		return mock.ExpectExec(gaugeQuery).WithArgs("cpu_usage", "", 80.0, "memory_usage", "", 60.0)
+	}
+	expectCounters := func() *sqlmock.ExpectedQuery {
+		return mock.ExpectQuery(counterQuery).WithArgs("counter1", "", int64(15), "counter1", `host="agent-1"`, int64(3))
+	}
+	counterRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"name", "labels", "value"}).
+			AddRow("counter1", "", 20).
+			AddRow("counter1", `host="agent-1"`, 3)
+	}
+
+	tests := []struct {
+		name         string
+		metrics      []models.Metrics
+		mockBehavior func()
+		wantErr      error
+		wantDeltas   []int64
+		wantState    *models.Histogram
+	}{
+		{
+			name:    "Valid batch update",
+			metrics: batch(),
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				expectGauges().WillReturnResult(sqlmock.NewResult(0, 2))
+				expectCounters().WillReturnRows(counterRows())
+				mock.ExpectExec(histogramInsert).WithArgs("latency", "").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectQuery(histogramSelect).WithArgs("latency", "").
+					WillReturnRows(sqlmock.NewRows([]string{"state"}).AddRow(""))
+				mock.ExpectExec(histogramUpdate).
+					WithArgs("latency", "", `{"bounds":[1,5],"counts":[0,1,0],"count":1,"sum":3}`).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+			// значения серии после каждого приращения, как при последовательных обновлениях
+			wantDeltas: []int64{15, 3, 20},
+			wantState:  &models.Histogram{Bounds: []float64{1, 5}, Counts: []uint64{0, 1, 0}, Count: 1, Sum: 3},
+		},
+		{
+			name:    "Invalid transaction start",
+			metrics: batch(),
+			mockBehavior: func() {
+				mock.ExpectBegin().WillReturnError(fmt.Errorf("error occured on creating tx on batchupdate"))
+			},
+			wantErr: assert.AnError,
+		},
+		{
+			name:    "SQL execution error on gauge",
+			metrics: batch(),
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				expectGauges().WillReturnError(fmt.Errorf("insert error gauge"))
+				mock.ExpectRollback()
+			},
+			wantErr:    assert.AnError,
+			wantDeltas: []int64{10, 3, 5},
+		},
+		{
+			name:    "SQL execution error on counter",
+			metrics: batch(),
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				expectGauges().WillReturnResult(sqlmock.NewResult(0, 2))
+				expectCounters().WillReturnError(fmt.Errorf("insert error counter"))
+				mock.ExpectRollback()
+			},
+			wantErr: assert.AnError,
+		},
+		{
+			name:    "Histogram layout mismatch rolls back the whole batch",
+			metrics: batch(),
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				expectGauges().WillReturnResult(sqlmock.NewResult(0, 2))
+				expectCounters().WillReturnRows(counterRows())
+				mock.ExpectExec(histogramInsert).WithArgs("latency", "").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectQuery(histogramSelect).WithArgs("latency", "").
+					WillReturnRows(sqlmock.NewRows([]string{"state"}).AddRow(`{"bounds":[1,10],"counts":[0,0,0]}`))
+				mock.ExpectRollback()
+			},
+			wantErr: models.ErrLayoutMismatch,
+		},
+		{
+			name:         "empty list metrics",
+			metrics:      []models.Metrics{},
+			mockBehavior: func() {},
+			wantErr:      assert.AnError,
+		},
+		{
+			name: "unsupported metrics type",
+			metrics: []models.Metrics{
+				{ID: "unsupported_metric", MType: "unsupported", Value: ptrToFloat64(75.5)},
+			},
+			mockBehavior: func() {},
+			wantErr:      assert.AnError,
+		},
+		{
+			name: "counter without delta",
+			metrics: []models.Metrics{
+				{ID: "counter1", MType: "counter"},
+			},
+			mockBehavior: func() {},
+			wantErr:      assert.AnError,
+		},
+		{
+			name:    "failed to commit transaction",
+			metrics: batch(),
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				expectGauges().WillReturnResult(sqlmock.NewResult(0, 2))
+				expectCounters().WillReturnRows(counterRows())
+				mock.ExpectExec(histogramInsert).WithArgs("latency", "").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectQuery(histogramSelect).WithArgs("latency", "").
+					WillReturnRows(sqlmock.NewRows([]string{"state"}).AddRow(""))
+				mock.ExpectExec(histogramUpdate).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit().WillReturnError(fmt.Errorf("failed to commit transaction"))
+			},
+			wantErr:    assert.AnError,
+			wantDeltas: []int64{10, 3, 5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pg := &Postgres{DB: sqlx.NewDb(db, "sqlmock")}
+
+			tt.mockBehavior()
+			err := pg.BatchUpdate(context.Background(), tt.metrics)
+
+			switch tt.wantErr {
+			case nil:
+				assert.NoError(t, err)
+			case assert.AnError:
+				assert.Error(t, err)
+			default:
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+			if tt.wantDeltas != nil {
+				var deltas []int64
+				for _, m := range tt.metrics {
+					if m.MType == "counter" {
+						deltas = append(deltas, *m.Delta)
+					}
+				}
+				assert.Equal(t, tt.wantDeltas, deltas)
+			}
+			if len(tt.metrics) == len(batch()) {
+				// при ошибке состояние histogram в пачку не записывается
+				assert.Equal(t, tt.wantState, tt.metrics[6].Histogram)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet(), "Not all SQL expectations were met")
+		})
+	}
+}
+
+func TestBatchUpdateChunks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	metrics := make([]models.Metrics, batchChunkSize+1)
+	for i := range metrics {
+		metrics[i] = models.Metrics{ID: fmt.Sprintf("gauge%05d", i), MType: "gauge", Value: ptrToFloat64(float64(i))}
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`VALUES ($1, $2, $3), ($4, $5, $6)`)).WillReturnResult(sqlmock.NewResult(0, batchChunkSize))
+	mock.ExpectExec(regexp.QuoteMeta(`VALUES ($1, $2, $3) ON CONFLICT`)).
+		WithArgs(fmt.Sprintf("gauge%05d", batchChunkSize), "", float64(batchChunkSize)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	pg := &Postgres{DB: sqlx.NewDb(db, "sqlmock")}
+	require.NoError(t, pg.BatchUpdate(context.Background(), metrics))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestValuesList(t *testing.T) {
+	assert.Equal(t, "($1, $2, $3)", valuesList(1, 3))
+	assert.Equal(t, "($1, $2), ($3, $4), ($5, $6)", valuesList(3, 2))
+}
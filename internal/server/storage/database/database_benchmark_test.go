@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"fmt"
 	"testing"
 
 	"github.com/Sofja96/go-metrics.git/internal/models"
@@ -77,6 +78,8 @@ func BenchmarkBatchUpdate(b *testing.B) {
 	}
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
+		// BatchUpdate записывает в Delta новое значение counter
+		*metrics[1].Delta = 1
 		err := db.BatchUpdate(context.Background(), metrics)
 		if err != nil {
 			b.Fatalf("Failed to batch update: %v", err)
@@ -84,6 +87,38 @@ func BenchmarkBatchUpdate(b *testing.B) {
 	}
 }
 
+// BenchmarkBatchUpdateSize - задержка одной пачки в зависимости от ее размера. Половина
+// пачки - gauge, половина - counter, каждый counter повторяется дважды.
+func BenchmarkBatchUpdateSize(b *testing.B) {
+	db := setupDB(b)
+	for _, size := range []int{10, 100, 1000, 5000} {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			metrics := make([]models.Metrics, 0, size)
+			for i := 0; i < size/2; i++ {
+				metrics = append(metrics, models.Metrics{MType: "gauge", ID: fmt.Sprintf("bench_gauge_%d", i), Value: float64Ptr(1.23)})
+			}
+			for i := size / 2; i < size; i++ {
+				metrics = append(metrics, models.Metrics{MType: "counter", ID: fmt.Sprintf("bench_counter_%d", i/2), Delta: int64Ptr(1)})
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _, m := range metrics {
+					if m.Delta != nil {
+						*m.Delta = 1
+					}
+				}
+				if err := db.BatchUpdate(context.Background(), metrics); err != nil {
+					b.Fatalf("Failed to batch update: %v", err)
+				}
+			}
+			perBatch := float64(b.Elapsed().Microseconds()) / float64(b.N)
+			b.ReportMetric(perBatch/1000, "ms/batch")
+			b.ReportMetric(perBatch/float64(size), "µs/metric")
+		})
+	}
+}
+
 func float64Ptr(v float64) *float64 {
 	return &v
 }
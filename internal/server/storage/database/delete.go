@@ -0,0 +1,233 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Sofja96/go-metrics.git/internal/models"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+)
+
+// seriesTypes - типы метрик в порядке обхода таблиц при удалении.
+var seriesTypes = []string{"gauge", "counter", "histogram", "summary"}
+
+// seriesTables - таблицы текущих значений серий по типам метрик.
+var seriesTables = map[string]string{
+	"gauge":     "gauge_metrics",
+	"counter":   "counter_metrics",
+	"histogram": "histogram_metrics",
+	"summary":   "summary_metrics",
+}
+
+// historyTables - таблицы истории серий: исходные значения и агрегаты.
+var historyTables = []string{"metric_samples", "metric_aggregates"}
+
+// Delete - удаляет серию id метрики типа mType вместе с ее историей.
+func (pg *Postgres) Delete(ctx context.Context, mType, id string) (bool, error) {
+	table, ok := seriesTables[mType]
+	if !ok {
+		return false, fmt.Errorf("unsupported metrics type: %s", mType)
+	}
+	name, labels := models.SplitSeriesKey(id)
+
+	tx, err := pg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("error occured on creating tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	n, err := execAffected(ctx, tx, fmt.Sprintf("DELETE FROM %s WHERE name = $1 AND labels = $2", table), name, labels)
+	if err != nil {
+		return false, fmt.Errorf("error delete %s: %w", table, err)
+	}
+	if err = deleteHistory(ctx, tx, name, labels, mType); err != nil {
+		return false, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return n != 0, nil
+}
+
+// DeleteByPrefix - удаляет серии метрик типа mType (любого, если тип пуст), имена которых начинаются с prefix.
+func (pg *Postgres) DeleteByPrefix(ctx context.Context, mType, prefix string) ([]storage.SeriesID, error) {
+	types := seriesTypes
+	if mType != "" {
+		if _, ok := seriesTables[mType]; !ok {
+			return nil, fmt.Errorf("unsupported metrics type: %s", mType)
+		}
+		types = []string{mType}
+	}
+
+	tx, err := pg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error occured on creating tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var deleted []storage.SeriesID
+	for _, t := range types {
+		table := seriesTables[t]
+		series, err := deleteReturning(ctx, tx, t,
+			fmt.Sprintf("DELETE FROM %s WHERE starts_with(name, $1) RETURNING name, labels", table), prefix)
+		if err != nil {
+			return nil, fmt.Errorf("error delete %s: %w", table, err)
+		}
+		for _, history := range historyTables {
+			_, err = tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE type = $1 AND starts_with(name, $2)", history), t, prefix)
+			if err != nil {
+				return nil, fmt.Errorf("error delete %s: %w", history, err)
+			}
+		}
+		deleted = append(deleted, series...)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return deleted, nil
+}
+
+// deleteReturning - выполняет в транзакции запрос удаления серий метрики типа mType,
+// возвращающий имена и метки удаленных строк, и возвращает удаленные серии.
+func deleteReturning(ctx context.Context, tx *sql.Tx, mType, query string, args ...any) ([]storage.SeriesID, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deleted []storage.SeriesID
+	for rows.Next() {
+		var name, labels string
+		if err := rows.Scan(&name, &labels); err != nil {
+			return nil, err
+		}
+		deleted = append(deleted, storage.SeriesID{Type: mType, ID: seriesKey(name, labels)})
+	}
+	return deleted, rows.Err()
+}
+
+// seriesKey - возвращает идентификатор серии по имени и строке меток из таблицы.
+func seriesKey(name, labels string) string {
+	if labels == "" {
+		return name
+	}
+	return name + "{" + labels + "}"
+}
+
+// DeleteExpired - удаляет серии, не обновлявшиеся дольше времени жизни ttl(mType, name) на момент now.
+// Серия, обновленная между выборкой и удалением, сохраняется.
+func (pg *Postgres) DeleteExpired(ctx context.Context, now time.Time, ttl func(mType, name string) time.Duration) ([]storage.SeriesID, error) {
+	var deleted []storage.SeriesID
+	for _, t := range seriesTypes {
+		expired, err := pg.selectExpired(ctx, t, now, ttl)
+		if err != nil {
+			return deleted, err
+		}
+		for _, series := range expired {
+			ok, err := pg.deleteIfStale(ctx, t, series)
+			if err != nil {
+				return deleted, err
+			}
+			if ok {
+				deleted = append(deleted, storage.SeriesID{Type: t, ID: seriesKey(series.name, series.labels)})
+			}
+		}
+	}
+	return deleted, nil
+}
+
+// staleSeries - серия, которая не обновлялась позже before.
+type staleSeries struct {
+	name   string
+	labels string
+	before time.Time
+}
+
+// selectExpired - выбирает серии метрики типа mType, время жизни которых истекло на момент now.
+func (pg *Postgres) selectExpired(ctx context.Context, mType string, now time.Time, ttl func(mType, name string) time.Duration) ([]staleSeries, error) {
+	table := seriesTables[mType]
+	rows, err := pg.DB.QueryContext(ctx, fmt.Sprintf("SELECT name, labels, updated_at FROM %s", table))
+	if err != nil {
+		return nil, fmt.Errorf("error selecting %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var expired []staleSeries
+	for rows.Next() {
+		var (
+			series  staleSeries
+			updated time.Time
+		)
+		if err := rows.Scan(&series.name, &series.labels, &updated); err != nil {
+			return nil, fmt.Errorf("error scanning %s: %w", table, err)
+		}
+		d := ttl(mType, series.name)
+		if d <= 0 || now.Sub(updated) < d {
+			continue
+		}
+		series.before = now.Add(-d)
+		expired = append(expired, series)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error selecting %s: %w", table, err)
+	}
+	return expired, nil
+}
+
+// deleteIfStale - удаляет серию вместе с историей, если она не обновлялась позже series.before.
+func (pg *Postgres) deleteIfStale(ctx context.Context, mType string, series staleSeries) (bool, error) {
+	table := seriesTables[mType]
+
+	tx, err := pg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("error occured on creating tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	n, err := execAffected(ctx, tx, fmt.Sprintf("DELETE FROM %s WHERE name = $1 AND labels = $2 AND updated_at <= $3", table),
+		series.name, series.labels, series.before)
+	if err != nil {
+		return false, fmt.Errorf("error delete %s: %w", table, err)
+	}
+	if n == 0 {
+		return false, nil
+	}
+	if err = deleteHistory(ctx, tx, series.name, series.labels, mType); err != nil {
+		return false, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return true, nil
+}
+
+// deleteHistory - удаляет в транзакции исходные значения и агрегаты истории серии.
+func deleteHistory(ctx context.Context, tx *sql.Tx, name, labels, mType string) error {
+	for _, history := range historyTables {
+		_, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE name = $1 AND labels = $2 AND type = $3", history),
+			name, labels, mType)
+		if err != nil {
+			return fmt.Errorf("error delete %s: %w", history, err)
+		}
+	}
+	return nil
+}
+
+// execAffected - выполняет запрос в транзакции и возвращает количество затронутых строк.
+func execAffected(ctx context.Context, tx *sql.Tx, query string, args ...any) (int, error) {
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
@@ -0,0 +1,213 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+)
+
+func TestDelete(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open mock database: %v", err)
+	}
+	defer db.Close()
+
+	deleteQuery := regexp.QuoteMeta(`DELETE FROM gauge_metrics WHERE name = $1 AND labels = $2`)
+	samplesQuery := regexp.QuoteMeta(`DELETE FROM metric_samples WHERE name = $1 AND labels = $2 AND type = $3`)
+	aggregatesQuery := regexp.QuoteMeta(`DELETE FROM metric_aggregates WHERE name = $1 AND labels = $2 AND type = $3`)
+
+	tests := []struct {
+		name         string
+		mType        string
+		mockBehavior func()
+		expected     bool
+		wantErr      bool
+	}{
+		{
+			name:  "Successful delete",
+			mType: "gauge",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(deleteQuery).WithArgs("Alloc", `host="agent-1"`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(samplesQuery).WithArgs("Alloc", `host="agent-1"`, "gauge").
+					WillReturnResult(sqlmock.NewResult(0, 3))
+				mock.ExpectExec(aggregatesQuery).WithArgs("Alloc", `host="agent-1"`, "gauge").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			expected: true,
+		},
+		{
+			name:  "Unknown series",
+			mType: "gauge",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(deleteQuery).WithArgs("Alloc", `host="agent-1"`).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(samplesQuery).WithArgs("Alloc", `host="agent-1"`, "gauge").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(aggregatesQuery).WithArgs("Alloc", `host="agent-1"`, "gauge").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			},
+			expected: false,
+		},
+		{
+			name:  "Delete error",
+			mType: "gauge",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(deleteQuery).WithArgs("Alloc", `host="agent-1"`).
+					WillReturnError(fmt.Errorf("connection lost"))
+				mock.ExpectRollback()
+			},
+			wantErr: true,
+		},
+		{
+			name:         "Unsupported type",
+			mType:        "unknown",
+			mockBehavior: func() {},
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockBehavior()
+
+			pg := &Postgres{DB: sqlx.NewDb(db, "sqlmock")}
+			ok, err := pg.Delete(context.Background(), tt.mType, `Alloc{host="agent-1"}`)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, ok)
+			}
+
+			assert.NoError(t, mock.ExpectationsWereMet(), "not all expectations were met")
+		})
+	}
+}
+
+func TestDeleteByPrefix(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open mock database: %v", err)
+	}
+	defer db.Close()
+
+	samplesQuery := regexp.QuoteMeta(`DELETE FROM metric_samples WHERE type = $1 AND starts_with(name, $2)`)
+	aggregatesQuery := regexp.QuoteMeta(`DELETE FROM metric_aggregates WHERE type = $1 AND starts_with(name, $2)`)
+	expectType := func(mType string, deleted ...string) {
+		rows := sqlmock.NewRows([]string{"name", "labels"})
+		for _, name := range deleted {
+			rows.AddRow(name, "")
+		}
+		mock.ExpectQuery(regexp.QuoteMeta(fmt.Sprintf(`DELETE FROM %s_metrics WHERE starts_with(name, $1) RETURNING name, labels`, mType))).
+			WithArgs("Heap").WillReturnRows(rows)
+		mock.ExpectExec(samplesQuery).WithArgs(mType, "Heap").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(aggregatesQuery).WithArgs(mType, "Heap").WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+
+	pg := &Postgres{DB: sqlx.NewDb(db, "sqlmock")}
+
+	t.Run("One type", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(`DELETE FROM gauge_metrics WHERE starts_with(name, $1) RETURNING name, labels`)).
+			WithArgs("Heap").WillReturnRows(sqlmock.NewRows([]string{"name", "labels"}).
+			AddRow("HeapAlloc", "").
+			AddRow("HeapInuse", `host="a"`))
+		mock.ExpectExec(samplesQuery).WithArgs("gauge", "Heap").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(aggregatesQuery).WithArgs("gauge", "Heap").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		deleted, err := pg.DeleteByPrefix(context.Background(), "gauge", "Heap")
+		assert.NoError(t, err)
+		assert.Equal(t, []storage.SeriesID{
+			{Type: "gauge", ID: "HeapAlloc"},
+			{Type: "gauge", ID: `HeapInuse{host="a"}`},
+		}, deleted)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Any type", func(t *testing.T) {
+		mock.ExpectBegin()
+		expectType("gauge", "HeapAlloc", "HeapInuse")
+		expectType("counter", "HeapObjects")
+		expectType("histogram")
+		expectType("summary", "HeapSize")
+		mock.ExpectCommit()
+
+		deleted, err := pg.DeleteByPrefix(context.Background(), "", "Heap")
+		assert.NoError(t, err)
+		assert.Equal(t, []storage.SeriesID{
+			{Type: "gauge", ID: "HeapAlloc"},
+			{Type: "gauge", ID: "HeapInuse"},
+			{Type: "counter", ID: "HeapObjects"},
+			{Type: "summary", ID: "HeapSize"},
+		}, deleted)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Unsupported type", func(t *testing.T) {
+		_, err := pg.DeleteByPrefix(context.Background(), "unknown", "Heap")
+		assert.Error(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestDeleteExpired(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open mock database: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	ttl := func(mType, name string) time.Duration {
+		if name == "PollCount" {
+			return 0
+		}
+		return time.Hour
+	}
+	selectQuery := func(table string) string {
+		return regexp.QuoteMeta(fmt.Sprintf(`SELECT name, labels, updated_at FROM %s`, table))
+	}
+
+	mock.ExpectQuery(selectQuery("gauge_metrics")).WillReturnRows(
+		sqlmock.NewRows([]string{"name", "labels", "updated_at"}).
+			AddRow("Alloc", "", now.Add(-2*time.Hour)).
+			AddRow("HeapAlloc", "", now.Add(-time.Minute)).
+			AddRow("Refreshed", "", now.Add(-2*time.Hour)))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM gauge_metrics WHERE name = $1 AND labels = $2 AND updated_at <= $3`)).
+		WithArgs("Alloc", "", now.Add(-time.Hour)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM metric_samples WHERE name = $1 AND labels = $2 AND type = $3`)).
+		WithArgs("Alloc", "", "gauge").WillReturnResult(sqlmock.NewResult(0, 5))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM metric_aggregates WHERE name = $1 AND labels = $2 AND type = $3`)).
+		WithArgs("Alloc", "", "gauge").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM gauge_metrics WHERE name = $1 AND labels = $2 AND updated_at <= $3`)).
+		WithArgs("Refreshed", "", now.Add(-time.Hour)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	mock.ExpectQuery(selectQuery("counter_metrics")).WillReturnRows(
+		sqlmock.NewRows([]string{"name", "labels", "updated_at"}).AddRow("PollCount", "", now.Add(-48*time.Hour)))
+	mock.ExpectQuery(selectQuery("histogram_metrics")).WillReturnRows(
+		sqlmock.NewRows([]string{"name", "labels", "updated_at"}))
+	mock.ExpectQuery(selectQuery("summary_metrics")).WillReturnError(fmt.Errorf("connection lost"))
+
+	pg := &Postgres{DB: sqlx.NewDb(db, "sqlmock")}
+	deleted, err := pg.DeleteExpired(context.Background(), now, ttl)
+	assert.Error(t, err)
+	assert.Equal(t, []storage.SeriesID{{Type: "gauge", ID: "Alloc"}}, deleted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,191 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// migrationFS - встроенные файлы миграций <версия>_<название>.up.sql и <версия>_<название>.down.sql.
+//
+//go:embed migrations/*.sql
+var migrationFS embed.FS
+
+// Migration - миграция схемы БД: запросы перехода на версию Version и отката с нее.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// migrations - встроенные миграции по возрастанию версии.
+var migrations = mustLoadMigrations(migrationFS, "migrations")
+
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// versionTable - таблица примененных миграций; текущая версия схемы - максимальная версия в ней.
+const versionTable = `CREATE TABLE IF NOT EXISTS schema_version (version integer PRIMARY KEY, name text NOT NULL,
+	applied_at timestamptz NOT NULL DEFAULT now());`
+
+// LatestVersion - возвращает последнюю версию схемы БД, известную серверу.
+func LatestVersion() int {
+	return len(migrations)
+}
+
+// Migrations - возвращает встроенные миграции по возрастанию версии.
+func Migrations() []Migration {
+	return migrations
+}
+
+func mustLoadMigrations(fsys fs.FS, dir string) []Migration {
+	m, err := loadMigrations(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// loadMigrations - читает миграции из каталога dir. Версии должны идти подряд с 1,
+// и у каждой миграции должны быть запросы перехода и отката.
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("error read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		match := migrationFile.FindStringSubmatch(e.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file %s", e.Name())
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", e.Name(), err)
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error read migration %s: %w", e.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has different names %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	result := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		result = append(result, *m)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+
+	for i, m := range result {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration %d is missing", i+1)
+		}
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have up and down files", m.Version, m.Name)
+		}
+	}
+	return result, nil
+}
+
+// SchemaVersion - возвращает текущую версию схемы БД; 0 - миграции не применялись.
+func (pg *Postgres) SchemaVersion(ctx context.Context) (int, error) {
+	if _, err := pg.DB.ExecContext(ctx, versionTable); err != nil {
+		return 0, fmt.Errorf("error create schema_version: %w", err)
+	}
+
+	var version int
+	err := pg.DB.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("error select schema version: %w", err)
+	}
+	return version, nil
+}
+
+// Migrate - переводит схему БД на версию target, применяя или откатывая миграции по одной.
+// Каждая миграция выполняется в отдельной транзакции вместе с записью в schema_version.
+func (pg *Postgres) Migrate(ctx context.Context, target int) error {
+	if target < 0 || target > LatestVersion() {
+		return fmt.Errorf("unknown schema version %d, latest is %d", target, LatestVersion())
+	}
+	if _, err := pg.DB.ExecContext(ctx, versionTable); err != nil {
+		return fmt.Errorf("error create schema_version: %w", err)
+	}
+
+	for {
+		done, err := pg.migrateStep(ctx, target)
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// migrateStep - применяет или откатывает одну миграцию в направлении версии target.
+// Возвращает true, если схема уже на версии target.
+func (pg *Postgres) migrateStep(ctx context.Context, target int) (bool, error) {
+	tx, err := pg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("error occured on creating tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	// блокировка не дает нескольким серверам применять миграции одновременно
+	if _, err = tx.ExecContext(ctx, "LOCK TABLE schema_version IN EXCLUSIVE MODE"); err != nil {
+		return false, fmt.Errorf("error lock schema_version: %w", err)
+	}
+	var current int
+	err = tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&current)
+	if err != nil {
+		return false, fmt.Errorf("error select schema version: %w", err)
+	}
+	if current > LatestVersion() {
+		return false, fmt.Errorf("schema version %d is newer than latest known %d", current, LatestVersion())
+	}
+
+	switch {
+	case current < target:
+		m := migrations[current]
+		if _, err = tx.ExecContext(ctx, m.Up); err != nil {
+			return false, fmt.Errorf("error apply migration %d_%s: %w", m.Version, m.Name, err)
+		}
+		_, err = tx.ExecContext(ctx, "INSERT INTO schema_version (version, name) VALUES ($1, $2)", m.Version, m.Name)
+		if err != nil {
+			return false, fmt.Errorf("error insert schema version: %w", err)
+		}
+		log.Printf("applied migration %d_%s", m.Version, m.Name)
+	case current > target:
+		m := migrations[current-1]
+		if _, err = tx.ExecContext(ctx, m.Down); err != nil {
+			return false, fmt.Errorf("error revert migration %d_%s: %w", m.Version, m.Name, err)
+		}
+		if _, err = tx.ExecContext(ctx, "DELETE FROM schema_version WHERE version = $1", m.Version); err != nil {
+			return false, fmt.Errorf("error delete schema version: %w", err)
+		}
+		log.Printf("reverted migration %d_%s", m.Version, m.Name)
+	default:
+		return true, tx.Commit()
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return false, nil
+}
@@ -0,0 +1,207 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+	"testing/fstest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// expectMigrationStep - ожидает начало шага миграции на схеме версии current.
+func expectMigrationStep(mock sqlmock.Sqlmock, current int) {
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("LOCK TABLE schema_version IN EXCLUSIVE MODE")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(MAX(version), 0) FROM schema_version")).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(current))
+}
+
+func TestLoadMigrations(t *testing.T) {
+	t.Run("Embedded migrations", func(t *testing.T) {
+		m := Migrations()
+		require.NotEmpty(t, m)
+		names := make([]string, 0, len(m))
+		for _, migration := range m {
+			names = append(names, migration.Name)
+		}
+		assert.Equal(t, []string{
+			"initial_schema",
+			"metric_samples",
+			"series_labels",
+			"histograms_summaries",
+			"series_updated_at",
+			"text_series_names",
+			"history_rollups",
+		}, names)
+		assert.Contains(t, m[5].Up, "PRIMARY KEY (name, labels)")
+		assert.Contains(t, m[5].Down, "char(30)")
+	})
+
+	file := func(s string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(s)} }
+
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		want    []Migration
+		wantErr bool
+	}{
+		{
+			name: "Sorted by version",
+			files: fstest.MapFS{
+				"m/0002_second.up.sql":   file("up 2"),
+				"m/0002_second.down.sql": file("down 2"),
+				"m/0001_first.up.sql":    file("up 1"),
+				"m/0001_first.down.sql":  file("down 1"),
+			},
+			want: []Migration{
+				{Version: 1, Name: "first", Up: "up 1", Down: "down 1"},
+				{Version: 2, Name: "second", Up: "up 2", Down: "down 2"},
+			},
+		},
+		{
+			name: "Missing version",
+			files: fstest.MapFS{
+				"m/0002_second.up.sql":   file("up 2"),
+				"m/0002_second.down.sql": file("down 2"),
+			},
+			wantErr: true,
+		},
+		{
+			name: "Missing down",
+			files: fstest.MapFS{
+				"m/0001_first.up.sql": file("up 1"),
+			},
+			wantErr: true,
+		},
+		{
+			name: "Different names",
+			files: fstest.MapFS{
+				"m/0001_first.up.sql":   file("up 1"),
+				"m/0001_other.down.sql": file("down 1"),
+			},
+			wantErr: true,
+		},
+		{
+			name: "Unexpected file",
+			files: fstest.MapFS{
+				"m/README.md": file("docs"),
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadMigrations(tt.files, "m")
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name         string
+		target       int
+		mockBehavior func(mock sqlmock.Sqlmock)
+		wantErr      bool
+	}{
+		{
+			name:   "Down to zero",
+			target: 0,
+			mockBehavior: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(regexp.QuoteMeta(versionTable)).WillReturnResult(sqlmock.NewResult(0, 0))
+				expectMigrationStep(mock, 1)
+				mock.ExpectExec(regexp.QuoteMeta(migrations[0].Down)).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM schema_version WHERE version = $1")).
+					WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				expectMigrationStep(mock, 0)
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name:   "Already latest",
+			target: LatestVersion(),
+			mockBehavior: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(regexp.QuoteMeta(versionTable)).WillReturnResult(sqlmock.NewResult(0, 0))
+				expectMigrationStep(mock, LatestVersion())
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name:   "Schema newer than server",
+			target: LatestVersion(),
+			mockBehavior: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(regexp.QuoteMeta(versionTable)).WillReturnResult(sqlmock.NewResult(0, 0))
+				expectMigrationStep(mock, LatestVersion()+1)
+				mock.ExpectRollback()
+			},
+			wantErr: true,
+		},
+		{
+			name:   "Failed down keeps version",
+			target: 0,
+			mockBehavior: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(regexp.QuoteMeta(versionTable)).WillReturnResult(sqlmock.NewResult(0, 0))
+				expectMigrationStep(mock, 1)
+				mock.ExpectExec(regexp.QuoteMeta(migrations[0].Down)).
+					WillReturnError(fmt.Errorf("value too long for type character(30)"))
+				mock.ExpectRollback()
+			},
+			wantErr: true,
+		},
+		{
+			name:         "Unknown target",
+			target:       LatestVersion() + 1,
+			mockBehavior: func(mock sqlmock.Sqlmock) {},
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			tt.mockBehavior(mock)
+			pg := &Postgres{DB: sqlx.NewDb(db, "sqlmock")}
+
+			err = pg.Migrate(ctx, tt.target)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestSchemaVersion(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta(versionTable)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(MAX(version), 0) FROM schema_version")).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+
+	pg := &Postgres{DB: sqlx.NewDb(db, "sqlmock")}
+	version, err := pg.SchemaVersion(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
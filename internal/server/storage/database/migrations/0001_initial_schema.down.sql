@@ -0,0 +1,4 @@
+-- Удаляет таблицы значений gauge и counter.
+
+DROP TABLE IF EXISTS gauge_metrics;
+DROP TABLE IF EXISTS counter_metrics;
@@ -0,0 +1,4 @@
+-- Исходная схема: последние значения gauge и counter по имени метрики.
+
+CREATE TABLE IF NOT EXISTS counter_metrics (name char(30) UNIQUE, value bigint);
+CREATE TABLE IF NOT EXISTS gauge_metrics (name char(30) UNIQUE, value double precision);
@@ -0,0 +1,4 @@
+-- Удаляет историю значений.
+
+DROP INDEX IF EXISTS metric_samples_name_ts_idx;
+DROP TABLE IF EXISTS metric_samples;
@@ -0,0 +1,9 @@
+-- История значений gauge и counter: каждое обновление сохраняется с меткой времени.
+
+CREATE TABLE IF NOT EXISTS metric_samples (
+    name  text             NOT NULL,
+    type  text             NOT NULL,
+    ts    timestamptz      NOT NULL DEFAULT now(),
+    value double precision NOT NULL
+);
+CREATE INDEX IF NOT EXISTS metric_samples_name_ts_idx ON metric_samples (name, ts);
@@ -0,0 +1,11 @@
+-- Возвращает уникальность по имени и удаляет метки. Откат завершится ошибкой, если у метрики
+-- есть несколько серий с разными метками.
+
+DROP INDEX IF EXISTS gauge_metrics_series_idx;
+DROP INDEX IF EXISTS counter_metrics_series_idx;
+ALTER TABLE gauge_metrics ADD CONSTRAINT gauge_metrics_name_key UNIQUE (name);
+ALTER TABLE counter_metrics ADD CONSTRAINT counter_metrics_name_key UNIQUE (name);
+
+ALTER TABLE metric_samples DROP COLUMN IF EXISTS labels;
+ALTER TABLE gauge_metrics DROP COLUMN IF EXISTS labels;
+ALTER TABLE counter_metrics DROP COLUMN IF EXISTS labels;
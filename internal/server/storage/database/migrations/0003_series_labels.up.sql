@@ -0,0 +1,11 @@
+-- Метки серий: серия определяется именем и строкой меток, поэтому уникальность по имени
+-- заменяется уникальным индексом по (name, labels).
+
+ALTER TABLE counter_metrics ADD COLUMN IF NOT EXISTS labels text NOT NULL DEFAULT '';
+ALTER TABLE gauge_metrics ADD COLUMN IF NOT EXISTS labels text NOT NULL DEFAULT '';
+ALTER TABLE metric_samples ADD COLUMN IF NOT EXISTS labels text NOT NULL DEFAULT '';
+
+ALTER TABLE counter_metrics DROP CONSTRAINT IF EXISTS counter_metrics_name_key;
+ALTER TABLE gauge_metrics DROP CONSTRAINT IF EXISTS gauge_metrics_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS counter_metrics_series_idx ON counter_metrics (name, labels);
+CREATE UNIQUE INDEX IF NOT EXISTS gauge_metrics_series_idx ON gauge_metrics (name, labels);
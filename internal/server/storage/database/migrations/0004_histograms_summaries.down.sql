@@ -0,0 +1,4 @@
+-- Удаляет таблицы histogram и summary.
+
+DROP TABLE IF EXISTS summary_metrics;
+DROP TABLE IF EXISTS histogram_metrics;
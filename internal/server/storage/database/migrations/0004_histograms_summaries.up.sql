@@ -0,0 +1,15 @@
+-- Состояния histogram и summary хранятся в виде JSON по серии.
+
+CREATE TABLE IF NOT EXISTS histogram_metrics (
+    name   text NOT NULL,
+    labels text NOT NULL DEFAULT '',
+    state  text NOT NULL,
+    PRIMARY KEY (name, labels)
+);
+
+CREATE TABLE IF NOT EXISTS summary_metrics (
+    name   text NOT NULL,
+    labels text NOT NULL DEFAULT '',
+    state  text NOT NULL,
+    PRIMARY KEY (name, labels)
+);
@@ -0,0 +1,6 @@
+-- Удаляет время последнего обновления серий.
+
+ALTER TABLE summary_metrics DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE histogram_metrics DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE gauge_metrics DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE counter_metrics DROP COLUMN IF EXISTS updated_at;
@@ -0,0 +1,6 @@
+-- Время последнего обновления серии для удаления серий с истекшим временем жизни.
+
+ALTER TABLE counter_metrics ADD COLUMN IF NOT EXISTS updated_at timestamptz NOT NULL DEFAULT now();
+ALTER TABLE gauge_metrics ADD COLUMN IF NOT EXISTS updated_at timestamptz NOT NULL DEFAULT now();
+ALTER TABLE histogram_metrics ADD COLUMN IF NOT EXISTS updated_at timestamptz NOT NULL DEFAULT now();
+ALTER TABLE summary_metrics ADD COLUMN IF NOT EXISTS updated_at timestamptz NOT NULL DEFAULT now();
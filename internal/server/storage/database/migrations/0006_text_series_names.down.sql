@@ -0,0 +1,11 @@
+-- Возвращает имена char(30) и уникальный индекс по серии. Откат завершится ошибкой,
+-- если в БД есть имена длиннее 30 символов. Строки без имени, удаленные при переходе,
+-- не восстанавливаются.
+
+ALTER TABLE gauge_metrics DROP CONSTRAINT IF EXISTS gauge_metrics_pkey;
+ALTER TABLE counter_metrics DROP CONSTRAINT IF EXISTS counter_metrics_pkey;
+ALTER TABLE gauge_metrics ALTER COLUMN name TYPE char(30), ALTER COLUMN name DROP NOT NULL;
+ALTER TABLE counter_metrics ALTER COLUMN name TYPE char(30), ALTER COLUMN name DROP NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS gauge_metrics_series_idx ON gauge_metrics (name, labels);
+CREATE UNIQUE INDEX IF NOT EXISTS counter_metrics_series_idx ON counter_metrics (name, labels);
@@ -0,0 +1,15 @@
+-- Имена метрик хранятся как text без ограничения длины, а серия (name, labels) становится
+-- первичным ключом вместо уникального индекса.
+
+DROP INDEX IF EXISTS counter_metrics_series_idx;
+DROP INDEX IF EXISTS gauge_metrics_series_idx;
+
+-- char(30) дополнял имена пробелами до 30 символов
+DELETE FROM counter_metrics WHERE name IS NULL;
+DELETE FROM gauge_metrics WHERE name IS NULL;
+ALTER TABLE counter_metrics ALTER COLUMN name TYPE text USING rtrim(name), ALTER COLUMN name SET NOT NULL;
+ALTER TABLE gauge_metrics ALTER COLUMN name TYPE text USING rtrim(name), ALTER COLUMN name SET NOT NULL;
+ALTER TABLE counter_metrics DROP CONSTRAINT IF EXISTS counter_metrics_pkey;
+ALTER TABLE gauge_metrics DROP CONSTRAINT IF EXISTS gauge_metrics_pkey;
+ALTER TABLE counter_metrics ADD CONSTRAINT counter_metrics_pkey PRIMARY KEY (name, labels);
+ALTER TABLE gauge_metrics ADD CONSTRAINT gauge_metrics_pkey PRIMARY KEY (name, labels);
@@ -0,0 +1,5 @@
+-- Удаляет агрегаты истории; исходные значения в metric_samples не затрагиваются.
+
+DROP INDEX IF EXISTS metric_samples_ts_idx;
+DROP TABLE IF EXISTS metric_rollups;
+DROP TABLE IF EXISTS metric_aggregates;
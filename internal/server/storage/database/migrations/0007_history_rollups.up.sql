@@ -0,0 +1,24 @@
+-- Агрегаты истории для политики хранения: значения metric_samples сворачиваются в min/max/sum/count
+-- по интервалам с разрешением resolution (в секундах), а metric_rollups хранит момент,
+-- по который свернут каждый уровень.
+
+CREATE TABLE IF NOT EXISTS metric_aggregates (
+    name       text             NOT NULL,
+    labels     text             NOT NULL DEFAULT '',
+    type       text             NOT NULL,
+    resolution bigint           NOT NULL,
+    ts         timestamptz      NOT NULL,
+    min        double precision NOT NULL,
+    max        double precision NOT NULL,
+    sum        double precision NOT NULL,
+    count      bigint           NOT NULL,
+    PRIMARY KEY (name, labels, type, resolution, ts)
+);
+
+CREATE TABLE IF NOT EXISTS metric_rollups (
+    resolution   bigint      PRIMARY KEY,
+    rolled_until timestamptz NOT NULL
+);
+
+-- сжатие выбирает и удаляет значения по времени без учета серии
+CREATE INDEX IF NOT EXISTS metric_samples_ts_idx ON metric_samples (ts);
@@ -2,8 +2,9 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"fmt"
-	"log"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -17,17 +18,23 @@ type Postgres struct {
 	DB *sqlx.DB
 }
 
-// NewStorage - создает хранилище БД
-func NewStorage(ctx context.Context, dsn string) (*Postgres, error) {
-	dbc := &Postgres{}
+var (
+	_ storage.Storage   = (*Postgres)(nil)
+	_ storage.Ranger    = (*Postgres)(nil)
+	_ storage.Deleter   = (*Postgres)(nil)
+	_ storage.Compactor = (*Postgres)(nil)
+)
 
-	conn, err := sqlx.Open("postgres", dsn)
+// migrateTimeout - время на проверку и применение миграций при запуске.
+const migrateTimeout = time.Minute
+
+// NewStorage - создает хранилище БД и переводит схему на последнюю версию.
+func NewStorage(ctx context.Context, dsn string) (*Postgres, error) {
+	dbc, err := Open(dsn)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database connection: %w", err)
+		return nil, err
 	}
 
-	dbc.DB = conn
-
 	err = dbc.InitDB(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("error init db: %w", err)
@@ -35,31 +42,44 @@ func NewStorage(ctx context.Context, dsn string) (*Postgres, error) {
 	return dbc, nil
 }
 
+// Open - открывает подключение к БД без изменения схемы.
+func Open(dsn string) (*Postgres, error) {
+	conn, err := sqlx.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database connection: %w", err)
+	}
+	return &Postgres{DB: conn}, nil
+}
+
+// Close - закрывает подключения к БД.
+func (pg *Postgres) Close() error {
+	return pg.DB.Close()
+}
+
+// Shared - сообщает, что база может быть общей для нескольких экземпляров сервера.
+func (pg *Postgres) Shared() bool {
+	return true
+}
+
+// InitDB - проверяет подключение и применяет недостающие миграции схемы.
 func (pg *Postgres) InitDB(ctx context.Context) error {
 	err := pg.DB.PingContext(ctx)
 	if err != nil {
 		return fmt.Errorf("unable to connect to database: %w", err)
 	}
-	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, migrateTimeout)
 	defer cancel()
 
-	_, err = pg.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS 
-    										counter_metrics (name char(30) UNIQUE, value bigint);`)
-	if err != nil {
-		return fmt.Errorf("error occured on creating table gauge: %w", err)
-	}
-
-	_, err = pg.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS 
-    										gauge_metrics (name char(30) UNIQUE, value double precision);`)
-	if err != nil {
-		return fmt.Errorf("error occured on creating table counter: %w", err)
+	if err = pg.Migrate(ctx, LatestVersion()); err != nil {
+		return fmt.Errorf("error occured on init schema: %w", err)
 	}
 
 	return nil
 }
 
 func (pg *Postgres) GetGaugeValue(ctx context.Context, id string) (float64, bool) {
-	raw := pg.DB.QueryRowContext(ctx, "SELECT value FROM gauge_metrics WHERE name = $1", id)
+	name, labels := models.SplitSeriesKey(id)
+	raw := pg.DB.QueryRowContext(ctx, "SELECT value FROM gauge_metrics WHERE name = $1 AND labels = $2", name, labels)
 	var gm storage.GaugeMetric
 	err := raw.Scan(&gm.Value)
 	if err != nil {
@@ -68,20 +88,28 @@ func (pg *Postgres) GetGaugeValue(ctx context.Context, id string) (float64, bool
 	return gm.Value, true
 }
 
-func (pg *Postgres) UpdateGauge(ctx context.Context, name string, value float64) (float64, error) {
-	_, err := pg.DB.ExecContext(ctx, `INSERT INTO gauge_metrics(name, value) 
-											VALUES ($1, $2) ON CONFLICT (name) DO UPDATE SET value = $2`, name, value)
+func (pg *Postgres) UpdateGauge(ctx context.Context, key string, value float64) (float64, error) {
+	name, labels := models.SplitSeriesKey(key)
+	_, err := pg.DB.ExecContext(ctx, `WITH upsert AS (INSERT INTO gauge_metrics(name, labels, value) 
+											VALUES ($1, $2, $3) ON CONFLICT (name, labels) DO UPDATE SET value = $3, updated_at = now() 
+											RETURNING name, labels, value)
+											INSERT INTO metric_samples(name, labels, type, value) 
+											SELECT name, labels, 'gauge', value FROM upsert`, name, labels, value)
 	if err != nil {
 		return 0, fmt.Errorf("error insert gauge: %w", err)
 	}
 	return value, nil
 }
-func (pg *Postgres) UpdateCounter(ctx context.Context, name string, value int64) (int64, error) {
+func (pg *Postgres) UpdateCounter(ctx context.Context, key string, value int64) (int64, error) {
 	var newValue int64
-	raw := pg.DB.QueryRowContext(ctx, `INSERT INTO counter_metrics(name, value)VALUES ($1, $2) 
-                                              ON CONFLICT(name)DO UPDATE 
-                                              SET value = counter_metrics.value + $2 
-                                              RETURNING value`, name, value)
+	name, labels := models.SplitSeriesKey(key)
+	raw := pg.DB.QueryRowContext(ctx, `WITH upsert AS (INSERT INTO counter_metrics(name, labels, value)VALUES ($1, $2, $3) 
+                                              ON CONFLICT(name, labels)DO UPDATE 
+                                              SET value = counter_metrics.value + $3, updated_at = now() 
+                                              RETURNING name, labels, value), 
+                                              sample AS (INSERT INTO metric_samples(name, labels, type, value) 
+                                              SELECT name, labels, 'counter', value FROM upsert) 
+                                              SELECT value FROM upsert`, name, labels, value)
 	err := raw.Scan(&newValue)
 	if err != nil {
 		return 0, fmt.Errorf("error insert counter: %w", err)
@@ -90,7 +118,8 @@ func (pg *Postgres) UpdateCounter(ctx context.Context, name string, value int64)
 }
 
 func (pg *Postgres) GetCounterValue(ctx context.Context, id string) (int64, bool) {
-	raw := pg.DB.QueryRowContext(ctx, "SELECT value FROM counter_metrics WHERE name = $1", id)
+	name, labels := models.SplitSeriesKey(id)
+	raw := pg.DB.QueryRowContext(ctx, "SELECT value FROM counter_metrics WHERE name = $1 AND labels = $2", name, labels)
 	var cm storage.CounterMetric
 	err := raw.Scan(&cm.Value)
 	if err != nil {
@@ -101,7 +130,7 @@ func (pg *Postgres) GetCounterValue(ctx context.Context, id string) (int64, bool
 
 func (pg *Postgres) GetAllGauges(ctx context.Context) ([]storage.GaugeMetric, error) {
 	gauges := make([]storage.GaugeMetric, 0)
-	rowsGauge, err := pg.DB.QueryContext(ctx, "SELECT name, value FROM gauge_metrics;")
+	rowsGauge, err := pg.DB.QueryContext(ctx, "SELECT name, labels, value FROM gauge_metrics;")
 	if err != nil {
 		return nil, fmt.Errorf("error selecting all gauges: %w", err)
 	}
@@ -111,15 +140,15 @@ func (pg *Postgres) GetAllGauges(ctx context.Context) ([]storage.GaugeMetric, er
 	defer rowsGauge.Close()
 
 	for rowsGauge.Next() {
-		var gm storage.GaugeMetric
-		err = rowsGauge.Scan(&gm.Name, &gm.Value)
+		var (
+			gm     storage.GaugeMetric
+			labels string
+		)
+		err = rowsGauge.Scan(&gm.Name, &labels, &gm.Value)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning all gauges: %w", err)
 		}
-		_, err := pg.UpdateGauge(ctx, gm.Name, gm.Value)
-		if err != nil {
-			return nil, fmt.Errorf("error update gauge: %v", err)
-		}
+		gm.Labels = models.ParseLabels(labels)
 		gauges = append(gauges, gm)
 	}
 
@@ -128,7 +157,7 @@ func (pg *Postgres) GetAllGauges(ctx context.Context) ([]storage.GaugeMetric, er
 
 func (pg *Postgres) GetAllCounters(ctx context.Context) ([]storage.CounterMetric, error) {
 	counters := make([]storage.CounterMetric, 0)
-	rowsCounter, err := pg.DB.QueryContext(ctx, "SELECT name, value FROM counter_metrics;")
+	rowsCounter, err := pg.DB.QueryContext(ctx, "SELECT name, labels, value FROM counter_metrics;")
 	if err != nil {
 		return nil, fmt.Errorf("error selecting all counter: %w", err)
 	}
@@ -138,64 +167,249 @@ func (pg *Postgres) GetAllCounters(ctx context.Context) ([]storage.CounterMetric
 	defer rowsCounter.Close()
 
 	for rowsCounter.Next() {
-		var cm storage.CounterMetric
-		err = rowsCounter.Scan(&cm.Name, &cm.Value)
+		var (
+			cm     storage.CounterMetric
+			labels string
+		)
+		err = rowsCounter.Scan(&cm.Name, &labels, &cm.Value)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning all counter: %w", err)
 		}
-		_, err := pg.UpdateCounter(ctx, cm.Name, cm.Value)
-		if err != nil {
-			return nil, fmt.Errorf("error update counter: %v", err)
-		}
+		cm.Labels = models.ParseLabels(labels)
 		counters = append(counters, cm)
 	}
 	return counters, nil
 }
 
-func (pg *Postgres) BatchUpdate(ctx context.Context, metrics []models.Metrics) error {
-	tx, err := pg.DB.BeginTx(ctx, nil)
+func (pg *Postgres) Ping(ctx context.Context) error {
+	err := pg.DB.Ping()
 	if err != nil {
-		log.Printf("error occured on creating tx on batchupdate: %v", err)
-		return fmt.Errorf("error occured on creating tx on batchupdate: %w", err)
+		return fmt.Errorf("failed to ping database: %w", err)
 	}
-	defer tx.Rollback()
+	return nil
+}
+
+// UpdateHistogram - добавляет наблюдения в гистограмму. Состояние серии хранится в виде JSON.
+func (pg *Postgres) UpdateHistogram(ctx context.Context, key string, bounds, observations []float64) (models.Histogram, error) {
+	var result models.Histogram
+	err := pg.updateState(ctx, "histogram_metrics", key, observeHistogram(bounds, observations, &result))
+	if err != nil {
+		return models.Histogram{}, fmt.Errorf("error update histogram: %w", err)
+	}
+	return result, nil
+}
+
+// UpdateSummary - добавляет наблюдения в summary. Состояние серии хранится в виде JSON.
+func (pg *Postgres) UpdateSummary(ctx context.Context, key string, quantiles, observations []float64) (models.SummaryValue, error) {
+	var result models.SummaryValue
+	err := pg.updateState(ctx, "summary_metrics", key, observeSummary(quantiles, observations, &result))
+	if err != nil {
+		return models.SummaryValue{}, fmt.Errorf("error update summary: %w", err)
+	}
+	return result, nil
+}
 
-	if len(metrics) == 0 {
-		log.Println("no metrics provided")
-		return fmt.Errorf("no metrics provided")
-	}
-	for _, v := range metrics {
-		switch v.MType {
-		case "gauge":
-			_, err = pg.UpdateGauge(ctx, v.ID, *v.Value)
-			if err != nil {
-				log.Printf("error update gauge: %v", err)
-				return fmt.Errorf("error update gauge: %v", err)
+// observeHistogram - возвращает функцию обновления состояния гистограммы для updateState,
+// которая сохраняет новое значение в result.
+func observeHistogram(bounds, observations []float64, result *models.Histogram) func(state string) (string, error) {
+	return func(state string) (string, error) {
+		var h *models.Histogram
+		if state != "" {
+			h = new(models.Histogram)
+			if err := json.Unmarshal([]byte(state), h); err != nil {
+				return "", fmt.Errorf("error decode histogram: %w", err)
 			}
-		case "counter":
-			val, err := pg.UpdateCounter(ctx, v.ID, *v.Delta)
-			if err != nil {
-				log.Printf("error update counter: %v", err)
-				return fmt.Errorf("error update counter: %v", err)
+		}
+		h, err := models.ObserveHistogram(h, bounds, observations)
+		if err != nil {
+			return "", err
+		}
+		*result = h.Clone()
+		data, err := json.Marshal(h)
+		return string(data), err
+	}
+}
+
+// observeSummary - возвращает функцию обновления состояния summary для updateState,
+// которая сохраняет новое значение в result.
+func observeSummary(quantiles, observations []float64, result *models.SummaryValue) func(state string) (string, error) {
+	return func(state string) (string, error) {
+		var sm *models.Summary
+		if state != "" {
+			sm = new(models.Summary)
+			if err := json.Unmarshal([]byte(state), sm); err != nil {
+				return "", fmt.Errorf("error decode summary: %w", err)
 			}
-			*v.Delta = val
-		default:
-			log.Printf("unsopperted metrics type: %s", v.MType)
-			return fmt.Errorf("unsopperted metrics type: %s", v.MType)
 		}
+		sm, err := models.ObserveSummary(sm, quantiles, observations)
+		if err != nil {
+			return "", err
+		}
+		*result = sm.Value()
+		data, err := json.Marshal(sm)
+		return string(data), err
+	}
+}
+
+// updateState - в отдельной транзакции обновляет состояние серии key в таблице table.
+func (pg *Postgres) updateState(ctx context.Context, table, key string, update func(state string) (string, error)) error {
+	tx, err := pg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error occured on creating tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err = updateStateTx(ctx, tx, table, key, update); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// updateStateTx - в транзакции tx блокирует строку серии в таблице table, передает ее состояние
+// в update и сохраняет результат. Для новой серии update получает пустую строку.
+func updateStateTx(ctx context.Context, tx *sql.Tx, table, key string, update func(state string) (string, error)) error {
+	name, labels := models.SplitSeriesKey(key)
+
+	_, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s(name, labels, state) VALUES ($1, $2, '') 
+                                              ON CONFLICT (name, labels) DO NOTHING`, table), name, labels)
+	if err != nil {
+		return fmt.Errorf("error insert %s: %w", table, err)
 	}
 
-	if err = tx.Commit(); err != nil {
-		log.Printf("failed to commit transaction: %v", err)
-		return fmt.Errorf("failed to commit transaction: %v", err)
+	var state string
+	err = tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT state FROM %s WHERE name = $1 AND labels = $2 FOR UPDATE`, table),
+		name, labels).Scan(&state)
+	if err != nil {
+		return fmt.Errorf("error select %s: %w", table, err)
+	}
+
+	state, err = update(state)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET state = $3, updated_at = now() WHERE name = $1 AND labels = $2`, table),
+		name, labels, state)
+	if err != nil {
+		return fmt.Errorf("error update %s: %w", table, err)
 	}
 	return nil
 }
 
-func (pg *Postgres) Ping(ctx context.Context) error {
-	err := pg.DB.Ping()
+// GetHistogram - возвращает гистограмму по идентификатору серии.
+func (pg *Postgres) GetHistogram(ctx context.Context, id string) (models.Histogram, bool) {
+	var h models.Histogram
+	if !pg.getState(ctx, "histogram_metrics", id, &h) {
+		return models.Histogram{}, false
+	}
+	return h, true
+}
+
+// GetSummary - возвращает значения summary по идентификатору серии.
+func (pg *Postgres) GetSummary(ctx context.Context, id string) (models.SummaryValue, bool) {
+	var sm models.Summary
+	if !pg.getState(ctx, "summary_metrics", id, &sm) {
+		return models.SummaryValue{}, false
+	}
+	return sm.Value(), true
+}
+
+// getState - читает состояние серии из таблицы table в v.
+func (pg *Postgres) getState(ctx context.Context, table, id string, v any) bool {
+	name, labels := models.SplitSeriesKey(id)
+	var state string
+	err := pg.DB.QueryRowContext(ctx, fmt.Sprintf("SELECT state FROM %s WHERE name = $1 AND labels = $2", table),
+		name, labels).Scan(&state)
+	if err != nil || state == "" {
+		return false
+	}
+	return json.Unmarshal([]byte(state), v) == nil
+}
+
+// GetAllHistograms - возвращает все метрики типа histogram.
+func (pg *Postgres) GetAllHistograms(ctx context.Context) ([]storage.HistogramMetric, error) {
+	histograms := make([]storage.HistogramMetric, 0)
+	err := pg.scanStates(ctx, "histogram_metrics", func(name string, labels map[string]string, state []byte) error {
+		hm := storage.HistogramMetric{Name: name, Labels: labels}
+		if err := json.Unmarshal(state, &hm.Value); err != nil {
+			return err
+		}
+		histograms = append(histograms, hm)
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to ping database: %w", err)
+		return nil, err
+	}
+	return histograms, nil
+}
+
+// GetAllSummaries - возвращает все метрики типа summary.
+func (pg *Postgres) GetAllSummaries(ctx context.Context) ([]storage.SummaryMetric, error) {
+	summaries := make([]storage.SummaryMetric, 0)
+	err := pg.scanStates(ctx, "summary_metrics", func(name string, labels map[string]string, state []byte) error {
+		var sm models.Summary
+		if err := json.Unmarshal(state, &sm); err != nil {
+			return err
+		}
+		summaries = append(summaries, storage.SummaryMetric{Name: name, Labels: labels, Value: sm.Value()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
+
+// ListSeries - возвращает отсортированные идентификаторы серий метрики типа mType с именем name.
+func (pg *Postgres) ListSeries(ctx context.Context, mType, name string) ([]string, error) {
+	table, ok := seriesTables[mType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported metrics type: %s", mType)
+	}
+
+	rows, err := pg.DB.QueryContext(ctx, fmt.Sprintf("SELECT labels FROM %s WHERE name = $1 ORDER BY labels", table), name)
+	if err != nil {
+		return nil, fmt.Errorf("error list %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	keys := make([]string, 0)
+	for rows.Next() {
+		var labels string
+		if err := rows.Scan(&labels); err != nil {
+			return nil, fmt.Errorf("error scanning %s: %w", table, err)
+		}
+		if labels == "" {
+			keys = append(keys, name)
+		} else {
+			keys = append(keys, name+"{"+labels+"}")
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error list %s: %w", table, err)
+	}
+	return keys, nil
+}
+
+// scanStates - перебирает сохраненные состояния всех серий из таблицы table.
+func (pg *Postgres) scanStates(ctx context.Context, table string, fn func(name string, labels map[string]string, state []byte) error) error {
+	rows, err := pg.DB.QueryContext(ctx, fmt.Sprintf("SELECT name, labels, state FROM %s WHERE state <> '';", table))
+	if err != nil {
+		return fmt.Errorf("error selecting all %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, labels, state string
+		if err := rows.Scan(&name, &labels, &state); err != nil {
+			return fmt.Errorf("error scanning all %s: %w", table, err)
+		}
+		if err := fn(name, models.ParseLabels(labels), []byte(state)); err != nil {
+			return fmt.Errorf("error decode %s: %w", table, err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error selecting all %s: %w", table, err)
 	}
 	return nil
 }
@@ -50,12 +50,9 @@ func TestUpdateGauge(t *testing.T) {
 				value: 0.12,
 			},
 			mockBehavior: func(m *mocks, args args) {
-				expectedExec := `INSERT INTO 
-    							gauge_metrics(name, value) 
-								VALUES ($1, $2) ON CONFLICT (name)
-								 DO UPDATE SET value = $2
-								`
-				mock.ExpectExec(regexp.QuoteMeta(expectedExec)).WithArgs(args.name, args.value).
+				expectedExec := `INSERT INTO gauge_metrics(name, labels, value) VALUES ($1, $2, $3)
+								ON CONFLICT (name, labels) DO UPDATE SET value = $3, updated_at = now()`
+				mock.ExpectExec(regexp.QuoteMeta(expectedExec)).WithArgs(args.name, "", args.value).
 					WillReturnResult(sqlmock.NewResult(1, 1))
 			},
 			expectedValue: 0.12,
@@ -68,12 +65,9 @@ func TestUpdateGauge(t *testing.T) {
 				value: 0.12,
 			},
 			mockBehavior: func(m *mocks, args args) {
-				expectedExec := `INSERT INTO 
-    							gauge_metrics(name, value) 
-								VALUES ($1, $2) ON CONFLICT (name)
-								 DO UPDATE SET value = $2
-								`
-				mock.ExpectExec(regexp.QuoteMeta(expectedExec)).WithArgs(args.name, args.value).
+				expectedExec := `INSERT INTO gauge_metrics(name, labels, value) VALUES ($1, $2, $3)
+								ON CONFLICT (name, labels) DO UPDATE SET value = $3, updated_at = now()`
+				mock.ExpectExec(regexp.QuoteMeta(expectedExec)).WithArgs(args.name, "", args.value).
 					WillReturnError(fmt.Errorf("error insert gauge"))
 			},
 			expectedValue: 0,
@@ -136,11 +130,10 @@ func TestUpdateCounter(t *testing.T) {
 			mockBehavior: func(m *mocks, args args) {
 
 				rows := sqlmock.NewRows([]string{"value"}).AddRow(args.value)
-				expectedExec := `INSERT INTO counter_metrics(name, value)VALUES ($1, $2) 
-								ON CONFLICT(name)DO UPDATE SET value = counter_metrics.value 
-								    + $2 RETURNING value
-								`
-				mock.ExpectQuery(regexp.QuoteMeta(expectedExec)).WithArgs(args.name, args.value).
+				expectedExec := `INSERT INTO counter_metrics(name, labels, value)VALUES ($1, $2, $3)
+								ON CONFLICT(name, labels)DO UPDATE SET value = counter_metrics.value
+								    + $3, updated_at = now() RETURNING name, labels, value`
+				mock.ExpectQuery(regexp.QuoteMeta(expectedExec)).WithArgs(args.name, "", args.value).
 					WillReturnRows(rows)
 			},
 			expectedValue: 2,
@@ -153,11 +146,10 @@ func TestUpdateCounter(t *testing.T) {
 				value: 2,
 			},
 			mockBehavior: func(m *mocks, args args) {
-				expectedExec := `INSERT INTO counter_metrics(name, value)VALUES ($1, $2) 
-								ON CONFLICT(name)DO UPDATE SET value = counter_metrics.value 
-								    + $2 RETURNING value
-								`
-				mock.ExpectQuery(regexp.QuoteMeta(expectedExec)).WithArgs(args.name, args.value).
+				expectedExec := `INSERT INTO counter_metrics(name, labels, value)VALUES ($1, $2, $3)
+								ON CONFLICT(name, labels)DO UPDATE SET value = counter_metrics.value
+								    + $3, updated_at = now() RETURNING name, labels, value`
+				mock.ExpectQuery(regexp.QuoteMeta(expectedExec)).WithArgs(args.name, "", args.value).
 					WillReturnError(fmt.Errorf("error insert counter"))
 			},
 			expectedValue: 0,
@@ -190,6 +182,72 @@ func TestUpdateCounter(t *testing.T) {
 	}
 }
 
+func TestUpdateHistogram(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open mock database: %v", err)
+	}
+	defer db.Close()
+
+	insertQuery := regexp.QuoteMeta(`INSERT INTO histogram_metrics(name, labels, state) VALUES ($1, $2, '')`)
+	selectQuery := regexp.QuoteMeta(`SELECT state FROM histogram_metrics WHERE name = $1 AND labels = $2 FOR UPDATE`)
+	updateQuery := regexp.QuoteMeta(`UPDATE histogram_metrics SET state = $3, updated_at = now() WHERE name = $1 AND labels = $2`)
+	state := `{"bounds":[1,5],"counts":[1,0,0],"count":1,"sum":0.5}`
+
+	tests := []struct {
+		name          string
+		bounds        []float64
+		mockBehavior  func()
+		expectedValue models.Histogram
+		wantErr       error
+	}{
+		{
+			name:   "Successful update",
+			bounds: []float64{1, 5},
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(insertQuery).WithArgs("latency", "").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectQuery(selectQuery).WithArgs("latency", "").
+					WillReturnRows(sqlmock.NewRows([]string{"state"}).AddRow(state))
+				mock.ExpectExec(updateQuery).
+					WithArgs("latency", "", `{"bounds":[1,5],"counts":[1,1,0],"count":2,"sum":3.5}`).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+			expectedValue: models.Histogram{Bounds: []float64{1, 5}, Counts: []uint64{1, 1, 0}, Count: 2, Sum: 3.5},
+		},
+		{
+			name:   "Layout mismatch",
+			bounds: []float64{1, 10},
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(insertQuery).WithArgs("latency", "").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectQuery(selectQuery).WithArgs("latency", "").
+					WillReturnRows(sqlmock.NewRows([]string{"state"}).AddRow(state))
+				mock.ExpectRollback()
+			},
+			wantErr: models.ErrLayoutMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pg := &Postgres{DB: sqlx.NewDb(db, "sqlmock")}
+
+			tt.mockBehavior()
+			h, err := pg.UpdateHistogram(context.Background(), "latency", tt.bounds, []float64{3})
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedValue, h)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
 func TestGetGaugeValue(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -220,9 +278,8 @@ func TestGetGaugeValue(t *testing.T) {
 			mockBehavior: func(m *mocks, args args) {
 
 				rows := sqlmock.NewRows([]string{"value"}).AddRow(75.5)
-				expectedExec := `SELECT value FROM gauge_metrics WHERE name = $1
-								`
-				mock.ExpectQuery(regexp.QuoteMeta(expectedExec)).WithArgs(args.id).
+				expectedExec := `SELECT value FROM gauge_metrics WHERE name = $1 AND labels = $2`
+				mock.ExpectQuery(regexp.QuoteMeta(expectedExec)).WithArgs(args.id, "").
 					WillReturnRows(rows)
 			},
 			expectedValue: 75.5,
@@ -236,9 +293,8 @@ func TestGetGaugeValue(t *testing.T) {
 				id: "Alloc",
 			},
 			mockBehavior: func(m *mocks, args args) {
-				expectedExec := `SELECT value FROM gauge_metrics WHERE name = $1
-								`
-				mock.ExpectQuery(regexp.QuoteMeta(expectedExec)).WithArgs(args.id).
+				expectedExec := `SELECT value FROM gauge_metrics WHERE name = $1 AND labels = $2`
+				mock.ExpectQuery(regexp.QuoteMeta(expectedExec)).WithArgs(args.id, "").
 					WillReturnError(sql.ErrNoRows)
 			},
 			expectedValue: 0,
@@ -310,9 +366,8 @@ func TestGetCounterValue(t *testing.T) {
 			mockBehavior: func(m *mocks, args args) {
 
 				rows := sqlmock.NewRows([]string{"value"}).AddRow(2)
-				expectedExec := `SELECT value FROM counter_metrics WHERE name = $1
-								`
-				mock.ExpectQuery(regexp.QuoteMeta(expectedExec)).WithArgs(args.id).
+				expectedExec := `SELECT value FROM counter_metrics WHERE name = $1 AND labels = $2`
+				mock.ExpectQuery(regexp.QuoteMeta(expectedExec)).WithArgs(args.id, "").
 					WillReturnRows(rows)
 			},
 			expectedValue: 2,
@@ -326,9 +381,8 @@ func TestGetCounterValue(t *testing.T) {
 				id: "Counter",
 			},
 			mockBehavior: func(m *mocks, args args) {
-				expectedExec := `SELECT value FROM counter_metrics WHERE name = $1
-								`
-				mock.ExpectQuery(regexp.QuoteMeta(expectedExec)).WithArgs(args.id).
+				expectedExec := `SELECT value FROM counter_metrics WHERE name = $1 AND labels = $2`
+				mock.ExpectQuery(regexp.QuoteMeta(expectedExec)).WithArgs(args.id, "").
 					WillReturnError(sql.ErrNoRows)
 			},
 			expectedValue: 0,
@@ -402,35 +456,24 @@ func TestGetAllGauges(t *testing.T) {
 				value2: 60.0,
 			},
 			mockBehavior: func(m *mocks, args args) {
-				rows := sqlmock.NewRows([]string{"name", "value"}).
-					AddRow(args.name1, args.value1).
-					AddRow(args.name2, args.value2)
-				expectedExec := `SELECT name, value FROM gauge_metrics`
+				rows := sqlmock.NewRows([]string{"name", "labels", "value"}).
+					AddRow(args.name1, "", args.value1).
+					AddRow(args.name2, `host="agent-1"`, args.value2)
+				expectedExec := `SELECT name, labels, value FROM gauge_metrics`
 				mock.ExpectQuery(regexp.QuoteMeta(expectedExec)).WillReturnRows(rows)
-
-				expectedInsert := `INSERT INTO 
-    							gauge_metrics(name, value) 
-								VALUES ($1, $2) ON CONFLICT (name)
-								 DO UPDATE SET value = $2
-								`
-				mock.ExpectExec(regexp.QuoteMeta(expectedInsert)).WithArgs(args.name1, args.value1).
-					WillReturnResult(sqlmock.NewResult(1, 1))
-				mock.ExpectExec(regexp.QuoteMeta(expectedInsert)).WithArgs(args.name2, args.value2).
-					WillReturnResult(sqlmock.NewResult(1, 1))
 			},
 			expectedGauges: []storage.GaugeMetric{
 				{Name: "cpu_usage", Value: 75.5},
-				{Name: "memory_usage", Value: 60.0},
+				{Name: "memory_usage", Labels: map[string]string{"host": "agent-1"}, Value: 60.0},
 			},
 			wantErr: false,
 		},
 		{
 			name: "No gauges",
 			mockBehavior: func(m *mocks, args args) {
-				rows := sqlmock.NewRows([]string{"name", "value"})
+				rows := sqlmock.NewRows([]string{"name", "labels", "value"})
 
-				expectedExec := `SELECT name, value FROM gauge_metrics
-								`
+				expectedExec := `SELECT name, labels, value FROM gauge_metrics`
 				mock.ExpectQuery(regexp.QuoteMeta(expectedExec)).WillReturnRows(rows)
 			},
 			expectedGauges: []storage.GaugeMetric{},
@@ -439,31 +482,19 @@ func TestGetAllGauges(t *testing.T) {
 		{
 			name: "Query error",
 			mockBehavior: func(m *mocks, args args) {
-				expectedExec := `SELECT name, value FROM gauge_metrics
-								`
+				expectedExec := `SELECT name, labels, value FROM gauge_metrics`
 				mock.ExpectQuery(regexp.QuoteMeta(expectedExec)).WillReturnError(fmt.Errorf("error selecting all gauges"))
 			},
 			expectedGauges: nil,
 			wantErr:        true,
 		},
 		{
-			name: "Error updating gauge",
+			name: "Error scanning gauges",
 			mockBehavior: func(m *mocks, args args) {
-				rows := sqlmock.NewRows([]string{"name", "value"}).
-					AddRow(args.name1, args.value1).
-					AddRow(args.name2, args.value2)
-				expectedExec := `SELECT name, value FROM gauge_metrics`
+				rows := sqlmock.NewRows([]string{"name", "labels", "value"}).
+					AddRow("cpu_usage", "", "not a number")
+				expectedExec := `SELECT name, labels, value FROM gauge_metrics`
 				mock.ExpectQuery(regexp.QuoteMeta(expectedExec)).WillReturnRows(rows)
-
-				expectedInsert := `INSERT INTO 
-    							gauge_metrics(name, value) 
-								VALUES ($1, $2) ON CONFLICT (name)
-								 DO UPDATE SET value = $2
-								`
-				mock.ExpectExec(regexp.QuoteMeta(expectedInsert)).WithArgs(args.name1, args.value1).
-					WillReturnResult(sqlmock.NewResult(1, 1))
-				mock.ExpectExec(regexp.QuoteMeta(expectedInsert)).WithArgs(args.name2, args.value2).
-					WillReturnError(fmt.Errorf("error updating gauge"))
 			},
 			expectedGauges: nil,
 			wantErr:        true,
@@ -525,35 +556,24 @@ func TestGetAllCounters(t *testing.T) {
 				value2: 4,
 			},
 			mockBehavior: func(m *mocks, args args) {
-				rows := sqlmock.NewRows([]string{"name", "value"}).
-					AddRow(args.name1, args.value1).
-					AddRow(args.name2, args.value2)
-				expectedExec := `SELECT name, value FROM counter_metrics`
+				rows := sqlmock.NewRows([]string{"name", "labels", "value"}).
+					AddRow(args.name1, "", args.value1).
+					AddRow(args.name2, `host="agent-1"`, args.value2)
+				expectedExec := `SELECT name, labels, value FROM counter_metrics`
 				mock.ExpectQuery(regexp.QuoteMeta(expectedExec)).WillReturnRows(rows)
-
-				expectedInsert := `INSERT INTO counter_metrics(name, value)VALUES ($1, $2) 
-								ON CONFLICT(name)DO UPDATE SET value = counter_metrics.value 
-								    + $2 RETURNING value
-								`
-				rowsInsert := sqlmock.NewRows([]string{"value"}).
-					AddRow(args.value1).AddRow(args.value2)
-				mock.ExpectQuery(regexp.QuoteMeta(expectedInsert)).WithArgs(args.name1, args.value1).
-					WillReturnRows(rowsInsert)
-				mock.ExpectQuery(regexp.QuoteMeta(expectedInsert)).WithArgs(args.name2, args.value2).
-					WillReturnRows(rowsInsert)
 			},
 			expectedCounters: []storage.CounterMetric{
 				{Name: "counter1", Value: 2},
-				{Name: "counter2", Value: 4},
+				{Name: "counter2", Labels: map[string]string{"host": "agent-1"}, Value: 4},
 			},
 			wantErr: false,
 		},
 		{
 			name: "No counters",
 			mockBehavior: func(m *mocks, args args) {
-				rows := sqlmock.NewRows([]string{"name", "value"})
+				rows := sqlmock.NewRows([]string{"name", "labels", "value"})
 
-				expectedExec := `SELECT name, value FROM counter_metrics`
+				expectedExec := `SELECT name, labels, value FROM counter_metrics`
 				mock.ExpectQuery(regexp.QuoteMeta(expectedExec)).WillReturnRows(rows)
 			},
 			expectedCounters: []storage.CounterMetric{},
@@ -562,29 +582,19 @@ func TestGetAllCounters(t *testing.T) {
 		{
 			name: "Query error",
 			mockBehavior: func(m *mocks, args args) {
-				expectedExec := `SELECT name, value FROM counter_metrics`
+				expectedExec := `SELECT name, labels, value FROM counter_metrics`
 				mock.ExpectQuery(regexp.QuoteMeta(expectedExec)).WillReturnError(fmt.Errorf("error selecting all counter"))
 			},
 			expectedCounters: nil,
 			wantErr:          true,
 		},
 		{
-			name: "Error updating counters",
+			name: "Error scanning counters",
 			mockBehavior: func(m *mocks, args args) {
-				rows := sqlmock.NewRows([]string{"name", "value"}).
-					AddRow(args.name1, args.value1).
-					AddRow(args.name2, args.value2)
-				expectedExec := `SELECT name, value FROM counter_metrics`
+				rows := sqlmock.NewRows([]string{"name", "labels", "value"}).
+					AddRow("counter1", "", "not a number")
+				expectedExec := `SELECT name, labels, value FROM counter_metrics`
 				mock.ExpectQuery(regexp.QuoteMeta(expectedExec)).WillReturnRows(rows)
-
-				expectedInsert := `INSERT INTO counter_metrics(name, value)VALUES ($1, $2) 
-								ON CONFLICT(name)DO UPDATE SET value = counter_metrics.value 
-								    + $2 RETURNING value
-								`
-				mock.ExpectExec(regexp.QuoteMeta(expectedInsert)).WithArgs(args.name1, args.value1).
-					WillReturnResult(sqlmock.NewResult(1, 1))
-				mock.ExpectExec(regexp.QuoteMeta(expectedInsert)).WithArgs(args.name2, args.value2).
-					WillReturnError(fmt.Errorf("error updating counters"))
 			},
 			expectedCounters: nil,
 			wantErr:          true,
@@ -615,252 +625,71 @@ func TestGetAllCounters(t *testing.T) {
 	}
 }
 
-func TestBatchUpdate(t *testing.T) {
-	db, mock, err := sqlmock.New() // db - *sqlmock.DB, mock - sqlmock.Sqlmock
+func TestListSeries(t *testing.T) {
+	db, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatalf("failed to open mock database: %v", err)
 	}
 	defer db.Close()
 
-	type (
-		args struct {
-			name1        string
-			value1       float64
-			name2        string
-			value2       float64
-			nameCounter  string
-			valueCounter int64
-		}
-		mockBehavior func(m *mocks, args args)
-	)
+	listQuery := regexp.QuoteMeta(`SELECT labels FROM gauge_metrics WHERE name = $1 ORDER BY labels`)
 
 	tests := []struct {
 		name         string
-		metrics      []models.Metrics
-		mockBehavior mockBehavior
+		mType        string
+		mockBehavior func()
+		expected     []string
 		wantErr      bool
-		args         args
 	}{
 		{
-			name: "Valid batch update",
-			args: args{
-				name1:        "cpu_usage",
-				value1:       75.5,
-				name2:        "memory_usage",
-				value2:       60.0,
-				nameCounter:  "counter1",
-				valueCounter: 10,
-			},
-			mockBehavior: func(m *mocks, args args) {
-				mock.ExpectBegin()
-				expectedInsert := ` INSERT INTO
-										gauge_metrics(name, value)
-										VALUES ($1, $2) ON CONFLICT (name)
-										DO UPDATE SET value = $2
-										`
-				expectedInsertCounter := `INSERT INTO counter_metrics(name, value)VALUES ($1, $2) 
-								ON CONFLICT(name)DO UPDATE SET value = counter_metrics.value 
-								    + $2 RETURNING value
-								`
-
-				mock.ExpectExec(regexp.QuoteMeta(expectedInsert)).
-					WithArgs(args.name1, args.value1).
-					WillReturnResult(sqlmock.NewResult(1, 1))
-				mock.ExpectExec(regexp.QuoteMeta(expectedInsert)).
-					WithArgs(args.name2, args.value2).
-					WillReturnResult(sqlmock.NewResult(1, 1))
-
-				rowsInsertCounter := sqlmock.NewRows([]string{"value"}).
-					AddRow(10)
-				mock.ExpectQuery(regexp.QuoteMeta(expectedInsertCounter)).
-					WithArgs(args.nameCounter, args.valueCounter).
-					WillReturnRows(rowsInsertCounter)
-
-				mock.ExpectCommit()
-			},
-			metrics: []models.Metrics{
-				{ID: "cpu_usage", MType: "gauge", Value: ptrToFloat64(75.5)},
-				{ID: "memory_usage", MType: "gauge", Value: ptrToFloat64(60.0)},
-				{ID: "counter1", MType: "counter", Delta: ptrToInt64(10)},
-			},
-			wantErr: false,
+			name:  "Valid series",
+			mType: "gauge",
+			mockBehavior: func() {
+				rows := sqlmock.NewRows([]string{"labels"}).
+					AddRow("").
+					AddRow(`host="agent-1"`)
+				mock.ExpectQuery(listQuery).WithArgs("Alloc").WillReturnRows(rows)
+			},
+			expected: []string{"Alloc", `Alloc{host="agent-1"}`},
 		},
 		{
-			name: "Invalid transaction start",
-			args: args{
-				name1:        "cpu_usage",
-				value1:       75.5,
-				name2:        "memory_usage",
-				value2:       60.0,
-				nameCounter:  "counter1",
-				valueCounter: 10,
-			},
-			mockBehavior: func(m *mocks, args args) {
-				mock.ExpectBegin().WillReturnError(fmt.Errorf("error occured on creating tx on batchupdate"))
+			name:  "No series",
+			mType: "gauge",
+			mockBehavior: func() {
+				mock.ExpectQuery(listQuery).WithArgs("Alloc").WillReturnRows(sqlmock.NewRows([]string{"labels"}))
 			},
-			metrics: []models.Metrics{
-				{ID: "cpu_usage", MType: "gauge", Value: ptrToFloat64(75.5)},
-				{ID: "memory_usage", MType: "gauge", Value: ptrToFloat64(60.0)},
-				{ID: "counter1", MType: "counter", Delta: ptrToInt64(10)},
-			},
-			wantErr: true,
-		},
-		{
-			name: "SQL execution error on gauge",
-			args: args{
-				name1:        "cpu_usage",
-				value1:       75.5,
-				name2:        "memory_usage",
-				value2:       60.0,
-				nameCounter:  "counter1",
-				valueCounter: 10,
-			},
-			mockBehavior: func(m *mocks, args args) {
-				mock.ExpectBegin()
-				expectedInsert := `INSERT INTO
-                           gauge_metrics(name, value)
-                           VALUES ($1, $2) ON CONFLICT (name)
-                           DO UPDATE SET value = $2`
-				mock.ExpectExec(regexp.QuoteMeta(expectedInsert)).
-					WithArgs(args.name1, args.value1).
-					WillReturnError(fmt.Errorf("insert error gauge"))
-
-				mock.ExpectRollback()
-			},
-			metrics: []models.Metrics{
-				{ID: "cpu_usage", MType: "gauge", Value: ptrToFloat64(75.5)},
-				{ID: "memory_usage", MType: "gauge", Value: ptrToFloat64(60.0)},
-				{ID: "counter1", MType: "counter", Delta: ptrToInt64(10)},
-			},
-			wantErr: true,
-		},
-		{
-			name: "SQL execution error on counter",
-			args: args{
-				name1:        "cpu_usage",
-				value1:       75.5,
-				name2:        "memory_usage",
-				value2:       60.0,
-				nameCounter:  "counter1",
-				valueCounter: 10,
-			},
-			mockBehavior: func(m *mocks, args args) {
-				mock.ExpectBegin()
-				expectedInsert := ` INSERT INTO
-										gauge_metrics(name, value)
-										VALUES ($1, $2) ON CONFLICT (name)
-										DO UPDATE SET value = $2
-										`
-				expectedInsertCounter := `INSERT INTO counter_metrics(name, value)VALUES ($1, $2) 
-								ON CONFLICT(name)DO UPDATE SET value = counter_metrics.value 
-								    + $2 RETURNING value
-								`
-				mock.ExpectExec(regexp.QuoteMeta(expectedInsert)).
-					WithArgs(args.name1, args.value1).
-					WillReturnResult(sqlmock.NewResult(1, 1))
-				mock.ExpectExec(regexp.QuoteMeta(expectedInsert)).
-					WithArgs(args.name2, args.value2).
-					WillReturnResult(sqlmock.NewResult(1, 1))
-
-				mock.ExpectQuery(regexp.QuoteMeta(expectedInsertCounter)).
-					WithArgs(args.nameCounter, args.valueCounter).
-					WillReturnError(fmt.Errorf("insert error counter"))
-				mock.ExpectRollback()
-			},
-			metrics: []models.Metrics{
-				{ID: "cpu_usage", MType: "gauge", Value: ptrToFloat64(75.5)},
-				{ID: "memory_usage", MType: "gauge", Value: ptrToFloat64(60.0)},
-				{ID: "counter1", MType: "counter", Delta: ptrToInt64(10)},
-			},
-			wantErr: true,
-		},
-		{
-			name: "empty list metrics",
-			mockBehavior: func(m *mocks, args args) {
-				mock.ExpectBegin()
-			},
-			metrics: []models.Metrics{},
-			wantErr: true,
+			expected: []string{},
 		},
 		{
-			name: "unsupported metrics type",
-			mockBehavior: func(m *mocks, args args) {
-				mock.ExpectBegin()
-			},
-			metrics: []models.Metrics{
-				{
-					ID:    "unsupported_metric",
-					MType: "unsupported",
-					Value: ptrToFloat64(75.5)},
+			name:  "Query error",
+			mType: "gauge",
+			mockBehavior: func() {
+				mock.ExpectQuery(listQuery).WithArgs("Alloc").WillReturnError(fmt.Errorf("connection lost"))
 			},
 			wantErr: true,
 		},
 		{
-			name: "failed to commit transaction",
-			args: args{
-				name1:        "cpu_usage",
-				value1:       75.5,
-				name2:        "memory_usage",
-				value2:       60.0,
-				nameCounter:  "counter1",
-				valueCounter: 10,
-			},
-			mockBehavior: func(m *mocks, args args) {
-				mock.ExpectBegin()
-				expectedInsert := ` INSERT INTO
-										gauge_metrics(name, value)
-										VALUES ($1, $2) ON CONFLICT (name)
-										DO UPDATE SET value = $2
-										`
-				expectedInsertCounter := `INSERT INTO counter_metrics(name, value)VALUES ($1, $2) 
-								ON CONFLICT(name)DO UPDATE SET value = counter_metrics.value 
-								    + $2 RETURNING value
-								`
-
-				mock.ExpectExec(regexp.QuoteMeta(expectedInsert)).
-					WithArgs(args.name1, args.value1).
-					WillReturnResult(sqlmock.NewResult(1, 1))
-				mock.ExpectExec(regexp.QuoteMeta(expectedInsert)).
-					WithArgs(args.name2, args.value2).
-					WillReturnResult(sqlmock.NewResult(1, 1))
-
-				rowsInsertCounter := sqlmock.NewRows([]string{"value"}).
-					AddRow(10)
-				mock.ExpectQuery(regexp.QuoteMeta(expectedInsertCounter)).
-					WithArgs(args.nameCounter, args.valueCounter).
-					WillReturnRows(rowsInsertCounter)
-
-				mock.ExpectCommit().WillReturnError(fmt.Errorf("failed to commit transaction"))
-			},
-			metrics: []models.Metrics{
-				{ID: "cpu_usage", MType: "gauge", Value: ptrToFloat64(75.5)},
-				{ID: "memory_usage", MType: "gauge", Value: ptrToFloat64(60.0)},
-				{ID: "counter1", MType: "counter", Delta: ptrToInt64(10)},
-			},
-			wantErr: true,
+			name:         "Unsupported type",
+			mType:        "unknown",
+			mockBehavior: func() {},
+			wantErr:      true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			c := gomock.NewController(t)
-			defer c.Finish()
-
-			m := &mocks{
-				DB: sqlx.NewDb(db, "sqlmock"),
-			}
-			pg := &Postgres{DB: m.DB}
-
-			tt.mockBehavior(m, tt.args)
-
-			err := pg.BatchUpdate(context.Background(), tt.metrics)
+			tt.mockBehavior()
 
+			pg := &Postgres{DB: sqlx.NewDb(db, "sqlmock")}
+			keys, err := pg.ListSeries(context.Background(), tt.mType, "Alloc")
 			if tt.wantErr {
-				assert.Error(t, err, "Expected an error but got nil")
+				assert.Error(t, err)
 			} else {
 				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, keys)
 			}
-			assert.NoError(t, mock.ExpectationsWereMet(), "Not all SQL expectations were met")
+
+			assert.NoError(t, mock.ExpectationsWereMet(), "not all expectations were met")
 		})
 	}
 }
@@ -929,11 +758,15 @@ func TestInitDB(t *testing.T) {
 		{
 			name: "successful initDB",
 			mockBehavior: func(mock sqlmock.Sqlmock) {
-				expectedExecCounter := `CREATE TABLE IF NOT EXISTS counter_metrics (name char(30) UNIQUE, value bigint)`
-				expectedExecGauge := `CREATE TABLE IF NOT EXISTS gauge_metrics (name char(30) UNIQUE, value double precision`
 				mock.ExpectPing()
-				mock.ExpectExec(regexp.QuoteMeta(expectedExecCounter)).WillReturnResult(sqlmock.NewResult(0, 0))
-				mock.ExpectExec(regexp.QuoteMeta(expectedExecGauge)).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta(versionTable)).WillReturnResult(sqlmock.NewResult(0, 0))
+				expectMigrationStep(mock, 0)
+				mock.ExpectExec(regexp.QuoteMeta(migrations[0].Up)).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO schema_version (version, name) VALUES ($1, $2)")).
+					WithArgs(1, migrations[0].Name).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+				expectMigrationStep(mock, LatestVersion())
+				mock.ExpectCommit()
 			},
 			wantErr: false,
 		},
@@ -945,24 +778,23 @@ func TestInitDB(t *testing.T) {
 			wantErr: true,
 		},
 		{
-			name: "error creating counter_metrics table",
+			name: "error creating schema_version table",
 			mockBehavior: func(mock sqlmock.Sqlmock) {
-				expectedExecCounter := `CREATE TABLE IF NOT EXISTS counter_metrics (name char(30) UNIQUE, value bigint)`
 				mock.ExpectPing()
-				mock.ExpectExec(regexp.QuoteMeta(expectedExecCounter)).
-					WillReturnError(fmt.Errorf("failed to create table counter_metrics"))
+				mock.ExpectExec(regexp.QuoteMeta(versionTable)).
+					WillReturnError(fmt.Errorf("failed to create table schema_version"))
 			},
 			wantErr: true,
 		},
 		{
-			name: "error creating gauge_metrics table",
+			name: "error applying migration",
 			mockBehavior: func(mock sqlmock.Sqlmock) {
-				expectedExecCounter := `CREATE TABLE IF NOT EXISTS counter_metrics (name char(30) UNIQUE, value bigint)`
-				expectedExecGauge := `CREATE TABLE IF NOT EXISTS gauge_metrics (name char(30) UNIQUE, value double precision`
 				mock.ExpectPing()
-				mock.ExpectExec(regexp.QuoteMeta(expectedExecCounter)).WillReturnResult(sqlmock.NewResult(0, 0))
-				mock.ExpectExec(regexp.QuoteMeta(expectedExecGauge)).
-					WillReturnError(fmt.Errorf("failed to create table gauge_metrics"))
+				mock.ExpectExec(regexp.QuoteMeta(versionTable)).WillReturnResult(sqlmock.NewResult(0, 0))
+				expectMigrationStep(mock, 0)
+				mock.ExpectExec(regexp.QuoteMeta(migrations[0].Up)).
+					WillReturnError(fmt.Errorf("column name contains null values"))
+				mock.ExpectRollback()
 			},
 			wantErr: true,
 		},
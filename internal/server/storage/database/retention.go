@@ -0,0 +1,187 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/Sofja96/go-metrics.git/internal/models"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+)
+
+// rollupQuery - сворачивает значения из source за [$2, $3) в агрегаты с разрешением $1 секунд.
+// Интервал выравнивается по началу эпохи, как storage.BucketStart.
+const rollupQuery = `INSERT INTO metric_aggregates (name, labels, type, resolution, ts, min, max, sum, count)
+	SELECT name, labels, type, $1, to_timestamp((floor(extract(epoch FROM ts) / $1) * $1)::double precision) AS bucket, %s
+	FROM %s WHERE %s ts >= $2 AND ts < $3 GROUP BY name, labels, type, bucket
+	ON CONFLICT (name, labels, type, resolution, ts) DO UPDATE SET
+	min = LEAST(metric_aggregates.min, EXCLUDED.min), max = GREATEST(metric_aggregates.max, EXCLUDED.max),
+	sum = metric_aggregates.sum + EXCLUDED.sum, count = metric_aggregates.count + EXCLUDED.count`
+
+var (
+	// rollupSamplesQuery - сворачивает исходные значения.
+	rollupSamplesQuery = fmt.Sprintf(rollupQuery, "min(value), max(value), sum(value), count(*)", "metric_samples", "")
+	// rollupAggregatesQuery - сворачивает агрегаты с разрешением $4 секунд.
+	rollupAggregatesQuery = fmt.Sprintf(rollupQuery, "min(min), max(max), sum(sum), sum(count)", "metric_aggregates", "resolution = $4 AND")
+)
+
+// Compact - сворачивает историю серий в агрегаты уровней policy по начало текущего интервала каждого уровня
+// и удаляет значения и агрегаты старше времени хранения их уровня на момент now. Все выполняется
+// в одной транзакции, а одновременные вызовы с разных серверов ждут друг друга на блокировке metric_rollups.
+func (pg *Postgres) Compact(ctx context.Context, now time.Time, policy storage.RetentionPolicy) (int, error) {
+	tx, err := pg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error occured on creating tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, "LOCK TABLE metric_rollups IN EXCLUSIVE MODE"); err != nil {
+		return 0, fmt.Errorf("error lock metric_rollups: %w", err)
+	}
+	rolled, err := queryRolled(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	var prev time.Duration
+	resolutions := make([]int64, 0, len(policy))
+	for _, level := range policy.Aggregates() {
+		seconds := int64(level.Resolution / time.Second)
+		resolutions = append(resolutions, seconds)
+
+		from, until := rolled[level.Resolution], storage.BucketStart(now, level.Resolution)
+		if until.After(from) {
+			if prev == storage.RawResolution {
+				_, err = tx.ExecContext(ctx, rollupSamplesQuery, seconds, from, until)
+			} else {
+				_, err = tx.ExecContext(ctx, rollupAggregatesQuery, seconds, from, until, int64(prev/time.Second))
+			}
+			if err != nil {
+				return 0, fmt.Errorf("error rollup %s: %w", level.Resolution, err)
+			}
+			_, err = tx.ExecContext(ctx, `INSERT INTO metric_rollups (resolution, rolled_until) VALUES ($1, $2)
+				ON CONFLICT (resolution) DO UPDATE SET rolled_until = EXCLUDED.rolled_until`, seconds, until)
+			if err != nil {
+				return 0, fmt.Errorf("error update metric_rollups: %w", err)
+			}
+		}
+		prev = level.Resolution
+	}
+
+	removed, err := execAffected(ctx, tx, "DELETE FROM metric_samples WHERE ts < $1", now.Add(-policy.Raw()))
+	if err != nil {
+		return 0, fmt.Errorf("error delete samples: %w", err)
+	}
+	for i, level := range policy.Aggregates() {
+		n, err := execAffected(ctx, tx, "DELETE FROM metric_aggregates WHERE resolution = $1 AND ts < $2",
+			resolutions[i], now.Add(-level.Retain))
+		if err != nil {
+			return 0, fmt.Errorf("error delete aggregates: %w", err)
+		}
+		removed += n
+	}
+
+	// уровни, убранные из политики
+	n, err := execAffected(ctx, tx, "DELETE FROM metric_aggregates WHERE resolution <> ALL($1)", pq.Array(resolutions))
+	if err != nil {
+		return 0, fmt.Errorf("error delete aggregates: %w", err)
+	}
+	removed += n
+	if _, err = tx.ExecContext(ctx, "DELETE FROM metric_rollups WHERE resolution <> ALL($1)", pq.Array(resolutions)); err != nil {
+		return 0, fmt.Errorf("error delete metric_rollups: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return removed, nil
+}
+
+// GetRange - возвращает историю значений метрики за интервал [from, to] с шагом step.
+// Значения читаются из самого грубого уровня агрегатов, разрешение которого не больше step.
+func (pg *Postgres) GetRange(ctx context.Context, key, mType string, from, to time.Time, step time.Duration) ([]storage.Sample, error) {
+	name, labels := models.SplitSeriesKey(key)
+
+	var rolled map[time.Duration]time.Time
+	if step > 0 {
+		var err error
+		if rolled, err = queryRolled(ctx, pg.DB); err != nil {
+			return nil, err
+		}
+	}
+
+	return storage.ReadRange(from, to, step, rolled, func(resolution time.Duration, from, to time.Time) ([]storage.Sample, error) {
+		if resolution == storage.RawResolution {
+			return pg.querySamples(ctx, `SELECT ts, value FROM metric_samples
+				WHERE name = $1 AND labels = $2 AND type = $3 AND ts >= $4 AND ts < $5 ORDER BY ts`,
+				func(rows *sql.Rows, sample *storage.Sample) error {
+					return rows.Scan(&sample.Timestamp, &sample.Value)
+				}, name, labels, mType, from, to)
+		}
+		return pg.querySamples(ctx, `SELECT ts, min, max, sum, count FROM metric_aggregates
+			WHERE name = $1 AND labels = $2 AND type = $3 AND resolution = $4 AND ts >= $5 AND ts < $6 ORDER BY ts`,
+			func(rows *sql.Rows, sample *storage.Sample) error {
+				var a storage.Aggregate
+				if err := rows.Scan(&a.Timestamp, &a.Min, &a.Max, &a.Sum, &a.Count); err != nil {
+					return err
+				}
+				*sample = a.Sample(mType)
+				return nil
+			}, name, labels, mType, int64(resolution/time.Second), from, to)
+	})
+}
+
+// querySamples - выполняет запрос истории и читает значения функцией scan.
+func (pg *Postgres) querySamples(ctx context.Context, query string, scan func(rows *sql.Rows, sample *storage.Sample) error, args ...any) ([]storage.Sample, error) {
+	rows, err := pg.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting samples: %w", err)
+	}
+	defer rows.Close()
+
+	samples := make([]storage.Sample, 0)
+	for rows.Next() {
+		var sample storage.Sample
+		if err := scan(rows, &sample); err != nil {
+			return nil, fmt.Errorf("error scanning samples: %w", err)
+		}
+		samples = append(samples, sample)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error selecting samples: %w", err)
+	}
+	return samples, nil
+}
+
+// queryer - запросы в транзакции или вне ее.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// queryRolled - читает моменты, по которые свернуты уровни агрегатов.
+func queryRolled(ctx context.Context, q queryer) (map[time.Duration]time.Time, error) {
+	rows, err := q.QueryContext(ctx, "SELECT resolution, rolled_until FROM metric_rollups")
+	if err != nil {
+		return nil, fmt.Errorf("error selecting metric_rollups: %w", err)
+	}
+	defer rows.Close()
+
+	rolled := make(map[time.Duration]time.Time)
+	for rows.Next() {
+		var (
+			seconds int64
+			until   time.Time
+		)
+		if err := rows.Scan(&seconds, &until); err != nil {
+			return nil, fmt.Errorf("error scanning metric_rollups: %w", err)
+		}
+		rolled[time.Duration(seconds)*time.Second] = until
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error selecting metric_rollups: %w", err)
+	}
+	return rolled, nil
+}
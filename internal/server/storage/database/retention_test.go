@@ -0,0 +1,221 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+)
+
+func TestCompact(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 30, 10, 0, time.UTC)
+	minute, hour := now.Truncate(time.Minute), now.Truncate(time.Hour)
+	policy, err := storage.ParseRetention("raw=1h,1m=24h,1h=30d")
+	require.NoError(t, err)
+
+	rolledRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"resolution", "rolled_until"}).AddRow(int64(60), minute.Add(-5*time.Minute))
+	}
+	upsertRolled := regexp.QuoteMeta(`INSERT INTO metric_rollups (resolution, rolled_until) VALUES ($1, $2)`)
+
+	tests := []struct {
+		name         string
+		mockBehavior func(mock sqlmock.Sqlmock)
+		expected     int
+		wantErr      bool
+	}{
+		{
+			name: "Rollup and retention",
+			mockBehavior: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("LOCK TABLE metric_rollups IN EXCLUSIVE MODE")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT resolution, rolled_until FROM metric_rollups")).
+					WillReturnRows(rolledRows())
+				mock.ExpectExec(regexp.QuoteMeta(rollupSamplesQuery)).
+					WithArgs(int64(60), minute.Add(-5*time.Minute), minute).WillReturnResult(sqlmock.NewResult(0, 5))
+				mock.ExpectExec(upsertRolled).WithArgs(int64(60), minute).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta(rollupAggregatesQuery)).
+					WithArgs(int64(3600), time.Time{}, hour, int64(60)).WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectExec(upsertRolled).WithArgs(int64(3600), hour).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM metric_samples WHERE ts < $1")).
+					WithArgs(now.Add(-time.Hour)).WillReturnResult(sqlmock.NewResult(0, 10))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM metric_aggregates WHERE resolution = $1 AND ts < $2")).
+					WithArgs(int64(60), now.Add(-24*time.Hour)).WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM metric_aggregates WHERE resolution = $1 AND ts < $2")).
+					WithArgs(int64(3600), now.Add(-30*24*time.Hour)).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM metric_aggregates WHERE resolution <> ALL($1)")).
+					WithArgs(sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM metric_rollups WHERE resolution <> ALL($1)")).
+					WithArgs(sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			},
+			expected: 13,
+		},
+		{
+			name: "Rollup error",
+			mockBehavior: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("LOCK TABLE metric_rollups IN EXCLUSIVE MODE")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT resolution, rolled_until FROM metric_rollups")).
+					WillReturnRows(rolledRows())
+				mock.ExpectExec(regexp.QuoteMeta(rollupSamplesQuery)).
+					WillReturnError(fmt.Errorf("connection lost"))
+				mock.ExpectRollback()
+			},
+			wantErr: true,
+		},
+		{
+			name: "Lock error",
+			mockBehavior: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("LOCK TABLE metric_rollups IN EXCLUSIVE MODE")).
+					WillReturnError(fmt.Errorf(`relation "metric_rollups" does not exist`))
+				mock.ExpectRollback()
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			tt.mockBehavior(mock)
+			pg := &Postgres{DB: sqlx.NewDb(db, "sqlmock")}
+
+			n, err := pg.Compact(context.Background(), now, policy)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, n)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGetRange(t *testing.T) {
+	from := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+	end := to.Add(time.Nanosecond)
+	rawQuery := regexp.QuoteMeta(`SELECT ts, value FROM metric_samples
+		WHERE name = $1 AND labels = $2 AND type = $3 AND ts >= $4 AND ts < $5 ORDER BY ts`)
+	aggregatesQuery := regexp.QuoteMeta(`SELECT ts, min, max, sum, count FROM metric_aggregates
+		WHERE name = $1 AND labels = $2 AND type = $3 AND resolution = $4 AND ts >= $5 AND ts < $6 ORDER BY ts`)
+	rolledQuery := regexp.QuoteMeta("SELECT resolution, rolled_until FROM metric_rollups")
+
+	tests := []struct {
+		name            string
+		step            time.Duration
+		mockBehavior    func(mock sqlmock.Sqlmock)
+		expectedSamples []storage.Sample
+		wantErr         bool
+	}{
+		{
+			name: "Raw samples",
+			mockBehavior: func(mock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"ts", "value"}).
+					AddRow(from.Add(10*time.Second), 1.0).
+					AddRow(from.Add(20*time.Second), 2.0)
+				mock.ExpectQuery(rawQuery).
+					WithArgs("HeapInuse", `host="agent-1"`, "gauge", from, end).
+					WillReturnRows(rows)
+			},
+			expectedSamples: []storage.Sample{
+				{Timestamp: from.Add(10 * time.Second), Value: 1},
+				{Timestamp: from.Add(20 * time.Second), Value: 2},
+			},
+		},
+		{
+			name: "Samples with step",
+			step: time.Minute,
+			mockBehavior: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(rolledQuery).WillReturnRows(sqlmock.NewRows([]string{"resolution", "rolled_until"}))
+				rows := sqlmock.NewRows([]string{"ts", "value"}).
+					AddRow(from.Add(10*time.Second), 1.0).
+					AddRow(from.Add(20*time.Second), 2.0).
+					AddRow(from.Add(70*time.Second), 3.0)
+				mock.ExpectQuery(rawQuery).
+					WithArgs("HeapInuse", `host="agent-1"`, "gauge", from, end).
+					WillReturnRows(rows)
+			},
+			expectedSamples: []storage.Sample{
+				{Timestamp: from, Value: 2},
+				{Timestamp: from.Add(time.Minute), Value: 3},
+			},
+		},
+		{
+			name: "Aggregates before rolled time and raw samples after",
+			step: 10 * time.Minute,
+			mockBehavior: func(mock sqlmock.Sqlmock) {
+				rolled := from.Add(30 * time.Minute)
+				mock.ExpectQuery(rolledQuery).WillReturnRows(sqlmock.NewRows([]string{"resolution", "rolled_until"}).
+					AddRow(int64(60), rolled).
+					AddRow(int64(3600), from))
+				mock.ExpectQuery(aggregatesQuery).
+					WithArgs("HeapInuse", `host="agent-1"`, "gauge", int64(60), from, rolled).
+					WillReturnRows(sqlmock.NewRows([]string{"ts", "min", "max", "sum", "count"}).
+						AddRow(from, 1.0, 3.0, 4.0, int64(2)).
+						AddRow(from.Add(20*time.Minute), 5.0, 5.0, 5.0, int64(1)))
+				mock.ExpectQuery(rawQuery).
+					WithArgs("HeapInuse", `host="agent-1"`, "gauge", rolled, end).
+					WillReturnRows(sqlmock.NewRows([]string{"ts", "value"}).AddRow(from.Add(40*time.Minute), 7.0))
+			},
+			expectedSamples: []storage.Sample{
+				{Timestamp: from, Value: 2},
+				{Timestamp: from.Add(20 * time.Minute), Value: 5},
+				{Timestamp: from.Add(40 * time.Minute), Value: 7},
+			},
+		},
+		{
+			name: "Rollups query error",
+			step: time.Minute,
+			mockBehavior: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(rolledQuery).WillReturnError(fmt.Errorf("connection lost"))
+			},
+			wantErr: true,
+		},
+		{
+			name: "Query error",
+			mockBehavior: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(rawQuery).
+					WithArgs("HeapInuse", `host="agent-1"`, "gauge", from, end).
+					WillReturnError(fmt.Errorf("error selecting samples"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			tt.mockBehavior(mock)
+			pg := &Postgres{DB: sqlx.NewDb(db, "sqlmock")}
+
+			samples, err := pg.GetRange(context.Background(), `HeapInuse{host="agent-1"}`, "gauge", from, to, tt.step)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedSamples, samples)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet(), "not all expectations were met")
+		})
+	}
+}
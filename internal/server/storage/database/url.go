@@ -0,0 +1,42 @@
+package database
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+)
+
+// Schemes - схемы URL хранилища Postgres. URL целиком передается драйверу как строка подключения,
+// а строка вида "host=localhost user=metrics" - параметром dsn, см. URL.
+var Schemes = []string{"postgres", "postgresql"}
+
+func init() {
+	for _, scheme := range Schemes {
+		storage.Register(scheme, func(ctx context.Context, u *url.URL) (storage.Storage, error) {
+			return NewStorage(ctx, DSN(u))
+		})
+	}
+}
+
+// URL - возвращает URL хранилища для строки подключения dsn. URL возвращается без изменений,
+// а строка ключ-значение передается без разбора параметром dsn, чтобы значения в кавычках
+// с пробелами доходили до драйвера как есть.
+func URL(dsn string) string {
+	if strings.Contains(dsn, "://") {
+		return dsn
+	}
+	return Schemes[0] + "://?" + url.Values{"dsn": {dsn}}.Encode()
+}
+
+// DSN - возвращает строку подключения драйвера из URL хранилища: значение параметра dsn
+// или сам URL.
+func DSN(u *url.URL) string {
+	if u.Host == "" && u.Path == "" {
+		if q := u.Query(); len(q) == 1 && q.Has("dsn") {
+			return q.Get("dsn")
+		}
+	}
+	return u.String()
+}
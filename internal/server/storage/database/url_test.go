@@ -0,0 +1,55 @@
+package database
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+)
+
+func TestRegisteredSchemes(t *testing.T) {
+	for _, scheme := range Schemes {
+		assert.Contains(t, storage.Schemes(), scheme)
+	}
+
+	// порт 1 закрыт: фабрика должна вернуть ошибку подключения, а не хранилище
+	_, err := storage.Open(context.Background(), "postgres://metrics@127.0.0.1:1/metrics?sslmode=disable&connect_timeout=1")
+	assert.ErrorContains(t, err, "error open postgres storage")
+}
+
+func TestURL(t *testing.T) {
+	tests := []struct {
+		name string
+		dsn  string
+		want string
+	}{
+		{
+			name: "URL is kept",
+			dsn:  "postgres://metrics@localhost/metrics?sslmode=disable",
+			want: "postgres://metrics@localhost/metrics?sslmode=disable",
+		},
+		{
+			name: "Key value string",
+			dsn:  "host=localhost user=metrics sslmode=disable",
+			want: "host=localhost user=metrics sslmode=disable",
+		},
+		{
+			name: "Quoted value with spaces",
+			dsn:  `host=localhost password='a b' application_name='metrics \'server\''`,
+			want: `host=localhost password='a b' application_name='metrics \'server\''`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(URL(tt.dsn))
+			require.NoError(t, err)
+			assert.Contains(t, Schemes, u.Scheme)
+			assert.Equal(t, tt.want, DSN(u))
+		})
+	}
+}
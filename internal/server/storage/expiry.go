@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ttlTypes - типы метрик, которые можно указать в правиле времени жизни.
+var ttlTypes = []string{"gauge", "counter", "histogram", "summary"}
+
+const (
+	minExpiryInterval = time.Second
+	maxExpiryInterval = time.Minute
+)
+
+// TTLRule - время жизни серий метрик типа Type (любого, если тип пуст), имена которых начинаются с Prefix.
+// Нулевое время жизни отключает удаление подходящих серий.
+type TTLRule struct {
+	Type   string
+	Prefix string
+	TTL    time.Duration
+}
+
+// TTLRules - правила времени жизни серий. Для серии выбирается правило с самым длинным
+// совпавшим префиксом, при равных префиксах - правило с указанным типом.
+type TTLRules []TTLRule
+
+// ParseTTLRules - разбирает правила времени жизни вида "24h,gauge:Heap=1h,PollCount=0", где
+// значение без имени задает время жизни по умолчанию, а имя - префикс имени метрики
+// с необязательным типом через двоеточие.
+func ParseTTLRules(s string) (TTLRules, error) {
+	var rules TTLRules
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		var rule TTLRule
+		value := item
+		if selector, v, ok := strings.Cut(item, "="); ok {
+			value = v
+			rule.Prefix = strings.TrimSpace(selector)
+			if t, prefix, ok := strings.Cut(rule.Prefix, ":"); ok && slices.Contains(ttlTypes, t) {
+				rule.Type, rule.Prefix = t, prefix
+			}
+		}
+
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid ttl rule %q", item)
+		}
+		rule.TTL = d
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// TTL - возвращает время жизни серии метрики типа mType с именем name; 0 - без ограничения.
+func (r TTLRules) TTL(mType, name string) time.Duration {
+	best := -1
+	for i, rule := range r {
+		if (rule.Type != "" && rule.Type != mType) || !strings.HasPrefix(name, rule.Prefix) {
+			continue
+		}
+		if best < 0 || len(rule.Prefix) > len(r[best].Prefix) ||
+			(len(rule.Prefix) == len(r[best].Prefix) && rule.Type != "") {
+			best = i
+		}
+	}
+	if best < 0 {
+		return 0
+	}
+	return r[best].TTL
+}
+
+// Interval - возвращает период проверки: половина наименьшего времени жизни,
+// но не меньше секунды и не больше минуты. Если ни одно правило не удаляет серии, возвращает 0.
+func (r TTLRules) Interval() time.Duration {
+	var interval time.Duration
+	for _, rule := range r {
+		if rule.TTL > 0 && (interval == 0 || rule.TTL/2 < interval) {
+			interval = rule.TTL / 2
+		}
+	}
+	if interval == 0 {
+		return 0
+	}
+	return min(max(interval, minExpiryInterval), maxExpiryInterval)
+}
+
+// RunExpiry - периодически удаляет из s серии с истекшим временем жизни до отмены контекста.
+// Если хранилище не поддерживает удаление, удаление прекращается.
+func RunExpiry(ctx context.Context, s Deleter, rules TTLRules) {
+	interval := rules.Interval()
+	if interval == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			deleted, err := s.DeleteExpired(ctx, now, rules.TTL)
+			if errors.Is(err, ErrUnsupported) {
+				log.Printf("metric ttl is ignored: %v", err)
+				return
+			}
+			if err != nil {
+				log.Printf("error delete expired metrics: %v", err)
+				continue
+			}
+			if len(deleted) != 0 {
+				log.Printf("deleted %d expired metrics", len(deleted))
+			}
+		}
+	}
+}
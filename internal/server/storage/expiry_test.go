@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTTLRules(t *testing.T) {
+	rules, err := ParseTTLRules(" 24h, gauge:Heap=1h,PollCount=0, counter:=30m")
+	require.NoError(t, err)
+	assert.Equal(t, TTLRules{
+		{TTL: 24 * time.Hour},
+		{Type: "gauge", Prefix: "Heap", TTL: time.Hour},
+		{Prefix: "PollCount"},
+		{Type: "counter", TTL: 30 * time.Minute},
+	}, rules)
+
+	rules, err = ParseTTLRules("")
+	assert.NoError(t, err)
+	assert.Empty(t, rules)
+
+	for _, s := range []string{"forever", "Heap=1", "Heap=-1h"} {
+		_, err = ParseTTLRules(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestTTLRules_TTL(t *testing.T) {
+	rules := TTLRules{
+		{TTL: 24 * time.Hour},
+		{Prefix: "Heap", TTL: 2 * time.Hour},
+		{Type: "gauge", Prefix: "Heap", TTL: time.Hour},
+		{Prefix: "HeapInuse"},
+		{Prefix: "app:requests", TTL: time.Minute},
+	}
+
+	tests := []struct {
+		mType string
+		name  string
+		want  time.Duration
+	}{
+		{mType: "gauge", name: "Alloc", want: 24 * time.Hour},
+		{mType: "gauge", name: "HeapAlloc", want: time.Hour},
+		{mType: "counter", name: "HeapAlloc", want: 2 * time.Hour},
+		{mType: "gauge", name: "HeapInuse", want: 0},
+		{mType: "counter", name: "app:requests_total", want: time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mType+"/"+tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, rules.TTL(tt.mType, tt.name))
+		})
+	}
+
+	assert.Zero(t, TTLRules(nil).TTL("gauge", "Alloc"))
+}
+
+func TestTTLRules_Interval(t *testing.T) {
+	assert.Zero(t, TTLRules(nil).Interval())
+	assert.Zero(t, TTLRules{{Prefix: "Alloc"}}.Interval())
+	assert.Equal(t, time.Minute, TTLRules{{TTL: 24 * time.Hour}}.Interval())
+	assert.Equal(t, 15*time.Second, TTLRules{{TTL: time.Hour}, {Prefix: "Heap", TTL: 30 * time.Second}}.Interval())
+	assert.Equal(t, time.Second, TTLRules{{TTL: time.Second}}.Interval())
+}
@@ -0,0 +1,29 @@
+package storage
+
+import "time"
+
+// Sample - значение метрики, зафиксированное в момент времени.
+type Sample struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+// Downsample - прореживает упорядоченные по времени значения: для каждого интервала
+// [from+k*step, from+(k+1)*step) остается последнее значение, а его время выравнивается
+// по началу интервала. При step <= 0 значения возвращаются без изменений.
+func Downsample(samples []Sample, from time.Time, step time.Duration) []Sample {
+	if step <= 0 || len(samples) == 0 {
+		return samples
+	}
+
+	result := make([]Sample, 0, len(samples))
+	for _, sample := range samples {
+		bucket := from.Add(sample.Timestamp.Sub(from) / step * step)
+		if n := len(result); n > 0 && result[n-1].Timestamp.Equal(bucket) {
+			result[n-1].Value = sample.Value
+			continue
+		}
+		result = append(result, Sample{Timestamp: bucket, Value: sample.Value})
+	}
+	return result
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownsample(t *testing.T) {
+	from := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	samples := []Sample{
+		{Timestamp: from.Add(5 * time.Second), Value: 1},
+		{Timestamp: from.Add(30 * time.Second), Value: 2},
+		{Timestamp: from.Add(65 * time.Second), Value: 3},
+		{Timestamp: from.Add(200 * time.Second), Value: 4},
+	}
+
+	tests := []struct {
+		name     string
+		step     time.Duration
+		expected []Sample
+	}{
+		{
+			name:     "Without step",
+			step:     0,
+			expected: samples,
+		},
+		{
+			name: "Minute step",
+			step: time.Minute,
+			expected: []Sample{
+				{Timestamp: from, Value: 2},
+				{Timestamp: from.Add(time.Minute), Value: 3},
+				{Timestamp: from.Add(3 * time.Minute), Value: 4},
+			},
+		},
+		{
+			name: "Step wider than range",
+			step: time.Hour,
+			expected: []Sample{
+				{Timestamp: from, Value: 4},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Downsample(samples, from, tt.step))
+		})
+	}
+}
@@ -2,11 +2,16 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"io"
+	"time"
 
 	"github.com/Sofja96/go-metrics.git/internal/models"
 )
 
-// Storage - интерфейс хранилища
+// Storage - интерфейс хранилища. Необязательные возможности хранилища описаны отдельными
+// интерфейсами Ranger, Deleter и Compactor и проверяются приведением типа.
+// Параметры name и id - идентификаторы серий: имя метрики вместе с метками (см. models.SeriesKey).
 type Storage interface {
 	// UpdateCounter - обновляет метрику типа counter
 	UpdateCounter(ctx context.Context, name string, value int64) (int64, error)
@@ -22,18 +27,100 @@ type Storage interface {
 	GetAllGauges(context.Context) ([]GaugeMetric, error)
 	// GetAllCounters - получает все метрики типа counter
 	GetAllCounters(context.Context) ([]CounterMetric, error)
-	// BatchUpdate - обновляет метрики пачкой
+	// BatchUpdate - обновляет метрики пачкой. После успешного обновления в Delta метрик counter
+	// записываются значения серий, в Histogram и Summary - новые состояния histogram и summary
 	BatchUpdate(ctx context.Context, metrics []models.Metrics) error
+	// UpdateHistogram - добавляет наблюдения в метрику типа histogram
+	UpdateHistogram(ctx context.Context, name string, bounds, observations []float64) (models.Histogram, error)
+	// UpdateSummary - добавляет наблюдения в метрику типа summary
+	UpdateSummary(ctx context.Context, name string, quantiles, observations []float64) (models.SummaryValue, error)
+	// GetHistogram - получает метрику типа histogram
+	GetHistogram(ctx context.Context, id string) (models.Histogram, bool)
+	// GetSummary - получает метрику типа summary
+	GetSummary(ctx context.Context, id string) (models.SummaryValue, bool)
+	// GetAllHistograms - получает все метрики типа histogram
+	GetAllHistograms(context.Context) ([]HistogramMetric, error)
+	// GetAllSummaries - получает все метрики типа summary
+	GetAllSummaries(context.Context) ([]SummaryMetric, error)
+	// ListSeries - получает идентификаторы серий метрики типа mType с именем name
+	ListSeries(ctx context.Context, mType, name string) ([]string, error)
 }
 
-// CounterMetric - структура метрик counter, содержащая имя и значение
+// ErrUnsupported - хранилище не поддерживает операцию. Возвращается обертками хранилища,
+// когда вложенное хранилище не реализует необязательный интерфейс.
+var ErrUnsupported = errors.New("operation is not supported by storage")
+
+// Ranger - хранилище с историей значений метрик.
+type Ranger interface {
+	// GetRange - получает историю значений метрики за интервал [from, to] с шагом step
+	GetRange(ctx context.Context, name, mType string, from, to time.Time, step time.Duration) ([]Sample, error)
+}
+
+// Deleter - хранилище с удалением серий.
+type Deleter interface {
+	// Delete - удаляет серию id метрики типа mType вместе с ее историей; возвращает false, если серии нет
+	Delete(ctx context.Context, mType, id string) (bool, error)
+	// DeleteByPrefix - удаляет серии метрик типа mType (любого, если тип пуст), имена которых
+	// начинаются с prefix; возвращает удаленные серии
+	DeleteByPrefix(ctx context.Context, mType, prefix string) ([]SeriesID, error)
+	// DeleteExpired - удаляет серии, не обновлявшиеся дольше времени жизни ttl(mType, name) на момент now;
+	// серии с нулевым временем жизни не удаляются. Возвращает удаленные серии
+	DeleteExpired(ctx context.Context, now time.Time, ttl func(mType, name string) time.Duration) ([]SeriesID, error)
+}
+
+// Compactor - хранилище со сжатием истории по политике хранения.
+type Compactor interface {
+	// Compact - сворачивает историю в агрегаты по политике policy и удаляет значения и агрегаты старше
+	// времени хранения их уровня на момент now. Возвращает количество удаленных значений и агрегатов
+	Compact(ctx context.Context, now time.Time, policy RetentionPolicy) (int, error)
+}
+
+// Close - закрывает хранилище s, если оно держит ресурсы (файлы, журнал или подключения к БД)
+// и реализует io.Closer. Вызывается после остановки всех, кто обращается к хранилищу.
+func Close(s Storage) error {
+	if c, ok := s.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Shared - проверяет, что хранилище s могут одновременно изменять несколько экземпляров сервера,
+// например общая база данных: изменения других экземпляров не проходят через кеши этого экземпляра.
+func Shared(s Storage) bool {
+	sh, ok := s.(interface{ Shared() bool })
+	return ok && sh.Shared()
+}
+
+// SeriesID - серия метрики: тип и идентификатор серии (см. models.SeriesKey)
+type SeriesID struct {
+	Type string
+	ID   string
+}
+
+// CounterMetric - структура метрик counter, содержащая имя, метки и значение
 type CounterMetric struct {
-	Name  string `json:"name"`
-	Value int64  `json:"value"`
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  int64             `json:"value"`
 }
 
-// GaugeMetric  - структура метрик gauge, содержащая имя и значение
+// GaugeMetric  - структура метрик gauge, содержащая имя, метки и значение
 type GaugeMetric struct {
-	Name  string  `json:"name"`
-	Value float64 `json:"value"`
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  float64           `json:"value"`
+}
+
+// HistogramMetric - структура метрик histogram, содержащая имя, метки и состояние
+type HistogramMetric struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  models.Histogram  `json:"value"`
+}
+
+// SummaryMetric - структура метрик summary, содержащая имя, метки и значения квантилей
+type SummaryMetric struct {
+	Name   string              `json:"name"`
+	Labels map[string]string   `json:"labels,omitempty"`
+	Value  models.SummaryValue `json:"value"`
 }
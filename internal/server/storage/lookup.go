@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/Sofja96/go-metrics.git/internal/models"
+)
+
+// LookupGauge - ищет значение gauge по имени и меткам. Сначала проверяется серия с точно
+// такими метками; если ее нет и метки переданы, среди серий с этим именем выбирается единственная,
+// метки которой содержат все переданные. Если подходящих серий несколько, метрика считается не найденной.
+func LookupGauge(ctx context.Context, s Storage, name string, labels map[string]string) (float64, bool) {
+	return lookup(ctx, s, "gauge", name, labels, s.GetGaugeValue)
+}
+
+// LookupCounter - ищет значение counter по имени и меткам по тем же правилам, что и LookupGauge.
+func LookupCounter(ctx context.Context, s Storage, name string, labels map[string]string) (int64, bool) {
+	return lookup(ctx, s, "counter", name, labels, s.GetCounterValue)
+}
+
+// LookupHistogram - ищет histogram по имени и меткам по тем же правилам, что и LookupGauge.
+func LookupHistogram(ctx context.Context, s Storage, name string, labels map[string]string) (models.Histogram, bool) {
+	return lookup(ctx, s, "histogram", name, labels, s.GetHistogram)
+}
+
+// LookupSummary - ищет summary по имени и меткам по тем же правилам, что и LookupGauge.
+func LookupSummary(ctx context.Context, s Storage, name string, labels map[string]string) (models.SummaryValue, bool) {
+	return lookup(ctx, s, "summary", name, labels, s.GetSummary)
+}
+
+// lookup - общая часть поиска серии: точное совпадение через get, иначе выбор среди серий
+// с именем name, полученных через ListSeries.
+func lookup[V any](
+	ctx context.Context,
+	s Storage,
+	mType, name string,
+	labels map[string]string,
+	get func(context.Context, string) (V, bool),
+) (V, bool) {
+	var zero V
+	if value, ok := get(ctx, models.SeriesKey(name, labels)); ok {
+		return value, true
+	}
+	if len(labels) == 0 {
+		return zero, false
+	}
+
+	keys, err := s.ListSeries(ctx, mType, name)
+	if err != nil {
+		return zero, false
+	}
+
+	var found string
+	for _, key := range keys {
+		if _, seriesLabels := models.ParseSeriesKey(key); models.MatchLabels(seriesLabels, labels) {
+			if found != "" {
+				return zero, false
+			}
+			found = key
+		}
+	}
+	if found == "" {
+		return zero, false
+	}
+	return get(ctx, found)
+}
@@ -0,0 +1,125 @@
+package memory
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/Sofja96/go-metrics.git/internal/models"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+)
+
+// Delete - удаляет серию id метрики типа mType вместе с ее историей.
+func (s *MemStorage) Delete(ctx context.Context, mType, id string) (bool, error) {
+	sh := s.shard(id)
+	sh.mutex.Lock()
+	ok, err := sh.has(mType, id)
+	var seq uint64
+	if ok {
+		seq, err = s.deleteKeys(sh, mType, []string{id})
+	}
+	sh.mutex.Unlock()
+	if err != nil {
+		return false, err
+	}
+
+	return ok, s.commit(seq)
+}
+
+// DeleteByPrefix - удаляет серии метрик типа mType (любого, если тип пуст), имена которых начинаются с prefix.
+func (s *MemStorage) DeleteByPrefix(ctx context.Context, mType, prefix string) ([]storage.SeriesID, error) {
+	match := func(_ *shard, key string) bool {
+		name, _ := models.SplitSeriesKey(key)
+		return strings.HasPrefix(name, prefix)
+	}
+	if mType != "" {
+		return s.deleteSeries(mType, match)
+	}
+
+	var deleted []storage.SeriesID
+	for _, t := range []string{gauge, counter, histogram, summary} {
+		series, err := s.deleteSeries(t, match)
+		deleted = append(deleted, series...)
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// DeleteExpired - удаляет серии, не обновлявшиеся дольше времени жизни ttl(mType, name) на момент now.
+// Для серий из снимков прежних версий без времени обновления оно отсчитывается от первой проверки.
+func (s *MemStorage) DeleteExpired(ctx context.Context, now time.Time, ttl func(mType, name string) time.Duration) ([]storage.SeriesID, error) {
+	var deleted []storage.SeriesID
+	for _, t := range []string{gauge, counter, histogram, summary} {
+		series, err := s.deleteSeries(t, func(sh *shard, key string) bool {
+			name, _ := models.SplitSeriesKey(key)
+			d := ttl(t, name)
+			if d <= 0 {
+				return false
+			}
+			updated, ok := sh.updated[historyKey(t, key)]
+			if !ok {
+				sh.touch(t, key, now)
+				return false
+			}
+			return now.Sub(updated) >= d
+		})
+		deleted = append(deleted, series...)
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// deleteSeries - удаляет серии метрики типа mType, для ключей которых match возвращает true,
+// и возвращает удаленные серии. Шарды обрабатываются по очереди, match вызывается под
+// блокировкой шарда на запись.
+func (s *MemStorage) deleteSeries(mType string, match func(sh *shard, key string) bool) ([]storage.SeriesID, error) {
+	if err := checkType(mType); err != nil {
+		return nil, err
+	}
+
+	var deleted []storage.SeriesID
+	var last uint64
+	for _, sh := range s.shards {
+		sh.mutex.Lock()
+		keys, err := sh.matchKeys(mType, match)
+		var seq uint64
+		if err == nil {
+			seq, err = s.deleteKeys(sh, mType, keys)
+		}
+		sh.mutex.Unlock()
+		if err != nil {
+			return deleted, err
+		}
+		for _, key := range keys {
+			deleted = append(deleted, storage.SeriesID{Type: mType, ID: key})
+		}
+		last = max(last, seq)
+	}
+
+	return deleted, s.commit(last)
+}
+
+// deleteKeys - записывает удаление в журнал и удаляет серии keys шарда sh вместе с историей.
+// Вызывается под блокировкой шарда на запись.
+func (s *MemStorage) deleteKeys(sh *shard, mType string, keys []string) (uint64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	deleted := make([]walSeries, 0, len(keys))
+	for _, key := range keys {
+		deleted = append(deleted, walSeries{Type: mType, ID: key})
+	}
+	seq, err := s.log(walRecord{Deleted: deleted}, sh)
+	if err != nil {
+		return 0, err
+	}
+	for _, key := range keys {
+		sh.remove(mType, key)
+	}
+	return seq, nil
+}
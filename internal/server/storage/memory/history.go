@@ -0,0 +1,143 @@
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+)
+
+// historySize - количество последних значений, которые хранятся для каждой метрики.
+const historySize = 4096
+
+// ring - кольцевой буфер значений одной метрики. Буфер растет по мере добавления значений
+// до size, после чего новые значения вытесняют самые старые.
+type ring struct {
+	samples []storage.Sample
+	size    int
+	next    int // позиция самого старого значения в заполненном буфере
+}
+
+func newRing(size int) *ring {
+	return &ring{size: size}
+}
+
+// add - добавляет значение, вытесняя самое старое при переполнении буфера.
+func (r *ring) add(sample storage.Sample) {
+	if len(r.samples) < r.size {
+		r.samples = append(r.samples, sample)
+		return
+	}
+	r.samples[r.next] = sample
+	r.next = (r.next + 1) % r.size
+}
+
+// ordered - возвращает значения буфера в хронологическом порядке.
+func (r *ring) ordered() []storage.Sample {
+	if r.next == 0 {
+		return r.samples
+	}
+	return append(append(make([]storage.Sample, 0, len(r.samples)), r.samples[r.next:]...), r.samples[:r.next]...)
+}
+
+// dropBefore - удаляет значения старше t и возвращает их количество.
+func (r *ring) dropBefore(t time.Time) int {
+	ordered := r.ordered()
+	i := sort.Search(len(ordered), func(i int) bool { return !ordered[i].Timestamp.Before(t) })
+	if i == 0 {
+		return 0
+	}
+
+	r.samples, r.next = append([]storage.Sample(nil), ordered[i:]...), 0
+	return i
+}
+
+// between - возвращает значения из интервала [from, to] в хронологическом порядке.
+func (r *ring) between(from, to time.Time) []storage.Sample {
+	result := make([]storage.Sample, 0)
+	for _, sample := range r.ordered() {
+		if sample.Timestamp.Before(from) || sample.Timestamp.After(to) {
+			continue
+		}
+		result = append(result, sample)
+	}
+	return result
+}
+
+// historyKey - ключ истории метрики с учетом ее типа.
+func historyKey(mType, name string) string {
+	return mType + "/" + name
+}
+
+// record - сохраняет значение метрики в момент t в историю. Вызывается под блокировкой шарда на запись.
+func (sh *shard) record(mType, name string, value float64, t time.Time) {
+	key := historyKey(mType, name)
+	r, ok := sh.history[key]
+	if !ok {
+		r = newRing(historySize)
+		sh.history[key] = r
+	}
+	r.add(storage.Sample{Timestamp: t, Value: value})
+}
+
+// rollup - дополняет агрегаты серии key уровнями policy за интервалы между моментами rolled, по которые
+// уровни уже свернуты, и until, по который их нужно свернуть. Вызывается под блокировкой шарда на запись.
+func (sh *shard) rollup(key string, policy storage.RetentionPolicy, rolled, until map[time.Duration]time.Time) {
+	r, ok := sh.history[key]
+	if !ok {
+		return
+	}
+	aggregates := sh.aggregates[key]
+
+	var source []storage.Aggregate
+	for _, sample := range r.ordered() {
+		source = append(source, storage.SampleAggregate(sample))
+	}
+	for _, level := range policy.Aggregates() {
+		from, to := rolled[level.Resolution], until[level.Resolution]
+		var pending []storage.Aggregate
+		for _, a := range source {
+			if !a.Timestamp.Before(from) && a.Timestamp.Before(to) {
+				pending = append(pending, a)
+			}
+		}
+		if len(pending) != 0 {
+			if aggregates == nil {
+				aggregates = make(map[time.Duration][]storage.Aggregate)
+				sh.aggregates[key] = aggregates
+			}
+			aggregates[level.Resolution] = append(aggregates[level.Resolution], storage.Rollup(pending, level.Resolution)...)
+		}
+		source = aggregates[level.Resolution]
+	}
+}
+
+// retain - удаляет значения и агрегаты серии key старше времени хранения их уровня в policy на момент now,
+// а также агрегаты уровней, которых нет в policy. Вызывается под блокировкой шарда на запись.
+func (sh *shard) retain(key string, now time.Time, policy storage.RetentionPolicy) int {
+	removed := 0
+	if r, ok := sh.history[key]; ok {
+		removed += r.dropBefore(now.Add(-policy.Raw()))
+	}
+
+	aggregates := sh.aggregates[key]
+	for resolution, list := range aggregates {
+		retain := policy.Retain(resolution)
+		if retain == 0 {
+			removed += len(list)
+			delete(aggregates, resolution)
+			continue
+		}
+		cutoff := now.Add(-retain)
+		i := sort.Search(len(list), func(i int) bool { return !list[i].Timestamp.Before(cutoff) })
+		removed += i
+		aggregates[resolution] = append(list[:0:0], list[i:]...)
+		if len(aggregates[resolution]) == 0 {
+			delete(aggregates, resolution)
+		}
+	}
+	if len(aggregates) == 0 {
+		delete(sh.aggregates, key)
+	}
+	return removed
+}
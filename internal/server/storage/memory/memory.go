@@ -3,31 +3,68 @@ package memory
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"path"
+	"slices"
 	"time"
 
 	"os"
 )
 
-// saveStorageToFile - функция записи данных из хранилища в файл в формате JSON.
+// saveStorageToFile - функция записи снимка хранилища в файл в формате JSON.
+// Шарды копируются по очереди, не останавливая запись в остальные. Если ведется журнал,
+// перед снятием снимка начинается новый сегмент, а прежние удаляются после записи снимка.
 func saveStorageToFile(s *MemStorage, filePath string) error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-	var metrics AllMetrics
-	metrics.Counter = s.counterData
-	metrics.Gauge = s.gaugeData
+	s.snapshotMu.Lock()
+	defer s.snapshotMu.Unlock()
 
+	var walSeq uint64
+	var segment int
+	if s.wal != nil {
+		var err error
+		if walSeq, segment, err = s.wal.rotate(); err != nil {
+			return err
+		}
+	}
+
+	metrics, walSeqs := s.snapshot()
 	data, err := json.MarshalIndent(metrics, "", "   ")
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(filePath, data, 0666)
+	header := snapshotHeader{}
+	if s.wal != nil {
+		header.WALShards = walSeqs
+		header.WALSeq = max(walSeq, slices.Max(walSeqs))
+	}
+	if err := writeSnapshot(filePath, data, s.backups, header); err != nil {
+		return err
+	}
+	if s.wal != nil {
+		return s.wal.removeBefore(segment)
+	}
+	return nil
+}
 
+// Close - сохраняет снимок хранилища, если он сохраняется периодически, и закрывает журнал.
+// После закрытия журнала обновления хранилища завершаются ошибкой.
+func (s *MemStorage) Close() error {
+	var err error
+	if s.filePath != "" {
+		if err = saveStorageToFile(s, s.filePath); err != nil {
+			err = fmt.Errorf("error save data in file: %w", err)
+		}
+	}
+	if s.wal != nil {
+		err = errors.Join(err, s.wal.close())
+	}
+	return err
 }
 
-// Dump - переодически сохраняет состояние хранилища в файл в формате JSON.
+// Dump - переодически сохраняет снимок хранилища в файл в формате JSON.
 func Dump(ctx context.Context, s *MemStorage, filePath string, storeInterval int) error {
 	dir, _ := path.Split(filePath)
 	if dir == "" {
@@ -44,9 +81,9 @@ func Dump(ctx context.Context, s *MemStorage, filePath string, storeInterval int
 	for {
 		select {
 		case <-pollTicker.C:
-			err := saveStorageToFile(s, filePath)
-			if err != nil {
-				return fmt.Errorf("error save data in file: %w", err)
+			// при ошибке снимок повторяется на следующем тике: без снимков журнал не сжимается
+			if err := saveStorageToFile(s, filePath); err != nil {
+				log.Printf("error save data in file: %v", err)
 			}
 		case <-ctx.Done():
 			return nil
@@ -55,16 +92,18 @@ func Dump(ctx context.Context, s *MemStorage, filePath string, storeInterval int
 	}
 }
 
-// LoadStorageFromFile - загружает данные из файла в формате JSON.
+// LoadStorageFromFile - загружает данные из снимка в формате JSON. Если снимок отсутствует
+// или поврежден, данные загружаются из самой свежей исправной резервной копии.
 func LoadStorageFromFile(ctx context.Context, s *MemStorage, filePath string) error {
-	file, err := os.ReadFile(filePath)
-	if err != nil {
-		return fmt.Errorf("error read and load data from file: %w", err)
-	}
+	_, err := loadSnapshot(ctx, s, filePath)
+	return err
+}
 
-	var data AllMetrics
-	if err := json.Unmarshal(file, &data); err != nil {
-		return fmt.Errorf("error on restoring file: %w", err)
+// loadSnapshot - загружает данные из снимка и возвращает номер последней вошедшей в него записи журнала.
+func loadSnapshot(ctx context.Context, s *MemStorage, filePath string) (uint64, error) {
+	data, header, err := readSnapshot(filePath)
+	if err != nil {
+		return 0, err
 	}
 
 	if len(data.Counter) != 0 {
@@ -73,5 +112,19 @@ func LoadStorageFromFile(ctx context.Context, s *MemStorage, filePath string) er
 	if len(data.Gauge) != 0 {
 		s.UpdateGaugeData(ctx, data.Gauge)
 	}
-	return err
+	if len(data.Histogram) != 0 {
+		s.UpdateHistogramData(ctx, data.Histogram)
+	}
+	if len(data.Summary) != 0 {
+		s.UpdateSummaryData(ctx, data.Summary)
+	}
+	s.restoreHistory(data)
+
+	for i, seq := range header.shardSeqs() {
+		sh := s.shards[i]
+		sh.mutex.Lock()
+		sh.walSeq = seq
+		sh.mutex.Unlock()
+	}
+	return header.WALSeq, nil
 }
@@ -2,6 +2,9 @@ package memory
 
 import (
 	"context"
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
 
 	"github.com/Sofja96/go-metrics.git/internal/models"
@@ -56,6 +59,121 @@ func BenchmarkBatchUpdate(b *testing.B) {
 	}
 }
 
+// benchmarkSeries - количество серий, по которым распределяются параллельные обновления.
+const benchmarkSeries = 1024
+
+func benchmarkNames(prefix string) []string {
+	names := make([]string, benchmarkSeries)
+	for i := range names {
+		names[i] = fmt.Sprintf("%s_%d", prefix, i)
+	}
+	return names
+}
+
+// parallelOffset - начальная серия горутины, чтобы горутины обновляли разные серии.
+func parallelOffset(next *atomic.Int64) int {
+	return int(next.Add(1)) * 97
+}
+
+func BenchmarkUpdateCounterParallel(b *testing.B) {
+	ctx := context.Background()
+	s, _ := NewMemStorage(ctx, 0, "/tmp/metrics-db.json", false)
+	names := benchmarkNames("test_counter")
+	var next atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := parallelOffset(&next); pb.Next(); i++ {
+			s.UpdateCounter(ctx, names[i%len(names)], 1)
+		}
+	})
+}
+
+func BenchmarkUpdateGaugeParallel(b *testing.B) {
+	ctx := context.Background()
+	s, _ := NewMemStorage(ctx, 0, "/tmp/metrics-db.json", false)
+	names := benchmarkNames("test_gauge")
+	var next atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := parallelOffset(&next); pb.Next(); i++ {
+			s.UpdateGauge(ctx, names[i%len(names)], 1.23)
+		}
+	})
+}
+
+func BenchmarkGetGaugeValueParallel(b *testing.B) {
+	ctx := context.Background()
+	s, _ := NewMemStorage(ctx, 0, "/tmp/metrics-db.json", false)
+	names := benchmarkNames("test_gauge")
+	for _, name := range names {
+		s.UpdateGauge(ctx, name, 1.23)
+	}
+	var next atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := parallelOffset(&next); pb.Next(); i++ {
+			if i%10 == 0 {
+				s.UpdateGauge(ctx, names[i%len(names)], 1.23)
+				continue
+			}
+			s.GetGaugeValue(ctx, names[i%len(names)])
+		}
+	})
+}
+
+func BenchmarkBatchUpdateParallel(b *testing.B) {
+	ctx := context.Background()
+	s, _ := NewMemStorage(ctx, 0, "/tmp/metrics-db.json", false)
+	names := benchmarkNames("test_batch")
+	var next atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		metrics := make([]models.Metrics, 10)
+		for i := parallelOffset(&next); pb.Next(); i += len(metrics) {
+			for j := range metrics {
+				metrics[j] = models.Metrics{MType: "counter", ID: names[(i+j)%len(names)], Delta: int64Ptr(1)}
+			}
+			s.BatchUpdate(ctx, metrics)
+		}
+	})
+}
+
+// BenchmarkUpdateDuringSnapshot - обновления, пока снимок хранилища непрерывно пишется в файл.
+func BenchmarkUpdateDuringSnapshot(b *testing.B) {
+	ctx := context.Background()
+	s, _ := NewMemStorage(ctx, 0, "/tmp/metrics-db.json", false)
+	names := benchmarkNames("test_counter")
+	for _, name := range names {
+		s.UpdateCounter(ctx, name, 1)
+	}
+
+	path := filepath.Join(b.TempDir(), "metrics-db.json")
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				saveStorageToFile(s, path)
+			}
+		}
+	}()
+
+	var next atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := parallelOffset(&next); pb.Next(); i++ {
+			s.UpdateCounter(ctx, names[i%len(names)], 1)
+		}
+	})
+	b.StopTimer()
+	close(done)
+	<-stopped
+}
+
 func float64Ptr(v float64) *float64 {
 	return &v
 }
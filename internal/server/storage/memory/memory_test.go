@@ -5,10 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestLoadStorageFromFile(t *testing.T) {
@@ -29,23 +31,18 @@ func TestLoadStorageFromFile(t *testing.T) {
 
 		defer os.Remove(filePath)
 
-		storage := &MemStorage{
-			gaugeData:   make(map[string]Gauge),
-			counterData: make(map[string]Counter),
-		}
+		storage := newMemStorage()
 
 		err = LoadStorageFromFile(ctx, storage, filePath)
 		assert.NoError(t, err, "Ошибка при загрузке данных из файла: %v", err)
 
-		assert.Equal(t, Counter(100), storage.counterData["requests"])
-		assert.Equal(t, Gauge(23.5), storage.gaugeData["temperature"])
+		metrics := storage.AllMetrics(ctx)
+		assert.Equal(t, Counter(100), metrics.Counter["requests"])
+		assert.Equal(t, Gauge(23.5), metrics.Gauge["temperature"])
 	})
 
 	t.Run("file not found", func(t *testing.T) {
-		storage := &MemStorage{
-			gaugeData:   make(map[string]Gauge),
-			counterData: make(map[string]Counter),
-		}
+		storage := newMemStorage()
 		err := LoadStorageFromFile(ctx, storage, "./nonexistent_file.json")
 		assert.Errorf(t, err, "error read and load data from file: %v", err)
 	})
@@ -57,10 +54,7 @@ func TestLoadStorageFromFile(t *testing.T) {
 
 		defer os.Remove(filePath)
 
-		storage := &MemStorage{
-			gaugeData:   make(map[string]Gauge),
-			counterData: make(map[string]Counter),
-		}
+		storage := newMemStorage()
 		err = LoadStorageFromFile(ctx, storage, filePath)
 		assert.Errorf(t, err, "error read and load data from file: %v", fmt.Errorf("json: cannot unmarshal string into Go struct field AllMetrics.Gauge of type map[string]memory.Gauge"))
 	})
@@ -71,23 +65,18 @@ func TestLoadStorageFromFile(t *testing.T) {
 
 		defer os.Remove(filePath)
 
-		storage := &MemStorage{
-			gaugeData:   make(map[string]Gauge),
-			counterData: make(map[string]Counter),
-		}
+		storage := newMemStorage()
 		err = LoadStorageFromFile(ctx, storage, filePath)
 		assert.Errorf(t, err, "Ошибка при загрузке данных из пустого файла: %v", err)
 
-		assert.Empty(t, storage.counterData)
-		assert.Empty(t, storage.gaugeData)
+		metrics := storage.AllMetrics(ctx)
+		assert.Empty(t, metrics.Counter)
+		assert.Empty(t, metrics.Gauge)
 	})
 }
 
 func TestSaveStorageToFile(t *testing.T) {
-	storage := &MemStorage{
-		gaugeData:   map[string]Gauge{"temperature": 23.5},
-		counterData: map[string]Counter{"requests": 100},
-	}
+	storage := newTestStorage(map[string]Gauge{"temperature": 23.5}, map[string]Counter{"requests": 100})
 
 	filePath := "./test_storage.json"
 	defer os.Remove(filePath)
@@ -95,19 +84,21 @@ func TestSaveStorageToFile(t *testing.T) {
 	err := saveStorageToFile(storage, filePath)
 	assert.NoError(t, err, "Ошибка при записи данных в файл")
 
-	fileContent, err := os.ReadFile(filePath)
+	file, err := os.ReadFile(filePath)
 	assert.NoError(t, err, "Ошибка при чтении файла")
+	fileContent, _, err := decodeSnapshot(file)
+	assert.NoError(t, err, "Ошибка при проверке заголовка снимка")
 
 	var metrics AllMetrics
 	err = json.Unmarshal(fileContent, &metrics)
 	assert.NoError(t, err, "Ошибка при разборе JSON из файла")
 
-	assert.Equal(t, storage.counterData, metrics.Counter, "Метрики counter не совпадают")
-	assert.Equal(t, storage.gaugeData, metrics.Gauge, "Метрики gauge не совпадают")
+	assert.Equal(t, map[string]Counter{"requests": 100}, metrics.Counter, "Метрики counter не совпадают")
+	assert.Equal(t, map[string]Gauge{"temperature": 23.5}, metrics.Gauge, "Метрики gauge не совпадают")
 
 	var expectedMetrics AllMetrics
-	expectedMetrics.Counter = storage.counterData
-	expectedMetrics.Gauge = storage.gaugeData
+	expectedMetrics.Counter = metrics.Counter
+	expectedMetrics.Gauge = metrics.Gauge
 	expectedData, _ := json.MarshalIndent(expectedMetrics, "", "   ")
 
 	assert.JSONEq(t, string(expectedData), string(fileContent), "Содержимое файла не соответствует ожидаемому JSON с отступами")
@@ -115,10 +106,7 @@ func TestSaveStorageToFile(t *testing.T) {
 
 func TestDump(t *testing.T) {
 	t.Run("Save data successfully", func(t *testing.T) {
-		storage := &MemStorage{
-			gaugeData:   map[string]Gauge{"temperature": 23.5},
-			counterData: map[string]Counter{"requests": 100},
-		}
+		storage := newTestStorage(map[string]Gauge{"temperature": 23.5}, map[string]Counter{"requests": 100})
 
 		filePath := "./test_storage.json"
 		defer os.Remove(filePath)
@@ -130,11 +118,33 @@ func TestDump(t *testing.T) {
 		assert.NoError(t, err, "error save data in file")
 	})
 
+	t.Run("Continue after save error", func(t *testing.T) {
+		storage := newTestStorage(map[string]Gauge{"temperature": 23.5}, map[string]Counter{"requests": 100})
+
+		// каталог снимка занят файлом, поэтому первые сохранения завершаются ошибкой
+		dir := filepath.Join(t.TempDir(), "data")
+		require.NoError(t, os.WriteFile(dir, nil, 0644))
+		filePath := filepath.Join(dir, "metrics-db.json")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		done := make(chan error, 1)
+		go func() { done <- Dump(ctx, storage, filePath, 1) }()
+
+		time.Sleep(1500 * time.Millisecond)
+		require.NoError(t, os.Remove(dir))
+		require.NoError(t, os.Mkdir(dir, 0755))
+
+		assert.Eventually(t, func() bool {
+			_, err := os.Stat(filePath)
+			return err == nil
+		}, 3*time.Second, 50*time.Millisecond, "dump should keep saving after an error")
+		cancel()
+		assert.NoError(t, <-done)
+	})
+
 	t.Run("Cancel context", func(t *testing.T) {
-		storage := &MemStorage{
-			gaugeData:   map[string]Gauge{"temperature": 23.5},
-			counterData: map[string]Counter{"requests": 100},
-		}
+		storage := newTestStorage(map[string]Gauge{"temperature": 23.5}, map[string]Counter{"requests": 100})
 
 		filePath := "./test_storage.json"
 		defer os.Remove(filePath)
@@ -152,3 +162,10 @@ func TestDump(t *testing.T) {
 		time.Sleep(50 * time.Millisecond)
 	})
 }
+
+func newTestStorage(gauges map[string]Gauge, counters map[string]Counter) *MemStorage {
+	s := newMemStorage()
+	s.UpdateGaugeData(context.Background(), gauges)
+	s.UpdateCounterData(context.Background(), counters)
+	return s
+}
@@ -0,0 +1,50 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+)
+
+// Compact - сворачивает историю серий в агрегаты уровней policy по начало текущего интервала
+// каждого уровня и удаляет значения и агрегаты старше времени хранения их уровня на момент now.
+func (s *MemStorage) Compact(ctx context.Context, now time.Time, policy storage.RetentionPolicy) (int, error) {
+	s.compactMu.Lock()
+	defer s.compactMu.Unlock()
+
+	s.rolledMu.RLock()
+	rolled := s.rolled
+	s.rolledMu.RUnlock()
+
+	until := make(map[time.Duration]time.Time, len(policy))
+	for _, level := range policy.Aggregates() {
+		until[level.Resolution] = storage.BucketStart(now, level.Resolution)
+		// интервал, уже свернутый при прежнем вызове с более поздним now, не сворачивается повторно
+		if rolled[level.Resolution].After(until[level.Resolution]) {
+			until[level.Resolution] = rolled[level.Resolution]
+		}
+	}
+
+	removed := 0
+	for _, sh := range s.shards {
+		sh.mutex.Lock()
+		for key := range sh.history {
+			sh.rollup(key, policy, rolled, until)
+		}
+		for key := range sh.history {
+			removed += sh.retain(key, now, policy)
+		}
+		for key := range sh.aggregates {
+			if _, ok := sh.history[key]; !ok {
+				removed += sh.retain(key, now, policy)
+			}
+		}
+		sh.mutex.Unlock()
+	}
+
+	s.rolledMu.Lock()
+	s.rolled = until
+	s.rolledMu.Unlock()
+	return removed, nil
+}
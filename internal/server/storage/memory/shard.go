@@ -0,0 +1,275 @@
+package memory
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Sofja96/go-metrics.git/internal/models"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+)
+
+// shardCount - количество шардов хранилища. Номера записей журнала в снимке хранятся
+// по шардам, поэтому при изменении значения восстановление из журнала будет неточным.
+const shardCount = 32
+
+// shard - часть хранилища со своей блокировкой. Серия всегда попадает в один и тот же шард
+// по хешу своего ключа, поэтому запросы к разным сериям почти не конкурируют за блокировку.
+type shard struct {
+	mutex      sync.RWMutex
+	gauge      map[string]Gauge
+	counter    map[string]Counter
+	histogram  map[string]*models.Histogram
+	summary    map[string]*models.Summary
+	history    map[string]*ring
+	aggregates map[string]map[time.Duration][]storage.Aggregate // агрегаты истории по разрешению
+	updated    map[string]time.Time
+	walSeq     uint64 // номер последней записи журнала, изменения которой есть в шарде
+}
+
+func newShard() *shard {
+	return &shard{
+		gauge:      make(map[string]Gauge),
+		counter:    make(map[string]Counter),
+		histogram:  make(map[string]*models.Histogram),
+		summary:    make(map[string]*models.Summary),
+		history:    make(map[string]*ring),
+		aggregates: make(map[string]map[time.Duration][]storage.Aggregate),
+		updated:    make(map[string]time.Time),
+	}
+}
+
+// shardIndex - возвращает номер шарда серии key по хешу FNV-1a.
+func shardIndex(key string) int {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return int(h % shardCount)
+}
+
+// checkType - проверяет, что тип метрики поддерживается хранилищем.
+func checkType(mType string) error {
+	switch mType {
+	case gauge, counter, histogram, summary:
+		return nil
+	default:
+		return fmt.Errorf("unsupported metrics type: %s", mType)
+	}
+}
+
+// shard - возвращает шард серии key.
+func (s *MemStorage) shard(key string) *shard {
+	return s.shards[shardIndex(key)]
+}
+
+// lockShards - блокирует на запись шарды серий keys в порядке номеров, чтобы
+// одновременные пачки не взаимоблокировались, и возвращает их.
+func (s *MemStorage) lockShards(keys []string) []*shard {
+	indexes := make([]int, 0, len(keys))
+	seen := make(map[int]bool, len(keys))
+	for _, key := range keys {
+		i := shardIndex(key)
+		if !seen[i] {
+			seen[i] = true
+			indexes = append(indexes, i)
+		}
+	}
+	sort.Ints(indexes)
+
+	shards := make([]*shard, 0, len(indexes))
+	for _, i := range indexes {
+		s.shards[i].mutex.Lock()
+		shards = append(shards, s.shards[i])
+	}
+	return shards
+}
+
+func unlockShards(shards []*shard) {
+	for _, sh := range shards {
+		sh.mutex.Unlock()
+	}
+}
+
+// Методы ниже вызываются под блокировкой шарда на запись.
+
+// updateCounter - увеличивает counter в момент t.
+func (sh *shard) updateCounter(name string, value int64, t time.Time) int64 {
+	sh.counter[name] += Counter(value)
+	sh.record(counter, name, float64(sh.counter[name]), t)
+	sh.touch(counter, name, t)
+	return int64(sh.counter[name])
+}
+
+// updateGauge - устанавливает значение gauge в момент t.
+func (sh *shard) updateGauge(name string, value float64, t time.Time) float64 {
+	sh.gauge[name] = Gauge(value)
+	sh.record(gauge, name, value, t)
+	sh.touch(gauge, name, t)
+	return float64(sh.gauge[name])
+}
+
+// updateHistogram - добавляет наблюдения в гистограмму в момент t.
+func (sh *shard) updateHistogram(name string, bounds, observations []float64, t time.Time) (models.Histogram, error) {
+	h, err := models.ObserveHistogram(sh.histogram[name], bounds, observations)
+	if err != nil {
+		return models.Histogram{}, err
+	}
+	sh.histogram[name] = h
+	sh.touch(histogram, name, t)
+	return h.Clone(), nil
+}
+
+// updateSummary - добавляет наблюдения в summary в момент t.
+func (sh *shard) updateSummary(name string, quantiles, observations []float64, t time.Time) (models.SummaryValue, error) {
+	sm, err := models.ObserveSummary(sh.summary[name], quantiles, observations)
+	if err != nil {
+		return models.SummaryValue{}, err
+	}
+	sh.summary[name] = sm
+	sh.touch(summary, name, t)
+	return sm.Value(), nil
+}
+
+// apply - применяет обновление серии в момент его записи в журнал и для counter возвращает
+// новое значение. У записей журнала прежних версий момента нет, они применяются текущим временем.
+func (sh *shard) apply(u walUpdate) (int64, error) {
+	t := u.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	switch u.Type {
+	case gauge:
+		sh.updateGauge(u.ID, u.Value, t)
+	case counter:
+		return sh.updateCounter(u.ID, u.Delta, t), nil
+	case histogram:
+		_, err := sh.updateHistogram(u.ID, u.Bounds, u.Observations, t)
+		return 0, err
+	case summary:
+		_, err := sh.updateSummary(u.ID, u.Bounds, u.Observations, t)
+		return 0, err
+	default:
+		return 0, fmt.Errorf("unsupported metrics type: %s", u.Type)
+	}
+	return 0, nil
+}
+
+// checkLayouts - проверяет, что обновления histogram и summary пачки updates будут приняты:
+// раскладка новой серии задается ее первым обновлением. Вызывается под блокировкой шардов
+// всех серий пачки до применения обновлений.
+func (s *MemStorage) checkLayouts(updates []walUpdate) error {
+	histograms := make(map[string]*models.Histogram)
+	summaries := make(map[string]*models.Summary)
+	for _, u := range updates {
+		var err error
+		switch u.Type {
+		case histogram:
+			h, ok := histograms[u.ID]
+			if !ok {
+				h = s.shard(u.ID).histogram[u.ID]
+			}
+			if h == nil {
+				h, err = models.NewHistogram(u.Bounds)
+			} else if !h.SameBounds(u.Bounds) {
+				err = models.ErrLayoutMismatch
+			}
+			histograms[u.ID] = h
+		case summary:
+			sm, ok := summaries[u.ID]
+			if !ok {
+				sm = s.shard(u.ID).summary[u.ID]
+			}
+			if sm == nil {
+				sm, err = models.NewSummary(u.Bounds)
+			} else if !sm.SameQuantiles(u.Bounds) {
+				err = models.ErrLayoutMismatch
+			}
+			summaries[u.ID] = sm
+		}
+		if err != nil {
+			return fmt.Errorf("error update %s for batch update: %w", u.Type, err)
+		}
+	}
+	return nil
+}
+
+// has - проверяет наличие серии.
+func (sh *shard) has(mType, key string) (bool, error) {
+	var ok bool
+	switch mType {
+	case gauge:
+		_, ok = sh.gauge[key]
+	case counter:
+		_, ok = sh.counter[key]
+	case histogram:
+		_, ok = sh.histogram[key]
+	case summary:
+		_, ok = sh.summary[key]
+	default:
+		return false, fmt.Errorf("unsupported metrics type: %s", mType)
+	}
+	return ok, nil
+}
+
+// matchKeys - возвращает ключи серий метрики типа mType, для которых match возвращает true.
+func (sh *shard) matchKeys(mType string, match func(sh *shard, key string) bool) ([]string, error) {
+	switch mType {
+	case gauge:
+		return matchingKeys(sh, sh.gauge, match), nil
+	case counter:
+		return matchingKeys(sh, sh.counter, match), nil
+	case histogram:
+		return matchingKeys(sh, sh.histogram, match), nil
+	case summary:
+		return matchingKeys(sh, sh.summary, match), nil
+	default:
+		return nil, fmt.Errorf("unsupported metrics type: %s", mType)
+	}
+}
+
+func matchingKeys[V any](sh *shard, data map[string]V, match func(sh *shard, key string) bool) []string {
+	var keys []string
+	for key := range data {
+		if match(sh, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// remove - удаляет серию вместе с историей.
+func (sh *shard) remove(mType, key string) {
+	switch mType {
+	case gauge:
+		delete(sh.gauge, key)
+	case counter:
+		delete(sh.counter, key)
+	case histogram:
+		delete(sh.histogram, key)
+	case summary:
+		delete(sh.summary, key)
+	}
+	delete(sh.history, historyKey(mType, key))
+	delete(sh.aggregates, historyKey(mType, key))
+	delete(sh.updated, historyKey(mType, key))
+}
+
+// touch - запоминает время обновления серии.
+func (sh *shard) touch(mType, name string, t time.Time) {
+	sh.updated[historyKey(mType, name)] = t
+}
+
+// partition - распределяет серии data по шардам.
+func partition[V any](data map[string]V) [shardCount]map[string]V {
+	var parts [shardCount]map[string]V
+	for i := range parts {
+		parts[i] = make(map[string]V)
+	}
+	for key, v := range data {
+		parts[shardIndex(key)][key] = v
+	}
+	return parts
+}
@@ -0,0 +1,203 @@
+package memory
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// snapshotVersion - версия формата файла снимка. Версия 1 - JSON без заголовка,
+// начиная с версии 2 перед JSON идет строка заголовка с версией и контрольной суммой.
+const snapshotVersion = 2
+
+// snapshotHeader - заголовок файла снимка.
+type snapshotHeader struct {
+	Version   int      `json:"version"`
+	Checksum  string   `json:"checksum"`             // SHA-256 данных после заголовка в hex
+	WALSeq    uint64   `json:"wal_seq,omitempty"`    // номер последней записи журнала, вошедшей в снимок
+	WALShards []uint64 `json:"wal_shards,omitempty"` // номера последних записей журнала, вошедших в снимок каждого шарда
+}
+
+// shardSeqs - возвращает номера последних записей журнала, вошедших в снимок каждого шарда.
+// В снимках без разбивки по шардам все записи до WALSeq считаются вошедшими во все шарды.
+func (h snapshotHeader) shardSeqs() []uint64 {
+	if len(h.WALShards) == shardCount {
+		return h.WALShards
+	}
+	seqs := make([]uint64, shardCount)
+	for i := range seqs {
+		seqs[i] = h.WALSeq
+	}
+	return seqs
+}
+
+// encodeSnapshot - добавляет к данным снимка строку заголовка header с версией и контрольной суммой.
+func encodeSnapshot(data []byte, header snapshotHeader) ([]byte, error) {
+	sum := sha256.Sum256(data)
+	header.Version = snapshotVersion
+	header.Checksum = hex.EncodeToString(sum[:])
+	line, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 0, len(line)+1+len(data))
+	buf = append(buf, line...)
+	buf = append(buf, '\n')
+	return append(buf, data...), nil
+}
+
+// decodeSnapshot - проверяет заголовок и контрольную сумму снимка и возвращает его данные
+// и заголовок. Файл без заголовка считается снимком версии 1 и возвращается целиком.
+func decodeSnapshot(file []byte) ([]byte, snapshotHeader, error) {
+	line, data, ok := bytes.Cut(file, []byte("\n"))
+	var header snapshotHeader
+	if !ok || json.Unmarshal(line, &header) != nil || header.Version == 0 {
+		return file, snapshotHeader{}, nil
+	}
+	if header.Version > snapshotVersion {
+		return nil, snapshotHeader{}, fmt.Errorf("unsupported snapshot version %d", header.Version)
+	}
+
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != header.Checksum {
+		return nil, snapshotHeader{}, fmt.Errorf("snapshot checksum mismatch")
+	}
+	return data, header, nil
+}
+
+// writeSnapshot - атомарно заменяет файл снимка path: данные пишутся во временный файл
+// в том же каталоге, сбрасываются на диск и переименовываются в path. Перед заменой
+// предыдущие снимки сдвигаются в path.1 ... path.<backups>.
+func writeSnapshot(path string, data []byte, backups int, header snapshotHeader) error {
+	data, err := encodeSnapshot(data, header)
+	if err != nil {
+		return fmt.Errorf("error encode snapshot: %w", err)
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("error create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error write temp file: %w", err)
+	}
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("error chmod temp file: %w", err)
+	}
+
+	if err = rotateSnapshots(path, backups); err != nil {
+		return fmt.Errorf("error rotate snapshots: %w", err)
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error rename temp file: %w", err)
+	}
+	return syncDir(dir)
+}
+
+// rotateSnapshots - сдвигает резервные копии снимка path на одну позицию и сохраняет
+// текущий снимок как path.1. Текущий снимок остается на месте до его замены.
+func rotateSnapshots(path string, backups int) error {
+	if backups <= 0 {
+		return nil
+	}
+
+	for i := backups; i > 1; i-- {
+		err := os.Rename(backupPath(path, i-1), backupPath(path, i))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	first := backupPath(path, 1)
+	if err := os.Remove(first); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	err := os.Link(path, first)
+	switch {
+	case err == nil, errors.Is(err, os.ErrNotExist):
+		return nil
+	default:
+		// файловая система без жестких ссылок: снимок переносится, и до переименования
+		// нового снимка восстановление возьмет path.1
+		err = os.Rename(path, first)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+}
+
+// readSnapshot - читает снимок path, а если он отсутствует или поврежден - самую свежую
+// исправную резервную копию. Если исправных снимков нет, возвращает ошибку чтения path.
+// Вместе с данными возвращается заголовок снимка.
+func readSnapshot(path string) (*AllMetrics, snapshotHeader, error) {
+	metrics, header, firstErr := readSnapshotFile(path)
+	if firstErr == nil {
+		return metrics, header, nil
+	}
+
+	for i := 1; ; i++ {
+		backup := backupPath(path, i)
+		metrics, header, err := readSnapshotFile(backup)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, snapshotHeader{}, firstErr
+		}
+		if err != nil {
+			log.Printf("skip snapshot %s: %v", backup, err)
+			continue
+		}
+		log.Printf("snapshot %s is unavailable (%v), restored from %s", path, firstErr, backup)
+		return metrics, header, nil
+	}
+}
+
+func readSnapshotFile(path string) (*AllMetrics, snapshotHeader, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return nil, snapshotHeader{}, fmt.Errorf("error read and load data from file: %w", err)
+	}
+	data, header, err := decodeSnapshot(file)
+	if err != nil {
+		return nil, snapshotHeader{}, fmt.Errorf("error on restoring file %s: %w", path, err)
+	}
+
+	var metrics AllMetrics
+	if err := json.Unmarshal(data, &metrics); err != nil {
+		return nil, snapshotHeader{}, fmt.Errorf("error on restoring file %s: %w", path, err)
+	}
+	return &metrics, header, nil
+}
+
+func backupPath(path string, n int) string {
+	return path + "." + strconv.Itoa(n)
+}
+
+// syncDir - сбрасывает на диск каталог, чтобы переименование файла пережило сбой питания.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("error sync dir: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+)
+
+func TestSnapshotRotation(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics-db.json")
+	s := newMemStorage()
+	s.backups = 2
+
+	for i := 1; i <= 4; i++ {
+		_, err := s.UpdateCounter(ctx, "PollCount", 1)
+		require.NoError(t, err)
+		require.NoError(t, saveStorageToFile(s, path))
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.ElementsMatch(t, []string{"metrics-db.json", "metrics-db.json.1", "metrics-db.json.2"}, names,
+		"only the configured number of backups should be kept and no temp files left")
+
+	for file, want := range map[string]Counter{path: 4, path + ".1": 3, path + ".2": 2} {
+		metrics, _, err := readSnapshotFile(file)
+		require.NoError(t, err)
+		assert.Equal(t, want, metrics.Counter["PollCount"], file)
+	}
+}
+
+func TestSnapshotHistory(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics-db.json")
+	s := newMemStorage()
+
+	for i := 0; i < 3; i++ {
+		_, err := s.UpdateGauge(ctx, "Alloc", float64(i))
+		require.NoError(t, err)
+		_, err = s.UpdateCounter(ctx, "PollCount", 1)
+		require.NoError(t, err)
+	}
+	policy, err := storage.ParseRetention("raw=1h,1m=24h")
+	require.NoError(t, err)
+	_, err = s.Compact(ctx, time.Now().Add(2*time.Minute), policy)
+	require.NoError(t, err)
+	require.NoError(t, saveStorageToFile(s, path))
+
+	restored := newMemStorage()
+	require.NoError(t, LoadStorageFromFile(ctx, restored, path))
+
+	want, err := json.Marshal(s.AllMetrics(ctx))
+	require.NoError(t, err)
+	got, err := json.Marshal(restored.AllMetrics(ctx))
+	require.NoError(t, err)
+	assert.JSONEq(t, string(want), string(got), "history, aggregates and update times should survive a snapshot")
+
+	metrics := restored.AllMetrics(ctx)
+	assert.Len(t, metrics.History[historyKey(gauge, "Alloc")], 3)
+	assert.NotEmpty(t, metrics.Aggregates[historyKey(gauge, "Alloc")][time.Minute])
+	assert.Contains(t, metrics.Updated, historyKey(counter, "PollCount"))
+	assert.Contains(t, metrics.Rolled, time.Minute)
+}
+
+func TestLoadStorageFromFileFallback(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		corrupt func(t *testing.T, path string)
+	}{
+		{
+			name: "Truncated snapshot",
+			corrupt: func(t *testing.T, path string) {
+				data, err := os.ReadFile(path)
+				require.NoError(t, err)
+				require.NoError(t, os.WriteFile(path, data[:len(data)/2], 0644))
+			},
+		},
+		{
+			name: "Checksum mismatch",
+			corrupt: func(t *testing.T, path string) {
+				data, err := encodeSnapshot([]byte(`{"Counter":{"PollCount":1}}`), snapshotHeader{})
+				require.NoError(t, err)
+				data[len(data)-3] = '7'
+				require.NoError(t, os.WriteFile(path, data, 0644))
+			},
+		},
+		{
+			name: "Missing snapshot",
+			corrupt: func(t *testing.T, path string) {
+				require.NoError(t, os.Remove(path))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "metrics-db.json")
+			s := newMemStorage()
+			s.backups = 1
+			_, err := s.UpdateGauge(ctx, "Alloc", 1)
+			require.NoError(t, err)
+			require.NoError(t, saveStorageToFile(s, path))
+			_, err = s.UpdateGauge(ctx, "Alloc", 2)
+			require.NoError(t, err)
+			require.NoError(t, saveStorageToFile(s, path))
+
+			tt.corrupt(t, path)
+
+			restored, err := NewMemStorage(ctx, 0, path, true)
+			require.NoError(t, err)
+			value, ok := restored.GetGaugeValue(ctx, "Alloc")
+			assert.True(t, ok)
+			assert.Equal(t, float64(1), value, "previous snapshot should be restored")
+		})
+	}
+
+	t.Run("All snapshots corrupt", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "metrics-db.json")
+		require.NoError(t, os.WriteFile(path, []byte("{"), 0644))
+		require.NoError(t, os.WriteFile(path+".1", []byte("{"), 0644))
+
+		_, err := NewMemStorage(ctx, 0, path, true)
+		assert.Error(t, err)
+	})
+}
+
+func TestDecodeSnapshot(t *testing.T) {
+	t.Run("Legacy snapshot without header", func(t *testing.T) {
+		legacy := []byte("{\n   \"Counter\": {\"PollCount\": 1}\n}")
+		data, _, err := decodeSnapshot(legacy)
+		assert.NoError(t, err)
+		assert.Equal(t, legacy, data)
+	})
+
+	t.Run("Current version", func(t *testing.T) {
+		encoded, err := encodeSnapshot([]byte(`{"Gauge":{}}`), snapshotHeader{WALSeq: 42})
+		require.NoError(t, err)
+		data, header, err := decodeSnapshot(encoded)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"Gauge":{}}`, string(data))
+		assert.Equal(t, uint64(42), header.WALSeq)
+	})
+
+	t.Run("Unsupported version", func(t *testing.T) {
+		_, _, err := decodeSnapshot([]byte("{\"version\":3,\"checksum\":\"\"}\n{}"))
+		assert.Error(t, err)
+	})
+}
@@ -6,21 +6,47 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/Sofja96/go-metrics.git/internal/models"
 	"github.com/Sofja96/go-metrics.git/internal/server/storage"
 )
 
+const (
+	counter   string = "counter"
+	gauge     string = "gauge"
+	histogram string = "histogram"
+	summary   string = "summary"
+)
+
 type Gauge float64
 type Counter int64
 
+// MemStorage - локальное хранилище метрик. Серии распределены по шардам с отдельными
+// блокировками, поэтому конкурентные обновления разных серий не ждут друг друга.
 type MemStorage struct {
-	gaugeData   map[string]Gauge
-	counterData map[string]Counter
-	mutex       sync.RWMutex
+	shards   [shardCount]*shard
+	backups  int
+	wal      *wal   // nil, если журнал не ведется
+	filePath string // файл снимка; пустой, если снимок не сохраняется периодически
+
+	snapshotMu sync.Mutex // сериализует сохранение снимков
+
+	compactMu sync.Mutex
+	rolledMu  sync.RWMutex
+	rolled    map[time.Duration]time.Time // моменты, по которые свернуты уровни агрегатов истории
 }
 
+var (
+	_ storage.Storage   = (*MemStorage)(nil)
+	_ storage.Ranger    = (*MemStorage)(nil)
+	_ storage.Deleter   = (*MemStorage)(nil)
+	_ storage.Compactor = (*MemStorage)(nil)
+)
+
 func (s *MemStorage) Ping(ctx context.Context) error {
 	return nil
 }
@@ -31,135 +57,602 @@ func NewInMemStorage(ctx context.Context, storeInterval int, filePath string, re
 }
 
 func NewMemStorage(ctx context.Context, storeInterval int, filePath string, restore bool) (*MemStorage, error) {
-	s := &MemStorage{
-		gaugeData:   make(map[string]Gauge),
-		counterData: make(map[string]Counter),
+	return New(ctx, Options{StoreInterval: storeInterval, FilePath: filePath, Restore: restore})
+}
+
+// Options - настройки сохранения локального хранилища в файл.
+type Options struct {
+	StoreInterval int    // интервал сохранения снимка в секундах; 0 - снимок сохраняется только для сжатия журнала
+	FilePath      string // путь к файлу снимка
+	Restore       bool   // восстановить данные из снимка и журнала при создании хранилища
+	Backups       int    // количество хранимых предыдущих снимков, к которым откатывается восстановление
+
+	WALSync         SyncPolicy    // политика сброса журнала упреждающей записи; пустая - журнал не ведется
+	WALSyncInterval time.Duration // период сброса журнала для политики SyncInterval
+}
+
+// compactInterval - период сохранения снимка, в который сжимается журнал, если STORE_INTERVAL равен 0.
+const compactInterval = 60
+
+// newMemStorage - создает пустое хранилище без сохранения в файл.
+func newMemStorage() *MemStorage {
+	s := &MemStorage{}
+	for i := range s.shards {
+		s.shards[i] = newShard()
+	}
+	return s
+}
+
+// New - создает локальное хранилище с настройками opts.
+func New(ctx context.Context, opts Options) (*MemStorage, error) {
+	s := newMemStorage()
+	s.backups = opts.Backups
+
+	var walSeq uint64
+	if opts.Restore {
+		seq, err := loadSnapshot(ctx, s, opts.FilePath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to restore data from file: %w", err)
+		}
+		walSeq = seq
+	} else if opts.WALSync != "" {
+		// записи нового журнала нумеруются после записей, вошедших в прежний снимок,
+		// иначе при следующем восстановлении из этого снимка они были бы пропущены
+		_, header, _ := readSnapshot(opts.FilePath)
+		walSeq = header.WALSeq
 	}
 
-	if restore {
-		err := LoadStorageFromFile(ctx, s, filePath)
+	storeInterval := opts.StoreInterval
+	if opts.WALSync != "" {
+		w, err := openWAL(opts.FilePath, opts.WALSync, opts.Restore, walSeq, s.replay)
 		if err != nil {
-			if !errors.Is(err, os.ErrNotExist) {
-				return nil, fmt.Errorf("failed to restore data from file: %w", err)
+			return nil, fmt.Errorf("failed to open wal: %w", err)
+		}
+		s.wal = w
+
+		if opts.WALSync == SyncInterval {
+			interval := opts.WALSyncInterval
+			if interval <= 0 {
+				interval = DefaultWALSyncInterval
 			}
+			go w.syncEvery(ctx.Done(), interval)
+		}
+		if storeInterval == 0 {
+			storeInterval = compactInterval
 		}
 	}
 
 	if storeInterval != 0 {
+		s.filePath = opts.FilePath
 		go func() {
-			err := Dump(ctx, s, filePath, storeInterval)
+			err := Dump(ctx, s, opts.FilePath, storeInterval)
 			if err != nil {
 				log.Print(err)
 			}
 		}()
 	}
 	return s, nil
-
 }
 
 func (s *MemStorage) UpdateCounter(ctx context.Context, name string, value int64) (int64, error) {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	sh := s.shard(name)
+	sh.mutex.Lock()
+	now := time.Now()
+	seq, err := s.log(walRecord{Updates: []walUpdate{{Type: counter, ID: name, Time: now, Delta: value}}}, sh)
+	if err != nil {
+		sh.mutex.Unlock()
+		return 0, err
+	}
+	result := sh.updateCounter(name, value, now)
+	sh.mutex.Unlock()
 
-	s.counterData[name] += Counter(value)
-	return int64(s.counterData[name]), nil
+	return result, s.commit(seq)
 }
 
 func (s *MemStorage) UpdateGauge(ctx context.Context, name string, value float64) (float64, error) {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	sh := s.shard(name)
+	sh.mutex.Lock()
+	now := time.Now()
+	seq, err := s.log(walRecord{Updates: []walUpdate{{Type: gauge, ID: name, Time: now, Value: value}}}, sh)
+	if err != nil {
+		sh.mutex.Unlock()
+		return 0, err
+	}
+	result := sh.updateGauge(name, value, now)
+	sh.mutex.Unlock()
 
-	s.gaugeData[name] = Gauge(value)
-	return float64(s.gaugeData[name]), nil
+	return result, s.commit(seq)
 }
 
 func (s *MemStorage) GetCounterValue(ctx context.Context, id string) (int64, bool) {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
+	sh := s.shard(id)
+	sh.mutex.RLock()
+	defer sh.mutex.RUnlock()
 
-	val, ok := s.counterData[id]
+	val, ok := sh.counter[id]
 	return int64(val), ok
 }
 
 func (s *MemStorage) GetGaugeValue(ctx context.Context, id string) (float64, bool) {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
+	sh := s.shard(id)
+	sh.mutex.RLock()
+	defer sh.mutex.RUnlock()
 
-	_, ok := s.gaugeData[id]
-	return float64(s.gaugeData[id]), ok
+	val, ok := sh.gauge[id]
+	return float64(val), ok
 }
 
+// AllMetrics - данные хранилища. Вместе со значениями серий сохраняются их история,
+// агрегаты истории и время последнего обновления, от которого отсчитывается время жизни.
 type AllMetrics struct {
-	Gauge   map[string]Gauge
-	Counter map[string]Counter
+	Gauge      map[string]Gauge
+	Counter    map[string]Counter
+	Histogram  map[string]*models.Histogram                     `json:",omitempty"`
+	Summary    map[string]*models.Summary                       `json:",omitempty"`
+	History    map[string][]storage.Sample                      `json:",omitempty"` // по ключу historyKey
+	Aggregates map[string]map[time.Duration][]storage.Aggregate `json:",omitempty"` // по ключу historyKey и разрешению
+	Updated    map[string]time.Time                             `json:",omitempty"` // по ключу historyKey
+	Rolled     map[time.Duration]time.Time                      `json:",omitempty"` // моменты, по которые свернуты уровни агрегатов
 }
 
+// AllMetrics - возвращает копию всех метрик хранилища.
 func (s *MemStorage) AllMetrics(ctx context.Context) *AllMetrics {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
+	metrics, _ := s.snapshot()
+	return metrics
+}
+
+// snapshot - копирует данные хранилища. Шарды копируются по очереди, и блокируется только
+// копируемый шард, поэтому запись в остальные продолжается. Вместе с копией возвращаются
+// номера последних записей журнала, вошедших в копию каждого шарда.
+func (s *MemStorage) snapshot() (*AllMetrics, []uint64) {
+	metrics := &AllMetrics{
+		Gauge:      make(map[string]Gauge),
+		Counter:    make(map[string]Counter),
+		Histogram:  make(map[string]*models.Histogram),
+		Summary:    make(map[string]*models.Summary),
+		History:    make(map[string][]storage.Sample),
+		Aggregates: make(map[string]map[time.Duration][]storage.Aggregate),
+		Updated:    make(map[string]time.Time),
+	}
+	walSeqs := make([]uint64, shardCount)
+
+	for i, sh := range s.shards {
+		sh.mutex.RLock()
+		for key, v := range sh.gauge {
+			metrics.Gauge[key] = v
+		}
+		for key, v := range sh.counter {
+			metrics.Counter[key] = v
+		}
+		for key, h := range sh.histogram {
+			c := h.Clone()
+			metrics.Histogram[key] = &c
+		}
+		for key, sm := range sh.summary {
+			c := sm.Clone()
+			metrics.Summary[key] = &c
+		}
+		for key, r := range sh.history {
+			metrics.History[key] = append([]storage.Sample(nil), r.ordered()...)
+		}
+		for key, levels := range sh.aggregates {
+			c := make(map[time.Duration][]storage.Aggregate, len(levels))
+			for resolution, aggregates := range levels {
+				c[resolution] = append([]storage.Aggregate(nil), aggregates...)
+			}
+			metrics.Aggregates[key] = c
+		}
+		for key, t := range sh.updated {
+			metrics.Updated[key] = t
+		}
+		walSeqs[i] = sh.walSeq
+		sh.mutex.RUnlock()
+	}
 
-	return &AllMetrics{
-		Gauge:   s.gaugeData,
-		Counter: s.counterData,
+	s.rolledMu.RLock()
+	if len(s.rolled) != 0 {
+		metrics.Rolled = make(map[time.Duration]time.Time, len(s.rolled))
+		for resolution, t := range s.rolled {
+			metrics.Rolled[resolution] = t
+		}
 	}
+	s.rolledMu.RUnlock()
+	return metrics, walSeqs
 }
 
-func (s *MemStorage) UpdateGaugeData(ctx context.Context, gaugeData map[string]Gauge) {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+// restoreHistory - заменяет историю, агрегаты и время обновления серий данными снимка.
+func (s *MemStorage) restoreHistory(data *AllMetrics) {
+	for _, sh := range s.shards {
+		sh.mutex.Lock()
+		sh.history = make(map[string]*ring)
+		sh.aggregates = make(map[string]map[time.Duration][]storage.Aggregate)
+		sh.updated = make(map[string]time.Time)
+		sh.mutex.Unlock()
+	}
 
-	s.gaugeData = gaugeData
+	for key, samples := range data.History {
+		if len(samples) > historySize {
+			samples = samples[len(samples)-historySize:]
+		}
+		r := newRing(historySize)
+		r.samples = samples
+		sh := s.historyShard(key)
+		sh.mutex.Lock()
+		sh.history[key] = r
+		sh.mutex.Unlock()
+	}
+	for key, levels := range data.Aggregates {
+		sh := s.historyShard(key)
+		sh.mutex.Lock()
+		sh.aggregates[key] = levels
+		sh.mutex.Unlock()
+	}
+	for key, t := range data.Updated {
+		sh := s.historyShard(key)
+		sh.mutex.Lock()
+		sh.updated[key] = t
+		sh.mutex.Unlock()
+	}
+
+	s.rolledMu.Lock()
+	s.rolled = data.Rolled
+	s.rolledMu.Unlock()
+}
+
+// historyShard - возвращает шард серии по ключу ее истории historyKey.
+func (s *MemStorage) historyShard(key string) *shard {
+	_, name, _ := strings.Cut(key, "/")
+	return s.shard(name)
+}
+
+func (s *MemStorage) UpdateGaugeData(ctx context.Context, gaugeData map[string]Gauge) {
+	for i, part := range partition(gaugeData) {
+		sh := s.shards[i]
+		sh.mutex.Lock()
+		sh.gauge = part
+		sh.mutex.Unlock()
+	}
 }
 
 func (s *MemStorage) UpdateCounterData(ctx context.Context, counterData map[string]Counter) {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	for i, part := range partition(counterData) {
+		sh := s.shards[i]
+		sh.mutex.Lock()
+		sh.counter = part
+		sh.mutex.Unlock()
+	}
+}
 
-	s.counterData = counterData
+// UpdateHistogramData - заменяет все метрики типа histogram.
+func (s *MemStorage) UpdateHistogramData(ctx context.Context, histogramData map[string]*models.Histogram) {
+	for i, part := range partition(histogramData) {
+		sh := s.shards[i]
+		sh.mutex.Lock()
+		sh.histogram = part
+		sh.mutex.Unlock()
+	}
 }
 
-func (s *MemStorage) GetAllGauges(ctx context.Context) ([]storage.GaugeMetric, error) {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
+// UpdateSummaryData - заменяет все метрики типа summary.
+func (s *MemStorage) UpdateSummaryData(ctx context.Context, summaryData map[string]*models.Summary) {
+	for i, part := range partition(summaryData) {
+		sh := s.shards[i]
+		sh.mutex.Lock()
+		sh.summary = part
+		sh.mutex.Unlock()
+	}
+}
 
-	gauges := make([]storage.GaugeMetric, 0, len(s.gaugeData))
-	for name, value := range s.gaugeData {
-		gauges = append(gauges, storage.GaugeMetric{Name: name, Value: float64(value)})
+func (s *MemStorage) GetAllGauges(ctx context.Context) ([]storage.GaugeMetric, error) {
+	gauges := make([]storage.GaugeMetric, 0)
+	for _, sh := range s.shards {
+		sh.mutex.RLock()
+		for key, value := range sh.gauge {
+			name, labels := models.ParseSeriesKey(key)
+			gauges = append(gauges, storage.GaugeMetric{Name: name, Labels: labels, Value: float64(value)})
+		}
+		sh.mutex.RUnlock()
 	}
 	return gauges, nil
 }
 
 // GetAllCounters returns all counter metrics.
 func (s *MemStorage) GetAllCounters(ctx context.Context) ([]storage.CounterMetric, error) {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
-
-	counters := make([]storage.CounterMetric, 0, len(s.counterData))
-	for name, value := range s.counterData {
-		counters = append(counters, storage.CounterMetric{Name: name, Value: int64(value)})
+	counters := make([]storage.CounterMetric, 0)
+	for _, sh := range s.shards {
+		sh.mutex.RLock()
+		for key, value := range sh.counter {
+			name, labels := models.ParseSeriesKey(key)
+			counters = append(counters, storage.CounterMetric{Name: name, Labels: labels, Value: int64(value)})
+		}
+		sh.mutex.RUnlock()
 	}
 
 	return counters, nil
 }
 
+// BatchUpdate - обновляет метрики пачкой. Шарды всех серий пачки блокируются на время
+// обновления, а обновления проверяются и записываются в журнал одной записью до применения.
+// Пачка применяется целиком или не применяется вовсе. В Delta метрик counter записываются
+// значения серий, в Histogram и Summary - новые состояния.
 func (s *MemStorage) BatchUpdate(ctx context.Context, metrics []models.Metrics) error {
+	updates := make([]walUpdate, 0, len(metrics))
+	keys := make([]string, 0, len(metrics))
 	for _, v := range metrics {
+		u := walUpdate{Type: v.MType, ID: v.SeriesKey(), Observations: v.Observations}
 		switch v.MType {
-		case "gauge":
-			_, err := s.UpdateGauge(ctx, v.ID, *v.Value)
-			if err != nil {
-				return fmt.Errorf("error update gauge for batch update: %v", err)
+		case gauge:
+			if v.Value == nil {
+				return fmt.Errorf("gauge %s has no value", v.ID)
 			}
-		case "counter":
-			val, err := s.UpdateCounter(ctx, v.ID, *v.Delta)
-			if err != nil {
-				return fmt.Errorf("error update counter for batch update: %v", err)
+			u.Value = *v.Value
+		case counter:
+			if v.Delta == nil {
+				return fmt.Errorf("counter %s has no delta", v.ID)
 			}
-			*v.Delta = val
+			u.Delta = *v.Delta
+		case histogram:
+			u.Bounds = v.Buckets
+		case summary:
+			u.Bounds = v.Quantiles
 		default:
 			return fmt.Errorf("unsupported metrics type: %s", v.MType)
+		}
+		updates = append(updates, u)
+		keys = append(keys, u.ID)
+	}
 
+	shards := s.lockShards(keys)
+	// время обновления берется под блокировкой, чтобы история серии шла по возрастанию времени
+	now := time.Now()
+	for i := range updates {
+		updates[i].Time = now
+	}
+	if err := s.checkLayouts(updates); err != nil {
+		unlockShards(shards)
+		return err
+	}
+	seq, err := s.log(walRecord{Updates: updates}, shards...)
+	if err != nil {
+		unlockShards(shards)
+		return err
+	}
+	// после checkLayouts обновления пачки применяются без ошибок
+	for i, u := range updates {
+		sh := s.shard(u.ID)
+		val, _ := sh.apply(u)
+		switch u.Type {
+		case counter:
+			*metrics[i].Delta = val
+		case histogram:
+			h := sh.histogram[u.ID].Clone()
+			metrics[i].Histogram = &h
+		case summary:
+			v := sh.summary[u.ID].Value()
+			metrics[i].Summary = &v
 		}
 	}
-	return nil
+	unlockShards(shards)
+
+	return s.commit(seq)
+}
+
+// replay - применяет запись журнала при восстановлении. Изменения шардов, в снимок
+// которых запись уже вошла, пропускаются.
+func (s *MemStorage) replay(rec walRecord) {
+	keys := make([]string, 0, len(rec.Updates)+len(rec.Deleted))
+	for _, u := range rec.Updates {
+		keys = append(keys, u.ID)
+	}
+	for _, d := range rec.Deleted {
+		keys = append(keys, d.ID)
+	}
+	shards := s.lockShards(keys)
+	defer unlockShards(shards)
+
+	stale := make(map[*shard]bool, len(shards))
+	for _, sh := range shards {
+		stale[sh] = rec.Seq <= sh.walSeq
+	}
+
+	for _, u := range rec.Updates {
+		sh := s.shard(u.ID)
+		if stale[sh] {
+			continue
+		}
+		if _, err := sh.apply(u); err != nil {
+			log.Printf("error replay wal record %d: %v", rec.Seq, err)
+		}
+	}
+	for _, d := range rec.Deleted {
+		if sh := s.shard(d.ID); !stale[sh] {
+			sh.remove(d.Type, d.ID)
+		}
+	}
+	for _, sh := range shards {
+		if !stale[sh] {
+			sh.walSeq = rec.Seq
+		}
+	}
+}
+
+// log - записывает в журнал изменения шардов shards до их применения и возвращает
+// номер записи. Вызывается под блокировкой этих шардов на запись, поэтому записи об
+// изменениях одной серии следуют в журнале в порядке их применения. Если запись
+// не удалась, изменения не применяются.
+func (s *MemStorage) log(rec walRecord, shards ...*shard) (uint64, error) {
+	if s.wal == nil {
+		return 0, nil
+	}
+	seq, err := s.wal.append(rec)
+	if err != nil {
+		return 0, err
+	}
+	for _, sh := range shards {
+		sh.walSeq = seq
+	}
+	return seq, nil
+}
+
+// commit - ждет сброса записи журнала seq на диск. Вызывается без блокировки шардов.
+func (s *MemStorage) commit(seq uint64) error {
+	if s.wal == nil || seq == 0 {
+		return nil
+	}
+	return s.wal.wait(seq)
+}
+
+// GetRange - возвращает историю значений метрики за интервал [from, to] с шагом step.
+func (s *MemStorage) GetRange(ctx context.Context, name, mType string, from, to time.Time, step time.Duration) ([]storage.Sample, error) {
+	if mType != gauge && mType != counter {
+		return nil, fmt.Errorf("unsupported metrics type: %s", mType)
+	}
+
+	sh := s.shard(name)
+	sh.mutex.RLock()
+	defer sh.mutex.RUnlock()
+
+	key := historyKey(mType, name)
+	r, aggregates := sh.history[key], sh.aggregates[key]
+	if r == nil && aggregates == nil {
+		return []storage.Sample{}, nil
+	}
+
+	s.rolledMu.RLock()
+	defer s.rolledMu.RUnlock()
+
+	return storage.ReadRange(from, to, step, s.rolled, func(resolution time.Duration, from, to time.Time) ([]storage.Sample, error) {
+		samples := make([]storage.Sample, 0)
+		if resolution == storage.RawResolution {
+			if r != nil {
+				samples = r.between(from, to.Add(-time.Nanosecond))
+			}
+			return samples, nil
+		}
+		for _, a := range aggregates[resolution] {
+			if !a.Timestamp.Before(from) && a.Timestamp.Before(to) {
+				samples = append(samples, a.Sample(mType))
+			}
+		}
+		return samples, nil
+	})
+}
+
+// UpdateHistogram - добавляет наблюдения в гистограмму, создавая ее с границами bounds.
+func (s *MemStorage) UpdateHistogram(ctx context.Context, name string, bounds, observations []float64) (models.Histogram, error) {
+	sh := s.shard(name)
+	u := walUpdate{Type: histogram, ID: name, Bounds: bounds, Observations: observations}
+	sh.mutex.Lock()
+	u.Time = time.Now()
+	err := s.checkLayouts([]walUpdate{u})
+	var seq uint64
+	if err == nil {
+		seq, err = s.log(walRecord{Updates: []walUpdate{u}}, sh)
+	}
+	var h models.Histogram
+	if err == nil {
+		h, err = sh.updateHistogram(name, bounds, observations, u.Time)
+	}
+	sh.mutex.Unlock()
+	if err != nil {
+		return models.Histogram{}, err
+	}
+
+	return h, s.commit(seq)
+}
+
+// UpdateSummary - добавляет наблюдения в summary, создавая его с квантилями quantiles.
+func (s *MemStorage) UpdateSummary(ctx context.Context, name string, quantiles, observations []float64) (models.SummaryValue, error) {
+	sh := s.shard(name)
+	u := walUpdate{Type: summary, ID: name, Bounds: quantiles, Observations: observations}
+	sh.mutex.Lock()
+	u.Time = time.Now()
+	err := s.checkLayouts([]walUpdate{u})
+	var seq uint64
+	if err == nil {
+		seq, err = s.log(walRecord{Updates: []walUpdate{u}}, sh)
+	}
+	var value models.SummaryValue
+	if err == nil {
+		value, err = sh.updateSummary(name, quantiles, observations, u.Time)
+	}
+	sh.mutex.Unlock()
+	if err != nil {
+		return models.SummaryValue{}, err
+	}
+
+	return value, s.commit(seq)
+}
+
+// GetHistogram - возвращает гистограмму по идентификатору серии.
+func (s *MemStorage) GetHistogram(ctx context.Context, id string) (models.Histogram, bool) {
+	sh := s.shard(id)
+	sh.mutex.RLock()
+	defer sh.mutex.RUnlock()
+
+	h, ok := sh.histogram[id]
+	if !ok {
+		return models.Histogram{}, false
+	}
+	return h.Clone(), true
+}
+
+// GetSummary - возвращает значения summary по идентификатору серии.
+func (s *MemStorage) GetSummary(ctx context.Context, id string) (models.SummaryValue, bool) {
+	sh := s.shard(id)
+	sh.mutex.RLock()
+	defer sh.mutex.RUnlock()
+
+	sm, ok := sh.summary[id]
+	if !ok {
+		return models.SummaryValue{}, false
+	}
+	return sm.Value(), true
+}
+
+// GetAllHistograms - возвращает все метрики типа histogram.
+func (s *MemStorage) GetAllHistograms(ctx context.Context) ([]storage.HistogramMetric, error) {
+	histograms := make([]storage.HistogramMetric, 0)
+	for _, sh := range s.shards {
+		sh.mutex.RLock()
+		for key, h := range sh.histogram {
+			name, labels := models.ParseSeriesKey(key)
+			histograms = append(histograms, storage.HistogramMetric{Name: name, Labels: labels, Value: h.Clone()})
+		}
+		sh.mutex.RUnlock()
+	}
+	return histograms, nil
+}
+
+// GetAllSummaries - возвращает все метрики типа summary.
+func (s *MemStorage) GetAllSummaries(ctx context.Context) ([]storage.SummaryMetric, error) {
+	summaries := make([]storage.SummaryMetric, 0)
+	for _, sh := range s.shards {
+		sh.mutex.RLock()
+		for key, sm := range sh.summary {
+			name, labels := models.ParseSeriesKey(key)
+			summaries = append(summaries, storage.SummaryMetric{Name: name, Labels: labels, Value: sm.Value()})
+		}
+		sh.mutex.RUnlock()
+	}
+	return summaries, nil
+}
+
+// ListSeries - возвращает отсортированные идентификаторы серий метрики типа mType с именем name.
+func (s *MemStorage) ListSeries(ctx context.Context, mType, name string) ([]string, error) {
+	if err := checkType(mType); err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0)
+	for _, sh := range s.shards {
+		sh.mutex.RLock()
+		matched, _ := sh.matchKeys(mType, func(_ *shard, key string) bool {
+			seriesName, _ := models.SplitSeriesKey(key)
+			return seriesName == name
+		})
+		sh.mutex.RUnlock()
+		keys = append(keys, matched...)
+	}
+	sort.Strings(keys)
+	return keys, nil
 }
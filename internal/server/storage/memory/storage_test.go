@@ -5,12 +5,15 @@ import (
 	"fmt"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/Sofja96/go-metrics.git/internal/models"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
 	storagemock "github.com/Sofja96/go-metrics.git/internal/server/storage/mocks"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage/storagetest"
 )
 
 func TestUpdateCounter(t *testing.T) {
@@ -120,6 +123,72 @@ func TestGetAllGauges(t *testing.T) {
 	assert.Len(t, gauges, 2)
 }
 
+func TestGetAllGaugesWithLabels(t *testing.T) {
+	ctx := context.Background()
+	s, _ := NewMemStorage(ctx, 300, "", false)
+	_, err := s.UpdateGauge(ctx, `HeapAlloc{host="agent-1"}`, 10.5)
+	assert.NoError(t, err)
+	_, err = s.UpdateGauge(ctx, `HeapAlloc{host="agent-2"}`, 20.5)
+	assert.NoError(t, err)
+
+	gauges, err := s.GetAllGauges(ctx)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []storage.GaugeMetric{
+		{Name: "HeapAlloc", Labels: map[string]string{"host": "agent-1"}, Value: 10.5},
+		{Name: "HeapAlloc", Labels: map[string]string{"host": "agent-2"}, Value: 20.5},
+	}, gauges)
+}
+
+func TestUpdateHistogram(t *testing.T) {
+	ctx := context.Background()
+	s, _ := NewMemStorage(ctx, 300, "", false)
+
+	h, err := s.UpdateHistogram(ctx, "latency", []float64{1, 5}, []float64{0.5, 3})
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{1, 1, 0}, h.Counts)
+
+	h, err = s.UpdateHistogram(ctx, "latency", nil, []float64{10})
+	assert.NoError(t, err)
+	assert.Equal(t, models.Histogram{Bounds: []float64{1, 5}, Counts: []uint64{1, 1, 1}, Count: 3, Sum: 13.5}, h)
+
+	_, err = s.UpdateHistogram(ctx, "latency", []float64{1, 10}, []float64{1})
+	assert.ErrorIs(t, err, models.ErrLayoutMismatch)
+
+	got, ok := s.GetHistogram(ctx, "latency")
+	assert.True(t, ok)
+	assert.Equal(t, h, got)
+
+	histograms, err := s.GetAllHistograms(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []storage.HistogramMetric{{Name: "latency", Value: h}}, histograms)
+}
+
+func TestUpdateSummary(t *testing.T) {
+	ctx := context.Background()
+	s, _ := NewMemStorage(ctx, 300, "", false)
+
+	_, err := s.UpdateSummary(ctx, "size", []float64{0.5}, []float64{1, 2, 3})
+	assert.NoError(t, err)
+	value, err := s.UpdateSummary(ctx, "size", nil, []float64{4})
+	assert.NoError(t, err)
+	assert.Equal(t, models.SummaryValue{
+		Quantiles: []models.Quantile{{Quantile: 0.5, Value: 2}},
+		Count:     4,
+		Sum:       10,
+	}, value)
+
+	_, err = s.UpdateSummary(ctx, "size", []float64{0.9}, []float64{1})
+	assert.ErrorIs(t, err, models.ErrLayoutMismatch)
+
+	got, ok := s.GetSummary(ctx, "size")
+	assert.True(t, ok)
+	assert.Equal(t, value, got)
+
+	summaries, err := s.GetAllSummaries(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []storage.SummaryMetric{{Name: "size", Value: value}}, summaries)
+}
+
 func TestGetAllMetrics(t *testing.T) {
 	ctx := context.Background()
 	s, _ := NewMemStorage(ctx, 300, "", false)
@@ -164,10 +233,7 @@ func TestUpdateGaugeData(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			s.UpdateGaugeData(ctx, test.inputData)
 
-			s.mutex.Lock()
-			defer s.mutex.Unlock()
-
-			assert.Equal(t, test.expected, s.gaugeData)
+			assert.Equal(t, test.expected, s.AllMetrics(ctx).Gauge)
 		})
 	}
 }
@@ -197,10 +263,7 @@ func TestUpdateCounterData(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			s.UpdateCounterData(ctx, test.inputData)
 
-			s.mutex.Lock()
-			defer s.mutex.Unlock()
-
-			assert.Equal(t, test.expected, s.counterData)
+			assert.Equal(t, test.expected, s.AllMetrics(ctx).Counter)
 		})
 	}
 }
@@ -297,6 +360,210 @@ func TestBatchUpdate_Mock(t *testing.T) {
 
 }
 
+func TestGetRange(t *testing.T) {
+	ctx := context.Background()
+	s, _ := NewMemStorage(ctx, 0, "", false)
+
+	from := time.Now().Add(-time.Minute)
+	for i := 1; i <= 3; i++ {
+		_, err := s.UpdateGauge(ctx, "HeapInuse", float64(i))
+		assert.NoError(t, err)
+		_, err = s.UpdateCounter(ctx, "PollCount", 1)
+		assert.NoError(t, err)
+	}
+	to := time.Now().Add(time.Minute)
+
+	t.Run("Gauge history", func(t *testing.T) {
+		samples, err := s.GetRange(ctx, "HeapInuse", "gauge", from, to, 0)
+		assert.NoError(t, err)
+		assert.Len(t, samples, 3)
+		for i, sample := range samples {
+			assert.Equal(t, float64(i+1), sample.Value)
+		}
+	})
+
+	t.Run("Counter history keeps accumulated values", func(t *testing.T) {
+		samples, err := s.GetRange(ctx, "PollCount", "counter", from, to, 0)
+		assert.NoError(t, err)
+		assert.Len(t, samples, 3)
+		assert.Equal(t, float64(3), samples[2].Value)
+	})
+
+	t.Run("Step keeps last value per interval", func(t *testing.T) {
+		samples, err := s.GetRange(ctx, "HeapInuse", "gauge", from, to, time.Hour)
+		assert.NoError(t, err)
+		assert.Len(t, samples, 1)
+		assert.Equal(t, float64(3), samples[0].Value)
+		assert.Equal(t, from, samples[0].Timestamp)
+	})
+
+	t.Run("Interval without samples", func(t *testing.T) {
+		samples, err := s.GetRange(ctx, "HeapInuse", "gauge", to, to.Add(time.Minute), 0)
+		assert.NoError(t, err)
+		assert.Empty(t, samples)
+	})
+
+	t.Run("Unknown metric", func(t *testing.T) {
+		samples, err := s.GetRange(ctx, "unknown", "gauge", from, to, 0)
+		assert.NoError(t, err)
+		assert.Empty(t, samples)
+	})
+
+	t.Run("Unsupported type", func(t *testing.T) {
+		_, err := s.GetRange(ctx, "HeapInuse", "unknown", from, to, 0)
+		assert.Error(t, err)
+	})
+}
+
+func TestDelete(t *testing.T) {
+	ctx := context.Background()
+	s, _ := NewMemStorage(ctx, 0, "", false)
+
+	_, err := s.UpdateGauge(ctx, "HeapInuse", 1)
+	assert.NoError(t, err)
+	_, err = s.UpdateCounter(ctx, "HeapInuse", 1)
+	assert.NoError(t, err)
+	_, err = s.UpdateHistogram(ctx, "latency", []float64{1}, []float64{0.5})
+	assert.NoError(t, err)
+
+	ok, err := s.Delete(ctx, gauge, "HeapInuse")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	_, found := s.GetGaugeValue(ctx, "HeapInuse")
+	assert.False(t, found)
+	_, found = s.GetCounterValue(ctx, "HeapInuse")
+	assert.True(t, found, "series of other types should be kept")
+
+	samples, err := s.GetRange(ctx, "HeapInuse", gauge, time.Time{}, time.Now(), 0)
+	assert.NoError(t, err)
+	assert.Empty(t, samples, "history should be deleted with the series")
+
+	ok, err = s.Delete(ctx, gauge, "HeapInuse")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = s.Delete(ctx, histogram, "latency")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	_, err = s.Delete(ctx, "unknown", "HeapInuse")
+	assert.Error(t, err)
+}
+
+func TestDeleteByPrefix(t *testing.T) {
+	ctx := context.Background()
+	s, _ := NewMemStorage(ctx, 0, "", false)
+
+	for _, name := range []string{"HeapAlloc", `HeapInuse{host="agent-1"}`, "Alloc"} {
+		_, err := s.UpdateGauge(ctx, name, 1)
+		assert.NoError(t, err)
+	}
+	_, err := s.UpdateCounter(ctx, "HeapCount", 1)
+	assert.NoError(t, err)
+	_, err = s.UpdateSummary(ctx, "HeapPause", []float64{0.5}, []float64{1})
+	assert.NoError(t, err)
+
+	deleted, err := s.DeleteByPrefix(ctx, gauge, "Heap")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []storage.SeriesID{
+		{Type: gauge, ID: "HeapAlloc"},
+		{Type: gauge, ID: `HeapInuse{host="agent-1"}`},
+	}, deleted)
+
+	gauges, err := s.GetAllGauges(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []storage.GaugeMetric{{Name: "Alloc", Value: 1}}, gauges)
+
+	deleted, err = s.DeleteByPrefix(ctx, "", "Heap")
+	assert.NoError(t, err)
+	assert.Equal(t, []storage.SeriesID{{Type: counter, ID: "HeapCount"}, {Type: summary, ID: "HeapPause"}}, deleted)
+
+	_, err = s.DeleteByPrefix(ctx, "unknown", "Heap")
+	assert.Error(t, err)
+}
+
+func TestDeleteExpired(t *testing.T) {
+	ctx := context.Background()
+	s, _ := NewMemStorage(ctx, 0, "", false)
+
+	_, err := s.UpdateGauge(ctx, "Alloc", 1)
+	assert.NoError(t, err)
+	_, err = s.UpdateGauge(ctx, "HeapAlloc", 1)
+	assert.NoError(t, err)
+	_, err = s.UpdateCounter(ctx, "PollCount", 1)
+	assert.NoError(t, err)
+
+	ttl := storage.TTLRules{
+		{TTL: time.Hour},
+		{Prefix: "Heap", TTL: 2 * time.Hour},
+		{Prefix: "PollCount"},
+	}.TTL
+
+	deleted, err := s.DeleteExpired(ctx, time.Now(), ttl)
+	assert.NoError(t, err)
+	assert.Empty(t, deleted)
+
+	deleted, err = s.DeleteExpired(ctx, time.Now().Add(90*time.Minute), ttl)
+	assert.NoError(t, err)
+	assert.Equal(t, []storage.SeriesID{{Type: gauge, ID: "Alloc"}}, deleted)
+	_, ok := s.GetGaugeValue(ctx, "Alloc")
+	assert.False(t, ok)
+	_, ok = s.GetGaugeValue(ctx, "HeapAlloc")
+	assert.True(t, ok)
+
+	t.Run("Update resets ttl", func(t *testing.T) {
+		_, err := s.UpdateGauge(ctx, "HeapAlloc", 2)
+		assert.NoError(t, err)
+
+		deleted, err := s.DeleteExpired(ctx, time.Now().Add(90*time.Minute), ttl)
+		assert.NoError(t, err)
+		assert.Empty(t, deleted)
+	})
+
+	t.Run("Zero ttl keeps series", func(t *testing.T) {
+		_, err := s.DeleteExpired(ctx, time.Now().Add(24*time.Hour), ttl)
+		assert.NoError(t, err)
+		_, ok := s.GetCounterValue(ctx, "PollCount")
+		assert.True(t, ok)
+	})
+
+	t.Run("Restored series expire after first check", func(t *testing.T) {
+		s.UpdateGaugeData(ctx, map[string]Gauge{"Restored": 1})
+
+		now := time.Now().Add(24 * time.Hour)
+		deleted, err := s.DeleteExpired(ctx, now, ttl)
+		assert.NoError(t, err)
+		assert.Empty(t, deleted)
+
+		deleted, err = s.DeleteExpired(ctx, now.Add(time.Hour), ttl)
+		assert.NoError(t, err)
+		assert.Equal(t, []storage.SeriesID{{Type: gauge, ID: "Restored"}}, deleted)
+	})
+}
+
+func TestRingOverflow(t *testing.T) {
+	r := newRing(3)
+	assert.Zero(t, cap(r.samples), "ring should not allocate before the first sample")
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		r.add(storage.Sample{Timestamp: start.Add(time.Duration(i) * time.Second), Value: float64(i)})
+		assert.LessOrEqual(t, len(r.samples), 3)
+	}
+
+	samples := r.between(start, start.Add(time.Minute))
+	assert.Len(t, samples, 3)
+	assert.Equal(t, []float64{2, 3, 4}, []float64{samples[0].Value, samples[1].Value, samples[2].Value})
+
+	// после удаления старых значений буфер снова растет до size
+	assert.Equal(t, 2, r.dropBefore(start.Add(4*time.Second)))
+	for i := 5; i < 8; i++ {
+		r.add(storage.Sample{Timestamp: start.Add(time.Duration(i) * time.Second), Value: float64(i)})
+	}
+	samples = r.between(start, start.Add(time.Minute))
+	assert.Equal(t, []float64{5, 6, 7}, []float64{samples[0].Value, samples[1].Value, samples[2].Value})
+}
+
 func floatPtr(f float64) *float64 {
 	return &f
 }
@@ -393,3 +660,9 @@ func TestNewInMemStorage(t *testing.T) {
 		assert.Nil(t, s)
 	})
 }
+
+func TestStorageSuite(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return newMemStorage()
+	})
+}
@@ -0,0 +1,82 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+)
+
+// Scheme - схема URL локального хранилища, например
+// memory://?file=/tmp/metrics-db.json&store_interval=300&restore=true.
+const Scheme = "memory"
+
+func init() {
+	storage.Register(Scheme, func(ctx context.Context, u *url.URL) (storage.Storage, error) {
+		opts, err := OptionsFromURL(u)
+		if err != nil {
+			return nil, err
+		}
+		return New(ctx, opts)
+	})
+}
+
+// OptionsFromURL - разбирает настройки хранилища из параметров URL: store_interval (секунды),
+// file, restore, backups, wal_sync и wal_sync_interval. Без параметров хранилище не сохраняется в файл.
+func OptionsFromURL(u *url.URL) (Options, error) {
+	var opts Options
+	for key, values := range u.Query() {
+		value := values[len(values)-1]
+		var err error
+		switch key {
+		case "store_interval":
+			opts.StoreInterval, err = strconv.Atoi(value)
+		case "file":
+			opts.FilePath = value
+		case "restore":
+			opts.Restore, err = strconv.ParseBool(value)
+		case "backups":
+			opts.Backups, err = strconv.Atoi(value)
+		case "wal_sync":
+			opts.WALSync, err = ParseSyncPolicy(value)
+		case "wal_sync_interval":
+			opts.WALSyncInterval, err = time.ParseDuration(value)
+		default:
+			return Options{}, fmt.Errorf("unknown memory storage parameter %q", key)
+		}
+		if err != nil {
+			return Options{}, fmt.Errorf("invalid memory storage parameter %s: %w", key, err)
+		}
+	}
+
+	if opts.FilePath == "" && (opts.StoreInterval != 0 || opts.Restore || opts.WALSync != "") {
+		return Options{}, fmt.Errorf("memory storage parameters store_interval, restore and wal_sync require file")
+	}
+	return opts, nil
+}
+
+// URL - возвращает URL локального хранилища с настройками opts.
+func (opts Options) URL() string {
+	q := url.Values{}
+	if opts.FilePath != "" {
+		q.Set("file", opts.FilePath)
+		q.Set("store_interval", strconv.Itoa(opts.StoreInterval))
+		q.Set("restore", strconv.FormatBool(opts.Restore))
+	}
+	if opts.Backups != 0 {
+		q.Set("backups", strconv.Itoa(opts.Backups))
+	}
+	if opts.WALSync != "" {
+		q.Set("wal_sync", string(opts.WALSync))
+	}
+	if opts.WALSyncInterval != 0 {
+		q.Set("wal_sync_interval", opts.WALSyncInterval.String())
+	}
+	if len(q) == 0 {
+		return Scheme + "://"
+	}
+	return Scheme + "://?" + q.Encode()
+}
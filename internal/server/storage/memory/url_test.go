@@ -0,0 +1,111 @@
+package memory
+
+import (
+	"context"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+)
+
+func TestOptionsFromURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		want    Options
+		wantErr bool
+	}{
+		{
+			name: "Without parameters",
+			url:  "memory://",
+		},
+		{
+			name: "All parameters",
+			url:  "memory://?file=/tmp/metrics-db.json&store_interval=0&restore=true&backups=3&wal_sync=batch&wal_sync_interval=2s",
+			want: Options{
+				FilePath:        "/tmp/metrics-db.json",
+				Restore:         true,
+				Backups:         3,
+				WALSync:         SyncBatch,
+				WALSyncInterval: 2 * time.Second,
+			},
+		},
+		{
+			name:    "Unknown parameter",
+			url:     "memory://?file=/tmp/metrics-db.json&interval=10",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid store interval",
+			url:     "memory://?file=/tmp/metrics-db.json&store_interval=often",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid wal sync policy",
+			url:     "memory://?file=/tmp/metrics-db.json&wal_sync=sometimes",
+			wantErr: true,
+		},
+		{
+			name:    "Restore without file",
+			url:     "memory://?restore=true",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			require.NoError(t, err)
+
+			opts, err := OptionsFromURL(u)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, opts)
+		})
+	}
+}
+
+func TestOptionsURL(t *testing.T) {
+	opts := Options{
+		StoreInterval:   300,
+		FilePath:        "/tmp/metrics db.json",
+		Restore:         true,
+		Backups:         2,
+		WALSync:         SyncInterval,
+		WALSyncInterval: time.Second,
+	}
+
+	u, err := url.Parse(opts.URL())
+	require.NoError(t, err)
+	assert.Equal(t, Scheme, u.Scheme)
+	parsed, err := OptionsFromURL(u)
+	require.NoError(t, err)
+	assert.Equal(t, opts, parsed)
+
+	assert.Equal(t, "memory://", Options{}.URL())
+}
+
+func TestOpenURL(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	path := filepath.Join(t.TempDir(), "metrics-db.json")
+
+	s, err := storage.Open(ctx, Options{FilePath: path, WALSync: SyncAlways}.URL())
+	require.NoError(t, err)
+	_, err = s.UpdateCounter(ctx, "PollCount", 2)
+	require.NoError(t, err)
+
+	restored, err := storage.Open(ctx, Options{FilePath: path, Restore: true, WALSync: SyncAlways}.URL())
+	require.NoError(t, err)
+	v, ok := restored.GetCounterValue(ctx, "PollCount")
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), v)
+}
@@ -0,0 +1,413 @@
+package memory
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyncPolicy - политика сброса журнала упреждающей записи (WAL) на диск.
+type SyncPolicy string
+
+const (
+	// SyncAlways - fsync после каждой записи, до ответа клиенту.
+	SyncAlways SyncPolicy = "always"
+	// SyncBatch - записи конкурентных запросов сбрасываются одним fsync, каждый запрос ждет сброса своей записи.
+	SyncBatch SyncPolicy = "batch"
+	// SyncInterval - fsync по таймеру; при сбое теряются записи последнего интервала.
+	SyncInterval SyncPolicy = "interval"
+)
+
+// DefaultWALSyncInterval - период сброса журнала для политики SyncInterval по умолчанию.
+const DefaultWALSyncInterval = time.Second
+
+// walHeaderSize - размер заголовка записи журнала: длина данных и их CRC-32C.
+const walHeaderSize = 8
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// errWALClosed - журнал закрыт и не принимает записи.
+var errWALClosed = errors.New("wal is closed")
+
+// ParseSyncPolicy - разбирает политику сброса журнала. Пустая строка означает, что журнал не ведется.
+func ParseSyncPolicy(s string) (SyncPolicy, error) {
+	switch p := SyncPolicy(s); p {
+	case "", SyncAlways, SyncBatch, SyncInterval:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown wal sync policy %q, expected always, batch or interval", s)
+	}
+}
+
+// walRecord - запись журнала: обновления и удаления серий одного вызова хранилища.
+type walRecord struct {
+	Seq     uint64      `json:"seq"`
+	Updates []walUpdate `json:"updates,omitempty"`
+	Deleted []walSeries `json:"deleted,omitempty"`
+}
+
+// walUpdate - обновление серии ID метрики типа Type в момент Time. При восстановлении
+// из журнала момент обновления попадает в историю серии и в отсчет ее времени жизни.
+type walUpdate struct {
+	Type         string    `json:"type"`
+	ID           string    `json:"id"`
+	Time         time.Time `json:"time"`
+	Delta        int64     `json:"delta,omitempty"`
+	Value        float64   `json:"value,omitempty"`
+	Bounds       []float64 `json:"bounds,omitempty"` // границы корзин histogram или квантили summary
+	Observations []float64 `json:"observations,omitempty"`
+}
+
+// walSeries - удаленная серия.
+type walSeries struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// wal - журнал упреждающей записи. Журнал состоит из сегментов <path>.wal.<n>: записи
+// дописываются в последний сегмент, а при сохранении снимка открывается новый сегмент,
+// и предыдущие удаляются после того, как снимок записан на диск.
+type wal struct {
+	path   string
+	policy SyncPolicy
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	file    *os.File
+	segment int
+	seq     uint64 // номер последней записанной записи
+	synced  uint64 // номер последней записи, сброшенной на диск
+	syncing bool
+	err     error // ошибка записи; после нее журнал не принимает записи
+}
+
+// openWAL - открывает журнал снимка path. Если restore, записи журнала передаются в apply
+// по порядку, а apply пропускает уже вошедшие в снимок; иначе прежние сегменты удаляются.
+// Новые записи нумеруются после fromSeq и последней записи журнала. Поврежденный хвост
+// журнала, например недописанная при сбое запись, отбрасывается.
+func openWAL(path string, policy SyncPolicy, restore bool, fromSeq uint64, apply func(walRecord)) (*wal, error) {
+	w := &wal{path: path, policy: policy, seq: fromSeq}
+	w.cond = sync.NewCond(&w.mu)
+
+	segments, err := w.segments()
+	if err != nil {
+		return nil, err
+	}
+
+	if restore {
+		for i, n := range segments {
+			ok, err := w.replay(n, apply)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				for _, rest := range segments[i+1:] {
+					log.Printf("drop wal segment %s after corrupted record", w.segmentPath(rest))
+					_ = os.Remove(w.segmentPath(rest))
+				}
+				segments = segments[:i+1]
+				break
+			}
+		}
+	} else {
+		for _, n := range segments {
+			if err := os.Remove(w.segmentPath(n)); err != nil {
+				return nil, fmt.Errorf("error remove wal segment: %w", err)
+			}
+		}
+		segments = nil
+	}
+
+	w.segment = 1
+	if len(segments) != 0 {
+		w.segment = segments[len(segments)-1] + 1
+	}
+	if err := w.openSegment(); err != nil {
+		return nil, err
+	}
+	w.synced = w.seq
+	return w, nil
+}
+
+// segments - возвращает номера существующих сегментов по возрастанию.
+func (w *wal) segments() ([]int, error) {
+	matches, err := filepath.Glob(w.path + ".wal.*")
+	if err != nil {
+		return nil, fmt.Errorf("error list wal segments: %w", err)
+	}
+
+	segments := make([]int, 0, len(matches))
+	for _, m := range matches {
+		n, err := strconv.Atoi(strings.TrimPrefix(m, w.path+".wal."))
+		if err != nil {
+			continue
+		}
+		segments = append(segments, n)
+	}
+	sort.Ints(segments)
+	return segments, nil
+}
+
+func (w *wal) segmentPath(n int) string {
+	return w.path + ".wal." + strconv.Itoa(n)
+}
+
+func (w *wal) openSegment() error {
+	f, err := os.OpenFile(w.segmentPath(w.segment), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("error open wal segment: %w", err)
+	}
+	w.file = f
+	return syncDir(filepath.Dir(w.path))
+}
+
+// replay - применяет записи сегмента n. Возвращает false, если сегмент поврежден:
+// он обрезается по последней целой записи.
+func (w *wal) replay(n int, apply func(walRecord)) (bool, error) {
+	path := w.segmentPath(n)
+	f, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("error open wal segment: %w", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		rec, size, err := readRecord(r)
+		if errors.Is(err, io.EOF) {
+			return true, nil
+		}
+		if err != nil {
+			log.Printf("wal segment %s is corrupted at offset %d: %v", path, offset, err)
+			if err := os.Truncate(path, offset); err != nil {
+				return false, fmt.Errorf("error truncate wal segment: %w", err)
+			}
+			return false, nil
+		}
+		offset += size
+
+		apply(rec)
+		w.seq = max(w.seq, rec.Seq)
+	}
+}
+
+// readRecord - читает запись журнала и возвращает ее размер вместе с заголовком.
+// На конце журнала возвращает io.EOF.
+func readRecord(r io.Reader) (walRecord, int64, error) {
+	var header [walHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return walRecord{}, 0, fmt.Errorf("truncated record header")
+		}
+		return walRecord{}, 0, err
+	}
+
+	size := binary.LittleEndian.Uint32(header[:4])
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return walRecord{}, 0, fmt.Errorf("truncated record: %w", err)
+	}
+	if crc32.Checksum(payload, crcTable) != binary.LittleEndian.Uint32(header[4:]) {
+		return walRecord{}, 0, fmt.Errorf("record checksum mismatch")
+	}
+
+	var rec walRecord
+	if err := json.Unmarshal(payload, &rec); err != nil {
+		return walRecord{}, 0, fmt.Errorf("error decode record: %w", err)
+	}
+	return rec, walHeaderSize + int64(size), nil
+}
+
+// append - дописывает запись в журнал и возвращает ее номер. При политике SyncAlways
+// запись сбрасывается на диск до возврата, иначе нужно дождаться ее сброса через wait.
+// Вызывается под блокировкой шардов изменяемых серий, поэтому записи об изменениях
+// одной серии следуют в порядке их применения.
+func (w *wal) append(rec walRecord) (uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	rec.Seq = w.seq + 1
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return 0, fmt.Errorf("error encode wal record: %w", err)
+	}
+	frame := make([]byte, walHeaderSize, walHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(frame[:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(frame[4:], crc32.Checksum(payload, crcTable))
+	frame = append(frame, payload...)
+
+	if _, err := w.file.Write(frame); err != nil {
+		w.err = fmt.Errorf("error write wal: %w", err)
+		return 0, w.err
+	}
+	w.seq = rec.Seq
+
+	if w.policy == SyncAlways {
+		if err := w.file.Sync(); err != nil {
+			w.err = fmt.Errorf("error sync wal: %w", err)
+			return 0, w.err
+		}
+		w.synced = w.seq
+	}
+	return w.seq, nil
+}
+
+// wait - ждет, пока запись seq будет сброшена на диск, если этого требует политика.
+func (w *wal) wait(seq uint64) error {
+	if w.policy != SyncBatch {
+		return nil
+	}
+	return w.syncTo(seq)
+}
+
+// syncTo - сбрасывает журнал на диск, пока не будет сброшена запись seq. Одновременные
+// вызовы объединяются: один выполняет fsync за всех, остальные ждут его результата.
+func (w *wal) syncTo(seq uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for w.synced < seq {
+		if w.err != nil {
+			return w.err
+		}
+		if w.syncing {
+			w.cond.Wait()
+			continue
+		}
+
+		w.syncing = true
+		target, f := w.seq, w.file
+		w.mu.Unlock()
+		err := f.Sync()
+		w.mu.Lock()
+		w.syncing = false
+		if err != nil && w.err == nil {
+			w.err = fmt.Errorf("error sync wal: %w", err)
+		}
+		if err == nil && target > w.synced {
+			w.synced = target
+		}
+		w.cond.Broadcast()
+	}
+	return w.err
+}
+
+// sync - сбрасывает на диск все записанные записи.
+func (w *wal) sync() error {
+	w.mu.Lock()
+	seq := w.seq
+	w.mu.Unlock()
+	return w.syncTo(seq)
+}
+
+// syncEvery - сбрасывает журнал с периодом interval до отмены контекста.
+func (w *wal) syncEvery(done <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			if err := w.sync(); err != nil && !errors.Is(err, errWALClosed) {
+				log.Print(err)
+			}
+			return
+		case <-ticker.C:
+			if err := w.sync(); err != nil && !errors.Is(err, errWALClosed) {
+				log.Print(err)
+			}
+		}
+	}
+}
+
+// rotate - сбрасывает текущий сегмент на диск и открывает следующий. Возвращает номер
+// последней записи и номер нового сегмента. Вызывается перед снятием снимка: все записи
+// прежних сегментов уже применены к шардам и попадут в снимок.
+func (w *wal) rotate() (uint64, int, error) {
+	if err := w.sync(); err != nil {
+		return 0, 0, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for w.syncing {
+		w.cond.Wait()
+	}
+	if w.err != nil {
+		return 0, 0, w.err
+	}
+	if err := w.file.Sync(); err != nil {
+		w.err = fmt.Errorf("error sync wal: %w", err)
+		return 0, 0, w.err
+	}
+	w.synced = w.seq
+	if err := w.file.Close(); err != nil {
+		w.err = fmt.Errorf("error close wal segment: %w", err)
+		return 0, 0, w.err
+	}
+
+	w.segment++
+	if err := w.openSegment(); err != nil {
+		w.err = err
+		return 0, 0, err
+	}
+	return w.seq, w.segment, nil
+}
+
+// close - сбрасывает журнал на диск и закрывает текущий сегмент. После закрытия журнал
+// не принимает записи.
+func (w *wal) close() error {
+	if err := w.sync(); err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for w.syncing {
+		w.cond.Wait()
+	}
+	if w.err != nil {
+		return w.err
+	}
+	w.err = errWALClosed
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("error close wal segment: %w", err)
+	}
+	return nil
+}
+
+// removeBefore - удаляет сегменты с номерами меньше segment, записи которых уже есть в снимке.
+func (w *wal) removeBefore(segment int) error {
+	segments, err := w.segments()
+	if err != nil {
+		return err
+	}
+	for _, n := range segments {
+		if n >= segment {
+			break
+		}
+		if err := os.Remove(w.segmentPath(n)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("error remove wal segment: %w", err)
+		}
+	}
+	return nil
+}
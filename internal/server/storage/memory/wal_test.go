@@ -0,0 +1,374 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Sofja96/go-metrics.git/internal/models"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+)
+
+func openWALStorage(t *testing.T, path string, policy SyncPolicy, restore bool) *MemStorage {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	s, err := New(ctx, Options{StoreInterval: 300, FilePath: path, Restore: restore, WALSync: policy})
+	require.NoError(t, err)
+	return s
+}
+
+func walSegments(t *testing.T, path string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(path + ".wal.*")
+	require.NoError(t, err)
+	return matches
+}
+
+func TestWALReplay(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics-db.json")
+
+	s := openWALStorage(t, path, SyncAlways, true)
+	for i := 0; i < 3; i++ {
+		_, err := s.UpdateCounter(ctx, "PollCount", 2)
+		require.NoError(t, err)
+	}
+	_, err := s.UpdateGauge(ctx, "Alloc", 1.5)
+	require.NoError(t, err)
+	_, err = s.UpdateGauge(ctx, "Heap", 7)
+	require.NoError(t, err)
+	delta, value := int64(4), 2.5
+	require.NoError(t, s.BatchUpdate(ctx, []models.Metrics{
+		{ID: "PollCount", MType: counter, Delta: &delta},
+		{ID: "Alloc", MType: gauge, Value: &value},
+	}))
+	_, err = s.UpdateHistogram(ctx, "Latency", []float64{1, 5}, []float64{0.5, 3})
+	require.NoError(t, err)
+	ok, err := s.Delete(ctx, gauge, "Heap")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	restored := openWALStorage(t, path, SyncAlways, true)
+	pollCount, ok := restored.GetCounterValue(ctx, "PollCount")
+	assert.True(t, ok)
+	assert.Equal(t, int64(10), pollCount)
+	alloc, ok := restored.GetGaugeValue(ctx, "Alloc")
+	assert.True(t, ok)
+	assert.Equal(t, 2.5, alloc)
+	_, ok = restored.GetGaugeValue(ctx, "Heap")
+	assert.False(t, ok, "deleted series should stay deleted after replay")
+	h, ok := restored.GetHistogram(ctx, "Latency")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(2), h.Count)
+}
+
+func TestWALReplayTimestamps(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics-db.json")
+
+	s := openWALStorage(t, path, SyncAlways, true)
+	for i := 0; i < 3; i++ {
+		_, err := s.UpdateGauge(ctx, "Alloc", float64(i))
+		require.NoError(t, err)
+	}
+	_, err := s.UpdateHistogram(ctx, "Latency", []float64{1, 5}, []float64{0.5})
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+
+	unixNano := func(samples []storage.Sample) []int64 {
+		result := make([]int64, 0, len(samples))
+		for _, sample := range samples {
+			result = append(result, sample.Timestamp.UnixNano())
+		}
+		return result
+	}
+	from, to := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	want, err := s.GetRange(ctx, "Alloc", gauge, from, to, 0)
+	require.NoError(t, err)
+	require.Len(t, want, 3)
+
+	restored := openWALStorage(t, path, SyncAlways, true)
+	got, err := restored.GetRange(ctx, "Alloc", gauge, from, to, 0)
+	require.NoError(t, err)
+	assert.Equal(t, unixNano(want), unixNano(got), "replayed history should keep the original timestamps")
+
+	updated := func(s *MemStorage, mType, name string) int64 {
+		sh := s.shard(name)
+		sh.mutex.RLock()
+		defer sh.mutex.RUnlock()
+		return sh.updated[historyKey(mType, name)].UnixNano()
+	}
+	assert.Equal(t, updated(s, gauge, "Alloc"), updated(restored, gauge, "Alloc"), "replay should not reset the ttl")
+	assert.Equal(t, updated(s, histogram, "Latency"), updated(restored, histogram, "Latency"), "replay should not reset the ttl")
+}
+
+func TestClose(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics-db.json")
+
+	s := openWALStorage(t, path, SyncInterval, true)
+	_, err := s.UpdateCounter(ctx, "PollCount", 3)
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	// при закрытии сохраняется снимок, и журнал сжимается
+	metrics, _, err := readSnapshotFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, Counter(3), metrics.Counter["PollCount"])
+	_, err = s.UpdateCounter(ctx, "PollCount", 1)
+	assert.ErrorIs(t, err, errWALClosed)
+
+	restored := openWALStorage(t, path, SyncAlways, true)
+	pollCount, _ := restored.GetCounterValue(ctx, "PollCount")
+	assert.Equal(t, int64(3), pollCount)
+}
+
+func TestWALCompaction(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics-db.json")
+
+	s := openWALStorage(t, path, SyncAlways, true)
+	for i := 0; i < 5; i++ {
+		_, err := s.UpdateCounter(ctx, "PollCount", 1)
+		require.NoError(t, err)
+	}
+	require.NoError(t, saveStorageToFile(s, path))
+	assert.Equal(t, []string{path + ".wal.2"}, walSegments(t, path),
+		"segments folded into the snapshot should be removed")
+
+	_, err := s.UpdateCounter(ctx, "PollCount", 1)
+	require.NoError(t, err)
+
+	restored := openWALStorage(t, path, SyncAlways, true)
+	pollCount, ok := restored.GetCounterValue(ctx, "PollCount")
+	assert.True(t, ok)
+	assert.Equal(t, int64(6), pollCount, "records already in the snapshot must not be applied twice")
+
+	t.Run("Lost segment removal", func(t *testing.T) {
+		// сбой между записью снимка и удалением сегментов: старые записи уже есть в снимке
+		_, err := restored.UpdateCounter(ctx, "PollCount", 1)
+		require.NoError(t, err)
+		data, err := os.ReadFile(path + ".wal.3")
+		require.NoError(t, err)
+		require.NoError(t, saveStorageToFile(restored, path))
+		require.NoError(t, os.WriteFile(path+".wal.3", data, 0644))
+
+		again := openWALStorage(t, path, SyncAlways, true)
+		pollCount, ok := again.GetCounterValue(ctx, "PollCount")
+		assert.True(t, ok)
+		assert.Equal(t, int64(7), pollCount)
+	})
+}
+
+func TestWALCorruptedTail(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics-db.json")
+
+	s := openWALStorage(t, path, SyncAlways, true)
+	for i := 0; i < 3; i++ {
+		_, err := s.UpdateCounter(ctx, "PollCount", 1)
+		require.NoError(t, err)
+	}
+
+	// недописанная при сбое запись
+	f, err := os.OpenFile(path+".wal.1", os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{42, 0, 0, 0, 1, 2, 3, 4, '{', '"'})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	restored := openWALStorage(t, path, SyncAlways, true)
+	pollCount, ok := restored.GetCounterValue(ctx, "PollCount")
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), pollCount)
+
+	_, err = restored.UpdateCounter(ctx, "PollCount", 1)
+	require.NoError(t, err)
+
+	again := openWALStorage(t, path, SyncAlways, true)
+	pollCount, ok = again.GetCounterValue(ctx, "PollCount")
+	assert.True(t, ok)
+	assert.Equal(t, int64(4), pollCount, "records written after the truncated tail should be replayed")
+}
+
+func TestWALConcurrentWriters(t *testing.T) {
+	ctx := context.Background()
+
+	for _, policy := range []SyncPolicy{SyncAlways, SyncBatch, SyncInterval} {
+		t.Run(string(policy), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "metrics-db.json")
+			s := openWALStorage(t, path, policy, true)
+
+			var wg sync.WaitGroup
+			for w := 0; w < 8; w++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < 50; i++ {
+						_, err := s.UpdateCounter(ctx, "PollCount", 1)
+						assert.NoError(t, err)
+					}
+				}()
+			}
+			wg.Wait()
+			require.NoError(t, s.wal.sync())
+
+			restored := openWALStorage(t, path, policy, true)
+			pollCount, ok := restored.GetCounterValue(ctx, "PollCount")
+			assert.True(t, ok)
+			assert.Equal(t, int64(400), pollCount)
+		})
+	}
+}
+
+func TestWALSnapshotDuringWrites(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics-db.json")
+	s := openWALStorage(t, path, SyncBatch, true)
+
+	const writers, updates = 8, 200
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < updates; i++ {
+				_, err := s.UpdateCounter(ctx, fmt.Sprintf("Counter%d", i%16), 1)
+				assert.NoError(t, err)
+				delta := int64(1)
+				assert.NoError(t, s.BatchUpdate(ctx, []models.Metrics{
+					{ID: "Batch", MType: counter, Delta: &delta},
+					{ID: fmt.Sprintf("Writer%d", w), MType: counter, Delta: &delta},
+				}))
+			}
+		}(w)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 5; i++ {
+			assert.NoError(t, saveStorageToFile(s, path))
+		}
+	}()
+	wg.Wait()
+	<-done
+
+	restored := openWALStorage(t, path, SyncBatch, true)
+	var total int64
+	for i := 0; i < 16; i++ {
+		v, _ := restored.GetCounterValue(ctx, fmt.Sprintf("Counter%d", i))
+		total += v
+	}
+	assert.Equal(t, int64(writers*updates), total, "snapshot and log replay should count every update exactly once")
+	batch, _ := restored.GetCounterValue(ctx, "Batch")
+	assert.Equal(t, int64(writers*updates), batch)
+	for w := 0; w < writers; w++ {
+		v, _ := restored.GetCounterValue(ctx, fmt.Sprintf("Writer%d", w))
+		assert.Equal(t, int64(updates), v)
+	}
+}
+
+func TestWALWithoutRestore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics-db.json")
+
+	s := openWALStorage(t, path, SyncAlways, true)
+	_, err := s.UpdateCounter(ctx, "PollCount", 1)
+	require.NoError(t, err)
+	require.NoError(t, saveStorageToFile(s, path))
+	_, err = s.UpdateCounter(ctx, "PollCount", 1)
+	require.NoError(t, err)
+
+	fresh := openWALStorage(t, path, SyncAlways, false)
+	_, ok := fresh.GetCounterValue(ctx, "PollCount")
+	assert.False(t, ok)
+	_, err = fresh.UpdateCounter(ctx, "Other", 1)
+	require.NoError(t, err)
+
+	restored := openWALStorage(t, path, SyncAlways, true)
+	pollCount, _ := restored.GetCounterValue(ctx, "PollCount")
+	assert.Equal(t, int64(1), pollCount, "old log should be discarded without restore")
+	other, ok := restored.GetCounterValue(ctx, "Other")
+	assert.True(t, ok, "records of the new log should be replayed over the old snapshot")
+	assert.Equal(t, int64(1), other)
+}
+
+func TestParseSyncPolicy(t *testing.T) {
+	for _, s := range []string{"", "always", "batch", "interval"} {
+		policy, err := ParseSyncPolicy(s)
+		assert.NoError(t, err)
+		assert.Equal(t, SyncPolicy(s), policy)
+	}
+
+	_, err := ParseSyncPolicy("sometimes")
+	assert.Error(t, err)
+}
+
+func TestWALAppendFailure(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics-db.json")
+
+	s := openWALStorage(t, path, SyncAlways, true)
+	_, err := s.UpdateCounter(ctx, "PollCount", 2)
+	require.NoError(t, err)
+	_, err = s.UpdateGauge(ctx, "Alloc", 1.5)
+	require.NoError(t, err)
+
+	// ошибка записи журнала: изменения не должны примениться
+	s.wal.mu.Lock()
+	require.NoError(t, s.wal.file.Close())
+	s.wal.mu.Unlock()
+
+	_, err = s.UpdateCounter(ctx, "PollCount", 3)
+	assert.Error(t, err)
+	_, err = s.UpdateGauge(ctx, "Alloc", 7)
+	assert.Error(t, err)
+	delta, value := int64(4), 2.5
+	assert.Error(t, s.BatchUpdate(ctx, []models.Metrics{
+		{ID: "PollCount", MType: counter, Delta: &delta},
+		{ID: "Alloc", MType: gauge, Value: &value},
+	}))
+	_, err = s.UpdateHistogram(ctx, "Latency", nil, []float64{0.5})
+	assert.Error(t, err)
+	_, err = s.UpdateSummary(ctx, "Duration", nil, []float64{0.5})
+	assert.Error(t, err)
+	_, err = s.Delete(ctx, gauge, "Alloc")
+	assert.Error(t, err)
+
+	pollCount, _ := s.GetCounterValue(ctx, "PollCount")
+	assert.Equal(t, int64(2), pollCount)
+	alloc, ok := s.GetGaugeValue(ctx, "Alloc")
+	assert.True(t, ok)
+	assert.Equal(t, 1.5, alloc)
+	_, ok = s.GetHistogram(ctx, "Latency")
+	assert.False(t, ok)
+	_, ok = s.GetSummary(ctx, "Duration")
+	assert.False(t, ok)
+}
+
+func TestBatchUpdateAtomic(t *testing.T) {
+	ctx := context.Background()
+	s := openWALStorage(t, filepath.Join(t.TempDir(), "metrics-db.json"), SyncAlways, true)
+	_, err := s.UpdateHistogram(ctx, "Latency", []float64{1, 5}, []float64{0.5})
+	require.NoError(t, err)
+
+	// несовпадающие границы последней серии отклоняют всю пачку
+	delta := int64(4)
+	err = s.BatchUpdate(ctx, []models.Metrics{
+		{ID: "PollCount", MType: counter, Delta: &delta},
+		{ID: "Latency", MType: histogram, Buckets: []float64{2}, Observations: []float64{1}},
+	})
+	assert.ErrorIs(t, err, models.ErrLayoutMismatch)
+	_, ok := s.GetCounterValue(ctx, "PollCount")
+	assert.False(t, ok)
+}
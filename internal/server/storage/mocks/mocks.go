@@ -7,6 +7,7 @@ package mock_storage
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 
@@ -81,6 +82,36 @@ func (mr *MockStorageMockRecorder) GetAllGauges(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllGauges", reflect.TypeOf((*MockStorage)(nil).GetAllGauges), arg0)
 }
 
+// GetAllHistograms mocks base method.
+func (m *MockStorage) GetAllHistograms(arg0 context.Context) ([]storage.HistogramMetric, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAllHistograms", arg0)
+	ret0, _ := ret[0].([]storage.HistogramMetric)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAllHistograms indicates an expected call of GetAllHistograms.
+func (mr *MockStorageMockRecorder) GetAllHistograms(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllHistograms", reflect.TypeOf((*MockStorage)(nil).GetAllHistograms), arg0)
+}
+
+// GetAllSummaries mocks base method.
+func (m *MockStorage) GetAllSummaries(arg0 context.Context) ([]storage.SummaryMetric, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAllSummaries", arg0)
+	ret0, _ := ret[0].([]storage.SummaryMetric)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAllSummaries indicates an expected call of GetAllSummaries.
+func (mr *MockStorageMockRecorder) GetAllSummaries(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllSummaries", reflect.TypeOf((*MockStorage)(nil).GetAllSummaries), arg0)
+}
+
 // GetCounterValue mocks base method.
 func (m *MockStorage) GetCounterValue(ctx context.Context, id string) (int64, bool) {
 	m.ctrl.T.Helper()
@@ -111,6 +142,51 @@ func (mr *MockStorageMockRecorder) GetGaugeValue(ctx, id interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGaugeValue", reflect.TypeOf((*MockStorage)(nil).GetGaugeValue), ctx, id)
 }
 
+// GetHistogram mocks base method.
+func (m *MockStorage) GetHistogram(ctx context.Context, id string) (models.Histogram, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetHistogram", ctx, id)
+	ret0, _ := ret[0].(models.Histogram)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// GetHistogram indicates an expected call of GetHistogram.
+func (mr *MockStorageMockRecorder) GetHistogram(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHistogram", reflect.TypeOf((*MockStorage)(nil).GetHistogram), ctx, id)
+}
+
+// GetSummary mocks base method.
+func (m *MockStorage) GetSummary(ctx context.Context, id string) (models.SummaryValue, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSummary", ctx, id)
+	ret0, _ := ret[0].(models.SummaryValue)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// GetSummary indicates an expected call of GetSummary.
+func (mr *MockStorageMockRecorder) GetSummary(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSummary", reflect.TypeOf((*MockStorage)(nil).GetSummary), ctx, id)
+}
+
+// ListSeries mocks base method.
+func (m *MockStorage) ListSeries(ctx context.Context, mType, name string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListSeries", ctx, mType, name)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListSeries indicates an expected call of ListSeries.
+func (mr *MockStorageMockRecorder) ListSeries(ctx, mType, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListSeries", reflect.TypeOf((*MockStorage)(nil).ListSeries), ctx, mType, name)
+}
+
 // Ping mocks base method.
 func (m *MockStorage) Ping(arg0 context.Context) error {
 	m.ctrl.T.Helper()
@@ -154,3 +230,177 @@ func (mr *MockStorageMockRecorder) UpdateGauge(ctx, name, value interface{}) *go
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateGauge", reflect.TypeOf((*MockStorage)(nil).UpdateGauge), ctx, name, value)
 }
+
+// UpdateHistogram mocks base method.
+func (m *MockStorage) UpdateHistogram(ctx context.Context, name string, bounds, observations []float64) (models.Histogram, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateHistogram", ctx, name, bounds, observations)
+	ret0, _ := ret[0].(models.Histogram)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateHistogram indicates an expected call of UpdateHistogram.
+func (mr *MockStorageMockRecorder) UpdateHistogram(ctx, name, bounds, observations interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateHistogram", reflect.TypeOf((*MockStorage)(nil).UpdateHistogram), ctx, name, bounds, observations)
+}
+
+// UpdateSummary mocks base method.
+func (m *MockStorage) UpdateSummary(ctx context.Context, name string, quantiles, observations []float64) (models.SummaryValue, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateSummary", ctx, name, quantiles, observations)
+	ret0, _ := ret[0].(models.SummaryValue)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateSummary indicates an expected call of UpdateSummary.
+func (mr *MockStorageMockRecorder) UpdateSummary(ctx, name, quantiles, observations interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateSummary", reflect.TypeOf((*MockStorage)(nil).UpdateSummary), ctx, name, quantiles, observations)
+}
+
+// MockRanger is a mock of Ranger interface.
+type MockRanger struct {
+	ctrl     *gomock.Controller
+	recorder *MockRangerMockRecorder
+}
+
+// MockRangerMockRecorder is the mock recorder for MockRanger.
+type MockRangerMockRecorder struct {
+	mock *MockRanger
+}
+
+// NewMockRanger creates a new mock instance.
+func NewMockRanger(ctrl *gomock.Controller) *MockRanger {
+	mock := &MockRanger{ctrl: ctrl}
+	mock.recorder = &MockRangerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRanger) EXPECT() *MockRangerMockRecorder {
+	return m.recorder
+}
+
+// GetRange mocks base method.
+func (m *MockRanger) GetRange(ctx context.Context, name, mType string, from, to time.Time, step time.Duration) ([]storage.Sample, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRange", ctx, name, mType, from, to, step)
+	ret0, _ := ret[0].([]storage.Sample)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRange indicates an expected call of GetRange.
+func (mr *MockRangerMockRecorder) GetRange(ctx, name, mType, from, to, step interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRange", reflect.TypeOf((*MockRanger)(nil).GetRange), ctx, name, mType, from, to, step)
+}
+
+// MockDeleter is a mock of Deleter interface.
+type MockDeleter struct {
+	ctrl     *gomock.Controller
+	recorder *MockDeleterMockRecorder
+}
+
+// MockDeleterMockRecorder is the mock recorder for MockDeleter.
+type MockDeleterMockRecorder struct {
+	mock *MockDeleter
+}
+
+// NewMockDeleter creates a new mock instance.
+func NewMockDeleter(ctrl *gomock.Controller) *MockDeleter {
+	mock := &MockDeleter{ctrl: ctrl}
+	mock.recorder = &MockDeleterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockDeleter) EXPECT() *MockDeleterMockRecorder {
+	return m.recorder
+}
+
+// Delete mocks base method.
+func (m *MockDeleter) Delete(ctx context.Context, mType, id string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, mType, id)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockDeleterMockRecorder) Delete(ctx, mType, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockDeleter)(nil).Delete), ctx, mType, id)
+}
+
+// DeleteByPrefix mocks base method.
+func (m *MockDeleter) DeleteByPrefix(ctx context.Context, mType, prefix string) ([]storage.SeriesID, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteByPrefix", ctx, mType, prefix)
+	ret0, _ := ret[0].([]storage.SeriesID)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteByPrefix indicates an expected call of DeleteByPrefix.
+func (mr *MockDeleterMockRecorder) DeleteByPrefix(ctx, mType, prefix interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteByPrefix", reflect.TypeOf((*MockDeleter)(nil).DeleteByPrefix), ctx, mType, prefix)
+}
+
+// DeleteExpired mocks base method.
+func (m *MockDeleter) DeleteExpired(ctx context.Context, now time.Time, ttl func(string, string) time.Duration) ([]storage.SeriesID, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteExpired", ctx, now, ttl)
+	ret0, _ := ret[0].([]storage.SeriesID)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteExpired indicates an expected call of DeleteExpired.
+func (mr *MockDeleterMockRecorder) DeleteExpired(ctx, now, ttl interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteExpired", reflect.TypeOf((*MockDeleter)(nil).DeleteExpired), ctx, now, ttl)
+}
+
+// MockCompactor is a mock of Compactor interface.
+type MockCompactor struct {
+	ctrl     *gomock.Controller
+	recorder *MockCompactorMockRecorder
+}
+
+// MockCompactorMockRecorder is the mock recorder for MockCompactor.
+type MockCompactorMockRecorder struct {
+	mock *MockCompactor
+}
+
+// NewMockCompactor creates a new mock instance.
+func NewMockCompactor(ctrl *gomock.Controller) *MockCompactor {
+	mock := &MockCompactor{ctrl: ctrl}
+	mock.recorder = &MockCompactorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockCompactor) EXPECT() *MockCompactorMockRecorder {
+	return m.recorder
+}
+
+// Compact mocks base method.
+func (m *MockCompactor) Compact(ctx context.Context, now time.Time, policy storage.RetentionPolicy) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Compact", ctx, now, policy)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Compact indicates an expected call of Compact.
+func (mr *MockCompactorMockRecorder) Compact(ctx, now, policy interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Compact", reflect.TypeOf((*MockCompactor)(nil).Compact), ctx, now, policy)
+}
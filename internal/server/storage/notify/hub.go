@@ -0,0 +1,124 @@
+// Package notify рассылает подписчикам изменения метрик, примененные через хранилище.
+// Декоратор Storage оборачивает любое хранилище (в памяти или Postgres) и после каждого
+// успешного обновления или удаления публикует в Hub новое состояние серий или их удаление;
+// Hub раздает изменения подписчикам, не блокируя запись.
+package notify
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Sofja96/go-metrics.git/internal/models"
+)
+
+// DefaultBuffer - размер буфера подписки по умолчанию.
+const DefaultBuffer = 256
+
+// Event - изменение серии метрики: новое состояние серии или ее удаление. У удаленной
+// серии заполнены только имя, тип и метки.
+type Event struct {
+	models.Metrics
+	Deleted bool
+}
+
+// Filter - условия отбора изменений для подписки. Пустые поля не ограничивают отбор.
+type Filter struct {
+	Prefix string // начало имени метрики
+	Type   string // тип метрики
+}
+
+// Match - проверяет, что изменение метрики m подходит под фильтр.
+func (f Filter) Match(m models.Metrics) bool {
+	if f.Type != "" && f.Type != m.MType {
+		return false
+	}
+	return strings.HasPrefix(m.ID, f.Prefix)
+}
+
+// Hub - рассылает изменения метрик подписчикам. Безопасен для конкурентного использования.
+type Hub struct {
+	mu   sync.RWMutex
+	subs map[*Subscription]struct{}
+}
+
+// NewHub - создает Hub без подписчиков.
+func NewHub() *Hub {
+	return &Hub{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscribe - подписывает на изменения, подходящие под filter. Изменения буферизуются
+// в канале размером buffer (DefaultBuffer, если buffer <= 0); если подписчик не успевает
+// их читать, новые изменения отбрасываются и учитываются в TakeDropped.
+func (h *Hub) Subscribe(filter Filter, buffer int) *Subscription {
+	if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
+	sub := &Subscription{
+		hub:    h,
+		filter: filter,
+		ch:     make(chan Event, buffer),
+	}
+
+	h.mu.Lock()
+	h.subs[sub] = struct{}{}
+	h.mu.Unlock()
+
+	return sub
+}
+
+// Publish - рассылает изменения подписчикам без ожидания медленных.
+func (h *Hub) Publish(events ...Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for sub := range h.subs {
+		for _, e := range events {
+			if !sub.filter.Match(e.Metrics) {
+				continue
+			}
+			select {
+			case sub.ch <- e:
+			default:
+				sub.dropped.Add(1)
+			}
+		}
+	}
+}
+
+// Subscribers - возвращает количество подписчиков.
+func (h *Hub) Subscribers() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subs)
+}
+
+// Subscription - подписка на изменения метрик.
+type Subscription struct {
+	hub     *Hub
+	filter  Filter
+	ch      chan Event
+	dropped atomic.Uint64
+	once    sync.Once
+}
+
+// C - возвращает канал изменений; он закрывается после Close.
+func (s *Subscription) C() <-chan Event {
+	return s.ch
+}
+
+// TakeDropped - возвращает количество изменений, отброшенных с прошлого вызова
+// из-за переполнения буфера, и обнуляет его.
+func (s *Subscription) TakeDropped() uint64 {
+	return s.dropped.Swap(0)
+}
+
+// Close - отменяет подписку и закрывает канал изменений.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.hub.mu.Lock()
+		delete(s.hub.subs, s)
+		close(s.ch)
+		s.hub.mu.Unlock()
+	})
+}
@@ -0,0 +1,183 @@
+package notify
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Sofja96/go-metrics.git/internal/models"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage/memory"
+	storagemock "github.com/Sofja96/go-metrics.git/internal/server/storage/mocks"
+	"github.com/Sofja96/go-metrics.git/internal/utils"
+)
+
+func TestHub(t *testing.T) {
+	hub := NewHub()
+
+	gauges := hub.Subscribe(Filter{Type: gauge}, 1)
+	heap := hub.Subscribe(Filter{Prefix: "Heap"}, 10)
+	assert.Equal(t, 2, hub.Subscribers())
+
+	hub.Publish(
+		Event{Metrics: models.Metrics{ID: "HeapAlloc", MType: gauge, Value: utils.FloatPtr(1)}},
+		Event{Metrics: models.Metrics{ID: "PollCount", MType: counter}},
+		Event{Metrics: models.Metrics{ID: "HeapInuse", MType: gauge, Value: utils.FloatPtr(2)}, Deleted: true},
+	)
+
+	t.Run("Filter", func(t *testing.T) {
+		assert.Equal(t, "HeapAlloc", (<-heap.C()).ID)
+		e := <-heap.C()
+		assert.Equal(t, "HeapInuse", e.ID)
+		assert.True(t, e.Deleted)
+		assert.Zero(t, heap.TakeDropped())
+	})
+
+	t.Run("SlowSubscriberDoesNotBlock", func(t *testing.T) {
+		assert.Equal(t, "HeapAlloc", (<-gauges.C()).ID)
+		assert.Equal(t, uint64(1), gauges.TakeDropped())
+		assert.Zero(t, gauges.TakeDropped(), "counter is reset")
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		gauges.Close()
+		gauges.Close()
+		_, ok := <-gauges.C()
+		assert.False(t, ok)
+		assert.Equal(t, 1, hub.Subscribers())
+
+		hub.Publish(Event{Metrics: models.Metrics{ID: "HeapAlloc", MType: gauge}})
+		assert.Len(t, heap.C(), 1)
+	})
+}
+
+func TestStorage(t *testing.T) {
+	ctx := context.Background()
+	mem, err := memory.NewMemStorage(ctx, 300, "", false)
+	require.NoError(t, err)
+
+	hub := NewHub()
+	s := New(mem, hub)
+	sub := hub.Subscribe(Filter{}, 10)
+	defer sub.Close()
+
+	t.Run("UpdateGauge", func(t *testing.T) {
+		_, err := s.UpdateGauge(ctx, `HeapAlloc{host="agent-1"}`, 1.5)
+		require.NoError(t, err)
+
+		m := <-sub.C()
+		assert.Equal(t, "HeapAlloc", m.ID)
+		assert.Equal(t, gauge, m.MType)
+		assert.Equal(t, map[string]string{"host": "agent-1"}, m.Labels)
+		assert.Equal(t, 1.5, *m.Value)
+	})
+
+	t.Run("UpdateCounter", func(t *testing.T) {
+		_, err := s.UpdateCounter(ctx, "PollCount", 2)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), *(<-sub.C()).Delta)
+	})
+
+	t.Run("BatchUpdatePublishesCurrentState", func(t *testing.T) {
+		err := s.BatchUpdate(ctx, []models.Metrics{
+			{ID: "PollCount", MType: counter, Delta: utils.IntPtr(3)},
+			{ID: "PollCount", MType: counter, Delta: utils.IntPtr(4)},
+			{ID: "Latency", MType: histogram, Buckets: []float64{1, 2}, Observations: []float64{1.5}},
+		})
+		require.NoError(t, err)
+
+		m := <-sub.C()
+		assert.Equal(t, "PollCount", m.ID)
+		assert.Equal(t, int64(9), *m.Delta, "total of the series, not the applied delta")
+
+		m = <-sub.C()
+		assert.Equal(t, "Latency", m.ID)
+		require.NotNil(t, m.Histogram)
+		assert.Equal(t, uint64(1), m.Histogram.Count)
+		assert.Empty(t, sub.C())
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		ok, err := s.Delete(ctx, counter, "PollCount")
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		e := <-sub.C()
+		assert.Equal(t, Event{Metrics: models.Metrics{ID: "PollCount", MType: counter}, Deleted: true}, e)
+
+		ok, err = s.Delete(ctx, counter, "PollCount")
+		require.NoError(t, err)
+		require.False(t, ok)
+		assert.Empty(t, sub.C(), "missing series is not published")
+	})
+
+	t.Run("DeleteByPrefix", func(t *testing.T) {
+		deleted, err := s.DeleteByPrefix(ctx, gauge, "Heap")
+		require.NoError(t, err)
+		require.Len(t, deleted, 1)
+
+		e := <-sub.C()
+		assert.True(t, e.Deleted)
+		assert.Equal(t, "HeapAlloc", e.ID)
+		assert.Equal(t, map[string]string{"host": "agent-1"}, e.Labels)
+		assert.Nil(t, e.Value)
+	})
+
+	t.Run("DeleteExpired", func(t *testing.T) {
+		ttl := func(mType, name string) time.Duration { return time.Hour }
+		deleted, err := s.DeleteExpired(ctx, time.Now().Add(2*time.Hour), ttl)
+		require.NoError(t, err)
+		require.Len(t, deleted, 1)
+
+		e := <-sub.C()
+		assert.Equal(t, Event{Metrics: models.Metrics{ID: "Latency", MType: histogram}, Deleted: true}, e)
+		assert.Empty(t, sub.C())
+	})
+}
+
+func TestStorageBatchUpdateDoesNotReadStorage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mock := storagemock.NewMockStorage(ctrl)
+	hub := NewHub()
+	s := New(mock, hub)
+	sub := hub.Subscribe(Filter{}, 10)
+	defer sub.Close()
+
+	// хранилище записывает в пачку значения серий после обновления; других вызовов нет
+	mock.EXPECT().BatchUpdate(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, metrics []models.Metrics) error {
+		*metrics[0].Delta = 11
+		*metrics[2].Delta = 14
+		metrics[3].Histogram = &models.Histogram{Bounds: []float64{1}, Counts: []uint64{1, 0}, Count: 1, Sum: 0.5}
+		return nil
+	})
+	require.NoError(t, s.BatchUpdate(context.Background(), []models.Metrics{
+		{ID: "PollCount", MType: counter, Delta: utils.IntPtr(1)},
+		{ID: "Alloc", MType: gauge, Value: utils.FloatPtr(2)},
+		{ID: "PollCount", MType: counter, Delta: utils.IntPtr(3)},
+		{ID: "Latency", MType: histogram, Buckets: []float64{1}, Observations: []float64{0.5}},
+	}))
+
+	assert.Equal(t, int64(14), *(<-sub.C()).Delta)
+	assert.Equal(t, 2.0, *(<-sub.C()).Value)
+	assert.Equal(t, uint64(1), (<-sub.C()).Histogram.Count)
+	assert.Empty(t, sub.C())
+}
+
+func TestStorageWithoutSubscribers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mock := storagemock.NewMockStorage(ctrl)
+	s := New(mock, NewHub())
+
+	// без подписчиков состояние серий не перечитывается
+	mock.EXPECT().BatchUpdate(gomock.Any(), gomock.Any()).Return(nil)
+	assert.NoError(t, s.BatchUpdate(context.Background(), []models.Metrics{
+		{ID: "PollCount", MType: counter, Delta: utils.IntPtr(1)},
+	}))
+}
@@ -0,0 +1,225 @@
+package notify
+
+import (
+	"context"
+	"time"
+
+	"github.com/Sofja96/go-metrics.git/internal/models"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+)
+
+const (
+	counter   string = "counter"
+	gauge     string = "gauge"
+	histogram string = "histogram"
+	summary   string = "summary"
+)
+
+// Storage - декоратор хранилища, публикующий в Hub новое состояние каждой
+// обновленной серии и удаление серий. Чтение выполняется напрямую из оборачиваемого хранилища.
+type Storage struct {
+	storage.Storage
+	hub *Hub
+}
+
+var (
+	_ storage.Storage   = (*Storage)(nil)
+	_ storage.Ranger    = (*Storage)(nil)
+	_ storage.Deleter   = (*Storage)(nil)
+	_ storage.Compactor = (*Storage)(nil)
+)
+
+// New - оборачивает хранилище s, публикуя изменения в hub.
+func New(s storage.Storage, hub *Hub) *Storage {
+	return &Storage{Storage: s, hub: hub}
+}
+
+// Close - закрывает оборачиваемое хранилище.
+func (s *Storage) Close() error {
+	return storage.Close(s.Storage)
+}
+
+// UpdateCounter - обновляет counter и публикует его новое значение.
+func (s *Storage) UpdateCounter(ctx context.Context, name string, value int64) (int64, error) {
+	total, err := s.Storage.UpdateCounter(ctx, name, value)
+	if err == nil {
+		s.hub.Publish(counterChange(name, total))
+	}
+	return total, err
+}
+
+// UpdateGauge - обновляет gauge и публикует его новое значение.
+func (s *Storage) UpdateGauge(ctx context.Context, name string, value float64) (float64, error) {
+	v, err := s.Storage.UpdateGauge(ctx, name, value)
+	if err == nil {
+		s.hub.Publish(gaugeChange(name, v))
+	}
+	return v, err
+}
+
+// UpdateHistogram - добавляет наблюдения в histogram и публикует его новое состояние.
+func (s *Storage) UpdateHistogram(ctx context.Context, name string, bounds, observations []float64) (models.Histogram, error) {
+	h, err := s.Storage.UpdateHistogram(ctx, name, bounds, observations)
+	if err == nil {
+		s.hub.Publish(histogramChange(name, h))
+	}
+	return h, err
+}
+
+// UpdateSummary - добавляет наблюдения в summary и публикует его новые значения.
+func (s *Storage) UpdateSummary(ctx context.Context, name string, quantiles, observations []float64) (models.SummaryValue, error) {
+	v, err := s.Storage.UpdateSummary(ctx, name, quantiles, observations)
+	if err == nil {
+		s.hub.Publish(summaryChange(name, v))
+	}
+	return v, err
+}
+
+// BatchUpdate - обновляет метрики пачкой и публикует новое состояние затронутых серий.
+// Состояние берется из самой пачки: хранилище записывает в нее значения counter и состояния
+// histogram и summary после обновления. Для серии, повторяющейся в пачке, публикуется
+// состояние после ее последнего обновления.
+func (s *Storage) BatchUpdate(ctx context.Context, metrics []models.Metrics) error {
+	if err := s.Storage.BatchUpdate(ctx, metrics); err != nil {
+		return err
+	}
+	if s.hub.Subscribers() == 0 {
+		return nil
+	}
+
+	type series struct{ key, mType string }
+	last := make(map[series]int, len(metrics))
+	order := make([]series, 0, len(metrics))
+	for i, m := range metrics {
+		sr := series{key: m.SeriesKey(), mType: m.MType}
+		if _, ok := last[sr]; !ok {
+			order = append(order, sr)
+		}
+		last[sr] = i
+	}
+
+	changes := make([]Event, 0, len(order))
+	for _, sr := range order {
+		if change, ok := batchChange(sr.key, metrics[last[sr]]); ok {
+			changes = append(changes, change)
+		}
+	}
+	s.hub.Publish(changes...)
+	return nil
+}
+
+// GetRange - получает историю метрики из оборачиваемого хранилища.
+func (s *Storage) GetRange(ctx context.Context, name, mType string, from, to time.Time, step time.Duration) ([]storage.Sample, error) {
+	r, ok := s.Storage.(storage.Ranger)
+	if !ok {
+		return nil, storage.ErrUnsupported
+	}
+	return r.GetRange(ctx, name, mType, from, to, step)
+}
+
+// Compact - сжимает историю в оборачиваемом хранилище; сжатие не публикуется.
+func (s *Storage) Compact(ctx context.Context, now time.Time, policy storage.RetentionPolicy) (int, error) {
+	c, ok := s.Storage.(storage.Compactor)
+	if !ok {
+		return 0, storage.ErrUnsupported
+	}
+	return c.Compact(ctx, now, policy)
+}
+
+// Delete - удаляет серию и публикует ее удаление.
+func (s *Storage) Delete(ctx context.Context, mType, id string) (bool, error) {
+	d, ok := s.Storage.(storage.Deleter)
+	if !ok {
+		return false, storage.ErrUnsupported
+	}
+	deleted, err := d.Delete(ctx, mType, id)
+	if deleted && err == nil {
+		s.hub.Publish(deletion(storage.SeriesID{Type: mType, ID: id}))
+	}
+	return deleted, err
+}
+
+// DeleteByPrefix - удаляет серии по префиксу имени и публикует их удаление.
+func (s *Storage) DeleteByPrefix(ctx context.Context, mType, prefix string) ([]storage.SeriesID, error) {
+	d, ok := s.Storage.(storage.Deleter)
+	if !ok {
+		return nil, storage.ErrUnsupported
+	}
+	deleted, err := d.DeleteByPrefix(ctx, mType, prefix)
+	s.publishDeleted(deleted)
+	return deleted, err
+}
+
+// DeleteExpired - удаляет серии с истекшим временем жизни и публикует их удаление.
+func (s *Storage) DeleteExpired(ctx context.Context, now time.Time, ttl func(mType, name string) time.Duration) ([]storage.SeriesID, error) {
+	d, ok := s.Storage.(storage.Deleter)
+	if !ok {
+		return nil, storage.ErrUnsupported
+	}
+	deleted, err := d.DeleteExpired(ctx, now, ttl)
+	s.publishDeleted(deleted)
+	return deleted, err
+}
+
+// publishDeleted - публикует удаление серий deleted. Серии, удаленные до ошибки хранилища,
+// тоже публикуются.
+func (s *Storage) publishDeleted(deleted []storage.SeriesID) {
+	if len(deleted) == 0 {
+		return
+	}
+	events := make([]Event, 0, len(deleted))
+	for _, series := range deleted {
+		events = append(events, deletion(series))
+	}
+	s.hub.Publish(events...)
+}
+
+// batchChange - формирует изменение серии key по метрике пачки m после обновления.
+func batchChange(key string, m models.Metrics) (Event, bool) {
+	switch {
+	case m.MType == gauge && m.Value != nil:
+		return gaugeChange(key, *m.Value), true
+	case m.MType == counter && m.Delta != nil:
+		return counterChange(key, *m.Delta), true
+	case m.MType == histogram && m.Histogram != nil:
+		return histogramChange(key, *m.Histogram), true
+	case m.MType == summary && m.Summary != nil:
+		return summaryChange(key, *m.Summary), true
+	}
+	return Event{}, false
+}
+
+func deletion(series storage.SeriesID) Event {
+	e := change(series.ID, series.Type)
+	e.Deleted = true
+	return e
+}
+
+func change(key, mType string) Event {
+	name, labels := models.ParseSeriesKey(key)
+	return Event{Metrics: models.Metrics{ID: name, MType: mType, Labels: labels}}
+}
+
+func gaugeChange(key string, value float64) Event {
+	m := change(key, gauge)
+	m.Value = &value
+	return m
+}
+
+func counterChange(key string, value int64) Event {
+	m := change(key, counter)
+	m.Delta = &value
+	return m
+}
+
+func histogramChange(key string, h models.Histogram) Event {
+	m := change(key, histogram)
+	m.Histogram = &h
+	return m
+}
+
+func summaryChange(key string, v models.SummaryValue) Event {
+	m := change(key, summary)
+	m.Summary = &v
+	return m
+}
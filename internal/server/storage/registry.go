@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+)
+
+// Factory - создает хранилище по URL, схема которого зарегистрирована через Register.
+type Factory func(ctx context.Context, u *url.URL) (Storage, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register - регистрирует фабрику хранилища для схемы URL scheme. Обычно вызывается
+// из init пакета хранилища. Повторная регистрация схемы приводит к панике.
+func Register(scheme string, f Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if f == nil {
+		panic("storage: register nil factory for scheme " + scheme)
+	}
+	if _, ok := factories[scheme]; ok {
+		panic("storage: register called twice for scheme " + scheme)
+	}
+	factories[scheme] = f
+}
+
+// Schemes - возвращает зарегистрированные схемы URL по алфавиту.
+func Schemes() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	schemes := make([]string, 0, len(factories))
+	for scheme := range factories {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// Open - создает хранилище фабрикой, зарегистрированной для схемы rawURL.
+func Open(ctx context.Context, rawURL string) (Storage, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage url: %w", err)
+	}
+
+	factoriesMu.RLock()
+	f, ok := factories[u.Scheme]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown storage scheme %q, registered: %v", u.Scheme, Schemes())
+	}
+
+	s, err := f(ctx, u)
+	if err != nil {
+		return nil, fmt.Errorf("error open %s storage: %w", u.Scheme, err)
+	}
+	return s, nil
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testStorage - хранилище-заглушка, запоминающее URL, по которому создано.
+type testStorage struct {
+	Storage
+	url *url.URL
+}
+
+func TestRegistry(t *testing.T) {
+	ctx := context.Background()
+	Register("test", func(ctx context.Context, u *url.URL) (Storage, error) {
+		if u.Query().Get("fail") != "" {
+			return nil, fmt.Errorf("requested failure")
+		}
+		return &testStorage{url: u}, nil
+	})
+
+	t.Run("Open registered scheme", func(t *testing.T) {
+		s, err := Open(ctx, "test://host/path?opt=1")
+		require.NoError(t, err)
+		ts, ok := s.(*testStorage)
+		require.True(t, ok)
+		assert.Equal(t, "host", ts.url.Host)
+		assert.Equal(t, "/path", ts.url.Path)
+		assert.Equal(t, "1", ts.url.Query().Get("opt"))
+	})
+
+	t.Run("Factory error", func(t *testing.T) {
+		_, err := Open(ctx, "test://?fail=1")
+		assert.ErrorContains(t, err, "requested failure")
+	})
+
+	t.Run("Unknown scheme", func(t *testing.T) {
+		_, err := Open(ctx, "unknown://")
+		assert.ErrorContains(t, err, `unknown storage scheme "unknown"`)
+	})
+
+	t.Run("Invalid url", func(t *testing.T) {
+		_, err := Open(ctx, "test://%zz")
+		assert.Error(t, err)
+	})
+
+	t.Run("Duplicate registration", func(t *testing.T) {
+		assert.Panics(t, func() {
+			Register("test", func(ctx context.Context, u *url.URL) (Storage, error) { return nil, nil })
+		})
+	})
+
+	t.Run("Nil factory", func(t *testing.T) {
+		assert.Panics(t, func() { Register("nil", nil) })
+	})
+
+	assert.Contains(t, Schemes(), "test")
+}
@@ -0,0 +1,268 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RawResolution - разрешение уровня исходных значений в политике хранения.
+const RawResolution time.Duration = 0
+
+const maxCompactInterval = time.Minute
+
+// RetentionLevel - уровень хранения истории: значения с разрешением Resolution хранятся в течение Retain.
+// Уровень с разрешением RawResolution хранит исходные значения, остальные - агрегаты.
+type RetentionLevel struct {
+	Resolution time.Duration
+	Retain     time.Duration
+}
+
+// RetentionPolicy - уровни хранения истории по возрастанию разрешения. Первый уровень всегда
+// хранит исходные значения, каждый следующий сворачивается из предыдущего.
+type RetentionPolicy []RetentionLevel
+
+// ParseRetention - разбирает политику хранения вида "raw=24h,1m=30d,1h=365d", где слева задано
+// разрешение уровня, а справа - время хранения. Длительности допускают суффикс d (сутки).
+// Разрешения агрегатов должны быть целым числом секунд и делиться на разрешение предыдущего уровня,
+// а предыдущий уровень должен храниться не меньше разрешения следующего, чтобы его успели свернуть.
+func ParseRetention(s string) (RetentionPolicy, error) {
+	var policy RetentionPolicy
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		resolution, retain, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid retention level %q", item)
+		}
+		var level RetentionLevel
+		if resolution = strings.TrimSpace(resolution); resolution != "raw" {
+			d, err := parseDays(resolution)
+			if err != nil || d < time.Second || d%time.Second != 0 {
+				return nil, fmt.Errorf("invalid retention resolution %q", item)
+			}
+			level.Resolution = d
+		}
+		d, err := parseDays(strings.TrimSpace(retain))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid retention period %q", item)
+		}
+		level.Retain = d
+		policy = append(policy, level)
+	}
+	if len(policy) == 0 {
+		return nil, nil
+	}
+
+	sort.Slice(policy, func(i, j int) bool { return policy[i].Resolution < policy[j].Resolution })
+	if policy[0].Resolution != RawResolution {
+		return nil, fmt.Errorf("retention policy must set raw period")
+	}
+	for i := 1; i < len(policy); i++ {
+		prev, level := policy[i-1], policy[i]
+		if level.Resolution == prev.Resolution {
+			return nil, fmt.Errorf("duplicate retention resolution %s", level.Resolution)
+		}
+		if prev.Resolution != RawResolution && level.Resolution%prev.Resolution != 0 {
+			return nil, fmt.Errorf("retention resolution %s is not a multiple of %s", level.Resolution, prev.Resolution)
+		}
+		if prev.Retain < level.Resolution {
+			return nil, fmt.Errorf("retention period %s is shorter than next resolution %s", prev.Retain, level.Resolution)
+		}
+	}
+	return policy, nil
+}
+
+// parseDays - разбирает длительность, дополнительно допуская суффикс d для суток, например "30d".
+func parseDays(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// Raw - возвращает время хранения исходных значений.
+func (p RetentionPolicy) Raw() time.Duration {
+	if len(p) == 0 {
+		return 0
+	}
+	return p[0].Retain
+}
+
+// Aggregates - возвращает уровни агрегатов по возрастанию разрешения.
+func (p RetentionPolicy) Aggregates() []RetentionLevel {
+	if len(p) == 0 {
+		return nil
+	}
+	return p[1:]
+}
+
+// Retain - возвращает время хранения агрегатов с разрешением resolution; 0 - уровня нет в политике.
+func (p RetentionPolicy) Retain(resolution time.Duration) time.Duration {
+	for _, level := range p {
+		if level.Resolution == resolution {
+			return level.Retain
+		}
+	}
+	return 0
+}
+
+// Interval - возвращает период сжатия истории: наименьшее разрешение агрегатов,
+// но не больше минуты. Для пустой политики возвращает 0.
+func (p RetentionPolicy) Interval() time.Duration {
+	if len(p) == 0 {
+		return 0
+	}
+	interval := maxCompactInterval
+	if aggregates := p.Aggregates(); len(aggregates) != 0 {
+		interval = min(aggregates[0].Resolution, interval)
+	}
+	return interval
+}
+
+// Aggregate - агрегат значений серии за интервал, начинающийся в Timestamp.
+type Aggregate struct {
+	Timestamp time.Time `json:"timestamp"`
+	Min       float64   `json:"min"`
+	Max       float64   `json:"max"`
+	Sum       float64   `json:"sum"`
+	Count     int64     `json:"count"`
+}
+
+// Avg - возвращает среднее значение за интервал.
+func (a Aggregate) Avg() float64 {
+	if a.Count == 0 {
+		return 0
+	}
+	return a.Sum / float64(a.Count)
+}
+
+// Sample - возвращает значение агрегата для истории метрики типа mType: для counter,
+// значения которого не убывают, - максимум, то есть последнее значение, для остальных - среднее.
+func (a Aggregate) Sample(mType string) Sample {
+	if mType == "counter" {
+		return Sample{Timestamp: a.Timestamp, Value: a.Max}
+	}
+	return Sample{Timestamp: a.Timestamp, Value: a.Avg()}
+}
+
+// SampleAggregate - возвращает агрегат из одного значения.
+func SampleAggregate(s Sample) Aggregate {
+	return Aggregate{Timestamp: s.Timestamp, Min: s.Value, Max: s.Value, Sum: s.Value, Count: 1}
+}
+
+// BucketStart - возвращает начало интервала длиной resolution, содержащего t. Интервалы отсчитываются от начала эпохи Unix.
+func BucketStart(t time.Time, resolution time.Duration) time.Time {
+	return time.Unix(0, t.UnixNano()/int64(resolution)*int64(resolution)).In(t.Location())
+}
+
+// Rollup - сворачивает упорядоченные по времени агрегаты в агрегаты с разрешением resolution.
+func Rollup(src []Aggregate, resolution time.Duration) []Aggregate {
+	result := make([]Aggregate, 0)
+	for _, a := range src {
+		bucket := BucketStart(a.Timestamp, resolution)
+		if n := len(result); n > 0 && result[n-1].Timestamp.Equal(bucket) {
+			last := &result[n-1]
+			last.Min = min(last.Min, a.Min)
+			last.Max = max(last.Max, a.Max)
+			last.Sum += a.Sum
+			last.Count += a.Count
+			continue
+		}
+		a.Timestamp = bucket
+		result = append(result, a)
+	}
+	return result
+}
+
+// ReadRange - читает историю за интервал [from, to] с шагом step из уровней хранения. Значения берутся
+// из самого грубого уровня с разрешением не больше step до момента, по который он свернут, более поздние -
+// из более точных уровней, а самые новые - из исходных значений. rolled - моменты, по которые свернуты
+// уровни агрегатов; read читает значения уровня с разрешением resolution за полуинтервал [from, to).
+func ReadRange(from, to time.Time, step time.Duration, rolled map[time.Duration]time.Time,
+	read func(resolution time.Duration, from, to time.Time) ([]Sample, error)) ([]Sample, error) {
+	resolutions := make([]time.Duration, 0, len(rolled))
+	for resolution := range rolled {
+		if resolution <= step {
+			resolutions = append(resolutions, resolution)
+		}
+	}
+	slices.Sort(resolutions)
+	slices.Reverse(resolutions)
+
+	end := to.Add(time.Nanosecond)
+	result := make([]Sample, 0)
+	start := from
+	for _, resolution := range resolutions {
+		until := rolled[resolution]
+		if !until.After(start) {
+			continue
+		}
+		samples, err := read(resolution, start, minTime(until, end))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, samples...)
+		if start = until; !start.Before(end) {
+			return Downsample(result, from, step), nil
+		}
+	}
+
+	samples, err := read(RawResolution, start, end)
+	if err != nil {
+		return nil, err
+	}
+	return Downsample(append(result, samples...), from, step), nil
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// RunCompactor - периодически сжимает историю s по политике policy до отмены контекста.
+// Если хранилище не поддерживает сжатие, сжатие прекращается.
+func RunCompactor(ctx context.Context, s Compactor, policy RetentionPolicy) {
+	interval := policy.Interval()
+	if interval == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			n, err := s.Compact(ctx, now, policy)
+			if errors.Is(err, ErrUnsupported) {
+				log.Printf("retention policy is ignored: %v", err)
+				return
+			}
+			if err != nil {
+				log.Printf("error compact history: %v", err)
+				continue
+			}
+			if n != 0 {
+				log.Printf("removed %d history entries outside retention", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRetention(t *testing.T) {
+	policy, err := ParseRetention(" 1h=365d, raw=24h,1m=30d")
+	require.NoError(t, err)
+	assert.Equal(t, RetentionPolicy{
+		{Resolution: RawResolution, Retain: 24 * time.Hour},
+		{Resolution: time.Minute, Retain: 30 * 24 * time.Hour},
+		{Resolution: time.Hour, Retain: 365 * 24 * time.Hour},
+	}, policy)
+	assert.Equal(t, 24*time.Hour, policy.Raw())
+	assert.Equal(t, policy[1:], RetentionPolicy(policy.Aggregates()))
+	assert.Equal(t, 30*24*time.Hour, policy.Retain(time.Minute))
+	assert.Zero(t, policy.Retain(time.Second))
+
+	policy, err = ParseRetention("")
+	assert.NoError(t, err)
+	assert.Empty(t, policy)
+
+	for _, s := range []string{
+		"24h",                 // нет разрешения
+		"1m=30d",              // нет исходных значений
+		"raw=forever",         // неверное время хранения
+		"raw=1h,500ms=1h",     // разрешение меньше секунды
+		"raw=1h,1m=1h,1m=2h",  // повтор разрешения
+		"raw=1h,1m=1h,90s=1h", // разрешение не кратно предыдущему
+		"raw=30s,1m=1h",       // исходные значения удаляются раньше, чем сворачиваются
+		"raw=1h,1m=0s",        // нулевое время хранения
+	} {
+		_, err = ParseRetention(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestRetentionPolicy_Interval(t *testing.T) {
+	tests := []struct {
+		policy string
+		want   time.Duration
+	}{
+		{policy: "", want: 0},
+		{policy: "raw=24h", want: time.Minute},
+		{policy: "raw=1h,10s=1d", want: 10 * time.Second},
+		{policy: "raw=2h,1h=30d", want: time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			policy, err := ParseRetention(tt.policy)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, policy.Interval())
+		})
+	}
+}
+
+func TestRollup(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, start, BucketStart(start.Add(59*time.Second), time.Minute))
+	assert.Equal(t, start.Add(time.Minute), BucketStart(start.Add(time.Minute), time.Minute))
+
+	var raw []Aggregate
+	for i, v := range []float64{4, 2, 6, 10} {
+		raw = append(raw, SampleAggregate(Sample{Timestamp: start.Add(time.Duration(i*20) * time.Second), Value: v}))
+	}
+
+	minutes := Rollup(raw, time.Minute)
+	assert.Equal(t, []Aggregate{
+		{Timestamp: start, Min: 2, Max: 6, Sum: 12, Count: 3},
+		{Timestamp: start.Add(time.Minute), Min: 10, Max: 10, Sum: 10, Count: 1},
+	}, minutes)
+	assert.Equal(t, 4.0, minutes[0].Avg())
+	assert.Equal(t, Sample{Timestamp: start, Value: 4}, minutes[0].Sample("gauge"))
+	assert.Equal(t, Sample{Timestamp: start, Value: 6}, minutes[0].Sample("counter"))
+
+	assert.Equal(t, []Aggregate{{Timestamp: start, Min: 2, Max: 10, Sum: 22, Count: 4}}, Rollup(minutes, time.Hour))
+	assert.Empty(t, Rollup(nil, time.Hour))
+}
+
+func TestReadRange(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(3 * time.Hour)
+	rolled := map[time.Duration]time.Time{
+		time.Minute: from.Add(2*time.Hour + 30*time.Minute),
+		time.Hour:   from.Add(2 * time.Hour),
+	}
+
+	// read - возвращает по значению на начало каждого запрошенного уровня и запоминает запросы
+	var reads []string
+	read := func(resolution time.Duration, from, to time.Time) ([]Sample, error) {
+		reads = append(reads, fmt.Sprintf("%s [%s, %s)", resolution, from.Format("15:04"), to.Format("15:04")))
+		return []Sample{{Timestamp: from, Value: resolution.Minutes()}}, nil
+	}
+
+	tests := []struct {
+		name  string
+		step  time.Duration
+		reads []string
+		want  []Sample
+	}{
+		{
+			name:  "Raw",
+			reads: []string{"0s [00:00, 03:00)"},
+			want:  []Sample{{Timestamp: from, Value: 0}},
+		},
+		{
+			name:  "Minutes",
+			step:  30 * time.Minute,
+			reads: []string{"1m0s [00:00, 02:30)", "0s [02:30, 03:00)"},
+			want:  []Sample{{Timestamp: from, Value: 1}, {Timestamp: from.Add(150 * time.Minute), Value: 0}},
+		},
+		{
+			name:  "Hours",
+			step:  time.Hour,
+			reads: []string{"1h0m0s [00:00, 02:00)", "1m0s [02:00, 02:30)", "0s [02:30, 03:00)"},
+			want: []Sample{
+				{Timestamp: from, Value: 60},
+				{Timestamp: from.Add(2 * time.Hour), Value: 0},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reads = nil
+			samples, err := ReadRange(from, to, tt.step, rolled, read)
+			require.NoError(t, err)
+			assert.Equal(t, tt.reads, reads)
+			assert.Equal(t, tt.want, samples)
+		})
+	}
+
+	t.Run("Error", func(t *testing.T) {
+		_, err := ReadRange(from, to, time.Hour, rolled, func(time.Duration, time.Time, time.Time) ([]Sample, error) {
+			return nil, assert.AnError
+		})
+		assert.ErrorIs(t, err, assert.AnError)
+	})
+}
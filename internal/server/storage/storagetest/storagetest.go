@@ -0,0 +1,530 @@
+// Package storagetest - общий набор тестов реализаций storage.Storage. Каждая реализация
+// хранилища должна проходить его, чтобы сервер вел себя одинаково с любым из них. Тесты
+// необязательных возможностей (storage.Ranger, storage.Deleter, storage.Compactor) пропускаются,
+// если хранилище их не реализует.
+package storagetest
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Sofja96/go-metrics.git/internal/models"
+	"github.com/Sofja96/go-metrics.git/internal/server/storage"
+)
+
+// Run - запускает набор тестов. open должен возвращать новое пустое хранилище для каждого теста.
+func Run(t *testing.T, open func(t *testing.T) storage.Storage) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s storage.Storage)
+	}{
+		{"Counter", testCounter},
+		{"Gauge", testGauge},
+		{"Labels", testLabels},
+		{"ListSeries", testListSeries},
+		{"Histogram", testHistogram},
+		{"Summary", testSummary},
+		{"BatchUpdate", testBatchUpdate},
+		{"BatchUpdateAtomicity", testBatchUpdateAtomicity},
+		{"GetRange", testGetRange},
+		{"Delete", testDelete},
+		{"DeleteByPrefix", testDeleteByPrefix},
+		{"DeleteExpired", testDeleteExpired},
+		{"Compact", testCompact},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, open(t))
+		})
+	}
+}
+
+func testCounter(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	require.NoError(t, s.Ping(ctx))
+
+	_, ok := s.GetCounterValue(ctx, "PollCount")
+	assert.False(t, ok)
+
+	v, err := s.UpdateCounter(ctx, "PollCount", 5)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), v)
+	v, err = s.UpdateCounter(ctx, "PollCount", -2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), v)
+
+	v, ok = s.GetCounterValue(ctx, "PollCount")
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), v)
+
+	counters, err := s.GetAllCounters(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []storage.CounterMetric{{Name: "PollCount", Value: 3}}, counters)
+}
+
+func testGauge(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	_, ok := s.GetGaugeValue(ctx, "Alloc")
+	assert.False(t, ok)
+
+	v, err := s.UpdateGauge(ctx, "Alloc", 1.5)
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, v)
+	_, err = s.UpdateGauge(ctx, "Alloc", -3.25)
+	require.NoError(t, err)
+
+	v, ok = s.GetGaugeValue(ctx, "Alloc")
+	assert.True(t, ok)
+	assert.Equal(t, -3.25, v)
+
+	gauges, err := s.GetAllGauges(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []storage.GaugeMetric{{Name: "Alloc", Value: -3.25}}, gauges)
+}
+
+func testLabels(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	agent1 := models.SeriesKey("Alloc", map[string]string{"host": "agent-1"})
+	agent2 := models.SeriesKey("Alloc", map[string]string{"host": "agent-2"})
+
+	_, err := s.UpdateGauge(ctx, agent1, 1)
+	require.NoError(t, err)
+	_, err = s.UpdateGauge(ctx, agent2, 2)
+	require.NoError(t, err)
+
+	v, ok := s.GetGaugeValue(ctx, agent2)
+	assert.True(t, ok)
+	assert.Equal(t, float64(2), v)
+	_, ok = s.GetGaugeValue(ctx, "Alloc")
+	assert.False(t, ok, "series without labels is a different series")
+
+	gauges, err := s.GetAllGauges(ctx)
+	require.NoError(t, err)
+	sort.Slice(gauges, func(i, j int) bool { return gauges[i].Value < gauges[j].Value })
+	assert.Equal(t, []storage.GaugeMetric{
+		{Name: "Alloc", Labels: map[string]string{"host": "agent-1"}, Value: 1},
+		{Name: "Alloc", Labels: map[string]string{"host": "agent-2"}, Value: 2},
+	}, gauges)
+}
+
+func testListSeries(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	agent1 := models.SeriesKey("Alloc", map[string]string{"host": "agent-1"})
+	agent2 := models.SeriesKey("Alloc", map[string]string{"host": "agent-2"})
+	for _, key := range []string{agent2, "Alloc", agent1, "AllocTotal"} {
+		_, err := s.UpdateGauge(ctx, key, 1)
+		require.NoError(t, err)
+	}
+	_, err := s.UpdateCounter(ctx, "Alloc", 1)
+	require.NoError(t, err)
+
+	keys, err := s.ListSeries(ctx, "gauge", "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Alloc", agent1, agent2}, keys)
+
+	keys, err = s.ListSeries(ctx, "histogram", "Alloc")
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+
+	_, err = s.ListSeries(ctx, "unknown", "Alloc")
+	assert.Error(t, err)
+}
+
+func testHistogram(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	h, err := s.UpdateHistogram(ctx, "Latency", []float64{1, 5}, []float64{0.5, 3})
+	require.NoError(t, err)
+	assert.Equal(t, models.Histogram{Bounds: []float64{1, 5}, Counts: []uint64{1, 1, 0}, Count: 2, Sum: 3.5}, h)
+
+	// пустые границы означают текущую раскладку серии
+	h, err = s.UpdateHistogram(ctx, "Latency", nil, []float64{10})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), h.Count)
+
+	_, err = s.UpdateHistogram(ctx, "Latency", []float64{1, 10}, []float64{1})
+	assert.ErrorIs(t, err, models.ErrLayoutMismatch)
+
+	h, ok := s.GetHistogram(ctx, "Latency")
+	assert.True(t, ok)
+	assert.Equal(t, models.Histogram{Bounds: []float64{1, 5}, Counts: []uint64{1, 1, 1}, Count: 3, Sum: 13.5}, h)
+	_, ok = s.GetHistogram(ctx, "Unknown")
+	assert.False(t, ok)
+
+	histograms, err := s.GetAllHistograms(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []storage.HistogramMetric{{Name: "Latency", Value: h}}, histograms)
+}
+
+func testSummary(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	_, err := s.UpdateSummary(ctx, "Latency", []float64{0.5}, []float64{1, 2, 3})
+	require.NoError(t, err)
+	v, err := s.UpdateSummary(ctx, "Latency", nil, []float64{4})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), v.Count)
+	assert.Equal(t, float64(10), v.Sum)
+
+	_, err = s.UpdateSummary(ctx, "Latency", []float64{0.9}, []float64{1})
+	assert.ErrorIs(t, err, models.ErrLayoutMismatch)
+
+	got, ok := s.GetSummary(ctx, "Latency")
+	assert.True(t, ok)
+	assert.Equal(t, v, got)
+
+	summaries, err := s.GetAllSummaries(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []storage.SummaryMetric{{Name: "Latency", Value: v}}, summaries)
+}
+
+func testBatchUpdate(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	_, err := s.UpdateCounter(ctx, "PollCount", 10)
+	require.NoError(t, err)
+
+	metrics := []models.Metrics{
+		{ID: "Alloc", MType: "gauge", Value: float64Ptr(1)},
+		{ID: "PollCount", MType: "counter", Delta: int64Ptr(2)},
+		{ID: "Alloc", MType: "gauge", Value: float64Ptr(7)},
+		{ID: "PollCount", MType: "counter", Delta: int64Ptr(3)},
+		{ID: "PollCount", MType: "counter", Labels: map[string]string{"host": "agent-1"}, Delta: int64Ptr(1)},
+		{ID: "Latency", MType: "histogram", Buckets: []float64{1, 5}, Observations: []float64{2}},
+		{ID: "Latency", MType: "histogram", Observations: []float64{4}},
+		{ID: "Duration", MType: "summary", Quantiles: []float64{0.5}, Observations: []float64{1, 2}},
+	}
+	require.NoError(t, s.BatchUpdate(ctx, metrics))
+
+	// в Delta возвращаются значения counter после каждого приращения
+	assert.Equal(t, int64(12), *metrics[1].Delta)
+	assert.Equal(t, int64(15), *metrics[3].Delta)
+	assert.Equal(t, int64(1), *metrics[4].Delta)
+	// в Histogram и Summary - состояния после каждого обновления
+	require.NotNil(t, metrics[5].Histogram)
+	assert.Equal(t, uint64(1), metrics[5].Histogram.Count)
+	require.NotNil(t, metrics[6].Histogram)
+	assert.Equal(t, []uint64{0, 2, 0}, metrics[6].Histogram.Counts)
+	require.NotNil(t, metrics[7].Summary)
+	assert.Equal(t, uint64(2), metrics[7].Summary.Count)
+
+	v, _ := s.GetGaugeValue(ctx, "Alloc")
+	assert.Equal(t, float64(7), v)
+	c, _ := s.GetCounterValue(ctx, "PollCount")
+	assert.Equal(t, int64(15), c)
+	h, _ := s.GetHistogram(ctx, "Latency")
+	assert.Equal(t, uint64(2), h.Count)
+	sm, _ := s.GetSummary(ctx, "Duration")
+	assert.Equal(t, uint64(2), sm.Count)
+}
+
+func testBatchUpdateAtomicity(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	_, err := s.UpdateHistogram(ctx, "Latency", []float64{1, 5}, []float64{2})
+	require.NoError(t, err)
+	_, err = s.UpdateCounter(ctx, "PollCount", 10)
+	require.NoError(t, err)
+
+	assertUnchanged := func(t *testing.T) {
+		t.Helper()
+		_, ok := s.GetGaugeValue(ctx, "Alloc")
+		assert.False(t, ok, "gauge of a failed batch must not be stored")
+		c, _ := s.GetCounterValue(ctx, "PollCount")
+		assert.Equal(t, int64(10), c, "counter of a failed batch must not be changed")
+		h, _ := s.GetHistogram(ctx, "Latency")
+		assert.Equal(t, uint64(1), h.Count)
+		_, ok = s.GetHistogram(ctx, "Fresh")
+		assert.False(t, ok)
+	}
+
+	t.Run("Layout mismatch at the end", func(t *testing.T) {
+		err := s.BatchUpdate(ctx, []models.Metrics{
+			{ID: "Alloc", MType: "gauge", Value: float64Ptr(1)},
+			{ID: "PollCount", MType: "counter", Delta: int64Ptr(5)},
+			{ID: "Latency", MType: "histogram", Observations: []float64{3}},
+			{ID: "Fresh", MType: "histogram", Buckets: []float64{1}, Observations: []float64{3}},
+			{ID: "Latency", MType: "histogram", Buckets: []float64{1, 10}, Observations: []float64{3}},
+		})
+		assert.ErrorIs(t, err, models.ErrLayoutMismatch)
+		assertUnchanged(t)
+	})
+
+	t.Run("Layout mismatch within the batch", func(t *testing.T) {
+		err := s.BatchUpdate(ctx, []models.Metrics{
+			{ID: "PollCount", MType: "counter", Delta: int64Ptr(5)},
+			{ID: "Fresh", MType: "histogram", Buckets: []float64{1}, Observations: []float64{3}},
+			{ID: "Fresh", MType: "histogram", Buckets: []float64{2}, Observations: []float64{3}},
+		})
+		assert.ErrorIs(t, err, models.ErrLayoutMismatch)
+		assertUnchanged(t)
+	})
+
+	t.Run("Unsupported type", func(t *testing.T) {
+		err := s.BatchUpdate(ctx, []models.Metrics{
+			{ID: "Alloc", MType: "gauge", Value: float64Ptr(1)},
+			{ID: "PollCount", MType: "counter", Delta: int64Ptr(5)},
+			{ID: "Other", MType: "unknown", Value: float64Ptr(1)},
+		})
+		assert.Error(t, err)
+		assertUnchanged(t)
+	})
+
+	t.Run("Missing value", func(t *testing.T) {
+		err := s.BatchUpdate(ctx, []models.Metrics{
+			{ID: "PollCount", MType: "counter", Delta: int64Ptr(5)},
+			{ID: "Alloc", MType: "gauge"},
+		})
+		assert.Error(t, err)
+		assertUnchanged(t)
+	})
+}
+
+func testGetRange(t *testing.T, s storage.Storage) {
+	r := capability[storage.Ranger](t, s)
+	ctx := context.Background()
+
+	from := time.Now().Add(-time.Minute)
+	for i := 1; i <= 3; i++ {
+		_, err := s.UpdateGauge(ctx, "HeapInuse", float64(i))
+		require.NoError(t, err)
+		_, err = s.UpdateCounter(ctx, "PollCount", 1)
+		require.NoError(t, err)
+	}
+	to := time.Now().Add(time.Minute)
+
+	samples, err := r.GetRange(ctx, "HeapInuse", "gauge", from, to, 0)
+	require.NoError(t, err)
+	require.Len(t, samples, 3)
+	for i, sample := range samples {
+		assert.Equal(t, float64(i+1), sample.Value)
+	}
+
+	samples, err = r.GetRange(ctx, "PollCount", "counter", from, to, 0)
+	require.NoError(t, err)
+	require.Len(t, samples, 3)
+	assert.Equal(t, float64(3), samples[2].Value)
+
+	samples, err = r.GetRange(ctx, "HeapInuse", "gauge", from, to, time.Hour)
+	require.NoError(t, err)
+	require.Len(t, samples, 1)
+	assert.Equal(t, float64(3), samples[0].Value)
+
+	samples, err = r.GetRange(ctx, "HeapInuse", "gauge", to, to.Add(time.Minute), 0)
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+
+	samples, err = r.GetRange(ctx, "Unknown", "gauge", from, to, 0)
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+}
+
+func testDelete(t *testing.T, s storage.Storage) {
+	d := capability[storage.Deleter](t, s)
+	r := capability[storage.Ranger](t, s)
+	ctx := context.Background()
+	_, err := s.UpdateGauge(ctx, "Alloc", 1)
+	require.NoError(t, err)
+	_, err = s.UpdateCounter(ctx, "Alloc", 1)
+	require.NoError(t, err)
+
+	ok, err := d.Delete(ctx, "gauge", "Alloc")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	_, ok = s.GetGaugeValue(ctx, "Alloc")
+	assert.False(t, ok)
+	_, ok = s.GetCounterValue(ctx, "Alloc")
+	assert.True(t, ok, "series of other types must be kept")
+
+	ok, err = d.Delete(ctx, "gauge", "Alloc")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// новая серия с тем же именем начинается без прежней истории
+	_, err = s.UpdateGauge(ctx, "Alloc", 2)
+	require.NoError(t, err)
+	samples, err := r.GetRange(ctx, "Alloc", "gauge", time.Now().Add(-time.Minute), time.Now().Add(time.Minute), 0)
+	require.NoError(t, err)
+	require.Len(t, samples, 1)
+	assert.Equal(t, float64(2), samples[0].Value)
+
+	_, err = d.Delete(ctx, "unknown", "Alloc")
+	assert.Error(t, err)
+}
+
+func testDeleteByPrefix(t *testing.T, s storage.Storage) {
+	d := capability[storage.Deleter](t, s)
+	ctx := context.Background()
+	for _, name := range []string{"HeapAlloc", "HeapInuse", "Alloc"} {
+		_, err := s.UpdateGauge(ctx, name, 1)
+		require.NoError(t, err)
+	}
+	_, err := s.UpdateGauge(ctx, models.SeriesKey("HeapSys", map[string]string{"host": "agent-1"}), 1)
+	require.NoError(t, err)
+	_, err = s.UpdateCounter(ctx, "HeapCount", 1)
+	require.NoError(t, err)
+
+	deleted, err := d.DeleteByPrefix(ctx, "gauge", "Heap")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []storage.SeriesID{
+		{Type: "gauge", ID: "HeapAlloc"},
+		{Type: "gauge", ID: "HeapInuse"},
+		{Type: "gauge", ID: models.SeriesKey("HeapSys", map[string]string{"host": "agent-1"})},
+	}, deleted)
+	_, ok := s.GetCounterValue(ctx, "HeapCount")
+	assert.True(t, ok)
+
+	deleted, err = d.DeleteByPrefix(ctx, "", "")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []storage.SeriesID{
+		{Type: "gauge", ID: "Alloc"},
+		{Type: "counter", ID: "HeapCount"},
+	}, deleted)
+	gauges, err := s.GetAllGauges(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, gauges)
+}
+
+func testDeleteExpired(t *testing.T, s storage.Storage) {
+	d := capability[storage.Deleter](t, s)
+	ctx := context.Background()
+	_, err := s.UpdateGauge(ctx, "Alloc", 1)
+	require.NoError(t, err)
+	_, err = s.UpdateGauge(ctx, "HeapAlloc", 1)
+	require.NoError(t, err)
+	_, err = s.UpdateCounter(ctx, "PollCount", 1)
+	require.NoError(t, err)
+
+	ttl := storage.TTLRules{
+		{TTL: time.Hour},
+		{Prefix: "Heap", TTL: 2 * time.Hour},
+		{Prefix: "PollCount"},
+	}.TTL
+
+	deleted, err := d.DeleteExpired(ctx, time.Now(), ttl)
+	require.NoError(t, err)
+	assert.Empty(t, deleted)
+
+	deleted, err = d.DeleteExpired(ctx, time.Now().Add(90*time.Minute), ttl)
+	require.NoError(t, err)
+	assert.Equal(t, []storage.SeriesID{{Type: "gauge", ID: "Alloc"}}, deleted)
+	_, ok := s.GetGaugeValue(ctx, "Alloc")
+	assert.False(t, ok)
+	_, ok = s.GetGaugeValue(ctx, "HeapAlloc")
+	assert.True(t, ok)
+
+	deleted, err = d.DeleteExpired(ctx, time.Now().Add(24*time.Hour), ttl)
+	require.NoError(t, err)
+	assert.Equal(t, []storage.SeriesID{{Type: "gauge", ID: "HeapAlloc"}}, deleted)
+	_, ok = s.GetCounterValue(ctx, "PollCount")
+	assert.True(t, ok, "series with zero ttl must be kept")
+}
+
+func testCompact(t *testing.T, s storage.Storage) {
+	c := capability[storage.Compactor](t, s)
+	d := capability[storage.Deleter](t, s)
+	r := capability[storage.Ranger](t, s)
+	ctx := context.Background()
+	for _, v := range []float64{1, 3} {
+		_, err := s.UpdateGauge(ctx, "Alloc", v)
+		require.NoError(t, err)
+		_, err = s.UpdateCounter(ctx, "PollCount", int64(v))
+		require.NoError(t, err)
+	}
+	start := time.Now()
+	from := storage.BucketStart(start, time.Hour).Add(-time.Hour)
+
+	policy, err := storage.ParseRetention("raw=1h,1m=24h,1h=30d")
+	require.NoError(t, err)
+
+	raw := make(map[string][]storage.Sample)
+	for _, mType := range []string{"gauge", "counter"} {
+		name := map[string]string{"gauge": "Alloc", "counter": "PollCount"}[mType]
+		raw[mType], err = r.GetRange(ctx, name, mType, from, start, 0)
+		require.NoError(t, err)
+		require.Len(t, raw[mType], 2)
+	}
+	// rolled - ожидаемая история из агрегатов исходных значений raw с разрешением resolution
+	rolled := func(mType string, resolution time.Duration) []storage.Sample {
+		var src []storage.Aggregate
+		for _, sample := range raw[mType] {
+			src = append(src, storage.SampleAggregate(sample))
+		}
+		samples := make([]storage.Sample, 0)
+		for _, a := range storage.Rollup(src, resolution) {
+			samples = append(samples, a.Sample(mType))
+		}
+		return storage.Downsample(samples, from, resolution)
+	}
+
+	now := start.Add(2 * time.Minute)
+	n, err := c.Compact(ctx, now, policy)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	samples, err := r.GetRange(ctx, "Alloc", "gauge", from, now, 0)
+	require.NoError(t, err)
+	assert.Len(t, samples, 2, "step below the first resolution reads raw samples")
+	samples, err = r.GetRange(ctx, "Alloc", "gauge", from, now, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, rolled("gauge", time.Minute), samples)
+
+	// исходные значения старше часа удаляются, агрегаты остаются
+	now = start.Add(2 * time.Hour)
+	n, err = c.Compact(ctx, now, policy)
+	require.NoError(t, err)
+	assert.Equal(t, 4, n)
+
+	samples, err = r.GetRange(ctx, "Alloc", "gauge", from, now, 0)
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+	for _, mType := range []string{"gauge", "counter"} {
+		name := map[string]string{"gauge": "Alloc", "counter": "PollCount"}[mType]
+		samples, err = r.GetRange(ctx, name, mType, from, now, time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, rolled(mType, time.Minute), samples, mType)
+		samples, err = r.GetRange(ctx, name, mType, from, now, 2*time.Hour)
+		require.NoError(t, err)
+		assert.Equal(t, storage.Downsample(rolled(mType, time.Hour), from, 2*time.Hour), samples, mType)
+	}
+
+	ok, err := d.Delete(ctx, "gauge", "Alloc")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	samples, err = r.GetRange(ctx, "Alloc", "gauge", from, now, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+
+	// уровни, убранные из политики, удаляются
+	policy, err = storage.ParseRetention("raw=1h")
+	require.NoError(t, err)
+	n, err = c.Compact(ctx, now, policy)
+	require.NoError(t, err)
+	assert.Equal(t, len(rolled("counter", time.Minute))+len(rolled("counter", time.Hour)), n)
+	samples, err = r.GetRange(ctx, "PollCount", "counter", from, now, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+}
+
+// capability - возвращает необязательную возможность T хранилища s; тест пропускается,
+// если хранилище ее не реализует.
+func capability[T any](t *testing.T, s storage.Storage) T {
+	c, ok := s.(T)
+	if !ok {
+		t.Skipf("storage does not implement %s", reflect.TypeOf((*T)(nil)).Elem())
+	}
+	return c
+}
+
+func float64Ptr(v float64) *float64 {
+	return &v
+}
+
+func int64Ptr(v int64) *int64 {
+	return &v
+}
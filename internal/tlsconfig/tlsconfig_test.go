@@ -0,0 +1,98 @@
+package tlsconfig
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Sofja96/go-metrics.git/internal/tlsconfig/tlstest"
+)
+
+func TestMutualTLS(t *testing.T) {
+	ca := tlstest.NewCA(t)
+	caFile := ca.File(t)
+	serverCert, serverKey := ca.Issue(t, "server", "localhost")
+	clientCert, clientKey := ca.Issue(t, "agent-1", "agent-1.metrics.local")
+
+	serverCfg, err := Server(serverCert, serverKey, caFile)
+	require.NoError(t, err)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, ok := Trusted(r.TLS, []string{"agent-1.metrics.local"})
+		if !ok {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = io.WriteString(w, name)
+	}))
+	srv.TLS = serverCfg
+	srv.StartTLS()
+	defer srv.Close()
+
+	t.Run("Client certificate", func(t *testing.T) {
+		clientCfg, err := Client(caFile, clientCert, clientKey)
+		require.NoError(t, err)
+
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientCfg}}
+		resp, err := client.Get(srv.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "agent-1.metrics.local", string(body))
+	})
+
+	t.Run("Untrusted client name", func(t *testing.T) {
+		otherCert, otherKey := ca.Issue(t, "agent-2")
+		clientCfg, err := Client(caFile, otherCert, otherKey)
+		require.NoError(t, err)
+
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientCfg}}
+		resp, err := client.Get(srv.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("No client certificate", func(t *testing.T) {
+		clientCfg, err := Client(caFile, "", "")
+		require.NoError(t, err)
+
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientCfg}}
+		_, err = client.Get(srv.URL)
+		assert.Error(t, err)
+	})
+
+	t.Run("Unknown server CA", func(t *testing.T) {
+		otherCA := tlstest.NewCA(t)
+		clientCfg, err := Client(otherCA.File(t), clientCert, clientKey)
+		require.NoError(t, err)
+
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientCfg}}
+		_, err = client.Get(srv.URL)
+		assert.Error(t, err)
+	})
+}
+
+func TestServer(t *testing.T) {
+	cfg, err := Server("", "", "")
+	assert.NoError(t, err)
+	assert.Nil(t, cfg)
+
+	_, err = Server("", "", "ca.pem")
+	assert.Error(t, err)
+
+	_, err = Server("missing.pem", "missing-key.pem", "")
+	assert.Error(t, err)
+}
+
+func TestParseNames(t *testing.T) {
+	assert.Equal(t, []string{"agent-1", "agent-2"}, ParseNames(" agent-1, ,agent-2 "))
+	assert.Empty(t, ParseNames(""))
+}